@@ -28,11 +28,14 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/council"
 	"github.com/sipeed/picoclaw/pkg/cron"
 	"github.com/sipeed/picoclaw/pkg/devices"
+	"github.com/sipeed/picoclaw/pkg/gateway"
 	"github.com/sipeed/picoclaw/pkg/heartbeat"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
 	"github.com/sipeed/picoclaw/pkg/migrate"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/sentinel"
@@ -40,6 +43,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/telemetry"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/tracing"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
@@ -376,6 +380,8 @@ func migrateHelp() {
 func agentCmd() {
 	message := ""
 	sessionKey := "cli:default"
+	recordPath := ""
+	replayPath := ""
 
 	args := os.Args[2:]
 	for i := 0; i < len(args); i++ {
@@ -393,22 +399,58 @@ func agentCmd() {
 				sessionKey = args[i+1]
 				i++
 			}
+		case "--record":
+			if i+1 < len(args) {
+				recordPath = args[i+1]
+				i++
+			}
+		case "--replay":
+			if i+1 < len(args) {
+				replayPath = args[i+1]
+				i++
+			}
 		}
 	}
 
+	if recordPath != "" && replayPath != "" {
+		fmt.Println("Error: --record and --replay are mutually exclusive")
+		os.Exit(1)
+	}
+
 	cfg, err := loadConfig()
 	if err != nil {
 		fmt.Printf("Error loading config: %v\n", err)
 		os.Exit(1)
 	}
 
-	provider, err := providers.CreateProvider(cfg)
+	var provider providers.LLMProvider
+	if replayPath != "" {
+		// Replay needs no credentials or network
+		provider, err = providers.NewReplayProvider(replayPath)
+	} else {
+		provider, err = providers.CreateProvider(cfg)
+	}
 	if err != nil {
 		fmt.Printf("Error creating provider: %v\n", err)
 		os.Exit(1)
 	}
+	if closer, ok := provider.(interface{ Close() }); ok {
+		defer closer.Close()
+	}
+	if recordPath != "" {
+		provider = providers.NewRecordingProvider(provider, recordPath)
+		fmt.Printf("⏺ Recording LLM calls to %s\n", recordPath)
+	}
 
 	msgBus := bus.NewMessageBus()
+	if cfg.Bus.Persistent {
+		durable, err := bus.NewDurableMessageBus(filepath.Join(cfg.WorkspacePath(), "bus"), cfg.Bus.MaxAttempts)
+		if err != nil {
+			fmt.Printf("Error opening message journal: %v\n", err)
+			os.Exit(1)
+		}
+		msgBus = durable
+	}
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider, getConfigPath())
 
 	// Print agent startup info (only for interactive mode)
@@ -546,6 +588,14 @@ func gatewayCmd() {
 	}
 
 	msgBus := bus.NewMessageBus()
+	if cfg.Bus.Persistent {
+		durable, err := bus.NewDurableMessageBus(filepath.Join(cfg.WorkspacePath(), "bus"), cfg.Bus.MaxAttempts)
+		if err != nil {
+			fmt.Printf("Error opening message journal: %v\n", err)
+			os.Exit(1)
+		}
+		msgBus = durable
+	}
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider, getConfigPath())
 
 	// Print agent startup info
@@ -569,8 +619,39 @@ func gatewayCmd() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	shutdownTracing := func(context.Context) error { return nil }
+	if cfg.Tracing.Enabled {
+		shutdown, err := tracing.Setup(ctx, cfg.Tracing, version)
+		if err != nil {
+			fmt.Printf("Error configuring tracing: %v\n", err)
+			os.Exit(1)
+		}
+		shutdownTracing = shutdown
+		fmt.Println("✓ OpenTelemetry tracing enabled")
+	}
+
 	// Setup telemetry tracker
 	tracker := telemetry.NewTracker(cfg.WorkspacePath())
+	tracker.SetCostConfig(cfg.Cost)
+	tracker.SetBudgetAlert(func(status telemetry.BudgetStatus) {
+		logger.WarnCF("telemetry", "LLM budget exceeded",
+			map[string]interface{}{
+				"daily_spent":   status.DailySpent,
+				"monthly_spent": status.MonthlySpent,
+				"policy":        status.Policy,
+			})
+		// Warn the owner on the last channel they used
+		lastChannel := state.NewManager(cfg.WorkspacePath()).GetLastChannel()
+		channel, chatID, ok := strings.Cut(lastChannel, ":")
+		if !ok || constants.IsInternalChannel(channel) {
+			return
+		}
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			Content: "⚠️ LLM budget exceeded\n" + telemetry.FormatBudgetStatus(status),
+		})
+	})
 	tracker.Start(ctx)
 	agentLoop.SetTracker(tracker)
 	agentLoop.RegisterTool(tools.NewTelemetryTool(tracker))
@@ -600,6 +681,7 @@ func gatewayCmd() {
 			councilTools.Register(tools.NewMemoryTool(cfg.WorkspacePath()))
 
 			councilInstance.SetRunner(func(ctx context.Context, model string, msgs []providers.Message) (string, error) {
+				model, _ = tracker.Admit(telemetry.FeatureCouncil, model)
 				result, err := tools.RunToolLoop(ctx, tools.ToolLoopConfig{
 					Provider:      provider,
 					Model:         model,
@@ -609,6 +691,8 @@ func gatewayCmd() {
 						"max_tokens":  2048,
 						"temperature": 0.7,
 					},
+					Tracker: tracker,
+					Feature: telemetry.FeatureCouncil,
 				}, msgs, "", "")
 				if err != nil {
 					return "", err
@@ -617,6 +701,7 @@ func gatewayCmd() {
 			})
 
 			councilTool := tools.NewCouncilTool(councilInstance)
+			councilTool.SetTracker(tracker)
 			councilTool.SetSendCallback(func(channel, chatID, content string) error {
 				msgBus.PublishOutbound(bus.OutboundMessage{
 					Channel: channel,
@@ -660,31 +745,30 @@ func gatewayCmd() {
 		os.Exit(1)
 	}
 
-	var transcriber *voice.GroqTranscriber
-	if cfg.Providers.Groq.APIKey != "" {
-		transcriber = voice.NewGroqTranscriber(cfg.Providers.Groq.APIKey)
-		logger.InfoC("voice", "Groq voice transcription enabled")
-	}
-
-	if transcriber != nil {
-		if telegramChannel, ok := channelManager.GetChannel("telegram"); ok {
-			if tc, ok := telegramChannel.(*channels.TelegramChannel); ok {
-				tc.SetTranscriber(transcriber)
-				logger.InfoC("voice", "Groq transcription attached to Telegram channel")
+	if transcriber := voice.NewTranscriber(cfg); transcriber != nil {
+		for _, name := range channelManager.GetEnabledChannels() {
+			ch, _ := channelManager.GetChannel(name)
+			if ta, ok := ch.(channels.TranscriberAware); ok {
+				ta.SetTranscriber(transcriber)
 			}
 		}
-		if discordChannel, ok := channelManager.GetChannel("discord"); ok {
-			if dc, ok := discordChannel.(*channels.DiscordChannel); ok {
-				dc.SetTranscriber(transcriber)
-				logger.InfoC("voice", "Groq transcription attached to Discord channel")
-			}
-		}
-		if slackChannel, ok := channelManager.GetChannel("slack"); ok {
-			if sc, ok := slackChannel.(*channels.SlackChannel); ok {
-				sc.SetTranscriber(transcriber)
-				logger.InfoC("voice", "Groq transcription attached to Slack channel")
+		logger.InfoCF("voice", "Voice transcription enabled", map[string]interface{}{
+			"backend":   fmt.Sprintf("%T", transcriber),
+			"available": transcriber.IsAvailable(),
+		})
+	}
+
+	if speaker := voice.NewSpeaker(cfg); speaker != nil {
+		for _, name := range channelManager.GetEnabledChannels() {
+			ch, _ := channelManager.GetChannel(name)
+			if sa, ok := ch.(channels.SpeakerAware); ok {
+				sa.SetSpeaker(speaker)
 			}
 		}
+		logger.InfoCF("voice", "Voice replies enabled", map[string]interface{}{
+			"provider": cfg.Voice.TTS.Provider,
+			"reply":    cfg.Voice.TTS.Reply,
+		})
 	}
 
 	enabledChannels := channelManager.GetEnabledChannels()
@@ -744,8 +828,61 @@ func gatewayCmd() {
 			"version": formatVersion(),
 			"uptime":  time.Since(startTime).String(),
 		}
+		if limiters := providers.GetRateLimiterStats(); len(limiters) > 0 {
+			status["llm_queue"] = limiters
+		}
+		if outbound := channelManager.GetSendStats(); len(outbound) > 0 {
+			status["outbound"] = outbound
+		}
+		if dead := msgBus.DeadLetters(); len(dead) > 0 {
+			status["dead_letters"] = len(dead)
+		}
 		json.NewEncoder(w).Encode(status)
 	})
+	metrics.OnScrape(func() {
+		inbound, outbound, events := msgBus.QueueDepths()
+		metrics.BusQueueDepth.Set(float64(inbound), "inbound")
+		metrics.BusQueueDepth.Set(float64(outbound), "outbound")
+		metrics.BusQueueDepth.Set(float64(events), "events")
+	})
+	healthMux.Handle("/metrics", metrics.Handler())
+	webPath := ""
+	if ch, ok := channelManager.GetChannel("web"); ok {
+		web := ch.(*channels.WebChannel)
+		web.Register(healthMux)
+		webPath = web.Path()
+	}
+	if cfg.Gateway.API.Enabled {
+		api, err := gateway.NewOpenAIAPI(cfg.Gateway.API, agentLoop)
+		if err != nil {
+			fmt.Printf("Error configuring API: %v\n", err)
+			os.Exit(1)
+		}
+		api.Register(healthMux)
+	}
+	if cfg.Gateway.Admin.Enabled {
+		admin, err := gateway.NewAdminAPI(cfg.Gateway.Admin, gateway.AdminServices{
+			Channels:  channelManager,
+			Sessions:  agentLoop.Sessions(),
+			Tools:     agentLoop.Tools(),
+			Cron:      cronService,
+			Telemetry: tracker,
+			Heartbeat: heartbeatService,
+			ReloadCost: func() error {
+				cost, err := cfg.ReloadCost(getConfigPath())
+				if err != nil {
+					return err
+				}
+				tracker.SetCostConfig(cost)
+				return nil
+			},
+		})
+		if err != nil {
+			fmt.Printf("Error configuring admin API: %v\n", err)
+			os.Exit(1)
+		}
+		admin.Register(healthMux)
+	}
 	healthAddr := fmt.Sprintf("%s:%d", cfg.Gateway.Host, cfg.Gateway.Port)
 	healthServer := &http.Server{Addr: healthAddr, Handler: healthMux}
 	go func() {
@@ -754,6 +891,16 @@ func gatewayCmd() {
 		}
 	}()
 	fmt.Printf("✓ Health endpoint: http://%s/health\n", healthAddr)
+	fmt.Printf("✓ Metrics: http://%s/metrics\n", healthAddr)
+	if webPath != "" {
+		fmt.Printf("✓ Web chat: http://%s%s/\n", healthAddr, webPath)
+	}
+	if cfg.Gateway.Admin.Enabled {
+		fmt.Printf("✓ Admin API: http://%s/admin/\n", healthAddr)
+	}
+	if cfg.Gateway.API.Enabled {
+		fmt.Printf("✓ OpenAI-compatible API: http://%s/v1/chat/completions\n", healthAddr)
+	}
 
 	go agentLoop.Run(ctx)
 
@@ -772,6 +919,12 @@ func gatewayCmd() {
 	agentLoop.Stop()
 	channelManager.StopAll(ctx)
 	msgBus.Close()
+	if closer, ok := provider.(interface{ Close() }); ok {
+		closer.Close()
+	}
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownTracing(flushCtx)
+	flushCancel()
 	fmt.Println("✓ Gateway stopped")
 }
 
@@ -12,6 +12,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 type ContextBuilder struct {
@@ -220,16 +221,30 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 		parts := []providers.ContentPart{
 			{Type: "text", Text: currentMessage},
 		}
-		for _, dataURI := range media {
-			if strings.HasPrefix(dataURI, "data:image/") {
-				parts = append(parts, providers.ContentPart{
-					Type: "image_url",
-					ImageURL: &providers.ImageURL{
-						URL:    dataURI,
-						Detail: "auto",
-					},
-				})
+		for _, ref := range media {
+			if !utils.IsImageRef(ref) {
+				continue
 			}
+			// Channels inline images already; paths and URLs come from
+			// callers that bypass them (CLI, webhooks).
+			dataURI := ref
+			if !strings.HasPrefix(ref, "data:image/") {
+				var err error
+				if dataURI, err = utils.ImageDataURI(ref); err != nil {
+					logger.WarnCF("agent", "Skipping unreadable image", map[string]interface{}{
+						"media": utils.Truncate(ref, 80),
+						"error": err.Error(),
+					})
+					continue
+				}
+			}
+			parts = append(parts, providers.ContentPart{
+				Type: "image_url",
+				ImageURL: &providers.ImageURL{
+					URL:    dataURI,
+					Detail: "auto",
+				},
+			})
 		}
 		userMsg.Parts = parts
 	}
@@ -239,6 +254,20 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 	return messages
 }
 
+// maxQuoteChars bounds how much of a quoted message goes into the prompt.
+const maxQuoteChars = 500
+
+// formatQuotedReply prefixes a reply with the message it quotes, so the
+// model knows what "this" or "that one" refers to when the user replies to
+// an older message.
+func formatQuotedReply(quoted, content string) string {
+	quoted = strings.TrimSpace(quoted)
+	if quoted == "" {
+		return content
+	}
+	return fmt.Sprintf("[Replying to: %q]\n%s", utils.Truncate(quoted, maxQuoteChars), content)
+}
+
 // GetSkillsInfo returns information about loaded skills.
 func (cb *ContextBuilder) GetSkillsInfo() map[string]interface{} {
 	allSkills := cb.skillsLoader.ListSkills()
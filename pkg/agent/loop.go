@@ -12,22 +12,29 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/documents"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/telemetry"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/tracing"
 	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
 type AgentLoop struct {
@@ -43,23 +50,52 @@ type AgentLoop struct {
 	tools          *tools.ToolRegistry
 	running        atomic.Bool
 	summarizing    sync.Map // Tracks which sessions are currently being summarized
+	reasoning      sync.Map // sessionKey -> reasoning behind the last answer, pending delivery
 	cfg            *config.Config // Reference to config for runtime updates
 	configPath     string         // Path to config.json for persistence
 	tracker        *telemetry.Tracker
+	voicePrefs     *voice.Preferences
 }
 
 // processOptions configures how a message is processed
 type processOptions struct {
-	SessionKey      string   // Session identifier for history/context
-	Channel         string   // Target channel for tool execution
-	ChatID          string   // Target chat ID for tool execution
-	UserMessage     string   // User message content (may include prefix)
-	Media           []string // Media data URIs (images as base64 data URIs)
-	DefaultResponse string   // Response when LLM returns empty
-	EnableSummary   bool     // Whether to trigger summarization
-	SendResponse    bool     // Whether to send response via bus
-	NoHistory       bool     // If true, don't load session history (for heartbeat)
-	Feature         string   // Telemetry feature label (chat, heartbeat, cron, summarize)
+	SessionKey      string               // Session identifier for history/context
+	Channel         string               // Target channel for tool execution
+	ChatID          string               // Target chat ID for tool execution
+	UserMessage     string               // User message content (may include prefix)
+	Media           []string             // Media data URIs (images as base64 data URIs)
+	DefaultResponse string               // Response when LLM returns empty
+	EnableSummary   bool                 // Whether to trigger summarization
+	SendResponse    bool                 // Whether to send response via bus
+	NoHistory       bool                 // If true, don't load session history (for heartbeat)
+	Feature         string               // Telemetry feature label (chat, heartbeat, cron, summarize)
+	AllowedTools    []string             // Tools the model may use; nil allows all
+	OnToolCall      func(bus.Event)      // Also receives tool progress events; may be nil
+	OnMessage       func(content string) // Receives message-tool sends to this chat; may be nil
+	Usage           *providers.UsageInfo // Accumulates the turn's token usage if set
+}
+
+// DirectRequest is a message processed outside the bus, such as one from
+// the HTTP API, whose reply goes straight back to the caller.
+type DirectRequest struct {
+	Content    string
+	Media      []string // image data URIs, paths or URLs
+	SessionKey string
+	Channel    string
+	ChatID     string
+	Tools      []string // tools the model may use; nil allows all
+
+	// OnToolCall and OnMessage, if set, are called while the turn runs with
+	// each tool progress event and each message the message tool sends to
+	// this chat, so the caller can show them before the reply is ready.
+	OnToolCall func(bus.Event)
+	OnMessage  func(content string)
+}
+
+// DirectResponse is the reply to a DirectRequest.
+type DirectResponse struct {
+	Content string
+	Usage   providers.UsageInfo // summed over the turn's LLM calls
 }
 
 // createToolRegistry creates a tool registry with common tools.
@@ -121,6 +157,9 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 	// Snippets
 	registry.Register(tools.NewSnippetTool(workspace))
 
+	// Documents ingested from attachments
+	registry.Register(tools.NewDocumentTool(documents.NewStore(workspace), workspace, restrict))
+
 	// Translator
 	registry.Register(tools.NewTranslateTool())
 
@@ -153,6 +192,10 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 		})
 		return nil
 	})
+	messageTool.SetRichSendCallback(func(msg bus.OutboundMessage) error {
+		msgBus.PublishOutbound(msg)
+		return nil
+	})
 	registry.Register(messageTool)
 
 	return registry
@@ -208,6 +251,7 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 		summarizing:    sync.Map{},
 		cfg:            cfg,
 		configPath:     configPath,
+		voicePrefs:     voice.NewPreferences(workspace),
 	}
 }
 
@@ -224,7 +268,16 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 				continue
 			}
 
-			response, media, err := al.processMessage(ctx, msg)
+			// Let the channel show progress while the agent works on a reply.
+			showTyping := !constants.IsInternalChannel(msg.Channel) &&
+				(msg.Event == nil || msg.Event.Type == bus.EventChoice)
+			if showTyping {
+				al.bus.PublishEvent(bus.Event{Type: bus.EventTypingStart, Channel: msg.Channel, ChatID: msg.ChatID})
+			}
+
+			turnCtx, span := startTurn(ctx, msg.Channel, msg.ChatID, msg.SessionKey)
+			response, media, err := al.processMessage(turnCtx, msg)
+			tracing.End(span, err)
 			if err != nil {
 				response = fmt.Sprintf("Error processing message: %v", err)
 				media = nil
@@ -240,15 +293,27 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 					}
 				}
 
+				var reasoning string
+				if r, ok := al.reasoning.LoadAndDelete(msg.SessionKey); ok {
+					reasoning = r.(string)
+				}
+
 				if !alreadySent {
 					al.bus.PublishOutbound(bus.OutboundMessage{
-						Channel: msg.Channel,
-						ChatID:  msg.ChatID,
-						Content: response,
-						Media:   media,
+						Channel:   msg.Channel,
+						ChatID:    msg.ChatID,
+						Content:   response,
+						Media:     media,
+						Reasoning: reasoning,
+						ReplyTo:   msg.MessageID,
+						Trace:     tracing.Inject(turnCtx),
 					})
 				}
 			}
+			if showTyping {
+				al.bus.PublishEvent(bus.Event{Type: bus.EventTypingStop, Channel: msg.Channel, ChatID: msg.ChatID})
+			}
+			al.bus.Ack(msg.ID)
 		}
 	}
 
@@ -263,6 +328,16 @@ func (al *AgentLoop) RegisterTool(tool tools.Tool) {
 	al.tools.Register(tool)
 }
 
+// Sessions returns the agent's conversation store.
+func (al *AgentLoop) Sessions() *session.SessionManager {
+	return al.sessions
+}
+
+// Tools returns the agent's tool registry.
+func (al *AgentLoop) Tools() *tools.ToolRegistry {
+	return al.tools
+}
+
 // SetTracker sets the telemetry tracker for recording token usage.
 func (al *AgentLoop) SetTracker(t *telemetry.Tracker) {
 	al.tracker = t
@@ -293,15 +368,50 @@ func (al *AgentLoop) ProcessDirectWithChannel(ctx context.Context, content, sess
 		SessionKey: sessionKey,
 	}
 
+	ctx, span := startTurn(ctx, channel, chatID, sessionKey)
 	response, _, err := al.processMessage(ctx, msg)
+	tracing.End(span, err)
+	al.reasoning.Delete(sessionKey)
 	return response, err
 }
 
+// ProcessRequest runs a direct request through the agent with its session
+// history, tools, memory and skills, and returns the reply.
+func (al *AgentLoop) ProcessRequest(ctx context.Context, req DirectRequest) (DirectResponse, error) {
+	ctx, span := startTurn(ctx, req.Channel, req.ChatID, req.SessionKey)
+	var usage providers.UsageInfo
+	response, _, err := al.runAgentLoop(ctx, processOptions{
+		SessionKey:      req.SessionKey,
+		Channel:         req.Channel,
+		ChatID:          req.ChatID,
+		UserMessage:     req.Content,
+		Media:           req.Media,
+		DefaultResponse: "I've completed processing but have no response to give.",
+		EnableSummary:   true,
+		SendResponse:    false,
+		Feature:         telemetry.FeatureAPI,
+		AllowedTools:    req.Tools,
+		OnToolCall:      req.OnToolCall,
+		OnMessage:       req.OnMessage,
+		Usage:           &usage,
+	})
+	tracing.End(span, err)
+	al.reasoning.Delete(req.SessionKey)
+	return DirectResponse{Content: response, Usage: usage}, err
+}
+
 // ProcessHeartbeat processes a heartbeat request without session history.
 // Each heartbeat is independent and doesn't accumulate context.
 // If the heartbeat sends a proactive message to the user, that message is
 // injected into the user's real session so follow-up conversations have context.
 func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, chatID string) (string, error) {
+	if al.tracker != nil {
+		if _, ok := al.tracker.Admit(telemetry.FeatureHeartbeat, al.model); !ok {
+			return "HEARTBEAT_OK", nil
+		}
+	}
+
+	ctx, span := startTurn(ctx, channel, chatID, "heartbeat")
 	response, _, err := al.runAgentLoop(ctx, processOptions{
 		SessionKey:      "heartbeat",
 		Channel:         channel,
@@ -313,6 +423,7 @@ func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, cha
 		NoHistory:       true, // Don't load session history for heartbeat
 		Feature:         telemetry.FeatureHeartbeat,
 	})
+	tracing.End(span, err)
 
 	// If the heartbeat sent a message to the user, inject it into the real session
 	// so follow-up conversations have context about what was said.
@@ -338,6 +449,15 @@ func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, cha
 	return response, err
 }
 
+// startTurn starts the root span of one inbound message or direct request.
+func startTurn(ctx context.Context, channel, chatID, sessionKey string) (context.Context, trace.Span) {
+	return tracing.StartRoot(ctx, "agent.message",
+		attribute.String("picoclaw.channel", channel),
+		attribute.String("picoclaw.chat_id", chatID),
+		attribute.String("picoclaw.session_key", sessionKey),
+	)
+}
+
 func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage) (string, []string, error) {
 	// Add message preview to log (show full content for error messages)
 	var logContent string
@@ -360,11 +480,34 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		return resp, nil, err
 	}
 
+	// A picked choice is answered like typed text; reactions and edits
+	// need no reply.
+	if msg.Event != nil && msg.Event.Type != bus.EventChoice {
+		logger.DebugCF("agent", "Inbound event", map[string]interface{}{
+			"channel":    msg.Channel,
+			"chat_id":    msg.ChatID,
+			"type":       string(msg.Event.Type),
+			"message_id": msg.Event.MessageID,
+			"content":    msg.Event.Content,
+		})
+		return "", nil, nil
+	}
+
 	// Handle /model command
 	if response, handled := al.handleModelCommand(msg.Content); handled {
 		return response, nil, nil
 	}
 
+	// Handle /think command
+	if response, handled := al.handleThinkCommand(msg.Content, msg.SessionKey); handled {
+		return response, nil, nil
+	}
+
+	// Handle /voice command
+	if response, handled := al.handleVoiceCommand(msg.Content, msg.Channel+":"+msg.ChatID); handled {
+		return response, nil, nil
+	}
+
 	// Detect feature: cron jobs have SenderID "cron"
 	feature := telemetry.FeatureChat
 	if msg.SenderID == "cron" {
@@ -376,7 +519,7 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		SessionKey:      msg.SessionKey,
 		Channel:         msg.Channel,
 		ChatID:          msg.ChatID,
-		UserMessage:     msg.Content,
+		UserMessage:     formatQuotedReply(msg.QuotedText, msg.Content),
 		Media:           msg.Media,
 		DefaultResponse: "I've completed processing but have no response to give.",
 		EnableSummary:   true,
@@ -478,6 +621,132 @@ func (al *AgentLoop) handleModelCommand(content string) (string, bool) {
 	return "", false
 }
 
+// handleThinkCommand handles the /think command to toggle extended reasoning for a chat.
+// "/think" shows the current state, "/think on|off" toggles it and "/think <tokens>"
+// sets the budget. Returns the response string and true if the command was handled.
+func (al *AgentLoop) handleThinkCommand(content, sessionKey string) (string, bool) {
+	trimmed := strings.TrimSpace(content)
+	if trimmed != "/think" && !strings.HasPrefix(trimmed, "/think ") {
+		return "", false
+	}
+
+	arg := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(trimmed, "/think")))
+	switch arg {
+	case "":
+		if budget := al.reasoningBudget(sessionKey); budget > 0 {
+			return fmt.Sprintf("Thinking: on (%d tokens)", budget), true
+		}
+		return "Thinking: off", true
+	case "on":
+		budget := al.cfg.Agents.Defaults.ReasoningBudget
+		if budget <= 0 {
+			budget = defaultReasoningBudget
+		}
+		al.sessions.SetReasoningBudget(sessionKey, budget)
+	case "off":
+		al.sessions.SetReasoningBudget(sessionKey, -1)
+	default:
+		var budget int
+		if _, err := fmt.Sscanf(arg, "%d", &budget); err != nil || budget <= 0 {
+			return "Usage: /think [on|off|<tokens>]", true
+		}
+		al.sessions.SetReasoningBudget(sessionKey, budget)
+	}
+	al.sessions.Save(sessionKey)
+
+	if budget := al.reasoningBudget(sessionKey); budget > 0 {
+		return fmt.Sprintf("Thinking enabled (%d tokens)", budget), true
+	}
+	return "Thinking disabled", true
+}
+
+// handleVoiceCommand handles the /voice command, which sets how this chat gets
+// voice replies: "/voice" shows the settings, "/voice auto|always|off" sets
+// the reply mode, "/voice lang <code>" and "/voice name <voice>" pick the
+// voice and "/voice reset" returns to the configured defaults.
+func (al *AgentLoop) handleVoiceCommand(content, chatKey string) (string, bool) {
+	trimmed := strings.TrimSpace(content)
+	if trimmed != "/voice" && !strings.HasPrefix(trimmed, "/voice ") {
+		return "", false
+	}
+
+	pref := al.voicePrefs.Get(chatKey)
+	args := strings.Fields(strings.TrimPrefix(trimmed, "/voice"))
+	if len(args) == 0 {
+		return describeVoicePreference(pref, al.cfg.Voice.TTS), true
+	}
+
+	switch strings.ToLower(args[0]) {
+	case voice.ReplyAuto, voice.ReplyAlways, voice.ReplyOff:
+		pref.Reply = strings.ToLower(args[0])
+	case "on":
+		pref.Reply = voice.ReplyAlways
+	case "lang", "language":
+		if len(args) < 2 {
+			return "Usage: /voice lang <language code, e.g. en>", true
+		}
+		pref.Language = strings.ToLower(args[1])
+		pref.Voice = ""
+	case "name":
+		if len(args) < 2 {
+			return "Usage: /voice name <voice>", true
+		}
+		if !voice.IsVoiceName(args[1]) {
+			return "Voice names use letters, digits, '.', '_' and '-' and start with a letter or digit.", true
+		}
+		pref.Voice = args[1]
+	case "reset":
+		pref = voice.Preference{}
+	default:
+		return "Usage: /voice [auto|always|off|lang <code>|name <voice>|reset]", true
+	}
+
+	if err := al.voicePrefs.Set(chatKey, pref); err != nil {
+		return fmt.Sprintf("Failed to save voice settings: %v", err), true
+	}
+	return describeVoicePreference(pref, al.cfg.Voice.TTS), true
+}
+
+func describeVoicePreference(pref voice.Preference, tts config.TTSConfig) string {
+	reply := pref.Reply
+	if reply == "" {
+		reply = tts.Reply
+	}
+	voiceName := pref.Voice
+	if voiceName == "" && pref.Language != "" {
+		voiceName = tts.Voices[pref.Language]
+	}
+	if voiceName == "" {
+		voiceName = tts.Voice
+	}
+
+	switch strings.ToLower(tts.Provider) {
+	case "", "none", "off":
+		reply += " (text-to-speech is disabled in the config)"
+	}
+
+	s := fmt.Sprintf("Voice replies: %s\nVoice: %s", reply, voiceName)
+	if pref.Language != "" {
+		s += fmt.Sprintf("\nLanguage: %s", pref.Language)
+	}
+	return s
+}
+
+// defaultReasoningBudget is used by "/think on" when no budget is configured.
+const defaultReasoningBudget = 4096
+
+// reasoningBudget returns the effective reasoning token budget for a session,
+// applying the per-chat /think override on top of the configured default.
+func (al *AgentLoop) reasoningBudget(sessionKey string) int {
+	switch override := al.sessions.GetReasoningBudget(sessionKey); {
+	case override < 0:
+		return 0
+	case override > 0:
+		return override
+	}
+	return al.cfg.Agents.Defaults.ReasoningBudget
+}
+
 // runAgentLoop is the core message processing logic.
 // It handles context building, LLM calls, tool execution, and response handling.
 func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (string, []string, error) {
@@ -496,6 +765,7 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 	al.updateToolContexts(opts.Channel, opts.ChatID)
 
 	// 2. Build messages (skip history for heartbeat)
+	_, buildSpan := tracing.Start(ctx, "agent.build_context")
 	var history []providers.Message
 	var summary string
 	if !opts.NoHistory {
@@ -510,12 +780,17 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		opts.Channel,
 		opts.ChatID,
 	)
+	buildSpan.SetAttributes(
+		attribute.Int("picoclaw.history_messages", len(history)),
+		attribute.Int("picoclaw.prompt_messages", len(messages)),
+	)
+	buildSpan.End()
 
 	// 3. Save user message to session
 	al.sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
 
 	// 4. Run LLM iteration loop
-	finalContent, iteration, media, err := al.runLLMIteration(ctx, messages, opts)
+	finalContent, reasoning, iteration, media, err := al.runLLMIteration(ctx, messages, opts)
 	if err != nil {
 		return "", nil, err
 	}
@@ -538,13 +813,21 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 	}
 
 	// 8. Optional: send response via bus
+	showReasoning := reasoning != "" && al.cfg.Agents.Defaults.ReasoningDisplay != "" && al.cfg.Agents.Defaults.ReasoningDisplay != "off"
 	if opts.SendResponse {
-		al.bus.PublishOutbound(bus.OutboundMessage{
+		msg := bus.OutboundMessage{
 			Channel: opts.Channel,
 			ChatID:  opts.ChatID,
 			Content: finalContent,
 			Media:   media,
-		})
+			Trace:   tracing.Inject(ctx),
+		}
+		if showReasoning {
+			msg.Reasoning = reasoning
+		}
+		al.bus.PublishOutbound(msg)
+	} else if showReasoning {
+		al.reasoning.Store(opts.SessionKey, reasoning)
 	}
 
 	// 9. Log response
@@ -560,12 +843,28 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 }
 
 // runLLMIteration executes the LLM call loop with tool handling.
-// Returns the final content, iteration count, collected media URLs, and any error.
-func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.Message, opts processOptions) (string, int, []string, error) {
+// Returns the final content, its reasoning, iteration count, collected media URLs, and any error.
+func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.Message, opts processOptions) (string, string, int, []string, error) {
 	iteration := 0
-	var finalContent string
+	var finalContent, finalReasoning string
 	var collectedMedia []string
 
+	llmOpts := map[string]interface{}{
+		"max_tokens":  8192,
+		"temperature": 0.7,
+	}
+	if budget := al.reasoningBudget(opts.SessionKey); budget > 0 {
+		llmOpts[providers.ReasoningBudgetOption] = budget
+	}
+	if opts.SessionKey != "" {
+		llmOpts[providers.SessionKeyOption] = opts.SessionKey
+	}
+
+	model := al.model
+	if al.tracker != nil {
+		model, _ = al.tracker.Admit(opts.Feature, model)
+	}
+
 	for iteration < al.maxIterations {
 		iteration++
 
@@ -576,13 +875,13 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 			})
 
 		// Build tool definitions
-		providerToolDefs := al.tools.ToProviderDefs()
+		providerToolDefs := filterToolDefs(al.tools.ToProviderDefs(), opts.AllowedTools)
 
 		// Log LLM request details
 		logger.DebugCF("agent", "LLM request",
 			map[string]interface{}{
 				"iteration":         iteration,
-				"model":             al.model,
+				"model":             model,
 				"messages_count":    len(messages),
 				"tools_count":       len(providerToolDefs),
 				"max_tokens":        8192,
@@ -601,14 +900,19 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 		}
 
 		// Call LLM
-		response, err := al.provider.Chat(ctx, messages, providerToolDefs, al.model, map[string]interface{}{
-			"max_tokens":  8192,
-			"temperature": 0.7,
-		})
+		llmCtx, llmSpan := tracing.StartLLM(ctx, model, iteration)
+		response, err := al.provider.Chat(llmCtx, messages, providerToolDefs, model, llmOpts)
+		tracing.EndLLM(llmSpan, response, err)
 
 		// Record token usage
-		if response != nil && response.Usage != nil && al.tracker != nil {
-			al.tracker.Record(opts.Feature, response.Usage.PromptTokens, response.Usage.CompletionTokens, response.Usage.TotalTokens)
+		if response != nil && al.tracker != nil {
+			al.tracker.Record(opts.Feature, providers.ProviderName(al.provider), model, response.Usage)
+		}
+		if response != nil && response.Usage != nil && opts.Usage != nil {
+			opts.Usage.PromptTokens += response.Usage.PromptTokens
+			opts.Usage.CompletionTokens += response.Usage.CompletionTokens
+			opts.Usage.TotalTokens += response.Usage.TotalTokens
+			opts.Usage.CachedTokens += response.Usage.CachedTokens
 		}
 
 		if err != nil {
@@ -632,12 +936,13 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 			default:
 				userMsg = fmt.Sprintf("Error al comunicarme con la API: %s", errMsg)
 			}
-			return userMsg, iteration, nil, fmt.Errorf("LLM call failed: %w", err)
+			return userMsg, "", iteration, nil, fmt.Errorf("LLM call failed: %w", err)
 		}
 
 		// Check if no tool calls - we're done
 		if len(response.ToolCalls) == 0 {
 			finalContent = response.Content
+			finalReasoning = response.Reasoning
 			logger.InfoCF("agent", "LLM response without tool calls (direct answer)",
 				map[string]interface{}{
 					"iteration":      iteration,
@@ -659,10 +964,12 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				"iteration": iteration,
 			})
 
-		// Build assistant message with tool calls
+		// Build assistant message with tool calls; thinking blocks are
+		// echoed back so the provider can continue its reasoning.
 		assistantMsg := providers.Message{
-			Role:    "assistant",
-			Content: response.Content,
+			Role:           "assistant",
+			Content:        response.Content,
+			ThinkingBlocks: response.ThinkingBlocks,
 		}
 		for _, tc := range response.ToolCalls {
 			argumentsJSON, _ := json.Marshal(tc.Arguments)
@@ -707,7 +1014,23 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				}
 			}
 
-			toolResult := al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+			al.publishToolProgress(opts, tc.Name, "running", argsPreview)
+			var toolResult *tools.ToolResult
+			if toolAllowed(opts.AllowedTools, tc.Name) {
+				toolResult = al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+			} else {
+				toolResult = tools.ErrorResult(fmt.Sprintf("tool %s is not permitted here", tc.Name))
+			}
+			if toolResult.IsError {
+				al.publishToolProgress(opts, tc.Name, "failed", "")
+			} else {
+				al.publishToolProgress(opts, tc.Name, "done", "")
+				if tc.Name == "message" && opts.OnMessage != nil && sentToChat(tc.Arguments, opts) {
+					if content, _ := tc.Arguments["content"].(string); content != "" {
+						opts.OnMessage(content)
+					}
+				}
+			}
 
 			// Collect media URLs from tool results
 			if len(toolResult.Media) > 0 {
@@ -720,6 +1043,7 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 					Channel: opts.Channel,
 					ChatID:  opts.ChatID,
 					Content: toolResult.ForUser,
+					Trace:   tracing.Inject(ctx),
 				})
 				logger.DebugCF("agent", "Sent tool result to user",
 					map[string]interface{}{
@@ -746,7 +1070,58 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 		}
 	}
 
-	return finalContent, iteration, collectedMedia, nil
+	return finalContent, finalReasoning, iteration, collectedMedia, nil
+}
+
+// publishToolProgress tells the channel a tool call started ("running")
+// or finished ("done" or "failed"); channels that do not show tool
+// progress never receive it.
+func (al *AgentLoop) publishToolProgress(opts processOptions, tool, status, args string) {
+	metadata := map[string]string{"status": status}
+	if args != "" {
+		metadata["args"] = args
+	}
+	ev := bus.Event{
+		Type:     bus.EventToolCall,
+		Channel:  opts.Channel,
+		ChatID:   opts.ChatID,
+		Content:  tool,
+		Metadata: metadata,
+	}
+	if opts.OnToolCall != nil {
+		opts.OnToolCall(ev)
+	}
+	if constants.IsInternalChannel(opts.Channel) {
+		return
+	}
+	al.bus.PublishEvent(ev)
+}
+
+// sentToChat reports whether message tool arguments target the turn's own
+// chat, which is where the tool sends when they name none.
+func sentToChat(args map[string]interface{}, opts processOptions) bool {
+	channel, _ := args["channel"].(string)
+	chatID, _ := args["chat_id"].(string)
+	return (channel == "" || channel == opts.Channel) && (chatID == "" || chatID == opts.ChatID)
+}
+
+// toolAllowed reports whether name is in allowed; a nil list allows all.
+func toolAllowed(allowed []string, name string) bool {
+	return allowed == nil || slices.Contains(allowed, name)
+}
+
+// filterToolDefs keeps the definitions of allowed tools.
+func filterToolDefs(defs []providers.ToolDefinition, allowed []string) []providers.ToolDefinition {
+	if allowed == nil {
+		return defs
+	}
+	kept := defs[:0]
+	for _, def := range defs {
+		if toolAllowed(allowed, def.Function.Name) {
+			kept = append(kept, def)
+		}
+	}
+	return kept
 }
 
 // updateToolContexts updates the context for tools that need channel/chatID info.
@@ -919,8 +1294,8 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 			"max_tokens":  1024,
 			"temperature": 0.3,
 		})
-		if resp != nil && resp.Usage != nil && al.tracker != nil {
-			al.tracker.Record(telemetry.FeatureSummarize, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
+		if resp != nil && al.tracker != nil {
+			al.tracker.Record(telemetry.FeatureSummarize, providers.ProviderName(al.provider), al.model, resp.Usage)
 		}
 		if err == nil {
 			finalSummary = resp.Content
@@ -957,8 +1332,8 @@ func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Messa
 		"max_tokens":  1024,
 		"temperature": 0.3,
 	})
-	if response != nil && response.Usage != nil && al.tracker != nil {
-		al.tracker.Record(telemetry.FeatureSummarize, response.Usage.PromptTokens, response.Usage.CompletionTokens, response.Usage.TotalTokens)
+	if response != nil && al.tracker != nil {
+		al.tracker.Record(telemetry.FeatureSummarize, providers.ProviderName(al.provider), al.model, response.Usage)
 	}
 	if err != nil {
 		return "", err
@@ -4,13 +4,19 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
 // mockProvider is a simple mock LLM provider for testing
@@ -527,3 +533,378 @@ func TestToolResult_UserFacingToolDoesSendMessage(t *testing.T) {
 		t.Errorf("Expected 'Command output: hello world', got: %s", response)
 	}
 }
+
+// TestHandleThinkCommand verifies /think toggles the per-session reasoning budget
+func TestHandleThinkCommand(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "agent-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         tmpDir,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				ReasoningBudget:   2048,
+			},
+		},
+	}
+
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{}, "")
+	const key = "test-session"
+
+	if got := al.reasoningBudget(key); got != 2048 {
+		t.Errorf("default budget = %d, want 2048", got)
+	}
+
+	if _, handled := al.handleThinkCommand("hello", key); handled {
+		t.Error("non-command message should not be handled")
+	}
+
+	al.handleThinkCommand("/think off", key)
+	if got := al.reasoningBudget(key); got != 0 {
+		t.Errorf("budget after /think off = %d, want 0", got)
+	}
+
+	al.handleThinkCommand("/think 10000", key)
+	if got := al.reasoningBudget(key); got != 10000 {
+		t.Errorf("budget after /think 10000 = %d, want 10000", got)
+	}
+
+	if reply, _ := al.handleThinkCommand("/think lots", key); reply != "Usage: /think [on|off|<tokens>]" {
+		t.Errorf("unexpected reply for invalid argument: %q", reply)
+	}
+}
+
+// toolFlowProvider asks for list_dir once, then answers.
+type toolFlowProvider struct {
+	calls int
+}
+
+func (m *toolFlowProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	m.calls++
+	if m.calls == 1 {
+		return &providers.LLMResponse{
+			ToolCalls: []providers.ToolCall{{
+				ID:        "call_1",
+				Name:      "list_dir",
+				Arguments: map[string]interface{}{"path": "."},
+			}},
+			FinishReason: "tool_calls",
+		}, nil
+	}
+	return &providers.LLMResponse{Content: "The workspace is ready", FinishReason: "stop"}, nil
+}
+
+func (m *toolFlowProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+// TestReplayProvider_ToolFlow records a tool-calling turn and replays it offline
+func TestReplayProvider_ToolFlow(t *testing.T) {
+	fixtures := filepath.Join(t.TempDir(), "tool_flow.jsonl")
+
+	run := func(provider providers.LLMProvider) string {
+		cfg := &config.Config{
+			Agents: config.AgentsConfig{
+				Defaults: config.AgentDefaults{
+					Workspace:         t.TempDir(),
+					Model:             "test-model",
+					MaxTokens:         4096,
+					MaxToolIterations: 10,
+				},
+			},
+		}
+		al := NewAgentLoop(cfg, bus.NewMessageBus(), provider, "")
+		response, err := al.ProcessDirect(context.Background(), "what's in the workspace?", "test-session")
+		if err != nil {
+			t.Fatalf("ProcessDirect failed: %v", err)
+		}
+		return response
+	}
+
+	recorded := run(providers.NewRecordingProvider(&toolFlowProvider{}, fixtures))
+
+	replay, err := providers.NewReplayProvider(fixtures)
+	if err != nil {
+		t.Fatalf("NewReplayProvider failed: %v", err)
+	}
+	if replayed := run(replay); replayed != recorded {
+		t.Errorf("replayed response = %q, want %q", replayed, recorded)
+	}
+}
+
+func TestHandleVoiceCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         tmpDir,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Voice: config.VoiceConfig{
+			TTS: config.TTSConfig{
+				Provider: "edge",
+				Voice:    "es-AR-TomasNeural",
+				Voices:   map[string]string{"en": "en-US-GuyNeural"},
+				Reply:    "auto",
+			},
+		},
+	}
+
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{}, "")
+	const key = "telegram:42"
+
+	if _, handled := al.handleVoiceCommand("/voiceover", key); handled {
+		t.Error("/voiceover should not be handled")
+	}
+
+	resp, _ := al.handleVoiceCommand("/voice", key)
+	if !strings.Contains(resp, "Voice replies: auto") || !strings.Contains(resp, "es-AR-TomasNeural") {
+		t.Errorf("/voice = %q", resp)
+	}
+
+	al.handleVoiceCommand("/voice always", key)
+	resp, _ = al.handleVoiceCommand("/voice lang en", key)
+	if !strings.Contains(resp, "Voice replies: always") || !strings.Contains(resp, "en-US-GuyNeural") {
+		t.Errorf("/voice lang en = %q", resp)
+	}
+	if pref := voice.NewPreferences(tmpDir).Get(key); pref.Reply != "always" || pref.Language != "en" {
+		t.Errorf("stored preference = %+v", pref)
+	}
+
+	for _, name := range []string{"/etc/passwd", "../models/x", "--help", ".hidden"} {
+		al.handleVoiceCommand("/voice name "+name, key)
+		if pref := al.voicePrefs.Get(key); pref.Voice != "" {
+			t.Errorf("/voice name %s was accepted", name)
+		}
+	}
+
+	al.handleVoiceCommand("/voice reset", key)
+	if pref := al.voicePrefs.Get(key); pref != (voice.Preference{}) {
+		t.Errorf("after reset = %+v", pref)
+	}
+}
+
+func TestRunPublishesTypingAndSkipsPassiveEvents(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	defer msgBus.Close()
+	al := NewAgentLoop(cfg, msgBus, &mockProvider{}, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go al.Run(ctx)
+	defer al.Stop()
+
+	msgBus.PublishInbound(bus.InboundMessage{
+		Channel: "telegram", SenderID: "1", ChatID: "42", SessionKey: "telegram:42",
+		Content: "👍",
+		Event:   &bus.Event{Type: bus.EventReaction, ChatID: "42", MessageID: "7", Content: "👍"},
+	})
+	msgBus.PublishInbound(bus.InboundMessage{
+		Channel: "telegram", SenderID: "1", ChatID: "42", SessionKey: "telegram:42",
+		Content: "hello",
+	})
+
+	var types []bus.EventType
+	for len(types) < 2 {
+		ev, ok := msgBus.SubscribeEvents(ctx)
+		if !ok {
+			t.Fatalf("events so far: %v", types)
+		}
+		types = append(types, ev.Type)
+	}
+	if types[0] != bus.EventTypingStart || types[1] != bus.EventTypingStop {
+		t.Errorf("events = %v, want typing start then stop", types)
+	}
+
+	out, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok || out.Content != "Mock response" {
+		t.Fatalf("outbound = %+v", out)
+	}
+	shortCtx, stop := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer stop()
+	if extra, ok := msgBus.SubscribeOutbound(shortCtx); ok {
+		t.Errorf("reaction produced a reply: %+v", extra)
+	}
+}
+
+func TestRunRepliesToQuotedMessage(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	defer msgBus.Close()
+	al := NewAgentLoop(cfg, msgBus, &mockProvider{}, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go al.Run(ctx)
+	defer al.Stop()
+
+	msgBus.PublishInbound(bus.InboundMessage{
+		Channel: "discord", SenderID: "1", ChatID: "42", SessionKey: "discord:42",
+		Content: "do that one", MessageID: "m2", ReplyToID: "m1", QuotedText: "Option B: rebuild the index",
+	})
+
+	out, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok || out.ReplyTo != "m2" {
+		t.Fatalf("outbound = %+v, want a reply to m2", out)
+	}
+	history := al.sessions.GetHistory("discord:42")
+	if len(history) == 0 || history[0].Content != "[Replying to: \"Option B: rebuild the index\"]\ndo that one" {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+// toolRecordingProvider asks for list_dir once, remembering the tools it
+// was offered and the tool result it got back.
+type toolRecordingProvider struct {
+	offered    []string
+	toolResult string
+}
+
+func (m *toolRecordingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	if m.offered == nil {
+		m.offered = []string{}
+		for _, def := range tools {
+			m.offered = append(m.offered, def.Function.Name)
+		}
+		return &providers.LLMResponse{
+			ToolCalls: []providers.ToolCall{{
+				ID:        "call_1",
+				Name:      "list_dir",
+				Arguments: map[string]interface{}{"path": "."},
+			}},
+			FinishReason: "tool_calls",
+			Usage:        &providers.UsageInfo{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110},
+		}, nil
+	}
+	m.toolResult = messages[len(messages)-1].Content
+	return &providers.LLMResponse{
+		Content:      "done",
+		FinishReason: "stop",
+		Usage:        &providers.UsageInfo{PromptTokens: 120, CompletionTokens: 5, TotalTokens: 125},
+	}, nil
+}
+
+func (m *toolRecordingProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func TestProcessRequestRestrictsTools(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := &toolRecordingProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider, "")
+
+	var progress []string
+	reply, err := al.ProcessRequest(context.Background(), DirectRequest{
+		Content:    "what's in the workspace?",
+		SessionKey: "api:ide",
+		Channel:    "api",
+		ChatID:     "api:ide",
+		Tools:      []string{"read_file"},
+		OnToolCall: func(ev bus.Event) {
+			progress = append(progress, ev.Content+":"+ev.Metadata["status"])
+		},
+	})
+	if err != nil || reply.Content != "done" {
+		t.Fatalf("ProcessRequest = %q, %v", reply.Content, err)
+	}
+	if strings.Join(progress, ",") != "list_dir:running,list_dir:failed" {
+		t.Errorf("progress = %v, want list_dir running then failed", progress)
+	}
+	if reply.Usage.PromptTokens != 220 || reply.Usage.CompletionTokens != 15 || reply.Usage.TotalTokens != 235 {
+		t.Errorf("usage = %+v, want both calls summed", reply.Usage)
+	}
+	if len(provider.offered) != 1 || provider.offered[0] != "read_file" {
+		t.Errorf("offered tools = %v, want only read_file", provider.offered)
+	}
+	if !strings.Contains(provider.toolResult, "not permitted") {
+		t.Errorf("tool result = %q, want a refusal", provider.toolResult)
+	}
+}
+
+func TestTurnIsTraced(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &toolRecordingProvider{}, "")
+	if _, err := al.ProcessRequest(context.Background(), DirectRequest{
+		Content:    "what's in the workspace?",
+		SessionKey: "api:ide",
+		Channel:    "api",
+		ChatID:     "api:ide",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	var root sdktrace.ReadOnlySpan
+	counts := map[string]int{}
+	for _, s := range spans {
+		counts[s.Name()]++
+		if s.Name() == "agent.message" {
+			root = s
+		}
+	}
+	if root == nil || root.Parent().IsValid() {
+		t.Fatalf("no root agent.message span in %v", counts)
+	}
+	if counts["agent.build_context"] != 1 || counts["llm.chat"] != 2 || counts["tool.execute"] != 1 {
+		t.Errorf("spans = %v", counts)
+	}
+	for _, s := range spans {
+		if s.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("%s is in another trace", s.Name())
+		}
+		if s.Name() == "tool.execute" && s.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("tool.execute parent = %v, want the root span", s.Parent().SpanID())
+		}
+	}
+}
@@ -2,31 +2,141 @@ package bus
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
+// Outbound retry policy: a failed send is retried after 2s, 4s, 8s...
+// (capped at retryMaxDelay) until DefaultMaxAttempts, then dead-lettered.
+// Unacknowledged inbound messages are replayed on restart up to the same
+// limit.
+const (
+	DefaultMaxAttempts = 5
+	retryBaseDelay     = 2 * time.Second
+	retryMaxDelay      = 5 * time.Minute
+)
+
 type MessageBus struct {
 	inbound  chan InboundMessage
 	outbound chan OutboundMessage
+	events   chan Event
 	handlers map[string]MessageHandler
 	mu       sync.RWMutex
+
+	journal     *journal
+	durable     bool
+	maxAttempts int
+	done        chan struct{}
+	closeOnce   sync.Once
 }
 
 func NewMessageBus() *MessageBus {
 	return &MessageBus{
-		inbound:  make(chan InboundMessage, 100),
-		outbound: make(chan OutboundMessage, 100),
-		handlers: make(map[string]MessageHandler),
+		inbound:     make(chan InboundMessage, 100),
+		outbound:    make(chan OutboundMessage, 100),
+		events:      make(chan Event, 100),
+		handlers:    make(map[string]MessageHandler),
+		journal:     newMemoryJournal(),
+		maxAttempts: DefaultMaxAttempts,
+		done:        make(chan struct{}),
+	}
+}
+
+// NewDurableMessageBus returns a bus that journals every message under dir
+// until it is acknowledged, and replays unacknowledged messages from a
+// previous run. maxAttempts <= 0 uses DefaultMaxAttempts.
+func NewDurableMessageBus(dir string, maxAttempts int) (*MessageBus, error) {
+	j, err := openJournal(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	mb := NewMessageBus()
+	mb.journal = j
+	mb.durable = true
+	if maxAttempts > 0 {
+		mb.maxAttempts = maxAttempts
+	}
+
+	pending := j.pendingRecords()
+	if len(pending) > 0 {
+		logger.InfoCF("bus", "Replaying unacknowledged messages", map[string]interface{}{
+			"count": len(pending),
+		})
+		go mb.replay(pending)
+	}
+	return mb, nil
+}
+
+// replay queues messages left over from the previous run, in publish order.
+// An inbound message still pending was delivered without being acknowledged,
+// so each replay counts as a failed attempt; one that keeps failing (say it
+// crashes the agent) is dropped after maxAttempts instead of looping forever.
+func (mb *MessageBus) replay(pending []*journalRecord) {
+	for _, rec := range pending {
+		switch {
+		case rec.Inbound != nil:
+			attempts := rec.Attempts + 1
+			if attempts >= mb.maxAttempts {
+				reason := fmt.Sprintf("not acknowledged after %d deliveries", attempts)
+				mb.journal.append(journalRecord{Op: opDead, ID: rec.ID, Attempts: attempts, Error: reason})
+				logger.ErrorCF("bus", "Inbound message dropped", map[string]interface{}{
+					"channel":   rec.Inbound.Channel,
+					"sender_id": rec.Inbound.SenderID,
+					"attempts":  attempts,
+					"error":     reason,
+				})
+				continue
+			}
+			mb.journal.append(journalRecord{Op: opRetry, ID: rec.ID, Attempts: attempts})
+			select {
+			case mb.inbound <- *rec.Inbound:
+			case <-mb.done:
+				return
+			}
+		case rec.Outbound != nil:
+			select {
+			case mb.outbound <- *rec.Outbound:
+			case <-mb.done:
+				return
+			}
+		}
 	}
 }
 
 func (mb *MessageBus) PublishInbound(msg InboundMessage) {
+	if msg.ID == "" {
+		msg.ID = uuid.New().String()
+	}
+	if err := mb.journal.append(journalRecord{Op: opInbound, ID: msg.ID, Inbound: &msg}); err != nil {
+		logger.ErrorCF("bus", "Failed to journal inbound message", map[string]interface{}{"error": err.Error()})
+	}
+
 	select {
 	case mb.inbound <- msg:
+	case <-mb.done:
 	case <-time.After(10 * time.Second):
+		if mb.durable {
+			// Journaled already, so keep waiting in the background rather
+			// than dropping it.
+			logger.WarnCF("bus", "Inbound queue full, delivering in background", map[string]interface{}{
+				"channel":   msg.Channel,
+				"sender_id": msg.SenderID,
+			})
+			go func() {
+				select {
+				case mb.inbound <- msg:
+				case <-mb.done:
+				}
+			}()
+			return
+		}
+		mb.journal.append(journalRecord{Op: opAck, ID: msg.ID})
 		logger.ErrorCF("bus", "PublishInbound timed out, message dropped", map[string]interface{}{
 			"channel":   msg.Channel,
 			"sender_id": msg.SenderID,
@@ -34,19 +144,51 @@ func (mb *MessageBus) PublishInbound(msg InboundMessage) {
 	}
 }
 
+// QueueDepths returns how many messages and events are waiting to be consumed.
+func (mb *MessageBus) QueueDepths() (inbound, outbound, events int) {
+	return len(mb.inbound), len(mb.outbound), len(mb.events)
+}
+
 func (mb *MessageBus) ConsumeInbound(ctx context.Context) (InboundMessage, bool) {
 	select {
 	case msg := <-mb.inbound:
 		return msg, true
 	case <-ctx.Done():
 		return InboundMessage{}, false
+	case <-mb.done:
+		return InboundMessage{}, false
 	}
 }
 
 func (mb *MessageBus) PublishOutbound(msg OutboundMessage) {
+	if msg.ID == "" {
+		msg.ID = uuid.New().String()
+	}
+	if err := mb.journal.append(journalRecord{Op: opOutbound, ID: msg.ID, Outbound: &msg}); err != nil {
+		logger.ErrorCF("bus", "Failed to journal outbound message", map[string]interface{}{"error": err.Error()})
+	}
+	mb.enqueueOutbound(msg)
+}
+
+func (mb *MessageBus) enqueueOutbound(msg OutboundMessage) {
 	select {
 	case mb.outbound <- msg:
+	case <-mb.done:
 	case <-time.After(10 * time.Second):
+		if mb.durable {
+			logger.WarnCF("bus", "Outbound queue full, delivering in background", map[string]interface{}{
+				"channel": msg.Channel,
+				"chat_id": msg.ChatID,
+			})
+			go func() {
+				select {
+				case mb.outbound <- msg:
+				case <-mb.done:
+				}
+			}()
+			return
+		}
+		mb.journal.append(journalRecord{Op: opAck, ID: msg.ID})
 		logger.ErrorCF("bus", "PublishOutbound timed out, message dropped", map[string]interface{}{
 			"channel": msg.Channel,
 			"chat_id": msg.ChatID,
@@ -60,9 +202,135 @@ func (mb *MessageBus) SubscribeOutbound(ctx context.Context) (OutboundMessage, b
 		return msg, true
 	case <-ctx.Done():
 		return OutboundMessage{}, false
+	case <-mb.done:
+		return OutboundMessage{}, false
+	}
+}
+
+// PublishEvent queues an outbound event such as a typing indicator. Events
+// are ephemeral: when nobody keeps up they are dropped rather than blocking
+// the publisher.
+func (mb *MessageBus) PublishEvent(ev Event) {
+	select {
+	case mb.events <- ev:
+	case <-mb.done:
+	default:
+		logger.DebugCF("bus", "Event queue full, event dropped", map[string]interface{}{
+			"channel": ev.Channel,
+			"type":    string(ev.Type),
+		})
 	}
 }
 
+func (mb *MessageBus) SubscribeEvents(ctx context.Context) (Event, bool) {
+	select {
+	case ev := <-mb.events:
+		return ev, true
+	case <-ctx.Done():
+		return Event{}, false
+	case <-mb.done:
+		return Event{}, false
+	}
+}
+
+// Ack marks a consumed message as handled: an inbound message once the
+// agent has processed it, an outbound one once Channel.Send succeeded.
+func (mb *MessageBus) Ack(id string) {
+	if id == "" {
+		return
+	}
+	if err := mb.journal.append(journalRecord{Op: opAck, ID: id}); err != nil {
+		logger.WarnCF("bus", "Failed to journal ack", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// Nack reports a failed send. The message is queued again after an
+// exponential backoff, or dead-lettered once it has used up its attempts.
+// It reports whether a retry was scheduled.
+func (mb *MessageBus) Nack(msg OutboundMessage, sendErr error) bool {
+	attempts := mb.journal.attempts(msg.ID) + 1
+	if attempts >= mb.maxAttempts {
+		mb.DeadLetter(msg, attempts, sendErr)
+		return false
+	}
+
+	mb.journal.append(journalRecord{Op: opRetry, ID: msg.ID, Attempts: attempts, Error: sendErr.Error()})
+	delay := RetryDelay(attempts)
+	logger.WarnCF("bus", "Outbound send failed, will retry", map[string]interface{}{
+		"channel":  msg.Channel,
+		"chat_id":  msg.ChatID,
+		"attempt":  attempts,
+		"retry_in": delay.String(),
+		"error":    sendErr.Error(),
+	})
+
+	time.AfterFunc(delay, func() {
+		select {
+		case <-mb.done:
+		default:
+			mb.enqueueOutbound(msg)
+		}
+	})
+	return true
+}
+
+// Defer queues msg again after a short delay without counting a failed
+// attempt, for a message its channel had no room for yet.
+func (mb *MessageBus) Defer(msg OutboundMessage) {
+	time.AfterFunc(retryBaseDelay, func() {
+		select {
+		case <-mb.done:
+		default:
+			mb.enqueueOutbound(msg)
+		}
+	})
+}
+
+// Attempts returns how many sends of a pending outbound message have failed.
+func (mb *MessageBus) Attempts(id string) int {
+	return mb.journal.attempts(id)
+}
+
+// DeadLetter gives up on an outbound message and records it for inspection
+// and manual requeueing.
+func (mb *MessageBus) DeadLetter(msg OutboundMessage, attempts int, reason error) {
+	if msg.ID == "" {
+		msg.ID = uuid.New().String()
+		mb.journal.append(journalRecord{Op: opOutbound, ID: msg.ID, Outbound: &msg})
+	}
+	mb.journal.append(journalRecord{Op: opDead, ID: msg.ID, Attempts: attempts, Error: reason.Error()})
+	logger.ErrorCF("bus", "Outbound message dead-lettered", map[string]interface{}{
+		"channel":  msg.Channel,
+		"chat_id":  msg.ChatID,
+		"attempts": attempts,
+		"error":    reason.Error(),
+	})
+}
+
+// DeadLetters returns undeliverable outbound messages, oldest first.
+func (mb *MessageBus) DeadLetters() []DeadLetter {
+	return mb.journal.deadLetters()
+}
+
+// Requeue publishes a dead-lettered message again with a fresh retry budget.
+func (mb *MessageBus) Requeue(id string) error {
+	msg, ok := mb.journal.deadLetter(id)
+	if !ok {
+		return fmt.Errorf("no dead letter with id %q", id)
+	}
+	mb.PublishOutbound(msg)
+	return nil
+}
+
+// RetryDelay is the backoff before retry number attempt (1-based).
+func RetryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMaxDelay)
+}
+
 func (mb *MessageBus) RegisterHandler(channel string, handler MessageHandler) {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
@@ -78,6 +346,8 @@ func (mb *MessageBus) GetHandler(channel string) (MessageHandler, bool) {
 
 // Drain discards remaining messages from both channels before closing.
 // Call this during graceful shutdown to unblock any goroutines waiting to send.
+// On a durable bus the discarded messages stay in the journal and are
+// replayed on the next start.
 func (mb *MessageBus) Drain() {
 	for {
 		select {
@@ -96,8 +366,15 @@ drainOutbound:
 	}
 }
 
+// Close stops delivery and closes the journal. The message channels stay
+// open so late publishers and pending retries never send on a closed
+// channel; consumers return false once the bus is closed.
 func (mb *MessageBus) Close() {
-	mb.Drain()
-	close(mb.inbound)
-	close(mb.outbound)
+	mb.closeOnce.Do(func() {
+		close(mb.done)
+		mb.Drain()
+		if err := mb.journal.close(); err != nil {
+			logger.WarnCF("bus", "Failed to close journal", map[string]interface{}{"error": err.Error()})
+		}
+	})
 }
@@ -0,0 +1,189 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDurableBusReplaysUnacked(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mb, err := NewDurableMessageBus(dir, 0)
+	if err != nil {
+		t.Fatalf("NewDurableMessageBus: %v", err)
+	}
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", Content: "handled"})
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", Content: "in flight"})
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "1", Content: "reply"})
+
+	first, _ := mb.ConsumeInbound(ctx)
+	if first.ID == "" {
+		t.Fatal("published message has no ID")
+	}
+	mb.Ack(first.ID)
+	mb.Close()
+
+	mb, err = NewDurableMessageBus(dir, 0)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer mb.Close()
+
+	in, ok := mb.ConsumeInbound(ctx)
+	if !ok || in.Content != "in flight" {
+		t.Errorf("replayed inbound = %+v, want the unacked message", in)
+	}
+	out, ok := mb.SubscribeOutbound(ctx)
+	if !ok || out.Content != "reply" {
+		t.Errorf("replayed outbound = %+v", out)
+	}
+	select {
+	case extra := <-mb.inbound:
+		t.Errorf("acked message replayed: %+v", extra)
+	default:
+	}
+}
+
+func TestReplayDropsInboundAfterMaxAttempts(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mb, err := NewDurableMessageBus(dir, 2)
+	if err != nil {
+		t.Fatalf("NewDurableMessageBus: %v", err)
+	}
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", Content: "poison"})
+	mb.Close()
+
+	// First restart: the unacked message is replayed once more.
+	mb, err = NewDurableMessageBus(dir, 2)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	in, ok := mb.ConsumeInbound(ctx)
+	if !ok || in.Content != "poison" {
+		t.Fatalf("replayed inbound = %+v", in)
+	}
+	if got := mb.journal.attempts(in.ID); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+	mb.Close()
+
+	// Second restart: it has used up its attempts and is dropped.
+	mb, err = NewDurableMessageBus(dir, 2)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer mb.Close()
+	select {
+	case m := <-mb.inbound:
+		t.Fatalf("message replayed after max attempts: %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if recs := mb.journal.pendingRecords(); len(recs) != 0 {
+		t.Errorf("pending after drop = %+v", recs)
+	}
+}
+
+func TestNackDeadLettersAfterMaxAttempts(t *testing.T) {
+	dir := t.TempDir()
+	mb, err := NewDurableMessageBus(dir, 1)
+	if err != nil {
+		t.Fatalf("NewDurableMessageBus: %v", err)
+	}
+
+	mb.PublishOutbound(OutboundMessage{Channel: "discord", ChatID: "9", Content: "hi"})
+	msg, _ := mb.SubscribeOutbound(context.Background())
+	mb.Nack(msg, errors.New("forbidden"))
+
+	dead := mb.DeadLetters()
+	if len(dead) != 1 || dead[0].Message.ID != msg.ID || dead[0].Error != "forbidden" {
+		t.Fatalf("dead letters = %+v", dead)
+	}
+	mb.Close()
+
+	// Dead letters survive a restart and are not replayed.
+	mb, err = NewDurableMessageBus(dir, 1)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer mb.Close()
+	if dead := mb.DeadLetters(); len(dead) != 1 {
+		t.Fatalf("dead letters after restart = %+v", dead)
+	}
+	select {
+	case m := <-mb.outbound:
+		t.Fatalf("dead letter replayed: %+v", m)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := mb.Requeue(msg.ID); err != nil {
+		t.Fatalf("Requeue: %v", err)
+	}
+	requeued, _ := mb.SubscribeOutbound(context.Background())
+	if requeued.ID != msg.ID || len(mb.DeadLetters()) != 0 {
+		t.Errorf("requeued = %+v, dead = %+v", requeued, mb.DeadLetters())
+	}
+	if err := mb.Requeue("missing"); err == nil {
+		t.Error("Requeue of unknown id should fail")
+	}
+}
+
+func TestNackRetries(t *testing.T) {
+	mb := NewMessageBus()
+	defer mb.Close()
+
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", ChatID: "C1", Content: "x"})
+	msg, _ := mb.SubscribeOutbound(context.Background())
+	mb.Nack(msg, errors.New("timeout"))
+
+	if got := mb.journal.attempts(msg.ID); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+	if len(mb.DeadLetters()) != 0 {
+		t.Error("first failure should not dead-letter")
+	}
+}
+
+func TestDeferDoesNotCountAttempt(t *testing.T) {
+	mb := NewMessageBus()
+	defer mb.Close()
+
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", ChatID: "C1", Content: "x"})
+	msg, _ := mb.SubscribeOutbound(context.Background())
+	mb.Defer(msg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	again, ok := mb.SubscribeOutbound(ctx)
+	if !ok || again.ID != msg.ID {
+		t.Fatalf("deferred message = %+v, want it queued again", again)
+	}
+	if got := mb.Attempts(msg.ID); got != 0 {
+		t.Errorf("attempts = %d, want 0", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	cases := map[int]time.Duration{1: 2 * time.Second, 2: 4 * time.Second, 4: 16 * time.Second, 20: retryMaxDelay}
+	for attempt, want := range cases {
+		if got := RetryDelay(attempt); got != want {
+			t.Errorf("RetryDelay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestClosedBusStopsConsumers(t *testing.T) {
+	mb := NewMessageBus()
+	mb.Close()
+	if _, ok := mb.ConsumeInbound(context.Background()); ok {
+		t.Error("ConsumeInbound on closed bus should return false")
+	}
+	// Publishing after close must not panic.
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "1"})
+}
@@ -0,0 +1,27 @@
+package bus
+
+// EventType identifies an interaction other than a plain message.
+type EventType string
+
+const (
+	EventTypingStart EventType = "typing_start" // the agent started working on a reply
+	EventTypingStop  EventType = "typing_stop"  // the agent finished, with or without a reply
+	EventEdit        EventType = "edit"         // a message's text changed
+	EventDelete      EventType = "delete"       // a message was removed
+	EventReaction    EventType = "reaction"     // an emoji reaction on a message
+	EventChoice      EventType = "choice"       // a button or choice was picked
+	EventToolCall    EventType = "tool_call"    // the agent runs a tool (Content is its name)
+)
+
+// Event is a typed interaction on a chat. Outbound events (agent to
+// channel) go through PublishEvent and are best-effort: they are not
+// journaled or retried. Inbound events (user to agent) ride on an
+// InboundMessage so they are acknowledged like any other message.
+type Event struct {
+	Type      EventType         `json:"type"`
+	Channel   string            `json:"channel"`
+	ChatID    string            `json:"chat_id"`
+	MessageID string            `json:"message_id,omitempty"` // the message edited, deleted or reacted to
+	Content   string            `json:"content,omitempty"`    // new text, reaction emoji or choice value
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
@@ -0,0 +1,266 @@
+package bus
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Journal record operations.
+const (
+	opInbound  = "in"
+	opOutbound = "out"
+	opAck      = "ack"
+	opRetry    = "retry"
+	opDead     = "dead"
+)
+
+// maxDeadLetters bounds the dead-letter list kept across compactions.
+const maxDeadLetters = 500
+
+// compactEvery is how many appended records trigger a compaction.
+const compactEvery = 2000
+
+type journalRecord struct {
+	Op       string           `json:"op"`
+	ID       string           `json:"id"`
+	Inbound  *InboundMessage  `json:"inbound,omitempty"`
+	Outbound *OutboundMessage `json:"outbound,omitempty"`
+	Attempts int              `json:"attempts,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Time     time.Time        `json:"time"`
+}
+
+// DeadLetter is an outbound message that could not be delivered.
+type DeadLetter struct {
+	Message  OutboundMessage `json:"message"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Time     time.Time       `json:"time"`
+}
+
+// journal tracks messages from publish until they are acknowledged or
+// dead-lettered. With a path it persists them in an append-only JSON-lines
+// file, written before the message is queued, so a restart replays whatever
+// was in flight. Writes are not fsynced: a crashed process loses nothing, a
+// crashed host may lose the last few records.
+type journal struct {
+	path     string
+	mu       sync.Mutex
+	f        *os.File
+	seq      int
+	order    map[string]int // id -> publish sequence, for replay order
+	pending  map[string]*journalRecord
+	dead     []DeadLetter
+	appended int
+}
+
+func newMemoryJournal() *journal {
+	return &journal{
+		order:   make(map[string]int),
+		pending: make(map[string]*journalRecord),
+	}
+}
+
+func openJournal(dir string) (*journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating bus directory: %w", err)
+	}
+	j := &journal{
+		path:    filepath.Join(dir, "journal.jsonl"),
+		order:   make(map[string]int),
+		pending: make(map[string]*journalRecord),
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if err := j.compactLocked(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *journal) load() error {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("opening bus journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A torn last line from a crash; everything before it is intact.
+			continue
+		}
+		j.apply(&rec)
+	}
+	return scanner.Err()
+}
+
+// apply folds one record into the in-memory state.
+func (j *journal) apply(rec *journalRecord) {
+	switch rec.Op {
+	case opInbound, opOutbound:
+		j.dropDead(rec.ID)
+		j.seq++
+		j.order[rec.ID] = j.seq
+		j.pending[rec.ID] = rec
+	case opRetry:
+		if p, ok := j.pending[rec.ID]; ok {
+			p.Attempts = rec.Attempts
+		}
+	case opAck:
+		delete(j.pending, rec.ID)
+		delete(j.order, rec.ID)
+	case opDead:
+		if p, ok := j.pending[rec.ID]; ok && p.Outbound != nil {
+			j.dead = append(j.dead, DeadLetter{Message: *p.Outbound, Attempts: rec.Attempts, Error: rec.Error, Time: rec.Time})
+			if len(j.dead) > maxDeadLetters {
+				j.dead = j.dead[len(j.dead)-maxDeadLetters:]
+			}
+		}
+		delete(j.pending, rec.ID)
+		delete(j.order, rec.ID)
+	}
+}
+
+func (j *journal) append(rec journalRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	rec.Time = time.Now()
+	if j.path == "" {
+		j.apply(&rec)
+		return nil
+	}
+	if j.f == nil {
+		return fmt.Errorf("bus journal closed")
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := j.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing bus journal: %w", err)
+	}
+	j.apply(&rec)
+
+	j.appended++
+	if j.appended >= compactEvery {
+		return j.compactLocked()
+	}
+	return nil
+}
+
+// compactLocked rewrites the journal with only pending messages and dead
+// letters, then reopens it for appending.
+func (j *journal) compactLocked() error {
+	tmp := j.path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("compacting bus journal: %w", err)
+	}
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+
+	for _, d := range j.dead {
+		msg := d.Message
+		enc.Encode(journalRecord{Op: opOutbound, ID: msg.ID, Outbound: &msg, Time: d.Time})
+		enc.Encode(journalRecord{Op: opDead, ID: msg.ID, Attempts: d.Attempts, Error: d.Error, Time: d.Time})
+	}
+	for _, rec := range j.pendingLocked() {
+		enc.Encode(rec)
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("compacting bus journal: %w", err)
+	}
+	out.Close()
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("compacting bus journal: %w", err)
+	}
+
+	if j.f != nil {
+		j.f.Close()
+	}
+	j.f, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0644)
+	j.appended = 0
+	return err
+}
+
+// pendingLocked returns unacknowledged records in publish order.
+func (j *journal) pendingLocked() []*journalRecord {
+	recs := make([]*journalRecord, 0, len(j.pending))
+	for _, rec := range j.pending {
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(a, b int) bool { return j.order[recs[a].ID] < j.order[recs[b].ID] })
+	return recs
+}
+
+func (j *journal) pendingRecords() []*journalRecord {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.pendingLocked()
+}
+
+// attempts returns how many sends of a pending message have failed.
+func (j *journal) attempts(id string) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if rec, ok := j.pending[id]; ok {
+		return rec.Attempts
+	}
+	return 0
+}
+
+func (j *journal) deadLetters() []DeadLetter {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]DeadLetter(nil), j.dead...)
+}
+
+// deadLetter returns the dead letter with the given message id.
+func (j *journal) deadLetter(id string) (OutboundMessage, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, d := range j.dead {
+		if d.Message.ID == id {
+			return d.Message, true
+		}
+	}
+	return OutboundMessage{}, false
+}
+
+// dropDead removes a dead letter that is being published again.
+func (j *journal) dropDead(id string) {
+	for i, d := range j.dead {
+		if d.Message.ID == id {
+			j.dead = append(j.dead[:i], j.dead[i+1:]...)
+			return
+		}
+	}
+}
+
+func (j *journal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
@@ -1,6 +1,7 @@
 package bus
 
 type InboundMessage struct {
+	ID         string            `json:"id,omitempty"` // assigned on publish, used to Ack
 	Channel    string            `json:"channel"`
 	SenderID   string            `json:"sender_id"`
 	ChatID     string            `json:"chat_id"`
@@ -8,13 +9,56 @@ type InboundMessage struct {
 	Media      []string          `json:"media,omitempty"`
 	SessionKey string            `json:"session_key"`
 	Metadata   map[string]string `json:"metadata,omitempty"`
+	Event      *Event            `json:"event,omitempty"`       // set for reactions, edits and choices
+	MessageID  string            `json:"message_id,omitempty"`  // platform ID of this message
+	ReplyToID  string            `json:"reply_to_id,omitempty"` // platform ID of the message it replies to
+	QuotedText string            `json:"quoted_text,omitempty"` // text of the replied-to message
 }
 
 type OutboundMessage struct {
-	Channel string   `json:"channel"`
-	ChatID  string   `json:"chat_id"`
-	Content string   `json:"content"`
-	Media   []string `json:"media,omitempty"`
+	ID        string   `json:"id,omitempty"` // assigned on publish, used to Ack/Nack
+	Channel   string   `json:"channel"`
+	ChatID    string   `json:"chat_id"`
+	Content   string   `json:"content"`
+	Media     []string `json:"media,omitempty"`
+	Reasoning string   `json:"reasoning,omitempty"` // model reasoning behind Content, if shown
+	ReplyTo   string   `json:"reply_to,omitempty"`  // platform message ID to reply to, where supported
+	Buttons   []Button `json:"buttons,omitempty"`   // quick replies shown with the message
+	Choices   []Button `json:"choices,omitempty"`   // a list to pick one item from
+	Card      *Card    `json:"card,omitempty"`
+
+	// Trace is the W3C trace context of the turn that produced the message,
+	// so its delivery shows up in the same trace.
+	Trace map[string]string `json:"trace,omitempty"`
+}
+
+// IsRich reports whether the message has buttons, choices or a card.
+func (m OutboundMessage) IsRich() bool {
+	return len(m.Buttons) > 0 || len(m.Choices) > 0 || m.Card != nil
+}
+
+// Button is an option the user can pick. Picking it comes back as an
+// inbound EventChoice whose content is the button's payload.
+type Button struct {
+	Label string `json:"label"`
+	Value string `json:"value,omitempty"` // defaults to Label
+}
+
+// Payload is what the agent receives when the button is picked.
+func (b Button) Payload() string {
+	if b.Value != "" {
+		return b.Value
+	}
+	return b.Label
+}
+
+// Card is a simple rich card: a title, text, an optional image and an
+// optional link.
+type Card struct {
+	Title    string `json:"title,omitempty"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	URL      string `json:"url,omitempty"`
 }
 
 type MessageHandler func(InboundMessage) error
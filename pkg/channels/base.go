@@ -3,10 +3,20 @@ package channels
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"os"
+	"path"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"unicode/utf8"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/documents"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
 type Channel interface {
@@ -18,12 +28,57 @@ type Channel interface {
 	IsAllowed(senderID string) bool
 }
 
+// ReasoningRenderer is implemented by channels that can show the model's
+// reasoning collapsed next to the answer (OutboundMessage.Reasoning).
+// Channels without it receive reasoning as a separate message instead.
+type ReasoningRenderer interface {
+	RendersReasoning() bool
+}
+
+// TranscriberAware is implemented by channels that transcribe received
+// audio. BaseChannel provides it, so every channel embedding it qualifies.
+type TranscriberAware interface {
+	SetTranscriber(transcriber voice.Transcriber)
+}
+
+// SpeakerAware is implemented by channels that can answer with voice notes.
+type SpeakerAware interface {
+	SetSpeaker(speaker *voice.Speaker)
+}
+
+// EventSender is implemented by channels that can act on typed events such
+// as typing indicators, edits and reactions. SupportedEvents lists the
+// outbound event types the channel handles; others are never sent to it.
+type EventSender interface {
+	SupportedEvents() []bus.EventType
+	SendEvent(ctx context.Context, ev bus.Event) error
+}
+
+// SupportsEvent reports whether channel handles outbound events of type t.
+func SupportsEvent(channel Channel, t bus.EventType) bool {
+	sender, ok := channel.(EventSender)
+	if !ok {
+		return false
+	}
+	for _, supported := range sender.SupportedEvents() {
+		if supported == t {
+			return true
+		}
+	}
+	return false
+}
+
 type BaseChannel struct {
-	config    interface{}
-	bus       *bus.MessageBus
-	running   atomic.Bool
-	name      string
-	allowList []string
+	config      interface{}
+	bus         *bus.MessageBus
+	running     atomic.Bool
+	name        string
+	allowList   []string
+	documents   *documents.Store
+	transcriber voice.Transcriber
+	speaker     *voice.Speaker
+	voiceInput  sync.Map // chatID -> true if the last inbound message was voice
+	choices     sync.Map // chatID -> []bus.Button shown as numbered text
 }
 
 func NewBaseChannel(name string, config interface{}, bus *bus.MessageBus, allowList []string) *BaseChannel {
@@ -82,11 +137,104 @@ func (c *BaseChannel) IsAllowed(senderID string) bool {
 	return false
 }
 
+// SetDocumentStore enables ingestion of document attachments: their text is
+// stored in the workspace and the agent gets the first page plus a pointer
+// to the document tool instead of a bare file path.
+func (c *BaseChannel) SetDocumentStore(store *documents.Store) {
+	c.documents = store
+}
+
+// SetSpeaker enables voice replies.
+func (c *BaseChannel) SetSpeaker(speaker *voice.Speaker) {
+	c.speaker = speaker
+}
+
+// SetTranscriber enables speech-to-text for voice and audio messages.
+func (c *BaseChannel) SetTranscriber(transcriber voice.Transcriber) {
+	c.transcriber = transcriber
+}
+
+// transcribeAudio returns the content marker for a received audio file: its
+// transcription when a transcriber is available, otherwise "[label]".
+func (c *BaseChannel) transcribeAudio(ctx context.Context, localPath, label string) string {
+	if c.transcriber == nil || !c.transcriber.IsAvailable() {
+		return fmt.Sprintf("[%s]", label)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, transcriptionTimeout)
+	defer cancel()
+
+	result, err := c.transcriber.Transcribe(ctx, localPath)
+	if err != nil {
+		logger.ErrorCF(c.name, "Voice transcription failed", map[string]interface{}{
+			"error": err.Error(),
+			"path":  localPath,
+		})
+		return fmt.Sprintf("[%s (transcription failed)]", label)
+	}
+	return fmt.Sprintf("[voice transcription: %s]", result.Text)
+}
+
+// markVoiceInput records whether the last message in a chat was a voice
+// message, which is what "auto" voice replies key off.
+func (c *BaseChannel) markVoiceInput(chatID string, wasVoice bool) {
+	if wasVoice {
+		c.voiceInput.Store(chatID, true)
+	} else {
+		c.voiceInput.Delete(chatID)
+	}
+}
+
+// voiceReply synthesizes msg as a voice note when the chat's reply mode asks
+// for it and the answer is short plain prose. It returns the audio file path,
+// which the caller sends and removes, or "" to send text instead.
+func (c *BaseChannel) voiceReply(ctx context.Context, msg bus.OutboundMessage, format voice.Format) string {
+	_, wasVoice := c.voiceInput.LoadAndDelete(msg.ChatID)
+	if c.speaker == nil {
+		return ""
+	}
+
+	key := c.name + ":" + msg.ChatID
+	if !c.speaker.ShouldSpeak(key, wasVoice) || containsCode(msg.Content) || msg.IsRich() {
+		return ""
+	}
+	text := stripMarkdown(msg.Content)
+	if text == "" || utf8.RuneCountInString(text) > c.speaker.MaxChars() {
+		return ""
+	}
+
+	path, err := c.speaker.Speak(ctx, key, text, format)
+	if err != nil {
+		logger.ErrorCF(c.name, "TTS failed, falling back to text", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return ""
+	}
+	return path
+}
+
+// expectChoices remembers options shown as numbered text so a numeric
+// reply can be turned into a choice.
+func (c *BaseChannel) expectChoices(chatID string, options []bus.Button) {
+	c.choices.Store(chatID, options)
+}
+
 func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []string, metadata map[string]string) {
 	if !c.IsAllowed(senderID) {
 		return
 	}
 
+	// A bare number answering numbered options is a choice; any other
+	// message moves the conversation on and drops them.
+	if options, ok := c.choices.LoadAndDelete(chatID); ok && len(media) == 0 {
+		if choice, ok := pickChoice(options.([]bus.Button), content); ok {
+			c.HandleEvent(senderID, bus.Event{Type: bus.EventChoice, ChatID: chatID, Content: choice.Payload()}, metadata)
+			return
+		}
+	}
+
+	content, media = c.ingestDocuments(content, media)
+
 	// Build session key: channel:chatID
 	sessionKey := fmt.Sprintf("%s:%s", c.name, chatID)
 
@@ -95,14 +243,149 @@ func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []st
 		SenderID:   senderID,
 		ChatID:     chatID,
 		Content:    content,
-		Media:      media,
+		Media:      c.inlineImages(media),
 		SessionKey: sessionKey,
 		Metadata:   metadata,
+		MessageID:  metadata["message_id"],
+		ReplyToID:  metadata["reply_to_id"],
+		QuotedText: metadata["quoted_text"],
 	}
 
+	metrics.MessagesInbound.Inc(c.name)
 	c.bus.PublishInbound(msg)
 }
 
+// HandleEvent publishes an inbound event (a reaction, edit or button press)
+// from senderID. The event's content, such as the value of a
+// picked choice, doubles as the message content.
+func (c *BaseChannel) HandleEvent(senderID string, ev bus.Event, metadata map[string]string) {
+	if !c.IsAllowed(senderID) {
+		return
+	}
+
+	ev.Channel = c.name
+	c.bus.PublishInbound(bus.InboundMessage{
+		Channel:    c.name,
+		SenderID:   senderID,
+		ChatID:     ev.ChatID,
+		Content:    ev.Content,
+		SessionKey: fmt.Sprintf("%s:%s", c.name, ev.ChatID),
+		Metadata:   metadata,
+		Event:      &ev,
+	})
+}
+
+// ingestDocuments ingests document paths and URLs in media, appending a
+// note per document to content and removing them from media.
+func (c *BaseChannel) ingestDocuments(content string, media []string) (string, []string) {
+	if c.documents == nil || len(media) == 0 {
+		return content, media
+	}
+
+	out := make([]string, 0, len(media))
+	for _, ref := range media {
+		if strings.HasPrefix(ref, "data:") {
+			out = append(out, ref)
+			continue
+		}
+
+		localPath, name := ref, utils.DownloadedFilename(ref)
+		isURL := strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")
+		if isURL {
+			if u, err := url.Parse(ref); err == nil {
+				name = path.Base(u.Path)
+			}
+		}
+		if !documents.Supported(name, "") {
+			out = append(out, ref)
+			continue
+		}
+
+		if isURL {
+			if localPath = utils.DownloadFile(ref, name, utils.DownloadOptions{LoggerPrefix: c.name}); localPath == "" {
+				out = append(out, ref)
+				continue
+			}
+			defer os.Remove(localPath)
+		}
+		content = appendContent(content, c.ingestDocument(localPath, name, ""))
+	}
+	return content, out
+}
+
+// ingestDocument stores a document and returns the note that replaces it in
+// the message: the full text when it fits on one page, otherwise page 1 and
+// how to reach the rest. Returns "" when ingestion is disabled or the type is
+// not supported, so callers can fall back to passing the file along.
+func (c *BaseChannel) ingestDocument(localPath, name, mimeType string) string {
+	if c.documents == nil || !documents.Supported(name, mimeType) {
+		return ""
+	}
+
+	doc, err := c.documents.Ingest(localPath, name, mimeType)
+	if err != nil {
+		logger.WarnCF(c.name, "Failed to ingest document", map[string]interface{}{
+			"name":  name,
+			"error": err.Error(),
+		})
+		return fmt.Sprintf("[document: %s (could not extract text: %v)]", name, err)
+	}
+
+	first, _, err := c.documents.Page(doc.ID, 1)
+	if err != nil {
+		return fmt.Sprintf("[document: %s (id %s, %d pages)]", name, doc.ID, doc.Pages)
+	}
+
+	logger.InfoCF(c.name, "Document ingested", map[string]interface{}{
+		"name":  name,
+		"id":    doc.ID,
+		"pages": doc.Pages,
+		"chars": doc.Chars,
+	})
+
+	if doc.Pages == 1 {
+		return fmt.Sprintf("[document: %s (id %s)]\n%s", name, doc.ID, first)
+	}
+	return fmt.Sprintf("[document: %s (id %s, %d pages, %d chars). Page 1 follows; use the document tool to read other pages or search it.]\n%s",
+		name, doc.ID, doc.Pages, doc.Chars, first)
+}
+
+// inlineImages replaces image paths and URLs in media with size-limited data
+// URIs. Channels delete their downloaded temp files once HandleMessage
+// returns, so images must be read before the message goes on the bus.
+// Other media (audio, documents) is passed through untouched.
+func (c *BaseChannel) inlineImages(media []string) []string {
+	if len(media) == 0 {
+		return media
+	}
+
+	out := make([]string, 0, len(media))
+	for _, ref := range media {
+		if !utils.IsImageRef(ref) {
+			out = append(out, ref)
+			continue
+		}
+
+		dataURI, err := utils.ImageDataURI(ref)
+		if err != nil {
+			logger.WarnCF(c.name, "Failed to load image, dropping it", map[string]interface{}{
+				"media": utils.Truncate(ref, 80),
+				"error": err.Error(),
+			})
+			continue
+		}
+		out = append(out, dataURI)
+	}
+	return out
+}
+
+// removeFiles deletes temporary media files once a message has been handed off.
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
+
 func (c *BaseChannel) setRunning(running bool) {
 	c.running.Store(running)
 }
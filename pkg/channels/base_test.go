@@ -1,6 +1,18 @@
 package channels
 
-import "testing"
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/documents"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
 
 func TestBaseChannelIsAllowed(t *testing.T) {
 	tests := []struct {
@@ -50,3 +62,156 @@ func TestBaseChannelIsAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestBaseChannelHandleMessageIngestsDocuments(t *testing.T) {
+	workspace := t.TempDir()
+	docPath := filepath.Join(workspace, "notes.txt")
+	if err := os.WriteFile(docPath, []byte("Meeting notes: ship on Friday."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, msgBus, nil)
+	ch.SetDocumentStore(documents.NewStore(workspace))
+
+	ch.HandleMessage("user", "chat", "see attached", []string{docPath, "/tmp/voice.ogg"}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("expected an inbound message")
+	}
+
+	if !strings.Contains(msg.Content, "[document: notes.txt (id doc_") ||
+		!strings.Contains(msg.Content, "ship on Friday") {
+		t.Errorf("content = %q, want document note with its text", msg.Content)
+	}
+	if len(msg.Media) != 1 || msg.Media[0] != "/tmp/voice.ogg" {
+		t.Errorf("media = %v, want only the non-document entry", msg.Media)
+	}
+}
+
+type stubTranscriber struct {
+	text string
+	err  error
+}
+
+func (s *stubTranscriber) Transcribe(ctx context.Context, path string) (*voice.TranscriptionResponse, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &voice.TranscriptionResponse{Text: s.text}, nil
+}
+
+func (s *stubTranscriber) IsAvailable() bool { return true }
+
+func TestBaseChannelTranscribeAudio(t *testing.T) {
+	ch := NewBaseChannel("test", nil, bus.NewMessageBus(), nil)
+	var _ TranscriberAware = ch
+
+	if got := ch.transcribeAudio(context.Background(), "a.ogg", "voice"); got != "[voice]" {
+		t.Errorf("without transcriber got %q", got)
+	}
+
+	ch.SetTranscriber(&stubTranscriber{text: "hello there"})
+	if got := ch.transcribeAudio(context.Background(), "a.ogg", "voice"); got != "[voice transcription: hello there]" {
+		t.Errorf("with transcriber got %q", got)
+	}
+
+	ch.SetTranscriber(&stubTranscriber{err: os.ErrNotExist})
+	if got := ch.transcribeAudio(context.Background(), "a.ogg", "audio: a.ogg"); got != "[audio: a.ogg (transcription failed)]" {
+		t.Errorf("failed transcription got %q", got)
+	}
+}
+
+type stubSynthesizer struct{ dir string }
+
+func (s *stubSynthesizer) Synthesize(ctx context.Context, text, voiceName string) (string, error) {
+	path := filepath.Join(s.dir, "reply.ogg")
+	return path, os.WriteFile(path, []byte(text), 0644)
+}
+
+func (s *stubSynthesizer) IsAvailable() bool { return true }
+
+func TestBaseChannelVoiceReply(t *testing.T) {
+	dir := t.TempDir()
+	ch := NewBaseChannel("test", nil, bus.NewMessageBus(), nil)
+	msg := bus.OutboundMessage{Channel: "test", ChatID: "7", Content: "**Sure**, it is sunny."}
+
+	ch.markVoiceInput("7", true)
+	if path := ch.voiceReply(context.Background(), msg, voice.FormatOpus); path != "" {
+		t.Errorf("without speaker got %q", path)
+	}
+
+	speaker := voice.NewSpeakerWith(&stubSynthesizer{dir: dir}, config.TTSConfig{Reply: voice.ReplyAuto}, voice.NewPreferences(dir))
+	ch.SetSpeaker(speaker)
+
+	if path := ch.voiceReply(context.Background(), msg, voice.FormatOpus); path != "" {
+		t.Errorf("text input in auto mode got %q", path)
+	}
+
+	ch.markVoiceInput("7", true)
+	path := ch.voiceReply(context.Background(), msg, voice.FormatOpus)
+	if data, _ := os.ReadFile(path); string(data) != "Sure, it is sunny." {
+		t.Errorf("voice reply = %q (%q), want markdown-free speech", path, data)
+	}
+
+	ch.markVoiceInput("7", true)
+	code := bus.OutboundMessage{ChatID: "7", Content: "Run `ls -la`"}
+	if path := ch.voiceReply(context.Background(), code, voice.FormatOpus); path != "" {
+		t.Errorf("answer with code got %q", path)
+	}
+}
+
+func TestBaseChannelHandleEvent(t *testing.T) {
+	mb := bus.NewMessageBus()
+	defer mb.Close()
+	ch := NewBaseChannel("telegram", nil, mb, []string{"7"})
+
+	ch.HandleEvent("8", bus.Event{Type: bus.EventChoice, ChatID: "42", Content: "yes"}, nil)
+	ch.HandleEvent("7", bus.Event{Type: bus.EventChoice, ChatID: "42", Content: "yes"}, nil)
+
+	msg, ok := mb.ConsumeInbound(context.Background())
+	if !ok || msg.SenderID != "7" {
+		t.Fatalf("inbound = %+v, want the allowed sender's event", msg)
+	}
+	if msg.Event == nil || msg.Event.Type != bus.EventChoice || msg.Event.Channel != "telegram" {
+		t.Errorf("event = %+v", msg.Event)
+	}
+	if msg.Content != "yes" || msg.SessionKey != "telegram:42" {
+		t.Errorf("content = %q, session = %q", msg.Content, msg.SessionKey)
+	}
+}
+
+func TestBaseChannelHandleMessageReplyFields(t *testing.T) {
+	mb := bus.NewMessageBus()
+	defer mb.Close()
+	ch := NewBaseChannel("telegram", nil, mb, nil)
+
+	ch.HandleMessage("7", "42", "why?", nil, map[string]string{
+		"message_id":  "11",
+		"reply_to_id": "10",
+		"quoted_text": "The build failed.",
+	})
+
+	msg, ok := mb.ConsumeInbound(context.Background())
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	if msg.MessageID != "11" || msg.ReplyToID != "10" || msg.QuotedText != "The build failed." {
+		t.Errorf("inbound = %+v", msg)
+	}
+}
+
+func TestTelegramReplyTo(t *testing.T) {
+	if p := telegramReplyTo(-100123, "55"); p == nil || p.MessageID != 55 || !p.AllowSendingWithoutReply {
+		t.Errorf("group reply = %+v", p)
+	}
+	if p := telegramReplyTo(123, "55"); p != nil {
+		t.Errorf("private chat should not thread, got %+v", p)
+	}
+	if p := telegramReplyTo(-100123, ""); p != nil {
+		t.Errorf("no trigger message, got %+v", p)
+	}
+}
@@ -4,9 +4,14 @@
 package channels
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"sync"
+	"time"
 
 	"github.com/open-dingtalk/dingtalk-stream-sdk-go/chatbot"
 	"github.com/open-dingtalk/dingtalk-stream-sdk-go/client"
@@ -16,6 +21,8 @@ import (
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
+const dingTalkAPIBase = "https://api.dingtalk.com"
+
 // DingTalkChannel implements the Channel interface for DingTalk (钉钉)
 // It uses WebSocket for receiving messages via stream mode and API for sending
 type DingTalkChannel struct {
@@ -28,6 +35,10 @@ type DingTalkChannel struct {
 	cancel       context.CancelFunc
 	// Map to store session webhooks for each chat
 	sessionWebhooks sync.Map // chatID -> sessionWebhook
+
+	tokenMu        sync.Mutex
+	accessToken    string
+	tokenExpiresAt time.Time
 }
 
 // NewDingTalkChannel creates a new DingTalk channel instance
@@ -132,6 +143,53 @@ func (c *DingTalkChannel) onChatBotMessageReceived(ctx context.Context, data *ch
 		}
 	}
 
+	// Pictures and files arrive as download codes
+	var mediaPaths []string
+	localFiles := []string{}
+	defer func() { removeFiles(localFiles) }()
+
+	addPicture := func(downloadCode string) {
+		if localPath := c.downloadMessageFile(ctx, downloadCode, "image.jpg"); localPath != "" {
+			localFiles = append(localFiles, localPath)
+			mediaPaths = append(mediaPaths, localPath)
+		}
+	}
+
+	if contentMap, ok := data.Content.(map[string]interface{}); ok {
+		switch data.Msgtype {
+		case "picture":
+			if code, _ := contentMap["downloadCode"].(string); code != "" {
+				addPicture(code)
+				content = appendContent(content, "[image]")
+			}
+		case "file":
+			code, _ := contentMap["downloadCode"].(string)
+			fileName, _ := contentMap["fileName"].(string)
+			note := fmt.Sprintf("[file: %s]", fileName)
+			if localPath := c.downloadMessageFile(ctx, code, fileName); localPath != "" {
+				localFiles = append(localFiles, localPath)
+				if doc := c.ingestDocument(localPath, fileName, ""); doc != "" {
+					note = doc
+				} else {
+					mediaPaths = append(mediaPaths, localPath)
+				}
+			}
+			content = appendContent(content, note)
+		case "richText":
+			items, _ := contentMap["richText"].([]interface{})
+			for _, raw := range items {
+				item, _ := raw.(map[string]interface{})
+				if text, _ := item["text"].(string); text != "" {
+					content += text
+				}
+				if code, _ := item["downloadCode"].(string); code != "" {
+					addPicture(code)
+					content = appendContent(content, "[image]")
+				}
+			}
+		}
+	}
+
 	if content == "" {
 		return nil, nil // Ignore empty messages
 	}
@@ -162,7 +220,7 @@ func (c *DingTalkChannel) onChatBotMessageReceived(ctx context.Context, data *ch
 	})
 
 	// Handle the message through the base channel
-	c.HandleMessage(senderID, chatID, content, nil, metadata)
+	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
 
 	// Return nil to indicate we've handled the message asynchronously
 	// The response will be sent through the message bus
@@ -191,3 +249,97 @@ func (c *DingTalkChannel) SendDirectReply(ctx context.Context, sessionWebhook, c
 
 	return nil
 }
+
+// downloadMessageFile resolves a message file's download code (pictures,
+// files) to a URL via the robot API and downloads it. Returns the local path
+// or "" on error.
+func (c *DingTalkChannel) downloadMessageFile(ctx context.Context, downloadCode, filename string) string {
+	if downloadCode == "" {
+		return ""
+	}
+
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		logger.ErrorCF("dingtalk", "Failed to get access token", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return ""
+	}
+
+	var result struct {
+		DownloadURL string `json:"downloadUrl"`
+	}
+	err = c.callAPI(ctx, "/v1.0/robot/messageFiles/download", token, map[string]string{
+		"downloadCode": downloadCode,
+		"robotCode":    c.clientID,
+	}, &result)
+	if err != nil || result.DownloadURL == "" {
+		logger.ErrorCF("dingtalk", "Failed to resolve file download URL", map[string]interface{}{
+			"error": fmt.Sprintf("%v", err),
+		})
+		return ""
+	}
+
+	return utils.DownloadFile(result.DownloadURL, filename, utils.DownloadOptions{
+		LoggerPrefix: "dingtalk",
+	})
+}
+
+// getAccessToken returns a cached app access token, refreshing it shortly
+// before it expires.
+func (c *DingTalkChannel) getAccessToken(ctx context.Context) (string, error) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+
+	if c.accessToken != "" && time.Now().Before(c.tokenExpiresAt) {
+		return c.accessToken, nil
+	}
+
+	var result struct {
+		AccessToken string `json:"accessToken"`
+		ExpireIn    int    `json:"expireIn"`
+	}
+	err := c.callAPI(ctx, "/v1.0/oauth2/accessToken", "", map[string]string{
+		"appKey":    c.clientID,
+		"appSecret": c.clientSecret,
+	}, &result)
+	if err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("empty access token in response")
+	}
+
+	c.accessToken = result.AccessToken
+	c.tokenExpiresAt = time.Now().Add(time.Duration(result.ExpireIn)*time.Second - time.Minute)
+	return c.accessToken, nil
+}
+
+func (c *DingTalkChannel) callAPI(ctx context.Context, path, token string, body interface{}, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dingTalkAPIBase+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("x-acs-dingtalk-access-token", token)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("dingtalk API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return json.Unmarshal(respBody, out)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -15,16 +17,16 @@ import (
 )
 
 const (
-	transcriptionTimeout = 30 * time.Second
+	transcriptionTimeout = 2 * time.Minute
 	sendTimeout          = 10 * time.Second
 )
 
 type DiscordChannel struct {
 	*BaseChannel
-	session     *discordgo.Session
-	config      config.DiscordConfig
-	transcriber *voice.GroqTranscriber
-	ctx         context.Context
+	session *discordgo.Session
+	config  config.DiscordConfig
+	ctx     context.Context
+	typing  sync.Map // channelID -> context.CancelFunc
 }
 
 func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordChannel, error) {
@@ -39,15 +41,10 @@ func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordC
 		BaseChannel: base,
 		session:     session,
 		config:      cfg,
-		transcriber: nil,
 		ctx:         context.Background(),
 	}, nil
 }
 
-func (c *DiscordChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
-	c.transcriber = transcriber
-}
-
 func (c *DiscordChannel) getContext() context.Context {
 	if c.ctx == nil {
 		return context.Background()
@@ -60,6 +57,9 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 
 	c.ctx = ctx
 	c.session.AddHandler(c.handleMessage)
+	c.session.AddHandler(c.handleMessageUpdate)
+	c.session.AddHandler(c.handleReactionAdd)
+	c.session.AddHandler(c.handleInteraction)
 
 	if err := c.session.Open(); err != nil {
 		return fmt.Errorf("failed to open discord session: %w", err)
@@ -97,18 +97,39 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 
 	channelID := msg.ChatID
 	if channelID == "" {
-		return fmt.Errorf("channel ID is empty")
+		return permanent(fmt.Errorf("channel ID is empty"))
+	}
+	c.stopTyping(channelID)
+
+	if msg.IsRich() {
+		send := discordRichMessage(msg)
+		discordReplyTo(send, channelID, msg.ReplyTo)
+		_, err := c.session.ChannelMessageSendComplex(channelID, send, discordgo.WithContext(ctx))
+		return err
 	}
 
 	message := msg.Content
 
+	if audioPath := c.voiceReply(ctx, msg, voice.FormatMP3); audioPath != "" {
+		err := c.sendVoice(channelID, audioPath)
+		os.Remove(audioPath)
+		if err == nil {
+			return nil
+		}
+		logger.ErrorCF("discord", "Failed to send voice reply, falling back to text", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
 	// 使用传入的 ctx 进行超时控制
 	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
 	defer cancel()
 
 	done := make(chan error, 1)
 	go func() {
-		_, err := c.session.ChannelMessageSend(channelID, message)
+		send := &discordgo.MessageSend{Content: message}
+		discordReplyTo(send, channelID, msg.ReplyTo)
+		_, err := c.session.ChannelMessageSendComplex(channelID, send)
 		done <- err
 	}()
 
@@ -123,6 +144,37 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 	}
 }
 
+// discordReplyTo makes send a reply to the triggering message, without
+// pinging its author. The reply still goes out if that message is gone.
+func discordReplyTo(send *discordgo.MessageSend, channelID, replyTo string) {
+	if replyTo == "" {
+		return
+	}
+	failIfNotExists := false
+	send.Reference = &discordgo.MessageReference{
+		MessageID:       replyTo,
+		ChannelID:       channelID,
+		FailIfNotExists: &failIfNotExists,
+	}
+	send.AllowedMentions = &discordgo.MessageAllowedMentions{
+		Parse:       []discordgo.AllowedMentionType{discordgo.AllowedMentionTypeUsers},
+		RepliedUser: false,
+	}
+}
+
+// sendVoice uploads a spoken answer as an audio attachment, which Discord
+// plays inline.
+func (c *DiscordChannel) sendVoice(channelID, audioPath string) error {
+	f, err := os.Open(audioPath)
+	if err != nil {
+		return fmt.Errorf("opening voice file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = c.session.ChannelFileSend(channelID, "reply.mp3", f)
+	return err
+}
+
 // appendContent 安全地追加内容到现有文本
 func appendContent(content, suffix string) string {
 	if content == "" {
@@ -140,12 +192,6 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		return
 	}
 
-	if err := c.session.ChannelTyping(m.ChannelID); err != nil {
-		logger.ErrorCF("discord", "Failed to send typing indicator", map[string]any{
-			"error": err.Error(),
-		})
-	}
-
 	// 检查白名单，避免为被拒绝的用户下载附件和转录
 	if !c.IsAllowed(m.Author.ID) {
 		logger.DebugCF("discord", "Message rejected by allowlist", map[string]any{
@@ -176,35 +222,17 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		}
 	}()
 
+	hasAudio := false
 	for _, attachment := range m.Attachments {
 		isAudio := utils.IsAudioFile(attachment.Filename, attachment.ContentType)
 
 		if isAudio {
+			hasAudio = true
 			localPath := c.downloadAttachment(attachment.URL, attachment.Filename)
 			if localPath != "" {
 				localFiles = append(localFiles, localPath)
 
-				transcribedText := ""
-				if c.transcriber != nil && c.transcriber.IsAvailable() {
-					ctx, cancel := context.WithTimeout(c.getContext(), transcriptionTimeout)
-					result, err := c.transcriber.Transcribe(ctx, localPath)
-					cancel() // 立即释放context资源，避免在for循环中泄漏
-
-					if err != nil {
-						logger.ErrorCF("discord", "Voice transcription failed", map[string]any{
-							"error": err.Error(),
-						})
-						transcribedText = fmt.Sprintf("[audio: %s (transcription failed)]", attachment.Filename)
-					} else {
-						transcribedText = fmt.Sprintf("[audio transcription: %s]", result.Text)
-						logger.DebugCF("discord", "Audio transcribed successfully", map[string]any{
-							"text": result.Text,
-						})
-					}
-				} else {
-					transcribedText = fmt.Sprintf("[audio: %s]", attachment.Filename)
-				}
-
+				transcribedText := c.transcribeAudio(c.getContext(), localPath, "audio: "+attachment.Filename)
 				content = appendContent(content, transcribedText)
 			} else {
 				logger.WarnCF("discord", "Failed to download audio attachment", map[string]any{
@@ -223,6 +251,7 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 	if content == "" && len(mediaPaths) == 0 {
 		return
 	}
+	c.markVoiceInput(m.ChannelID, hasAudio)
 
 	if content == "" {
 		content = "[media only]"
@@ -243,10 +272,209 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		"channel_id":   m.ChannelID,
 		"is_dm":        fmt.Sprintf("%t", m.GuildID == ""),
 	}
+	if ref := m.ReferencedMessage; ref != nil {
+		metadata["reply_to_id"] = ref.ID
+		metadata["quoted_text"] = ref.Content
+	}
 
 	c.HandleMessage(senderID, m.ChannelID, content, mediaPaths, metadata)
 }
 
+func (c *DiscordChannel) handleMessageUpdate(s *discordgo.Session, m *discordgo.MessageUpdate) {
+	// Embed unfurls also arrive as updates, without an author.
+	if m == nil || m.Author == nil || m.Author.ID == s.State.User.ID {
+		return
+	}
+	c.HandleEvent(m.Author.ID, bus.Event{
+		Type:      bus.EventEdit,
+		ChatID:    m.ChannelID,
+		MessageID: m.ID,
+		Content:   m.Content,
+	}, map[string]string{
+		"user_id":  m.Author.ID,
+		"username": m.Author.Username,
+	})
+}
+
+func (c *DiscordChannel) handleReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if r == nil || r.MessageReaction == nil || r.UserID == s.State.User.ID {
+		return
+	}
+	c.HandleEvent(r.UserID, bus.Event{
+		Type:      bus.EventReaction,
+		ChatID:    r.ChannelID,
+		MessageID: r.MessageID,
+		Content:   r.Emoji.Name,
+	}, map[string]string{
+		"user_id": r.UserID,
+	})
+}
+
+// RendersRich reports that Discord shows buttons and choices as message
+// components and cards as embeds.
+func (c *DiscordChannel) RendersRich() bool {
+	return true
+}
+
+// discordRichMessage builds a message with up to four rows of five buttons,
+// a select menu for choices (25 at most) and an embed for the card.
+func discordRichMessage(msg bus.OutboundMessage) *discordgo.MessageSend {
+	send := &discordgo.MessageSend{Content: utils.Truncate(msg.Content, 2000)}
+	if send.Content == "" && msg.Card == nil {
+		send.Content = "👇"
+	}
+
+	if card := msg.Card; card != nil {
+		embed := &discordgo.MessageEmbed{Title: card.Title, Description: card.Text, URL: card.URL}
+		if card.ImageURL != "" {
+			embed.Image = &discordgo.MessageEmbedImage{URL: card.ImageURL}
+		}
+		send.Embeds = []*discordgo.MessageEmbed{embed}
+	}
+
+	var row discordgo.ActionsRow
+	for _, b := range msg.Buttons {
+		if len(send.Components) == 4 {
+			break
+		}
+		row.Components = append(row.Components, discordgo.Button{
+			Label:    utils.Truncate(b.Label, 80),
+			Style:    discordgo.PrimaryButton,
+			CustomID: "choice:" + truncateBytes(b.Payload(), 93),
+		})
+		if len(row.Components) == 5 {
+			send.Components = append(send.Components, row)
+			row = discordgo.ActionsRow{}
+		}
+	}
+	if len(row.Components) > 0 && len(send.Components) < 4 {
+		send.Components = append(send.Components, row)
+	}
+
+	if len(msg.Choices) > 0 {
+		menu := discordgo.SelectMenu{CustomID: "choice", Placeholder: "Choose…"}
+		for i, b := range msg.Choices {
+			if i == 25 {
+				break
+			}
+			menu.Options = append(menu.Options, discordgo.SelectMenuOption{
+				Label: utils.Truncate(b.Label, 100),
+				Value: truncateBytes(b.Payload(), 100),
+			})
+		}
+		send.Components = append(send.Components, discordgo.ActionsRow{Components: []discordgo.MessageComponent{menu}})
+	}
+	return send
+}
+
+// handleInteraction turns a press on one of our buttons or a pick from our
+// select menu into a choice event, and removes the components so the
+// choice cannot be made twice.
+func (c *DiscordChannel) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i == nil || i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+	data := i.MessageComponentData()
+	var payload string
+	switch {
+	case data.CustomID == "choice" && len(data.Values) > 0:
+		payload = data.Values[0]
+	case strings.HasPrefix(data.CustomID, "choice:"):
+		payload = strings.TrimPrefix(data.CustomID, "choice:")
+	default:
+		return
+	}
+
+	user := i.User
+	if i.Member != nil && i.Member.User != nil {
+		user = i.Member.User
+	}
+	if user == nil {
+		return
+	}
+
+	response := &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredMessageUpdate}
+	if i.Message != nil {
+		response = &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Content:    i.Message.Content,
+				Embeds:     i.Message.Embeds,
+				Components: []discordgo.MessageComponent{},
+			},
+		}
+	}
+	if err := s.InteractionRespond(i.Interaction, response); err != nil {
+		logger.WarnCF("discord", "Failed to acknowledge interaction", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
+	ev := bus.Event{Type: bus.EventChoice, ChatID: i.ChannelID, Content: payload}
+	if i.Message != nil {
+		ev.MessageID = i.Message.ID
+	}
+	c.HandleEvent(user.ID, ev, map[string]string{
+		"user_id":  user.ID,
+		"username": user.Username,
+	})
+}
+
+// SupportedEvents lists the outbound events Discord handles.
+func (c *DiscordChannel) SupportedEvents() []bus.EventType {
+	return []bus.EventType{bus.EventTypingStart, bus.EventTypingStop, bus.EventEdit, bus.EventDelete, bus.EventReaction}
+}
+
+func (c *DiscordChannel) SendEvent(ctx context.Context, ev bus.Event) error {
+	switch ev.Type {
+	case bus.EventTypingStart:
+		c.startTyping(ev.ChatID)
+		return nil
+	case bus.EventTypingStop:
+		c.stopTyping(ev.ChatID)
+		return nil
+	case bus.EventEdit:
+		_, err := c.session.ChannelMessageEdit(ev.ChatID, ev.MessageID, ev.Content, discordgo.WithContext(ctx))
+		return err
+	case bus.EventDelete:
+		return c.session.ChannelMessageDelete(ev.ChatID, ev.MessageID, discordgo.WithContext(ctx))
+	case bus.EventReaction:
+		return c.session.MessageReactionAdd(ev.ChatID, ev.MessageID, ev.Content, discordgo.WithContext(ctx))
+	}
+	return nil
+}
+
+// startTyping keeps the typing indicator up (Discord clears it after ten
+// seconds) until typing stops, a reply is sent, or five minutes pass.
+func (c *DiscordChannel) startTyping(channelID string) {
+	c.stopTyping(channelID)
+	ctx, cancel := context.WithTimeout(c.getContext(), 5*time.Minute)
+	c.typing.Store(channelID, cancel)
+
+	go func() {
+		ticker := time.NewTicker(8 * time.Second)
+		defer ticker.Stop()
+		for {
+			if err := c.session.ChannelTyping(channelID, discordgo.WithContext(ctx)); err != nil && ctx.Err() == nil {
+				logger.ErrorCF("discord", "Failed to send typing indicator", map[string]any{
+					"error": err.Error(),
+				})
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *DiscordChannel) stopTyping(channelID string) {
+	if cancel, ok := c.typing.LoadAndDelete(channelID); ok {
+		cancel.(context.CancelFunc)()
+	}
+}
+
 func (c *DiscordChannel) downloadAttachment(url, filename string) string {
 	return utils.DownloadFile(url, filename, utils.DownloadOptions{
 		LoggerPrefix: "discord",
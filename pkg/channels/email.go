@@ -0,0 +1,832 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	_ "github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/documents"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// emailMaxAttachment caps the size of each attachment we save.
+	emailMaxAttachment = 25 << 20
+
+	// emailDialTimeout bounds connecting to the IMAP and SMTP servers.
+	emailDialTimeout = 30 * time.Second
+
+	// emailSendTimeout bounds a whole SMTP conversation.
+	emailSendTimeout = 2 * time.Minute
+)
+
+// EmailChannel implements the Channel interface for email: it watches an
+// IMAP mailbox with IDLE (or polling, where the server has no IDLE) and
+// replies over SMTP. Chat IDs are "sender/root Message-ID", so every email
+// thread is a session of its own; a bare address starts a new thread.
+type EmailChannel struct {
+	*BaseChannel
+	config       config.EmailConfig
+	address      string
+	pollInterval time.Duration
+	ctx          context.Context
+	cancel       context.CancelFunc
+
+	// Owned by the watch goroutine: the last UID we looked at, valid as
+	// long as the mailbox keeps its UIDVALIDITY.
+	uidValidity uint32
+	lastUID     uint32
+
+	threadsMu sync.Mutex
+	threads   map[string]*emailThread
+}
+
+// emailThread is what a reply needs to stay in its thread.
+type emailThread struct {
+	Subject    string
+	References []string
+}
+
+// NewEmailChannel creates an email channel for the configured mailbox.
+func NewEmailChannel(cfg config.EmailConfig, messageBus *bus.MessageBus) (*EmailChannel, error) {
+	if cfg.IMAPHost == "" || cfg.SMTPHost == "" || cfg.Username == "" {
+		return nil, fmt.Errorf("email imap_host, smtp_host and username are required")
+	}
+	if cfg.IMAPPort == 0 {
+		cfg.IMAPPort = 993
+	}
+	if cfg.SMTPPort == 0 {
+		cfg.SMTPPort = 587
+	}
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 60
+	}
+	address := cfg.Address
+	if address == "" {
+		address = cfg.Username
+	}
+	if _, err := mail.ParseAddress(address); err != nil {
+		return nil, fmt.Errorf("email address %q: %w", address, err)
+	}
+	if len(cfg.AllowFrom) > 0 && cfg.AuthservID == "" && !cfg.AllowUnauthenticated {
+		return nil, fmt.Errorf("email allow_from needs authserv_id to verify senders, or allow_unauthenticated to trust forgeable From headers")
+	}
+
+	// Addresses are compared lowercased.
+	allowFrom := make([]string, len(cfg.AllowFrom))
+	for i, addr := range cfg.AllowFrom {
+		allowFrom[i] = strings.ToLower(addr)
+	}
+	base := NewBaseChannel("email", cfg, messageBus, allowFrom)
+
+	return &EmailChannel{
+		BaseChannel:  base,
+		config:       cfg,
+		address:      strings.ToLower(address),
+		pollInterval: time.Duration(cfg.PollInterval) * time.Second,
+		threads:      make(map[string]*emailThread),
+	}, nil
+}
+
+// Start logs in to the IMAP server and starts watching the mailbox. Mail
+// already in it is left alone; only messages arriving from now on are
+// answered.
+func (c *EmailChannel) Start(ctx context.Context) error {
+	logger.InfoC("email", "Starting email channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	imapClient, err := c.connect()
+	if err != nil {
+		return fmt.Errorf("email imap login failed: %w", err)
+	}
+
+	go c.run(imapClient)
+
+	c.setRunning(true)
+	logger.InfoCF("email", "Email channel started", map[string]interface{}{
+		"address": c.address,
+		"mailbox": c.config.Mailbox,
+	})
+	return nil
+}
+
+func (c *EmailChannel) Stop(ctx context.Context) error {
+	logger.InfoC("email", "Stopping email channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	c.setRunning(false)
+	logger.InfoC("email", "Email channel stopped")
+	return nil
+}
+
+// connect dials the IMAP server, logs in and selects the mailbox.
+func (c *EmailChannel) connect() (*client.Client, error) {
+	addr := net.JoinHostPort(c.config.IMAPHost, strconv.Itoa(c.config.IMAPPort))
+	dialer := &net.Dialer{Timeout: emailDialTimeout}
+	tlsConfig := &tls.Config{ServerName: c.config.IMAPHost}
+
+	var imapClient *client.Client
+	var err error
+	if c.config.IMAPPort == 993 {
+		imapClient, err = client.DialWithDialerTLS(dialer, addr, tlsConfig)
+	} else {
+		imapClient, err = client.DialWithDialer(dialer, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.config.IMAPPort != 993 {
+		if ok, _ := imapClient.SupportStartTLS(); ok {
+			if err := imapClient.StartTLS(tlsConfig); err != nil {
+				imapClient.Logout()
+				return nil, fmt.Errorf("starttls: %w", err)
+			}
+		}
+	}
+	if err := imapClient.Login(c.config.Username, c.config.Password); err != nil {
+		imapClient.Logout()
+		return nil, err
+	}
+
+	status, err := imapClient.Select(c.config.Mailbox, false)
+	if err != nil {
+		imapClient.Logout()
+		return nil, fmt.Errorf("select %s: %w", c.config.Mailbox, err)
+	}
+	// UIDs only mean something within one UIDVALIDITY; when it changes
+	// (or on first login) start from whatever arrives next.
+	if status.UidValidity != c.uidValidity || c.uidValidity == 0 {
+		c.uidValidity = status.UidValidity
+		c.lastUID = 0
+		if status.UidNext > 0 {
+			c.lastUID = status.UidNext - 1
+		} else if uids, err := imapClient.UidSearch(imap.NewSearchCriteria()); err == nil && len(uids) > 0 {
+			c.lastUID = slices.Max(uids)
+		}
+	}
+	return imapClient, nil
+}
+
+// run watches the mailbox until the channel stops, reconnecting with
+// backoff when the connection drops.
+func (c *EmailChannel) run(imapClient *client.Client) {
+	backoff := time.Second
+	for {
+		if imapClient != nil {
+			started := time.Now()
+			err := c.watch(imapClient)
+			if c.ctx.Err() != nil {
+				return
+			}
+			if time.Since(started) > time.Minute {
+				backoff = time.Second
+			}
+			logger.WarnCF("email", "IMAP connection lost, reconnecting", map[string]interface{}{
+				"error":    fmt.Sprint(err),
+				"retry_in": backoff.String(),
+			})
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 5*time.Minute)
+
+		var err error
+		if imapClient, err = c.connect(); err != nil {
+			logger.WarnCF("email", "IMAP login failed", map[string]interface{}{
+				"error": err.Error(),
+			})
+			imapClient = nil
+		}
+	}
+}
+
+// watch handles new mail, then idles until the server reports a change or
+// the poll interval passes, until the connection fails or the channel stops.
+// It logs out before returning.
+func (c *EmailChannel) watch(imapClient *client.Client) error {
+	// go-imap blocks on unread updates, so drain them for as long as the
+	// connection lives and turn mailbox changes into a wake-up.
+	updates := make(chan client.Update, 16)
+	wake := make(chan struct{}, 1)
+	done := make(chan struct{})
+	defer close(done)
+	defer imapClient.Logout()
+	imapClient.Updates = updates
+	go func() {
+		for {
+			select {
+			case update := <-updates:
+				if _, ok := update.(*client.MailboxUpdate); ok {
+					select {
+					case wake <- struct{}{}:
+					default:
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		if err := c.fetchNew(imapClient); err != nil {
+			return err
+		}
+
+		stop := make(chan struct{})
+		idleDone := make(chan error, 1)
+		go func() {
+			idleDone <- imapClient.Idle(stop, &client.IdleOptions{PollInterval: c.pollInterval})
+		}()
+		timer := time.NewTimer(c.pollInterval)
+		select {
+		case <-wake:
+		case <-timer.C:
+		case <-c.ctx.Done():
+		case err := <-idleDone:
+			timer.Stop()
+			return fmt.Errorf("idle: %w", err)
+		}
+		timer.Stop()
+		close(stop)
+		if err := <-idleDone; err != nil {
+			return fmt.Errorf("idle: %w", err)
+		}
+		if c.ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// fetchNew handles messages that arrived since the last check and marks
+// the ones it passed on as seen. Mail from senders who are not allowed is
+// left unread for the mailbox owner.
+func (c *EmailChannel) fetchNew(imapClient *client.Client) error {
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(c.lastUID+1, 0)
+	uids, err := imapClient.UidSearch(criteria)
+	if err != nil {
+		return fmt.Errorf("search: %w", err)
+	}
+	// "n:*" always matches the newest message, even when it is older.
+	uids = slices.DeleteFunc(uids, func(uid uint32) bool { return uid <= c.lastUID })
+	if len(uids) == 0 {
+		return nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, len(uids))
+	if err := imapClient.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages); err != nil {
+		return fmt.Errorf("fetch: %w", err)
+	}
+
+	var fetched []*imap.Message
+	for msg := range messages {
+		fetched = append(fetched, msg)
+	}
+	slices.SortFunc(fetched, func(a, b *imap.Message) int { return int(a.Uid) - int(b.Uid) })
+
+	handled := new(imap.SeqSet)
+	for _, msg := range fetched {
+		if body := msg.GetBody(section); body != nil && c.handleEmail(body) {
+			handled.AddNum(msg.Uid)
+		}
+	}
+	c.lastUID = slices.Max(uids)
+
+	if !handled.Empty() {
+		flags := []interface{}{imap.SeenFlag}
+		if err := imapClient.UidStore(handled, imap.FormatFlagsOp(imap.AddFlags, true), flags, nil); err != nil {
+			logger.WarnCF("email", "Failed to mark messages as seen", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	return nil
+}
+
+// emailAuthenticated reports whether one of the Authentication-Results
+// header values (RFC 8601) added by authservID shows a DMARC pass for the sender's domain
+// or a DKIM pass signed by it (or a parent domain). Results under any other
+// authserv-id are ignored; the receiving server strips forged ones bearing
+// its own.
+func emailAuthenticated(results []string, authservID, sender string) bool {
+	_, domain, ok := strings.Cut(sender, "@")
+	if !ok || domain == "" {
+		return false
+	}
+
+	for _, value := range results {
+		id, resinfo, _ := strings.Cut(stripHeaderComments(value), ";")
+		if fields := strings.Fields(id); len(fields) == 0 || !strings.EqualFold(fields[0], authservID) {
+			continue
+		}
+
+		for _, result := range strings.Split(resinfo, ";") {
+			fields := strings.Fields(strings.ToLower(result))
+			if len(fields) == 0 {
+				continue
+			}
+			method, outcome, _ := strings.Cut(fields[0], "=")
+			if outcome != "pass" {
+				continue
+			}
+			props := make(map[string]string, len(fields)-1)
+			for _, f := range fields[1:] {
+				k, v, _ := strings.Cut(f, "=")
+				props[k] = strings.Trim(v, `"`)
+			}
+
+			switch method {
+			case "dmarc":
+				if props["header.from"] == domain {
+					return true
+				}
+			case "dkim":
+				d := props["header.d"]
+				if d == "" {
+					_, d, _ = strings.Cut(props["header.i"], "@")
+				}
+				if d != "" && (d == domain || strings.HasSuffix(domain, "."+d)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// stripHeaderComments removes parenthesized (possibly nested) comments from
+// a structured header value.
+func stripHeaderComments(value string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range value {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// handleEmail turns one raw message into an inbound message. It reports
+// whether the message was passed on.
+func (c *EmailChannel) handleEmail(raw io.Reader) bool {
+	mr, err := mail.CreateReader(raw)
+	if err != nil {
+		logger.WarnCF("email", "Failed to parse message", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return false
+	}
+	defer mr.Close()
+	h := mr.Header
+
+	from, _ := h.AddressList("From")
+	if len(from) == 0 {
+		return false
+	}
+	sender := strings.ToLower(from[0].Address)
+	if sender == c.address || isAutomatedEmail(h) {
+		return false
+	}
+	if !c.IsAllowed(sender) {
+		logger.DebugCF("email", "Message rejected by allowlist", map[string]interface{}{
+			"sender": sender,
+		})
+		return false
+	}
+	if c.config.AuthservID != "" && !emailAuthenticated(h.Values("Authentication-Results"), c.config.AuthservID, sender) {
+		logger.WarnCF("email", "Message rejected: sender not authenticated", map[string]interface{}{
+			"sender": sender,
+		})
+		return false
+	}
+
+	subject, _ := h.Subject()
+	messageID, _ := h.MessageID()
+	references, _ := h.MsgIDList("References")
+	inReplyTo, _ := h.MsgIDList("In-Reply-To")
+
+	// The first Message-ID of a thread names it for as long as clients
+	// keep References intact.
+	root := messageID
+	if len(references) > 0 {
+		root = references[0]
+	} else if len(inReplyTo) > 0 {
+		root = inReplyTo[0]
+	}
+	chatID := sender
+	if root != "" {
+		chatID = sender + "/" + root
+	}
+
+	var text, htmlText string
+	var labels, mediaPaths []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			logger.WarnCF("email", "Failed to read message part", map[string]interface{}{
+				"error": err.Error(),
+			})
+			break
+		}
+
+		switch ph := part.Header.(type) {
+		case *mail.InlineHeader:
+			// Inline images are mostly signature logos; only the text
+			// parts matter.
+			contentType, _, _ := ph.ContentType()
+			switch {
+			case contentType == "text/plain" && text == "":
+				body, _ := io.ReadAll(io.LimitReader(part.Body, emailMaxAttachment))
+				text = string(body)
+			case contentType == "text/html" && htmlText == "":
+				htmlText, _ = documents.HTMLText(io.LimitReader(part.Body, emailMaxAttachment))
+			}
+		case *mail.AttachmentHeader:
+			name, _ := ph.Filename()
+			if name == "" {
+				name = "attachment"
+			}
+			contentType, _, _ := ph.ContentType()
+			localPath := utils.SaveMedia(io.LimitReader(part.Body, emailMaxAttachment), name, "email")
+			if localPath == "" {
+				labels = append(labels, fmt.Sprintf("[file: %s (download failed)]", name))
+				continue
+			}
+			defer os.Remove(localPath)
+			mediaPaths = append(mediaPaths, localPath)
+
+			switch {
+			case utils.IsAudioFile(name, contentType):
+				labels = append(labels, c.transcribeAudio(c.ctx, localPath, "audio: "+name))
+			case utils.IsImageFile(name, contentType):
+				labels = append(labels, fmt.Sprintf("[image: %s]", name))
+			default:
+				labels = append(labels, fmt.Sprintf("[file: %s]", name))
+			}
+		}
+	}
+	if text == "" {
+		text = htmlText
+	}
+
+	body, quoted := stripEmailQuote(text)
+	content := strings.TrimSpace(body + "\n" + strings.Join(labels, "\n"))
+	if len(inReplyTo) == 0 && subject != "" {
+		content = strings.TrimSpace("Subject: " + subject + "\n\n" + content)
+	}
+	if content == "" {
+		return false
+	}
+
+	c.rememberThread(chatID, subject, references, inReplyTo, messageID)
+
+	metadata := map[string]string{
+		"message_id":  messageID,
+		"quoted_text": quoted,
+		"subject":     subject,
+		"platform":    "email",
+	}
+	if len(inReplyTo) > 0 {
+		metadata["reply_to_id"] = inReplyTo[0]
+	}
+
+	logger.DebugCF("email", "Received message", map[string]interface{}{
+		"sender_id": sender,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(sender, chatID, content, mediaPaths, metadata)
+	return true
+}
+
+// isAutomatedEmail reports whether a message was sent by a machine (an
+// out-of-office reply, a bounce, a mailing list), which we never answer
+// to avoid mail loops.
+func isAutomatedEmail(h mail.Header) bool {
+	if v := strings.ToLower(h.Get("Auto-Submitted")); v != "" && v != "no" {
+		return true
+	}
+	switch strings.ToLower(h.Get("Precedence")) {
+	case "bulk", "junk", "list":
+		return true
+	}
+	return false
+}
+
+// stripEmailQuote splits a reply into what the sender wrote and the
+// quoted message below it, dropping the "On ... wrote:" line and the
+// signature.
+func stripEmailQuote(text string) (reply, quoted string) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var out, quote []string
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case line == "-- " || line == "--":
+			return strings.TrimSpace(strings.Join(out, "\n")), strings.Join(quote, "\n")
+		case trimmed == "-----Original Message-----":
+			quote = append(quote, lines[i+1:]...)
+			return strings.TrimSpace(strings.Join(out, "\n")), strings.TrimSpace(strings.Join(quote, "\n"))
+		case strings.HasPrefix(trimmed, ">"):
+			quote = append(quote, strings.TrimSpace(strings.TrimLeft(trimmed, "> ")))
+		case strings.HasSuffix(trimmed, "wrote:") && nextLineIsQuote(lines[i+1:]):
+		default:
+			out = append(out, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(out, "\n")), strings.Join(quote, "\n")
+}
+
+func nextLineIsQuote(lines []string) bool {
+	for _, line := range lines {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			return strings.HasPrefix(trimmed, ">")
+		}
+	}
+	return false
+}
+
+// rememberThread records the subject and references a reply in chatID
+// has to carry.
+func (c *EmailChannel) rememberThread(chatID, subject string, references, inReplyTo []string, messageID string) {
+	refs := slices.Clone(references)
+	if len(refs) == 0 {
+		refs = slices.Clone(inReplyTo)
+	}
+	if messageID != "" {
+		refs = append(refs, messageID)
+	}
+
+	c.threadsMu.Lock()
+	defer c.threadsMu.Unlock()
+	c.threads[chatID] = &emailThread{Subject: subject, References: refs}
+}
+
+func (c *EmailChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("email channel not running")
+	}
+
+	to, root := parseEmailChatID(msg.ChatID)
+	if _, err := mail.ParseAddress(to); err != nil {
+		return permanent(fmt.Errorf("invalid email chat ID %q: %w", msg.ChatID, err))
+	}
+
+	c.threadsMu.Lock()
+	thread := c.threads[msg.ChatID]
+	c.threadsMu.Unlock()
+
+	var h mail.Header
+	h.SetDate(time.Now())
+	h.SetAddressList("From", []*mail.Address{{Address: c.address}})
+	h.SetAddressList("To", []*mail.Address{{Address: to}})
+	if err := h.GenerateMessageIDWithHostname(c.address[strings.LastIndex(c.address, "@")+1:]); err != nil {
+		return err
+	}
+	h.Set("Auto-Submitted", "auto-replied")
+
+	// Threaded replies carry the thread's subject and references; after a
+	// restart the root Message-ID in the chat ID is enough for clients.
+	var refs []string
+	subject := ""
+	if thread != nil {
+		refs = slices.Clone(thread.References)
+		subject = thread.Subject
+	} else if root != "" {
+		refs = []string{root}
+	}
+	if msg.ReplyTo != "" && !slices.Contains(refs, msg.ReplyTo) {
+		refs = append(refs, msg.ReplyTo)
+	}
+	if len(refs) > 0 {
+		inReplyTo := refs[len(refs)-1]
+		if msg.ReplyTo != "" {
+			inReplyTo = msg.ReplyTo
+		}
+		h.SetMsgIDList("In-Reply-To", []string{inReplyTo})
+		h.SetMsgIDList("References", refs)
+	}
+	h.SetSubject(emailSubject(subject, msg.Content, len(refs) > 0))
+
+	var buf bytes.Buffer
+	if err := c.writeEmail(&buf, h, msg); err != nil {
+		return err
+	}
+	if err := c.sendMail(ctx, to, buf.Bytes()); err != nil {
+		return err
+	}
+
+	logger.DebugCF("email", "Message sent", map[string]interface{}{
+		"to":      to,
+		"chat_id": msg.ChatID,
+	})
+	return nil
+}
+
+// emailSubject returns the subject of a reply: "Re: " and the thread's
+// subject, or the start of the message when there is none.
+func emailSubject(threadSubject, content string, isReply bool) string {
+	if threadSubject != "" {
+		if !isReply || strings.HasPrefix(strings.ToLower(threadSubject), "re:") {
+			return threadSubject
+		}
+		return "Re: " + threadSubject
+	}
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(stripMarkdown(content)), "\n")
+	if firstLine == "" {
+		firstLine = "Message from your assistant"
+	}
+	if isReply {
+		return "Re: " + utils.Truncate(firstLine, 60)
+	}
+	return utils.Truncate(firstLine, 60)
+}
+
+// writeEmail writes the message as plain text, with media as attachments.
+func (c *EmailChannel) writeEmail(w io.Writer, h mail.Header, msg bus.OutboundMessage) error {
+	var textHeader mail.InlineHeader
+	textHeader.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+
+	if len(msg.Media) == 0 {
+		h.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+		body, err := mail.CreateSingleInlineWriter(w, h)
+		if err != nil {
+			return err
+		}
+		io.WriteString(body, msg.Content)
+		return body.Close()
+	}
+
+	mw, err := mail.CreateWriter(w, h)
+	if err != nil {
+		return err
+	}
+	body, err := mw.CreateSingleInline(textHeader)
+	if err != nil {
+		return err
+	}
+	io.WriteString(body, msg.Content)
+	body.Close()
+
+	for _, ref := range msg.Media {
+		if err := c.attach(mw, ref); err != nil {
+			logger.ErrorCF("email", "Failed to attach media", map[string]interface{}{
+				"media": utils.Truncate(ref, 80),
+				"error": err.Error(),
+			})
+		}
+	}
+	return mw.Close()
+}
+
+func (c *EmailChannel) attach(mw *mail.Writer, ref string) error {
+	localPath := ref
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		localPath = utils.DownloadFile(ref, filepath.Base(ref), utils.DownloadOptions{LoggerPrefix: "email"})
+		if localPath == "" {
+			return fmt.Errorf("download failed")
+		}
+		defer os.Remove(localPath)
+	}
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+
+	name := utils.DownloadedFilename(localPath)
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	var ah mail.AttachmentHeader
+	ah.SetContentType(contentType, nil)
+	ah.SetFilename(name)
+	part, err := mw.CreateAttachment(ah)
+	if err != nil {
+		return err
+	}
+	part.Write(data)
+	return part.Close()
+}
+
+// sendMail delivers one message over SMTP. Port 465 speaks TLS from the
+// start; other ports upgrade with STARTTLS when the server offers it.
+func (c *EmailChannel) sendMail(ctx context.Context, to string, data []byte) error {
+	host := c.config.SMTPHost
+	addr := net.JoinHostPort(host, strconv.Itoa(c.config.SMTPPort))
+	dialer := &net.Dialer{Timeout: emailDialTimeout}
+	tlsConfig := &tls.Config{ServerName: host}
+
+	var conn net.Conn
+	var err error
+	if c.config.SMTPPort == 465 {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(emailSendTimeout))
+
+	sc, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer sc.Close()
+
+	if c.config.SMTPPort != 465 {
+		if ok, _ := sc.Extension("STARTTLS"); ok {
+			if err := sc.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("starttls: %w", err)
+			}
+		}
+	}
+	if ok, _ := sc.Extension("AUTH"); ok {
+		if err := sc.Auth(smtp.PlainAuth("", c.config.Username, c.config.Password, host)); err != nil {
+			return smtpError(err)
+		}
+	}
+	if err := sc.Mail(c.address); err != nil {
+		return smtpError(err)
+	}
+	if err := sc.Rcpt(to); err != nil {
+		return smtpError(err)
+	}
+	w, err := sc.Data()
+	if err != nil {
+		return smtpError(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return smtpError(err)
+	}
+	return sc.Quit()
+}
+
+// smtpError marks 5xx replies, such as an unknown recipient or rejected
+// credentials, as permanent; 4xx replies are worth retrying.
+func smtpError(err error) error {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+		return permanent(err)
+	}
+	return err
+}
+
+func parseEmailChatID(chatID string) (address, root string) {
+	address, root, _ = strings.Cut(chatID, "/")
+	return address, root
+}
@@ -0,0 +1,433 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// fakeSMTP accepts every message except those to nobody@, and hands the
+// DATA of each one to mails.
+type fakeSMTP struct {
+	addr  *net.TCPAddr
+	mails chan string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	f := &fakeSMTP{addr: l.Addr().(*net.TCPAddr), mails: make(chan string, 10)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		switch verb, _, _ := strings.Cut(strings.ToUpper(line), " "); verb {
+		case "EHLO":
+			tp.PrintfLine("250-fake")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			tp.PrintfLine("235 2.7.0 Authenticated")
+		case "RCPT":
+			if strings.Contains(line, "nobody@") {
+				tp.PrintfLine("550 5.1.1 No such user")
+			} else {
+				tp.PrintfLine("250 OK")
+			}
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			data, _ := tp.ReadDotBytes()
+			f.mails <- string(data)
+			tp.PrintfLine("250 Queued")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (f *fakeSMTP) next(t *testing.T) *mail.Message {
+	t.Helper()
+	select {
+	case data := <-f.mails:
+		msg, err := mail.ReadMessage(strings.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	case <-time.After(3 * time.Second):
+		t.Fatal("no mail sent")
+		return nil
+	}
+}
+
+// testMailbox is the in-memory INBOX behind the test IMAP server. The memory
+// backend is not safe for concurrent use, so the server's connections and
+// the test share mu.
+type testMailbox struct {
+	mu   *sync.Mutex
+	mbox *memory.Mailbox
+}
+
+// lockedBackend serializes the memory backend's mailbox operations.
+type lockedBackend struct {
+	backend.Backend
+	mu *sync.Mutex
+}
+
+func (b lockedBackend) Login(connInfo *imap.ConnInfo, username, password string) (backend.User, error) {
+	user, err := b.Backend.Login(connInfo, username, password)
+	if err != nil {
+		return nil, err
+	}
+	return lockedUser{user, b.mu}, nil
+}
+
+type lockedUser struct {
+	backend.User
+	mu *sync.Mutex
+}
+
+func (u lockedUser) GetMailbox(name string) (backend.Mailbox, error) {
+	mbox, err := u.User.GetMailbox(name)
+	if err != nil {
+		return nil, err
+	}
+	return lockedMailbox{mbox, u.mu}, nil
+}
+
+type lockedMailbox struct {
+	backend.Mailbox
+	mu *sync.Mutex
+}
+
+func (m lockedMailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Mailbox.Status(items)
+}
+
+func (m lockedMailbox) ListMessages(uid bool, seqset *imap.SeqSet, items []imap.FetchItem, ch chan<- *imap.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Mailbox.ListMessages(uid, seqset, items, ch)
+}
+
+func (m lockedMailbox) SearchMessages(uid bool, criteria *imap.SearchCriteria) ([]uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Mailbox.SearchMessages(uid, criteria)
+}
+
+func (m lockedMailbox) CreateMessage(flags []string, date time.Time, body imap.Literal) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Mailbox.CreateMessage(flags, date, body)
+}
+
+func (m lockedMailbox) UpdateMessagesFlags(uid bool, seqset *imap.SeqSet, op imap.FlagsOp, flags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Mailbox.UpdateMessagesFlags(uid, seqset, op, flags)
+}
+
+func (m lockedMailbox) Expunge() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Mailbox.Expunge()
+}
+
+// startTestEmail runs the channel against go-imap's in-memory server and a
+// fake SMTP server, and returns the INBOX to deliver test mail into.
+func startTestEmail(t *testing.T) (*EmailChannel, *bus.MessageBus, *testMailbox, *fakeSMTP) {
+	t.Helper()
+	mu := &sync.Mutex{}
+	be := memory.New()
+	imapServer := server.New(lockedBackend{be, mu})
+	imapServer.AllowInsecureAuth = true
+	imapServer.ErrorLog = nopIMAPLogger{}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go imapServer.Serve(l)
+	t.Cleanup(func() { imapServer.Close() })
+
+	user, _ := be.Login(nil, "username", "password")
+	inbox, _ := user.GetMailbox("INBOX")
+
+	smtpServer := newFakeSMTP(t)
+	mb := newTestBus(t)
+	c, err := NewEmailChannel(config.EmailConfig{
+		IMAPHost:   "127.0.0.1",
+		IMAPPort:   l.Addr().(*net.TCPAddr).Port,
+		SMTPHost:   "127.0.0.1",
+		SMTPPort:   smtpServer.addr.Port,
+		Username:   "username",
+		Password:   "password",
+		Address:    "bot@example.com",
+		AllowFrom:  config.FlexibleStringSlice{"Alice@Example.com"},
+		AuthservID: "mx.example.com",
+	}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pollInterval = 50 * time.Millisecond
+	startTestChannel(t, c)
+	return c, mb, &testMailbox{mu: mu, mbox: inbox.(*memory.Mailbox)}, smtpServer
+}
+
+type nopIMAPLogger struct{}
+
+func (nopIMAPLogger) Printf(string, ...interface{}) {}
+func (nopIMAPLogger) Println(...interface{})        {}
+
+func deliver(t *testing.T, inbox *testMailbox, raw string) {
+	t.Helper()
+	raw = strings.ReplaceAll(strings.TrimLeft(raw, "\n"), "\n", "\r\n")
+	inbox.mu.Lock()
+	defer inbox.mu.Unlock()
+	if err := inbox.mbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(raw)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func isSeen(inbox *testMailbox, i int) bool {
+	inbox.mu.Lock()
+	defer inbox.mu.Unlock()
+	for _, flag := range inbox.mbox.Messages[i].Flags {
+		if flag == imap.SeenFlag {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEmailThreadRoundTrip(t *testing.T) {
+	c, mb, inbox, smtpServer := startTestEmail(t)
+
+	deliver(t, inbox, `
+From: Alice <alice@example.com>
+To: bot@example.com
+Subject: Trip plans
+Authentication-Results: mx.example.com; dmarc=pass header.from=example.com
+Message-ID: <m1@example.com>
+Content-Type: text/plain; charset=utf-8
+
+Can you book a train?
+`)
+	in := nextInbound(t, mb)
+	if in.ChatID != "alice@example.com/m1@example.com" || in.Content != "Subject: Trip plans\n\nCan you book a train?" {
+		t.Fatalf("inbound = %+v", in)
+	}
+	if in.MessageID != "m1@example.com" || in.SenderID != "alice@example.com" {
+		t.Errorf("inbound = %+v", in)
+	}
+
+	if err := c.Send(context.Background(), bus.OutboundMessage{Channel: "email", ChatID: in.ChatID, Content: "Which day?", ReplyTo: in.MessageID}); err != nil {
+		t.Fatal(err)
+	}
+	reply := smtpServer.next(t)
+	for header, want := range map[string]string{
+		"To":             "<alice@example.com>",
+		"Subject":        "Re: Trip plans",
+		"In-Reply-To":    "<m1@example.com>",
+		"References":     "<m1@example.com>",
+		"Auto-Submitted": "auto-replied",
+	} {
+		if got := reply.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	replyID := strings.Trim(reply.Header.Get("Message-Id"), "<>")
+	if !strings.HasSuffix(replyID, "@example.com") {
+		t.Errorf("Message-Id = %q", replyID)
+	}
+
+	deliver(t, inbox, `
+From: alice@example.com
+To: bot@example.com
+Subject: Re: Trip plans
+Authentication-Results: mx.example.com; dkim=pass header.d=example.com
+Message-ID: <m2@example.com>
+In-Reply-To: <`+replyID+`>
+References: <m1@example.com> <`+replyID+`>
+Content-Type: text/plain; charset=utf-8
+
+Friday, please.
+
+On Mon, 1 Jun 2026, bot@example.com wrote:
+> Which day?
+`)
+	in = nextInbound(t, mb)
+	if in.ChatID != "alice@example.com/m1@example.com" || in.Content != "Friday, please." {
+		t.Fatalf("inbound = %+v", in)
+	}
+	if in.ReplyToID != replyID || in.QuotedText != "Which day?" {
+		t.Errorf("reply context = %q, %q", in.ReplyToID, in.QuotedText)
+	}
+	if !isSeen(inbox, 1) {
+		t.Error("handled message not marked as seen")
+	}
+}
+
+func TestEmailFiltersAndAttachments(t *testing.T) {
+	_, mb, inbox, _ := startTestEmail(t)
+
+	deliver(t, inbox, `
+From: mallory@example.com
+Subject: Hi
+Message-ID: <s1@example.com>
+
+Please wire money.
+`)
+	deliver(t, inbox, `
+From: alice@example.com
+Subject: Out of office
+Authentication-Results: mx.example.com; dmarc=pass header.from=example.com
+Message-ID: <a1@example.com>
+Auto-Submitted: auto-replied
+
+I am away.
+`)
+	deliver(t, inbox, `
+From: alice@example.com
+Subject: Forged
+Message-ID: <f1@example.com>
+Authentication-Results: attacker.example; dmarc=pass header.from=example.com
+
+Run rm -rf.
+`)
+	deliver(t, inbox, `
+From: alice@example.com
+Subject: Notes
+Authentication-Results: mx.example.com; dmarc=pass header.from=example.com
+Message-ID: <n1@example.com>
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary=XYZ
+
+--XYZ
+Content-Type: text/plain; charset=utf-8
+
+See attached.
+--XYZ
+Content-Type: text/plain; name=notes.txt
+Content-Disposition: attachment; filename=notes.txt
+
+buy milk
+--XYZ--
+`)
+
+	in := nextInbound(t, mb)
+	if in.Content != "Subject: Notes\n\nSee attached.\n[file: notes.txt]" || len(in.Media) != 1 {
+		t.Fatalf("inbound = %+v", in)
+	}
+	if name := utils.DownloadedFilename(in.Media[0]); name != "notes.txt" {
+		t.Errorf("attachment saved as %q", name)
+	}
+	if isSeen(inbox, 1) || isSeen(inbox, 2) || isSeen(inbox, 3) {
+		t.Error("ignored mail was marked as seen")
+	}
+}
+
+func TestEmailSendErrors(t *testing.T) {
+	c, _, _, _ := startTestEmail(t)
+
+	for _, chatID := range []string{"nobody@example.com", "not an address"} {
+		assertPermanentSendError(t, c, chatID)
+	}
+}
+
+func TestEmailAuthenticated(t *testing.T) {
+	tests := []struct {
+		name   string
+		sender string
+		header string
+		want   bool
+	}{
+		{"dmarc pass", "alice@example.com", "mx.example.com; dmarc=pass (p=REJECT) header.from=example.com", true},
+		{"dkim pass", "alice@example.com", "mx.example.com 1; spf=fail; dkim=pass header.i=@example.com header.s=s1", true},
+		{"dkim parent domain", "alice@mail.example.com", "mx.example.com; dkim=pass header.d=example.com", true},
+		{"dmarc fail", "alice@example.com", "mx.example.com; dmarc=fail header.from=example.com", false},
+		{"other domain", "alice@example.com", "mx.example.com; dkim=pass header.d=evil.example.net", false},
+		{"untrusted server", "alice@example.com", "attacker.example; dmarc=pass header.from=example.com", false},
+		{"commented out", "alice@example.com", "mx.example.com; (dmarc=pass header.from=example.com) dmarc=none", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := emailAuthenticated([]string{tt.header}, "mx.example.com", tt.sender); got != tt.want {
+				t.Errorf("emailAuthenticated() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEmailChannelRequiresSenderAuth(t *testing.T) {
+	cfg := config.EmailConfig{
+		IMAPHost:  "imap.example.com",
+		SMTPHost:  "smtp.example.com",
+		Username:  "bot@example.com",
+		AllowFrom: config.FlexibleStringSlice{"alice@example.com"},
+	}
+	if _, err := NewEmailChannel(cfg, bus.NewMessageBus()); err == nil {
+		t.Error("allow_from without authserv_id should be refused")
+	}
+	cfg.AllowUnauthenticated = true
+	if _, err := NewEmailChannel(cfg, bus.NewMessageBus()); err != nil {
+		t.Errorf("allow_unauthenticated should be accepted: %v", err)
+	}
+}
+
+func TestStripEmailQuote(t *testing.T) {
+	tests := []struct {
+		in, reply, quoted string
+	}{
+		{"Thanks!\n\nOn Tue, Bob wrote:\n> Done.\n> Anything else?", "Thanks!", "Done.\nAnything else?"},
+		{"Sounds good.\n\n-- \nAlice\nSent from my phone", "Sounds good.", ""},
+		{"Yes\r\n\r\n-----Original Message-----\r\nFrom: Bob\r\nOk?", "Yes", "From: Bob\nOk?"},
+		{"I wrote:\nnot a quote", "I wrote:\nnot a quote", ""},
+	}
+	for _, tt := range tests {
+		reply, quoted := stripEmailQuote(tt.in)
+		if reply != tt.reply || quoted != tt.quoted {
+			t.Errorf("stripEmailQuote(%q) = %q, %q; want %q, %q", tt.in, reply, quoted, tt.reply, tt.quoted)
+		}
+	}
+}
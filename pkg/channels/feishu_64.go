@@ -6,6 +6,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -128,7 +131,7 @@ func (c *FeishuChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	return nil
 }
 
-func (c *FeishuChannel) handleMessageReceive(_ context.Context, event *larkim.P2MessageReceiveV1) error {
+func (c *FeishuChannel) handleMessageReceive(ctx context.Context, event *larkim.P2MessageReceiveV1) error {
 	if event == nil || event.Event == nil || event.Event.Message == nil {
 		return nil
 	}
@@ -146,7 +149,40 @@ func (c *FeishuChannel) handleMessageReceive(_ context.Context, event *larkim.P2
 		senderID = "unknown"
 	}
 
+	// Check the allowlist before downloading or transcribing attachments.
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("feishu", "Message rejected by allowlist", map[string]interface{}{
+			"sender_id": senderID,
+		})
+		return nil
+	}
+
 	content := extractFeishuMessageContent(message)
+
+	var media []string
+	switch stringValue(message.MessageType) {
+	case larkim.MsgTypeImage:
+		content = "[image]"
+		payload := parseFeishuResource(message)
+		if data := c.downloadResource(ctx, stringValue(message.MessageId), payload.ImageKey, "image"); data != nil {
+			media = append(media, utils.DataURI(data))
+		}
+	case larkim.MsgTypeAudio:
+		content = "[voice]"
+		payload := parseFeishuResource(message)
+		if data := c.downloadResource(ctx, stringValue(message.MessageId), payload.FileKey, "file"); data != nil {
+			content = c.transcribeFeishuAudio(ctx, data)
+		}
+	case larkim.MsgTypeFile:
+		payload := parseFeishuResource(message)
+		content = fmt.Sprintf("[file: %s]", payload.FileName)
+		if data := c.downloadResource(ctx, stringValue(message.MessageId), payload.FileKey, "file"); data != nil {
+			if note := c.ingestFeishuFile(payload.FileName, data); note != "" {
+				content = note
+			}
+		}
+	}
+
 	if content == "" {
 		content = "[empty message]"
 	}
@@ -171,7 +207,7 @@ func (c *FeishuChannel) handleMessageReceive(_ context.Context, event *larkim.P2
 		"preview":   utils.Truncate(content, 80),
 	})
 
-	c.HandleMessage(senderID, chatID, content, nil, metadata)
+	c.HandleMessage(senderID, chatID, content, media, metadata)
 	return nil
 }
 
@@ -210,6 +246,97 @@ func extractFeishuMessageContent(message *larkim.EventMessage) string {
 	return *message.Content
 }
 
+// feishuResource is the content payload of image and file messages.
+type feishuResource struct {
+	ImageKey string `json:"image_key"`
+	FileKey  string `json:"file_key"`
+	FileName string `json:"file_name"`
+}
+
+func parseFeishuResource(message *larkim.EventMessage) feishuResource {
+	var payload feishuResource
+	json.Unmarshal([]byte(stringValue(message.Content)), &payload)
+	return payload
+}
+
+// downloadResource fetches an image or file attached to a message, or
+// returns nil on failure.
+func (c *FeishuChannel) downloadResource(ctx context.Context, messageID, key, resourceType string) []byte {
+	if messageID == "" || key == "" {
+		return nil
+	}
+
+	req := larkim.NewGetMessageResourceReqBuilder().
+		MessageId(messageID).
+		FileKey(key).
+		Type(resourceType).
+		Build()
+
+	resp, err := c.client.Im.MessageResource.Get(ctx, req)
+	if err != nil {
+		logger.ErrorCF("feishu", "Failed to download message resource", map[string]interface{}{
+			"message_id": messageID,
+			"type":       resourceType,
+			"error":      err.Error(),
+		})
+		return nil
+	}
+	if !resp.Success() {
+		logger.ErrorCF("feishu", "Message resource download returned error", map[string]interface{}{
+			"message_id": messageID,
+			"type":       resourceType,
+			"code":       resp.Code,
+			"msg":        resp.Msg,
+		})
+		return nil
+	}
+
+	data, err := io.ReadAll(resp.File)
+	if err != nil {
+		logger.ErrorCF("feishu", "Failed to read message resource", map[string]interface{}{
+			"message_id": messageID,
+			"error":      err.Error(),
+		})
+		return nil
+	}
+	return data
+}
+
+// ingestFeishuFile stores a downloaded file as a document via a temp file.
+func (c *FeishuChannel) ingestFeishuFile(fileName string, data []byte) string {
+	tmpPath, err := writeFeishuTemp(data, filepath.Ext(fileName))
+	if err != nil {
+		return ""
+	}
+	defer os.Remove(tmpPath)
+	return c.ingestDocument(tmpPath, fileName, "")
+}
+
+// transcribeFeishuAudio transcribes a voice message. Feishu records Opus in
+// an Ogg container, which transcription APIs accept under the .ogg name.
+func (c *FeishuChannel) transcribeFeishuAudio(ctx context.Context, data []byte) string {
+	tmpPath, err := writeFeishuTemp(data, ".ogg")
+	if err != nil {
+		return "[voice]"
+	}
+	defer os.Remove(tmpPath)
+	return c.transcribeAudio(ctx, tmpPath, "voice")
+}
+
+func writeFeishuTemp(data []byte, ext string) (string, error) {
+	tmp, err := os.CreateTemp("", "picoclaw-feishu-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
 func stringValue(v *string) string {
 	if v == nil {
 		return ""
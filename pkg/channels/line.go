@@ -248,6 +248,7 @@ type lineMessage struct {
 	ID         string `json:"id"`
 	Type       string `json:"type"` // "text", "image", "video", "audio", "file", "sticker"
 	Text       string `json:"text"`
+	FileName   string `json:"fileName"`
 	QuoteToken string `json:"quoteToken"`
 	Mention    *struct {
 		Mentionees []lineMentionee `json:"mentionees"`
@@ -292,6 +293,14 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 		return
 	}
 
+	// Check the allowlist before downloading or transcribing attachments.
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("line", "Message rejected by allowlist", map[string]interface{}{
+			"sender_id": senderID,
+		})
+		return
+	}
+
 	// Store reply token for later use
 	if event.ReplyToken != "" {
 		c.replyTokens.Store(chatID, replyTokenEntry{
@@ -339,7 +348,7 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 		if localPath != "" {
 			localFiles = append(localFiles, localPath)
 			mediaPaths = append(mediaPaths, localPath)
-			content = "[audio]"
+			content = c.transcribeAudio(c.ctx, localPath, "audio")
 		}
 	case "video":
 		localPath := c.downloadContent(msg.ID, "video.mp4")
@@ -349,7 +358,15 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 			content = "[video]"
 		}
 	case "file":
-		content = "[file]"
+		content = fmt.Sprintf("[file: %s]", msg.FileName)
+		if localPath := c.downloadContent(msg.ID, msg.FileName); localPath != "" {
+			localFiles = append(localFiles, localPath)
+			if note := c.ingestDocument(localPath, msg.FileName, ""); note != "" {
+				content = note
+			} else {
+				mediaPaths = append(mediaPaths, localPath)
+			}
+		}
 	case "sticker":
 		content = "[sticker]"
 	default:
@@ -496,7 +513,7 @@ func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if entry, ok := c.replyTokens.LoadAndDelete(msg.ChatID); ok {
 		tokenEntry := entry.(replyTokenEntry)
 		if time.Since(tokenEntry.timestamp) < lineReplyTokenMaxAge {
-			if err := c.sendReply(ctx, tokenEntry.token, msg.Content, quoteToken); err == nil {
+			if err := c.sendReply(ctx, tokenEntry.token, buildLINEMessages(msg, quoteToken)); err == nil {
 				logger.DebugCF("line", "Message sent via Reply API", map[string]interface{}{
 					"chat_id": msg.ChatID,
 					"quoted":  quoteToken != "",
@@ -508,12 +525,64 @@ func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	}
 
 	// Fall back to Push API
-	return c.sendPush(ctx, msg.ChatID, msg.Content, quoteToken)
+	return c.sendPush(ctx, msg.ChatID, buildLINEMessages(msg, quoteToken))
+}
+
+// RendersRich reports that LINE shows buttons and choices as quick replies.
+func (c *LINEChannel) RendersRich() bool {
+	return true
+}
+
+// lineMaxQuickReplies is LINE's limit on quick reply buttons per message.
+const lineMaxQuickReplies = 13
+
+// buildLINEMessages renders msg as LINE message objects: the card image, if
+// any, then the text with the card and buttons and choices as quick replies.
+// A quick reply sends its payload back as the user's own message.
+func buildLINEMessages(msg bus.OutboundMessage, quoteToken string) []map[string]interface{} {
+	var messages []map[string]interface{}
+	if msg.Card != nil && msg.Card.ImageURL != "" {
+		messages = append(messages, map[string]interface{}{
+			"type":               "image",
+			"originalContentUrl": msg.Card.ImageURL,
+			"previewImageUrl":    msg.Card.ImageURL,
+		})
+	}
+
+	text := msg.Content
+	if msg.Card != nil {
+		card := *msg.Card
+		card.ImageURL = ""
+		text = renderRichText(bus.OutboundMessage{Content: msg.Content, Card: &card})
+	}
+	if text == "" && msg.IsRich() {
+		text = "👇"
+	}
+	textMsg := buildTextMessage(text, quoteToken)
+
+	var items []map[string]interface{}
+	for _, b := range richOptions(msg) {
+		if len(items) == lineMaxQuickReplies {
+			break
+		}
+		items = append(items, map[string]interface{}{
+			"type": "action",
+			"action": map[string]string{
+				"type":  "message",
+				"label": utils.Truncate(b.Label, 20),
+				"text":  utils.Truncate(b.Payload(), 300),
+			},
+		})
+	}
+	if len(items) > 0 {
+		textMsg["quickReply"] = map[string]interface{}{"items": items}
+	}
+	return append(messages, textMsg)
 }
 
 // buildTextMessage creates a text message object, optionally with quoteToken.
-func buildTextMessage(content, quoteToken string) map[string]string {
-	msg := map[string]string{
+func buildTextMessage(content, quoteToken string) map[string]interface{} {
+	msg := map[string]interface{}{
 		"type": "text",
 		"text": content,
 	}
@@ -524,20 +593,20 @@ func buildTextMessage(content, quoteToken string) map[string]string {
 }
 
 // sendReply sends a message using the LINE Reply API.
-func (c *LINEChannel) sendReply(ctx context.Context, replyToken, content, quoteToken string) error {
+func (c *LINEChannel) sendReply(ctx context.Context, replyToken string, messages []map[string]interface{}) error {
 	payload := map[string]interface{}{
 		"replyToken": replyToken,
-		"messages":   []map[string]string{buildTextMessage(content, quoteToken)},
+		"messages":   messages,
 	}
 
 	return c.callAPI(ctx, lineReplyEndpoint, payload)
 }
 
 // sendPush sends a message using the LINE Push API.
-func (c *LINEChannel) sendPush(ctx context.Context, to, content, quoteToken string) error {
+func (c *LINEChannel) sendPush(ctx context.Context, to string, messages []map[string]interface{}) error {
 	payload := map[string]interface{}{
 		"to":       to,
-		"messages": []map[string]string{buildTextMessage(content, quoteToken)},
+		"messages": messages,
 	}
 
 	return c.callAPI(ctx, linePushEndpoint, payload)
@@ -9,12 +9,15 @@ package channels
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"sync"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/documents"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 type Manager struct {
@@ -22,6 +25,9 @@ type Manager struct {
 	bus          *bus.MessageBus
 	config       *config.Config
 	dispatchTask *asyncTask
+	senders      map[string]*channelSender
+	disabled     map[string]Channel // stopped at runtime by DisableChannel
+	runCtx       context.Context    // StartAll's context, for EnableChannel
 	mu           sync.RWMutex
 }
 
@@ -32,6 +38,8 @@ type asyncTask struct {
 func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error) {
 	m := &Manager{
 		channels: make(map[string]Channel),
+		senders:  make(map[string]*channelSender),
+		disabled: make(map[string]Channel),
 		bus:      messageBus,
 		config:   cfg,
 	}
@@ -189,6 +197,94 @@ func (m *Manager) initChannels() error {
 		}
 	}
 
+	if m.config.Channels.Web.Enabled {
+		logger.DebugC("channels", "Attempting to initialize web chat channel")
+		storeDir := filepath.Join(m.config.WorkspacePath(), "web", "sessions")
+		web, err := NewWebChannel(m.config.Channels.Web, m.bus, storeDir)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize web chat channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["web"] = web
+			logger.InfoC("channels", "Web chat channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Matrix.Enabled && m.config.Channels.Matrix.AccessToken != "" {
+		logger.DebugC("channels", "Attempting to initialize Matrix channel")
+		matrix, err := NewMatrixChannel(m.config.Channels.Matrix, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Matrix channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["matrix"] = matrix
+			logger.InfoC("channels", "Matrix channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Email.Enabled && m.config.Channels.Email.IMAPHost != "" {
+		logger.DebugC("channels", "Attempting to initialize email channel")
+		email, err := NewEmailChannel(m.config.Channels.Email, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize email channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["email"] = email
+			logger.InfoC("channels", "Email channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Signal.Enabled && m.config.Channels.Signal.Socket != "" {
+		logger.DebugC("channels", "Attempting to initialize Signal channel")
+		signal, err := NewSignalChannel(m.config.Channels.Signal, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Signal channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["signal"] = signal
+			logger.InfoC("channels", "Signal channel enabled successfully")
+		}
+	}
+
+	for _, pluginCfg := range m.config.Channels.Plugins {
+		if !pluginCfg.Enabled {
+			continue
+		}
+		logger.DebugCF("channels", "Attempting to initialize plugin channel", map[string]interface{}{
+			"channel": pluginCfg.Name,
+		})
+		if _, exists := m.channels[pluginCfg.Name]; exists || constants.IsInternalChannel(pluginCfg.Name) {
+			logger.ErrorCF("channels", "Plugin channel name already in use", map[string]interface{}{
+				"channel": pluginCfg.Name,
+			})
+			continue
+		}
+		plugin, err := NewPluginChannel(pluginCfg, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize plugin channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+			continue
+		}
+		m.channels[pluginCfg.Name] = plugin
+		logger.InfoCF("channels", "Plugin channel enabled successfully", map[string]interface{}{
+			"channel": pluginCfg.Name,
+		})
+	}
+
+	// Document attachments from every channel land in the workspace store
+	// the document tool reads from.
+	store := documents.NewStore(m.config.WorkspacePath())
+	for _, ch := range m.channels {
+		if ingester, ok := ch.(interface{ SetDocumentStore(*documents.Store) }); ok {
+			ingester.SetDocumentStore(store)
+		}
+	}
+
 	logger.InfoCF("channels", "Channel initialization completed", map[string]interface{}{
 		"enabled_channels": len(m.channels),
 	})
@@ -207,10 +303,12 @@ func (m *Manager) StartAll(ctx context.Context) error {
 
 	logger.InfoC("channels", "Starting all channels")
 
+	m.runCtx = ctx
 	dispatchCtx, cancel := context.WithCancel(ctx)
 	m.dispatchTask = &asyncTask{cancel: cancel}
 
 	go m.dispatchOutbound(dispatchCtx)
+	go m.dispatchEvents(dispatchCtx)
 
 	for name, channel := range m.channels {
 		logger.InfoCF("channels", "Starting channel", map[string]interface{}{
@@ -238,6 +336,7 @@ func (m *Manager) StopAll(ctx context.Context) error {
 		m.dispatchTask.cancel()
 		m.dispatchTask = nil
 	}
+	m.senders = make(map[string]*channelSender)
 
 	for name, channel := range m.channels {
 		logger.InfoCF("channels", "Stopping channel", map[string]interface{}{
@@ -266,35 +365,196 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 		default:
 			msg, ok := m.bus.SubscribeOutbound(ctx)
 			if !ok {
-				continue
+				// Context cancelled or bus closed.
+				logger.InfoC("channels", "Outbound dispatcher stopped")
+				return
 			}
 
 			// Silently skip internal channels
 			if constants.IsInternalChannel(msg.Channel) {
+				m.bus.Ack(msg.ID)
 				continue
 			}
 
-			m.mu.RLock()
-			channel, exists := m.channels[msg.Channel]
-			m.mu.RUnlock()
-
+			sender, exists := m.senderFor(ctx, msg.Channel)
 			if !exists {
-				logger.WarnCF("channels", "Unknown channel for outbound message", map[string]interface{}{
+				reason := fmt.Errorf("unknown channel %q", msg.Channel)
+				if m.isDisabled(msg.Channel) {
+					reason = fmt.Errorf("channel %q is disabled", msg.Channel)
+				}
+				logger.WarnCF("channels", "No channel for outbound message", map[string]interface{}{
 					"channel": msg.Channel,
+					"error":   reason.Error(),
 				})
+				m.bus.DeadLetter(msg, 0, reason)
 				continue
 			}
 
-			if err := channel.Send(ctx, msg); err != nil {
-				logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
+			if !sender.enqueue(msg) {
+				logger.WarnCF("channels", "Send queue full, deferring message", map[string]interface{}{
 					"channel": msg.Channel,
-					"error":   err.Error(),
+					"chat_id": msg.ChatID,
 				})
+				sender.requeue(msg)
 			}
 		}
 	}
 }
 
+func (m *Manager) dispatchEvents(ctx context.Context) {
+	for {
+		ev, ok := m.bus.SubscribeEvents(ctx)
+		if !ok {
+			return
+		}
+
+		sender, exists := m.senderFor(ctx, ev.Channel)
+		if !exists || !SupportsEvent(sender.channel, ev.Type) {
+			continue
+		}
+		if !sender.enqueueEvent(ev) {
+			logger.DebugCF("channels", "Event queue full, event dropped", map[string]interface{}{
+				"channel": ev.Channel,
+				"type":    string(ev.Type),
+			})
+		}
+	}
+}
+
+// SupportsEvent reports whether the named channel handles outbound events
+// of type t.
+func (m *Manager) SupportsEvent(channelName string, t bus.EventType) bool {
+	m.mu.RLock()
+	channel, exists := m.channels[channelName]
+	m.mu.RUnlock()
+	return exists && SupportsEvent(channel, t)
+}
+
+// senderFor returns the send queue for a channel, starting its goroutine
+// on first use.
+func (m *Manager) senderFor(ctx context.Context, name string) (*channelSender, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	channel, exists := m.channels[name]
+	if !exists {
+		return nil, false
+	}
+	sender, ok := m.senders[name]
+	if !ok || sender.channel != channel {
+		sender = newChannelSender(name, channel, m.bus)
+		sender.prepare = func(ctx context.Context, msg bus.OutboundMessage) bus.OutboundMessage {
+			if msg.Reasoning != "" {
+				msg = m.deliverReasoning(ctx, channel, msg)
+			}
+			if msg.IsRich() {
+				msg = flattenRich(channel, msg)
+			}
+			return msg
+		}
+		m.senders[name] = sender
+		go sender.run(ctx)
+	}
+	return sender, true
+}
+
+// maxReasoningChars caps reasoning shown to users; full traces can be huge.
+const maxReasoningChars = 3000
+
+// reasoningPrefix marks reasoning sent as a message of its own.
+const reasoningPrefix = "💭 "
+
+// deliverReasoning applies agents.defaults.reasoning_display to an outbound
+// message. "collapsed" is left to channels that render it natively; otherwise
+// reasoning goes out as its own message ahead of the answer. Returns the
+// message to send for the answer itself.
+func (m *Manager) deliverReasoning(ctx context.Context, channel Channel, msg bus.OutboundMessage) bus.OutboundMessage {
+	mode := m.config.Agents.Defaults.ReasoningDisplay
+	reasoning := utils.Truncate(msg.Reasoning, maxReasoningChars)
+	msg.Reasoning = ""
+
+	switch mode {
+	case "collapsed":
+		if r, ok := channel.(ReasoningRenderer); ok && r.RendersReasoning() {
+			msg.Reasoning = reasoning
+			return msg
+		}
+	case "separate":
+	default:
+		return msg
+	}
+
+	if err := channel.Send(ctx, bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: reasoningPrefix + reasoning,
+	}); err != nil {
+		logger.WarnCF("channels", "Failed to send reasoning message", map[string]interface{}{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+	}
+	return msg
+}
+
+// DisableChannel stops a channel and takes it out of routing until
+// EnableChannel. Replies addressed to it meanwhile become dead letters,
+// which can be requeued once it is back.
+func (m *Manager) DisableChannel(ctx context.Context, name string) error {
+	m.mu.Lock()
+	channel, ok := m.channels[name]
+	if !ok {
+		_, off := m.disabled[name]
+		m.mu.Unlock()
+		if off {
+			return nil
+		}
+		return fmt.Errorf("channel %s not found", name)
+	}
+	delete(m.channels, name)
+	m.disabled[name] = channel
+	m.mu.Unlock()
+
+	logger.InfoCF("channels", "Disabling channel", map[string]interface{}{
+		"channel": name,
+	})
+	return channel.Stop(ctx)
+}
+
+// EnableChannel restarts a channel stopped by DisableChannel. Channels not
+// enabled in the config at startup cannot be enabled at runtime.
+func (m *Manager) EnableChannel(name string) error {
+	m.mu.Lock()
+	channel, ok := m.disabled[name]
+	if !ok {
+		_, on := m.channels[name]
+		m.mu.Unlock()
+		if on {
+			return nil
+		}
+		return fmt.Errorf("channel %s not found", name)
+	}
+	delete(m.disabled, name)
+	m.channels[name] = channel
+	ctx := m.runCtx
+	m.mu.Unlock()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	logger.InfoCF("channels", "Enabling channel", map[string]interface{}{
+		"channel": name,
+	})
+	return channel.Start(ctx)
+}
+
+func (m *Manager) isDisabled(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, off := m.disabled[name]
+	return off
+}
+
 func (m *Manager) GetChannel(name string) (Channel, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -308,14 +568,37 @@ func (m *Manager) GetStatus() map[string]interface{} {
 
 	status := make(map[string]interface{})
 	for name, channel := range m.channels {
-		status[name] = map[string]interface{}{
+		entry := map[string]interface{}{
 			"enabled": true,
 			"running": channel.IsRunning(),
 		}
+		if sender, ok := m.senders[name]; ok {
+			entry["outbound"] = sender.snapshot()
+		}
+		status[name] = entry
+	}
+	for name, channel := range m.disabled {
+		status[name] = map[string]interface{}{
+			"enabled": false,
+			"running": channel.IsRunning(),
+		}
 	}
 	return status
 }
 
+// GetSendStats returns outbound delivery metrics for every channel that
+// has sent or queued a message since the channels were started.
+func (m *Manager) GetSendStats() map[string]SendStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := make(map[string]SendStats, len(m.senders))
+	for name, sender := range m.senders {
+		stats[name] = sender.snapshot()
+	}
+	return stats
+}
+
 func (m *Manager) GetEnabledChannels() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -0,0 +1,696 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+const (
+	// matrixSyncTimeout is how long the homeserver holds a /sync open
+	// when nothing happens.
+	matrixSyncTimeout = 30 * time.Second
+
+	// matrixTypingTimeout bounds a typing notification in case the stop
+	// never arrives.
+	matrixTypingTimeout = 2 * time.Minute
+
+	// matrixMaxUpload is the largest outbound media file we upload.
+	matrixMaxUpload = 50 << 20
+
+	// matrixSyncFilter keeps /sync to room timelines and invites.
+	matrixSyncFilter = `{"presence":{"not_types":["*"]},"account_data":{"not_types":["*"]},` +
+		`"room":{"ephemeral":{"not_types":["*"]},"account_data":{"not_types":["*"]},"timeline":{"limit":50}}}`
+)
+
+// MatrixChannel implements the Channel interface for Matrix over the
+// client-server API: a long-polling /sync loop for inbound events and REST
+// calls for everything else. Chat IDs are room IDs, or "room/thread root"
+// for messages in a thread.
+type MatrixChannel struct {
+	*BaseChannel
+	config config.MatrixConfig
+	client *http.Client
+	userID string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	txnPrefix string
+	txnSeq    atomic.Int64
+
+	warnedEncrypted sync.Map // room ID -> true once we logged that we cannot read it
+}
+
+// matrixError is an error response from the homeserver.
+type matrixError struct {
+	Status  int
+	ErrCode string `json:"errcode"`
+	Message string `json:"error"`
+}
+
+func (e *matrixError) Error() string {
+	return fmt.Sprintf("matrix: %d %s: %s", e.Status, e.ErrCode, e.Message)
+}
+
+type matrixSyncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]struct {
+			InviteState struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"invite_state"`
+		} `json:"invite"`
+	} `json:"rooms"`
+}
+
+type matrixEvent struct {
+	Type     string          `json:"type"`
+	EventID  string          `json:"event_id"`
+	Sender   string          `json:"sender"`
+	StateKey *string         `json:"state_key,omitempty"`
+	Content  json.RawMessage `json:"content"`
+}
+
+type matrixRelation struct {
+	RelType       string `json:"rel_type,omitempty"`
+	EventID       string `json:"event_id,omitempty"`
+	Key           string `json:"key,omitempty"`
+	IsFallingBack bool   `json:"is_falling_back,omitempty"`
+	InReplyTo     *struct {
+		EventID string `json:"event_id"`
+	} `json:"m.in_reply_to,omitempty"`
+}
+
+type matrixMessageContent struct {
+	MsgType  string `json:"msgtype"`
+	Body     string `json:"body"`
+	FileName string `json:"filename"`
+	URL      string `json:"url"`
+	Info     struct {
+		MimeType string `json:"mimetype"`
+	} `json:"info"`
+	RelatesTo  *matrixRelation `json:"m.relates_to"`
+	NewContent *struct {
+		Body string `json:"body"`
+	} `json:"m.new_content"`
+}
+
+// NewMatrixChannel creates a Matrix channel for the account behind the
+// configured access token.
+func NewMatrixChannel(cfg config.MatrixConfig, messageBus *bus.MessageBus) (*MatrixChannel, error) {
+	if cfg.Homeserver == "" || cfg.AccessToken == "" {
+		return nil, fmt.Errorf("matrix homeserver and access_token are required")
+	}
+	cfg.Homeserver = strings.TrimRight(cfg.Homeserver, "/")
+
+	base := NewBaseChannel("matrix", cfg, messageBus, cfg.AllowFrom)
+
+	return &MatrixChannel{
+		BaseChannel: base,
+		config:      cfg,
+		client:      &http.Client{Timeout: matrixSyncTimeout + 30*time.Second},
+		txnPrefix:   fmt.Sprintf("picoclaw%d", time.Now().UnixNano()),
+	}, nil
+}
+
+// Start checks the access token, skips the backlog and starts syncing.
+func (c *MatrixChannel) Start(ctx context.Context) error {
+	logger.InfoC("matrix", "Starting Matrix channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	if err := c.do(c.ctx, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, &whoami); err != nil {
+		return fmt.Errorf("matrix whoami failed: %w", err)
+	}
+	c.userID = whoami.UserID
+
+	// Only answer messages sent from now on; pending invites still count.
+	initial, err := c.sync(c.ctx, "", 0)
+	if err != nil {
+		return fmt.Errorf("matrix initial sync failed: %w", err)
+	}
+	c.handleInvites(initial)
+
+	go c.syncLoop(initial.NextBatch)
+
+	c.setRunning(true)
+	logger.InfoCF("matrix", "Matrix channel started", map[string]interface{}{
+		"user_id":    c.userID,
+		"homeserver": c.config.Homeserver,
+	})
+	return nil
+}
+
+func (c *MatrixChannel) Stop(ctx context.Context) error {
+	logger.InfoC("matrix", "Stopping Matrix channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	c.setRunning(false)
+	logger.InfoC("matrix", "Matrix channel stopped")
+	return nil
+}
+
+// syncLoop long-polls /sync until the channel stops, backing off while the
+// homeserver is unreachable.
+func (c *MatrixChannel) syncLoop(since string) {
+	backoff := time.Second
+	for c.ctx.Err() == nil {
+		resp, err := c.sync(c.ctx, since, matrixSyncTimeout)
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			logger.WarnCF("matrix", "Sync failed, retrying", map[string]interface{}{
+				"error":    err.Error(),
+				"retry_in": backoff.String(),
+			})
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+		backoff = time.Second
+		since = resp.NextBatch
+
+		c.handleInvites(resp)
+		for roomID, room := range resp.Rooms.Join {
+			for _, ev := range room.Timeline.Events {
+				c.handleEvent(roomID, ev)
+			}
+		}
+	}
+}
+
+func (c *MatrixChannel) sync(ctx context.Context, since string, timeout time.Duration) (*matrixSyncResponse, error) {
+	q := url.Values{}
+	q.Set("filter", matrixSyncFilter)
+	q.Set("timeout", fmt.Sprint(timeout.Milliseconds()))
+	if since != "" {
+		q.Set("since", since)
+	}
+	var resp matrixSyncResponse
+	if err := c.do(ctx, http.MethodGet, "/_matrix/client/v3/sync?"+q.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// handleInvites joins rooms an allowed user invited the bot to.
+func (c *MatrixChannel) handleInvites(resp *matrixSyncResponse) {
+	for roomID, invite := range resp.Rooms.Invite {
+		inviter := ""
+		for _, ev := range invite.InviteState.Events {
+			if ev.Type == "m.room.member" && ev.StateKey != nil && *ev.StateKey == c.userID {
+				inviter = ev.Sender
+			}
+		}
+		if !c.config.AutoJoin || inviter == "" || !c.IsAllowed(inviter) {
+			logger.InfoCF("matrix", "Ignoring room invite", map[string]interface{}{
+				"room_id": roomID,
+				"inviter": inviter,
+			})
+			continue
+		}
+		if err := c.do(c.ctx, http.MethodPost, "/_matrix/client/v3/rooms/"+url.PathEscape(roomID)+"/join", map[string]string{}, nil); err != nil {
+			logger.ErrorCF("matrix", "Failed to join room", map[string]interface{}{
+				"room_id": roomID,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		logger.InfoCF("matrix", "Joined room", map[string]interface{}{
+			"room_id": roomID,
+			"inviter": inviter,
+		})
+	}
+}
+
+func (c *MatrixChannel) handleEvent(roomID string, ev matrixEvent) {
+	if ev.Sender == c.userID {
+		return
+	}
+	switch ev.Type {
+	case "m.room.message":
+		c.handleMessage(roomID, ev)
+	case "m.reaction":
+		var content matrixMessageContent
+		if json.Unmarshal(ev.Content, &content) != nil || content.RelatesTo == nil || content.RelatesTo.RelType != "m.annotation" {
+			return
+		}
+		c.HandleEvent(ev.Sender, bus.Event{
+			Type:      bus.EventReaction,
+			ChatID:    roomID,
+			MessageID: content.RelatesTo.EventID,
+			Content:   content.RelatesTo.Key,
+		}, map[string]string{
+			"user_id": ev.Sender,
+		})
+	case "m.room.encrypted":
+		// Without a decrypting proxy in front of the homeserver we only
+		// see ciphertext; say so once per room rather than per message.
+		if _, warned := c.warnedEncrypted.LoadOrStore(roomID, true); !warned {
+			logger.WarnCF("matrix", "Received an encrypted message; point homeserver at a Pantalaimon proxy to read encrypted rooms", map[string]interface{}{
+				"room_id": roomID,
+			})
+		}
+	}
+}
+
+func (c *MatrixChannel) handleMessage(roomID string, ev matrixEvent) {
+	var content matrixMessageContent
+	if err := json.Unmarshal(ev.Content, &content); err != nil {
+		return
+	}
+	rel := content.RelatesTo
+
+	if rel != nil && rel.RelType == "m.replace" {
+		if content.NewContent == nil {
+			return
+		}
+		c.HandleEvent(ev.Sender, bus.Event{
+			Type:      bus.EventEdit,
+			ChatID:    roomID,
+			MessageID: rel.EventID,
+			Content:   content.NewContent.Body,
+		}, map[string]string{
+			"user_id": ev.Sender,
+		})
+		return
+	}
+
+	// m.notice is what bots send; answering it invites reply loops.
+	if content.MsgType == "m.notice" {
+		return
+	}
+
+	if !c.IsAllowed(ev.Sender) {
+		logger.DebugCF("matrix", "Message rejected by allowlist", map[string]interface{}{
+			"sender": ev.Sender,
+		})
+		return
+	}
+
+	threadRoot := ""
+	if rel != nil && rel.RelType == "m.thread" {
+		threadRoot = rel.EventID
+	} else if c.config.ThreadReplies {
+		threadRoot = ev.EventID
+	}
+	chatID := roomID
+	if threadRoot != "" {
+		chatID = roomID + "/" + threadRoot
+	}
+
+	metadata := map[string]string{
+		"message_id": ev.EventID,
+		"room_id":    roomID,
+		"thread_id":  threadRoot,
+		"platform":   "matrix",
+	}
+
+	text := content.Body
+	if rel != nil && rel.InReplyTo != nil && !rel.IsFallingBack {
+		var quoted string
+		text, quoted = stripMatrixReplyFallback(text)
+		metadata["reply_to_id"] = rel.InReplyTo.EventID
+		metadata["quoted_text"] = quoted
+	}
+
+	var mediaPaths []string
+	hasAudio := false
+	switch content.MsgType {
+	case "m.image", "m.file", "m.audio", "m.video":
+		// Since Matrix 1.10 the body is a caption when filename is set.
+		name := content.FileName
+		if name == "" {
+			name, text = text, ""
+		}
+		localPath := c.downloadMedia(content.URL, name)
+		if localPath == "" {
+			text = strings.TrimSpace(text + fmt.Sprintf("\n[file: %s (download failed)]", name))
+			break
+		}
+		defer os.Remove(localPath)
+		mediaPaths = append(mediaPaths, localPath)
+
+		switch {
+		case content.MsgType == "m.audio" || utils.IsAudioFile(name, content.Info.MimeType):
+			hasAudio = true
+			text = strings.TrimSpace(text + "\n" + c.transcribeAudio(c.ctx, localPath, "audio: "+name))
+		case content.MsgType == "m.image":
+			text = strings.TrimSpace(text + fmt.Sprintf("\n[image: %s]", name))
+		default:
+			text = strings.TrimSpace(text + fmt.Sprintf("\n[file: %s]", name))
+		}
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	c.markVoiceInput(chatID, hasAudio)
+
+	logger.DebugCF("matrix", "Received message", map[string]interface{}{
+		"sender_id": ev.Sender,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(text, 50),
+	})
+
+	c.HandleMessage(ev.Sender, chatID, text, mediaPaths, metadata)
+}
+
+// stripMatrixReplyFallback splits a reply's body into the reply and the
+// quoted text of the "> <@user> ..." fallback clients prepend to it.
+func stripMatrixReplyFallback(body string) (text, quoted string) {
+	lines := strings.Split(body, "\n")
+	i := 0
+	var quote []string
+	for ; i < len(lines) && strings.HasPrefix(lines[i], ">"); i++ {
+		line := strings.TrimSpace(strings.TrimPrefix(lines[i], ">"))
+		if i == 0 && strings.HasPrefix(line, "<") {
+			if end := strings.Index(line, "> "); end > 0 {
+				line = line[end+2:]
+			}
+		}
+		quote = append(quote, line)
+	}
+	if i == 0 {
+		return body, ""
+	}
+	return strings.TrimSpace(strings.Join(lines[i:], "\n")), strings.Join(quote, "\n")
+}
+
+// downloadMedia fetches an mxc:// URI to a temp file, through the
+// authenticated media API with the legacy endpoint as fallback.
+func (c *MatrixChannel) downloadMedia(mxc, name string) string {
+	serverAndID, ok := strings.CutPrefix(mxc, "mxc://")
+	if !ok || !strings.Contains(serverAndID, "/") {
+		logger.ErrorCF("matrix", "Invalid media URI", map[string]interface{}{"url": mxc})
+		return ""
+	}
+	opts := utils.DownloadOptions{
+		LoggerPrefix: "matrix",
+		ExtraHeaders: map[string]string{
+			"Authorization": "Bearer " + c.config.AccessToken,
+		},
+	}
+	if path := utils.DownloadFile(c.config.Homeserver+"/_matrix/client/v1/media/download/"+serverAndID, name, opts); path != "" {
+		return path
+	}
+	return utils.DownloadFile(c.config.Homeserver+"/_matrix/media/v3/download/"+serverAndID, name, opts)
+}
+
+func (c *MatrixChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("matrix channel not running")
+	}
+
+	roomID, threadRoot := parseMatrixChatID(msg.ChatID)
+	if !strings.HasPrefix(roomID, "!") {
+		return permanent(fmt.Errorf("invalid matrix room ID: %s", msg.ChatID))
+	}
+	relation := matrixReplyRelation(threadRoot, msg.ReplyTo)
+
+	for _, ref := range msg.Media {
+		if err := c.sendMedia(ctx, roomID, ref, relation); err != nil {
+			logger.ErrorCF("matrix", "Failed to send media", map[string]interface{}{
+				"media": utils.Truncate(ref, 80),
+				"error": err.Error(),
+			})
+		}
+	}
+
+	if audioPath := c.voiceReply(ctx, msg, voice.FormatOpus); audioPath != "" {
+		err := c.sendFile(ctx, roomID, audioPath, "voice.ogg", "audio/ogg", relation)
+		os.Remove(audioPath)
+		if err == nil {
+			return nil
+		}
+		logger.ErrorCF("matrix", "Failed to send voice reply, falling back to text", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if msg.Content == "" {
+		return nil
+	}
+	content := map[string]interface{}{
+		"msgtype":        "m.text",
+		"body":           msg.Content,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": matrixHTML(msg.Content),
+	}
+	if relation != nil {
+		content["m.relates_to"] = relation
+	}
+	if _, err := c.sendEvent(ctx, roomID, "m.room.message", content); err != nil {
+		return err
+	}
+
+	logger.DebugCF("matrix", "Message sent", map[string]interface{}{
+		"room_id":   roomID,
+		"thread_id": threadRoot,
+	})
+	return nil
+}
+
+// matrixReplyRelation threads a reply under threadRoot, or marks it as a
+// reply to replyTo outside threads.
+func matrixReplyRelation(threadRoot, replyTo string) *matrixRelation {
+	switch {
+	case threadRoot != "":
+		rel := &matrixRelation{RelType: "m.thread", EventID: threadRoot, IsFallingBack: true}
+		rel.InReplyTo = &struct {
+			EventID string `json:"event_id"`
+		}{EventID: threadRoot}
+		if replyTo != "" {
+			rel.InReplyTo.EventID = replyTo
+		}
+		return rel
+	case replyTo != "":
+		rel := &matrixRelation{}
+		rel.InReplyTo = &struct {
+			EventID string `json:"event_id"`
+		}{EventID: replyTo}
+		return rel
+	}
+	return nil
+}
+
+// sendMedia uploads a local file or http(s) URL and posts it to the room.
+func (c *MatrixChannel) sendMedia(ctx context.Context, roomID, ref string, relation *matrixRelation) error {
+	localPath := ref
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		localPath = utils.DownloadFile(ref, filepath.Base(ref), utils.DownloadOptions{LoggerPrefix: "matrix"})
+		if localPath == "" {
+			return fmt.Errorf("download failed")
+		}
+		defer os.Remove(localPath)
+	}
+	name := filepath.Base(localPath)
+	return c.sendFile(ctx, roomID, localPath, name, mime.TypeByExtension(filepath.Ext(name)), relation)
+}
+
+func (c *MatrixChannel) sendFile(ctx context.Context, roomID, path, name, mimeType string, relation *matrixRelation) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(data) > matrixMaxUpload {
+		return permanent(fmt.Errorf("%s is too large to upload (%d bytes)", name, len(data)))
+	}
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+
+	var upload struct {
+		ContentURI string `json:"content_uri"`
+	}
+	uploadPath := "/_matrix/media/v3/upload?filename=" + url.QueryEscape(name)
+	if err := c.doRaw(ctx, http.MethodPost, uploadPath, mimeType, data, &upload); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+
+	msgType := "m.file"
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		msgType = "m.image"
+	case strings.HasPrefix(mimeType, "audio/"):
+		msgType = "m.audio"
+	case strings.HasPrefix(mimeType, "video/"):
+		msgType = "m.video"
+	}
+	content := map[string]interface{}{
+		"msgtype":  msgType,
+		"body":     name,
+		"filename": name,
+		"url":      upload.ContentURI,
+		"info":     map[string]interface{}{"mimetype": mimeType, "size": len(data)},
+	}
+	if relation != nil {
+		content["m.relates_to"] = relation
+	}
+	_, err = c.sendEvent(ctx, roomID, "m.room.message", content)
+	return err
+}
+
+// SupportedEvents lists the outbound events Matrix handles.
+func (c *MatrixChannel) SupportedEvents() []bus.EventType {
+	return []bus.EventType{bus.EventTypingStart, bus.EventTypingStop, bus.EventEdit, bus.EventDelete, bus.EventReaction}
+}
+
+func (c *MatrixChannel) SendEvent(ctx context.Context, ev bus.Event) error {
+	roomID, _ := parseMatrixChatID(ev.ChatID)
+	room := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID)
+	switch ev.Type {
+	case bus.EventTypingStart, bus.EventTypingStop:
+		body := map[string]interface{}{"typing": ev.Type == bus.EventTypingStart}
+		if ev.Type == bus.EventTypingStart {
+			body["timeout"] = matrixTypingTimeout.Milliseconds()
+		}
+		return c.do(ctx, http.MethodPut, room+"/typing/"+url.PathEscape(c.userID), body, nil)
+	case bus.EventEdit:
+		_, err := c.sendEvent(ctx, roomID, "m.room.message", map[string]interface{}{
+			"msgtype":        "m.text",
+			"body":           "* " + ev.Content,
+			"m.new_content":  map[string]string{"msgtype": "m.text", "body": ev.Content},
+			"m.relates_to":   matrixRelation{RelType: "m.replace", EventID: ev.MessageID},
+			"format":         "org.matrix.custom.html",
+			"formatted_body": "* " + matrixHTML(ev.Content),
+		})
+		return err
+	case bus.EventDelete:
+		return c.do(ctx, http.MethodPut, room+"/redact/"+url.PathEscape(ev.MessageID)+"/"+c.nextTxnID(), map[string]string{}, nil)
+	case bus.EventReaction:
+		_, err := c.sendEvent(ctx, roomID, "m.reaction", map[string]interface{}{
+			"m.relates_to": matrixRelation{RelType: "m.annotation", EventID: ev.MessageID, Key: ev.Content},
+		})
+		return err
+	}
+	return nil
+}
+
+// sendEvent sends a room event and returns its event ID.
+func (c *MatrixChannel) sendEvent(ctx context.Context, roomID, eventType string, content interface{}) (string, error) {
+	var resp struct {
+		EventID string `json:"event_id"`
+	}
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID) + "/send/" + eventType + "/" + c.nextTxnID()
+	if err := c.do(ctx, http.MethodPut, path, content, &resp); err != nil {
+		return "", err
+	}
+	return resp.EventID, nil
+}
+
+// nextTxnID returns a transaction ID unique to this process, which lets
+// the homeserver drop duplicates when a request is retried.
+func (c *MatrixChannel) nextTxnID() string {
+	return fmt.Sprintf("%s.%d", c.txnPrefix, c.txnSeq.Add(1))
+}
+
+// do sends a JSON request to the homeserver and decodes the JSON reply.
+func (c *MatrixChannel) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	return c.doRaw(ctx, method, path, "application/json", data, out)
+}
+
+func (c *MatrixChannel) doRaw(ctx context.Context, method, path, contentType string, data []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.config.Homeserver+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+	if data != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		mErr := &matrixError{Status: resp.StatusCode}
+		json.Unmarshal(respBody, mErr)
+		// A bad request, a room we are not in or a revoked token will not
+		// get better by retrying.
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return permanent(mErr)
+		}
+		return mErr
+	}
+	if out != nil {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
+
+func parseMatrixChatID(chatID string) (roomID, threadRoot string) {
+	roomID, threadRoot, _ = strings.Cut(chatID, "/")
+	return roomID, threadRoot
+}
+
+// matrixHTML renders the agent's Markdown as the HTML subset Matrix
+// clients show, keeping line breaks outside code blocks.
+func matrixHTML(text string) string {
+	html := markdownToTelegramHTML(text)
+	var sb strings.Builder
+	for html != "" {
+		start := strings.Index(html, "<pre>")
+		if start < 0 {
+			sb.WriteString(strings.ReplaceAll(html, "\n", "<br>"))
+			break
+		}
+		sb.WriteString(strings.ReplaceAll(html[:start], "\n", "<br>"))
+		end := strings.Index(html[start:], "</pre>")
+		if end < 0 {
+			sb.WriteString(html[start:])
+			break
+		}
+		end += start + len("</pre>")
+		sb.WriteString(html[start:end])
+		html = html[end:]
+	}
+	return sb.String()
+}
@@ -0,0 +1,224 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeHomeserver stands in for a Matrix homeserver: /sync hands out the
+// batches queued on batches, and every other request is recorded.
+type fakeHomeserver struct {
+	*httptest.Server
+	batches chan string
+
+	mu       sync.Mutex
+	requests []fakeMatrixRequest
+}
+
+type fakeMatrixRequest struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+func newFakeHomeserver(t *testing.T, initial string) *fakeHomeserver {
+	t.Helper()
+	hs := &fakeHomeserver{batches: make(chan string, 10)}
+	hs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"errcode":"M_UNKNOWN_TOKEN","error":"bad token"}`)
+			return
+		}
+		switch {
+		case r.URL.Path == "/_matrix/client/v3/account/whoami":
+			io.WriteString(w, `{"user_id":"@bot:hs"}`)
+		case r.URL.Path == "/_matrix/client/v3/sync":
+			if r.URL.Query().Get("since") == "" {
+				io.WriteString(w, initial)
+				return
+			}
+			select {
+			case batch := <-hs.batches:
+				io.WriteString(w, batch)
+			case <-r.Context().Done():
+			case <-time.After(200 * time.Millisecond):
+				io.WriteString(w, `{"next_batch":"s"}`)
+			}
+		case strings.HasPrefix(r.URL.Path, "/_matrix/client/v1/media/download/"):
+			png.Encode(w, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+		case r.URL.Path == "/_matrix/media/v3/upload":
+			hs.record(r, nil)
+			io.WriteString(w, `{"content_uri":"mxc://hs/up1"}`)
+		case strings.Contains(r.URL.Path, "/rooms/!forbidden:hs/"):
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"errcode":"M_FORBIDDEN","error":"not in room"}`)
+		default:
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			hs.record(r, body)
+			io.WriteString(w, `{"event_id":"$sent"}`)
+		}
+	}))
+	t.Cleanup(hs.Close)
+	return hs
+}
+
+func (hs *fakeHomeserver) record(r *http.Request, body map[string]interface{}) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.requests = append(hs.requests, fakeMatrixRequest{Method: r.Method, Path: r.URL.Path, Body: body})
+}
+
+// waitFor returns the first recorded request whose path contains fragment.
+func (hs *fakeHomeserver) waitFor(t *testing.T, fragment string) fakeMatrixRequest {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		hs.mu.Lock()
+		for _, req := range hs.requests {
+			if strings.Contains(req.Path, fragment) {
+				hs.mu.Unlock()
+				return req
+			}
+		}
+		hs.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no request to %q", fragment)
+	return fakeMatrixRequest{}
+}
+
+func startTestMatrix(t *testing.T, hs *fakeHomeserver, cfg config.MatrixConfig) (*MatrixChannel, *bus.MessageBus) {
+	t.Helper()
+	mb := newTestBus(t)
+	cfg.Homeserver = hs.URL
+	cfg.AccessToken = "tok"
+	c, err := NewMatrixChannel(cfg, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startTestChannel(t, c)
+	return c, mb
+}
+
+func TestMatrixSyncAndThreadedReply(t *testing.T) {
+	hs := newFakeHomeserver(t, `{"next_batch":"s1","rooms":{
+		"join":{"!room:hs":{"timeline":{"events":[
+			{"type":"m.room.message","event_id":"$old","sender":"@alice:hs","content":{"msgtype":"m.text","body":"backlog"}}]}}},
+		"invite":{"!new:hs":{"invite_state":{"events":[
+			{"type":"m.room.member","sender":"@alice:hs","state_key":"@bot:hs","content":{"membership":"invite"}}]}},
+		          "!spam:hs":{"invite_state":{"events":[
+			{"type":"m.room.member","sender":"@mallory:hs","state_key":"@bot:hs","content":{"membership":"invite"}}]}}}}}`)
+	c, mb := startTestMatrix(t, hs, config.MatrixConfig{
+		AutoJoin:      true,
+		ThreadReplies: true,
+		AllowFrom:     config.FlexibleStringSlice{"@alice:hs"},
+	})
+
+	hs.waitFor(t, "/rooms/!new:hs/join")
+
+	hs.batches <- `{"next_batch":"s2","rooms":{"join":{"!room:hs":{"timeline":{"events":[
+		{"type":"m.room.message","event_id":"$m0","sender":"@mallory:hs","content":{"msgtype":"m.text","body":"ignore me"}},
+		{"type":"m.room.message","event_id":"$m1","sender":"@bot:hs","content":{"msgtype":"m.text","body":"my own"}},
+		{"type":"m.room.message","event_id":"$m2","sender":"@alice:hs","content":{"msgtype":"m.notice","body":"a bot"}},
+		{"type":"m.room.message","event_id":"$m3","sender":"@alice:hs","content":{"msgtype":"m.text","body":"hello bot"}}]}}}}}`
+
+	in := nextInbound(t, mb)
+	if in.ChatID != "!room:hs/$m3" || in.Content != "hello bot" || in.SenderID != "@alice:hs" {
+		t.Fatalf("inbound = %+v", in)
+	}
+	if in.Metadata["message_id"] != "$m3" || in.Metadata["room_id"] != "!room:hs" {
+		t.Errorf("metadata = %v", in.Metadata)
+	}
+
+	if err := c.Send(context.Background(), bus.OutboundMessage{Channel: "matrix", ChatID: in.ChatID, Content: "**hi**"}); err != nil {
+		t.Fatal(err)
+	}
+	sent := hs.waitFor(t, "/rooms/!room:hs/send/m.room.message/")
+	if sent.Method != http.MethodPut || sent.Body["body"] != "**hi**" || sent.Body["formatted_body"] != "<b>hi</b>" {
+		t.Errorf("sent = %+v", sent)
+	}
+	rel, _ := sent.Body["m.relates_to"].(map[string]interface{})
+	if rel["rel_type"] != "m.thread" || rel["event_id"] != "$m3" {
+		t.Errorf("relation = %v", rel)
+	}
+
+	if err := c.SendEvent(context.Background(), bus.Event{Type: bus.EventTypingStart, ChatID: in.ChatID}); err != nil {
+		t.Fatal(err)
+	}
+	typing := hs.waitFor(t, "/rooms/!room:hs/typing/@bot:hs")
+	if typing.Body["typing"] != true {
+		t.Errorf("typing = %+v", typing)
+	}
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	for _, req := range hs.requests {
+		if strings.Contains(req.Path, "!spam:hs") {
+			t.Errorf("joined a room a stranger invited us to: %s", req.Path)
+		}
+	}
+	if inbound, _, _ := mb.QueueDepths(); inbound != 0 {
+		t.Errorf("%d unexpected inbound messages", inbound)
+	}
+}
+
+func TestMatrixMedia(t *testing.T) {
+	hs := newFakeHomeserver(t, `{"next_batch":"s1"}`)
+	c, mb := startTestMatrix(t, hs, config.MatrixConfig{})
+
+	hs.batches <- `{"next_batch":"s2","rooms":{"join":{"!room:hs":{"timeline":{"events":[
+		{"type":"m.room.message","event_id":"$img","sender":"@alice:hs","content":{
+			"msgtype":"m.image","body":"look at this","filename":"cat.png","url":"mxc://hs/abc","info":{"mimetype":"image/png"}}}]}}}}}`
+
+	in := nextInbound(t, mb)
+	if in.ChatID != "!room:hs" || in.Content != "look at this\n[image: cat.png]" ||
+		len(in.Media) != 1 || !strings.HasPrefix(in.Media[0], "data:image/png;base64,") {
+		t.Fatalf("inbound = %+v", in)
+	}
+
+	path := filepath.Join(t.TempDir(), "chart.png")
+	os.WriteFile(path, []byte("\x89PNG\r\n\x1a\nchart"), 0o644)
+	if err := c.Send(context.Background(), bus.OutboundMessage{Channel: "matrix", ChatID: "!room:hs", Media: []string{path}}); err != nil {
+		t.Fatal(err)
+	}
+	hs.waitFor(t, "/_matrix/media/v3/upload")
+	sent := hs.waitFor(t, "/rooms/!room:hs/send/m.room.message/")
+	if sent.Body["msgtype"] != "m.image" || sent.Body["url"] != "mxc://hs/up1" || sent.Body["body"] != "chart.png" {
+		t.Errorf("sent = %+v", sent)
+	}
+}
+
+func TestMatrixSendErrors(t *testing.T) {
+	hs := newFakeHomeserver(t, `{"next_batch":"s1"}`)
+	c, _ := startTestMatrix(t, hs, config.MatrixConfig{})
+
+	for _, chatID := range []string{"!forbidden:hs", "not-a-room"} {
+		assertPermanentSendError(t, c, chatID)
+	}
+}
+
+func TestStripMatrixReplyFallback(t *testing.T) {
+	text, quoted := stripMatrixReplyFallback("> <@alice:hs> what time is it?\n> in Berlin\n\nmidnight")
+	if text != "midnight" || quoted != "what time is it?\nin Berlin" {
+		t.Errorf("got %q, %q", text, quoted)
+	}
+	if text, quoted := stripMatrixReplyFallback("no quote"); text != "no quote" || quoted != "" {
+		t.Errorf("got %q, %q", text, quoted)
+	}
+}
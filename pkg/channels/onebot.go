@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,6 +15,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 type OneBotChannel struct {
@@ -68,6 +70,7 @@ type oneBotEvent struct {
 	GroupID        int64
 	Content        string
 	RawContent     string
+	ImageURLs      []string
 	IsBotMentioned bool
 	Sender         oneBotSender
 	SelfID         int64
@@ -386,6 +389,42 @@ func parseJSONString(raw json.RawMessage) string {
 type parseMessageResult struct {
 	Text           string
 	IsBotMentioned bool
+	ImageURLs      []string
+}
+
+var reCQImage = regexp.MustCompile(`\[CQ:image,([^\]]*)\]`)
+
+var cqUnescaper = strings.NewReplacer("&#44;", ",", "&#91;", "[", "&#93;", "]", "&amp;", "&")
+
+// extractCQImages replaces [CQ:image,...] codes with "[image]" and returns
+// the image URLs they reference.
+func extractCQImages(s string) (string, []string) {
+	var urls []string
+	s = reCQImage.ReplaceAllStringFunc(s, func(code string) string {
+		params := map[string]string{}
+		for _, kv := range strings.Split(reCQImage.FindStringSubmatch(code)[1], ",") {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				params[k] = cqUnescaper.Replace(v)
+			}
+		}
+		if u := oneBotImageURL(params["url"], params["file"]); u != "" {
+			urls = append(urls, u)
+		}
+		return "[image]"
+	})
+	return s, urls
+}
+
+// oneBotImageURL picks the downloadable reference of an image segment: url,
+// or file when the implementation puts the URL there.
+func oneBotImageURL(url, file string) string {
+	if url != "" {
+		return url
+	}
+	if strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://") {
+		return file
+	}
+	return ""
 }
 
 func parseMessageContentEx(raw json.RawMessage, selfID int64) parseMessageResult {
@@ -404,12 +443,14 @@ func parseMessageContentEx(raw json.RawMessage, selfID int64) parseMessageResult
 				s = strings.TrimSpace(s)
 			}
 		}
-		return parseMessageResult{Text: s, IsBotMentioned: mentioned}
+		s, images := extractCQImages(s)
+		return parseMessageResult{Text: strings.TrimSpace(s), IsBotMentioned: mentioned, ImageURLs: images}
 	}
 
 	var segments []map[string]interface{}
 	if err := json.Unmarshal(raw, &segments); err == nil {
 		var text string
+		var images []string
 		mentioned := false
 		selfIDStr := strconv.FormatInt(selfID, 10)
 		for _, seg := range segments {
@@ -422,6 +463,15 @@ func parseMessageContentEx(raw json.RawMessage, selfID int64) parseMessageResult
 						text += t
 					}
 				}
+			case "image":
+				if data != nil {
+					u, _ := data["url"].(string)
+					f, _ := data["file"].(string)
+					if img := oneBotImageURL(u, f); img != "" {
+						images = append(images, img)
+					}
+					text += "[image]"
+				}
 			case "at":
 				if data != nil && selfID > 0 {
 					qqVal := fmt.Sprintf("%v", data["qq"])
@@ -431,7 +481,7 @@ func parseMessageContentEx(raw json.RawMessage, selfID int64) parseMessageResult
 				}
 			}
 		}
-		return parseMessageResult{Text: strings.TrimSpace(text), IsBotMentioned: mentioned}
+		return parseMessageResult{Text: strings.TrimSpace(text), IsBotMentioned: mentioned, ImageURLs: images}
 	}
 	return parseMessageResult{}
 }
@@ -484,15 +534,23 @@ func (c *OneBotChannel) normalizeMessageEvent(raw *oneBotRawEvent) (*oneBotEvent
 	isBotMentioned := parsed.IsBotMentioned
 
 	content := raw.RawMessage
+	imageURLs := parsed.ImageURLs
 	if content == "" {
 		content = parsed.Text
-	} else if selfID > 0 {
-		cqAt := fmt.Sprintf("[CQ:at,qq=%d]", selfID)
-		if strings.Contains(content, cqAt) {
-			isBotMentioned = true
-			content = strings.ReplaceAll(content, cqAt, "")
-			content = strings.TrimSpace(content)
+	} else {
+		var cqImages []string
+		content, cqImages = extractCQImages(content)
+		if len(imageURLs) == 0 {
+			imageURLs = cqImages
 		}
+		if selfID > 0 {
+			cqAt := fmt.Sprintf("[CQ:at,qq=%d]", selfID)
+			if strings.Contains(content, cqAt) {
+				isBotMentioned = true
+				content = strings.ReplaceAll(content, cqAt, "")
+			}
+		}
+		content = strings.TrimSpace(content)
 	}
 
 	var sender oneBotSender
@@ -523,6 +581,7 @@ func (c *OneBotChannel) normalizeMessageEvent(raw *oneBotRawEvent) (*oneBotEvent
 		GroupID:        groupID,
 		Content:        content,
 		RawContent:     raw.RawMessage,
+		ImageURLs:      imageURLs,
 		IsBotMentioned: isBotMentioned,
 		Sender:         sender,
 		SelfID:         selfID,
@@ -635,7 +694,16 @@ func (c *OneBotChannel) handleMessage(evt *oneBotEvent) {
 		"content":   truncate(content, 100),
 	})
 
-	c.HandleMessage(senderID, chatID, content, []string{}, metadata)
+	// QQ image URLs carry no file extension, so download them for sniffing
+	var media []string
+	for _, u := range evt.ImageURLs {
+		if localPath := utils.DownloadFile(u, "image", utils.DownloadOptions{LoggerPrefix: "onebot"}); localPath != "" {
+			media = append(media, localPath)
+		}
+	}
+	defer removeFiles(media)
+
+	c.HandleMessage(senderID, chatID, content, media, metadata)
 }
 
 func (c *OneBotChannel) isDuplicate(messageID string) bool {
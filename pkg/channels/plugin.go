@@ -0,0 +1,534 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Plugin channel protocol
+//
+// A plugin channel is an adapter running out of process, in any language,
+// that bridges one chat platform to the gateway. The gateway either dials
+// the adapter's WebSocket (channels.plugins[].url, with the token sent as
+// "Authorization: Bearer <token>") or starts it as a child process
+// (channels.plugins[].command) and talks over stdin and stdout. Each
+// WebSocket text message, or each line on stdio, is one JSON frame with a
+// "type". Anything the adapter writes to stderr is logged.
+//
+// On connect the gateway sends
+//
+//	{"type":"hello","protocol":1,"name":"<channel name>"}
+//
+// and the adapter answers with its own hello declaring what it supports:
+//
+//	{"type":"hello","protocol":1,"events":["typing_start","typing_stop","reaction"],"rich":true}
+//
+// events lists the outbound event types it handles (see bus.EventType);
+// rich means it renders buttons, choices and cards itself, otherwise they
+// arrive flattened to numbered text. Both default to none.
+//
+// Adapter to gateway:
+//
+//	{"type":"message","sender_id":"u1","chat_id":"c1","content":"hi","media":["/tmp/a.jpg"],
+//	 "message_id":"m1","reply_to_id":"m0","quoted_text":"...","metadata":{"username":"ann"}}
+//	{"type":"event","sender_id":"u1","event":{"type":"choice","chat_id":"c1","content":"yes"}}
+//	{"type":"result","id":"7"}
+//	{"type":"result","id":"8","error":"chat not found","permanent":true}
+//
+// Gateway to adapter:
+//
+//	{"type":"send","id":"7","message":{"chat_id":"c1","content":"hello","reply_to":"m1",...}}
+//	{"type":"event","event":{"type":"typing_start","chat_id":"c1"}}
+//
+// Every send must be answered with a result carrying the same id. A result
+// with an error is retried with backoff unless it is marked permanent.
+// Senders are checked against the plugin's allow_from before anything
+// reaches the agent. When the connection drops the gateway reconnects, or
+// restarts the command, with backoff.
+
+const (
+	pluginProtocol = 1
+
+	// pluginMaxBackoff caps the wait between reconnects.
+	pluginMaxBackoff = 30 * time.Second
+)
+
+// pluginFrame is one protocol frame in either direction.
+type pluginFrame struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+
+	// hello
+	Protocol int             `json:"protocol,omitempty"`
+	Name     string          `json:"name,omitempty"`
+	Events   []bus.EventType `json:"events,omitempty"`
+	Rich     bool            `json:"rich,omitempty"`
+
+	// message and inbound event
+	SenderID   string            `json:"sender_id,omitempty"`
+	ChatID     string            `json:"chat_id,omitempty"`
+	Content    string            `json:"content,omitempty"`
+	Media      []string          `json:"media,omitempty"`
+	MessageID  string            `json:"message_id,omitempty"`
+	ReplyToID  string            `json:"reply_to_id,omitempty"`
+	QuotedText string            `json:"quoted_text,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Event      *bus.Event        `json:"event,omitempty"`
+
+	// send
+	Message *bus.OutboundMessage `json:"message,omitempty"`
+
+	// result
+	Error     string `json:"error,omitempty"`
+	Permanent bool   `json:"permanent,omitempty"`
+}
+
+// pluginConn is a frame transport to an adapter.
+type pluginConn interface {
+	read() ([]byte, error)
+	write(data []byte) error
+	close() error
+}
+
+type PluginChannel struct {
+	*BaseChannel
+	config config.PluginChannelConfig
+	cancel context.CancelFunc
+	seq    atomic.Int64
+
+	mu      sync.Mutex
+	conn    pluginConn
+	events  []bus.EventType
+	rich    bool
+	pending map[string]chan pluginFrame
+
+	writeMu sync.Mutex
+}
+
+func NewPluginChannel(cfg config.PluginChannelConfig, messageBus *bus.MessageBus) (*PluginChannel, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("plugin channel name is required")
+	}
+	if (cfg.URL == "") == (len(cfg.Command) == 0) {
+		return nil, fmt.Errorf("plugin channel %s needs exactly one of url or command", cfg.Name)
+	}
+
+	return &PluginChannel{
+		BaseChannel: NewBaseChannel(cfg.Name, cfg, messageBus, cfg.AllowFrom),
+		config:      cfg,
+		pending:     make(map[string]chan pluginFrame),
+	}, nil
+}
+
+// Start connects in the background and keeps reconnecting until Stop, so a
+// slow or crashed adapter does not hold up the other channels.
+func (c *PluginChannel) Start(ctx context.Context) error {
+	ctx, c.cancel = context.WithCancel(ctx)
+	go c.run(ctx)
+	c.setRunning(true)
+
+	logger.InfoCF("plugin", "Plugin channel started", map[string]interface{}{
+		"channel": c.Name(),
+	})
+	return nil
+}
+
+func (c *PluginChannel) Stop(ctx context.Context) error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		conn.close()
+	}
+	c.setRunning(false)
+	return nil
+}
+
+func (c *PluginChannel) run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		conn, err := c.connect(ctx)
+		if err == nil {
+			backoff = time.Second
+			c.serve(ctx, conn)
+		} else if ctx.Err() == nil {
+			logger.WarnCF("plugin", "Failed to connect to plugin adapter", map[string]interface{}{
+				"channel": c.Name(),
+				"error":   err.Error(),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, pluginMaxBackoff)
+	}
+}
+
+func (c *PluginChannel) connect(ctx context.Context) (pluginConn, error) {
+	if c.config.URL != "" {
+		return dialPluginWebSocket(ctx, c.config.URL, c.config.Token)
+	}
+	return startPluginCommand(ctx, c.Name(), c.config.Command)
+}
+
+// serve reads frames from conn until it fails, then fails the sends still
+// waiting on it.
+func (c *PluginChannel) serve(ctx context.Context, conn pluginConn) {
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+
+	defer func() {
+		conn.close()
+		c.mu.Lock()
+		c.conn = nil
+		c.events, c.rich = nil, false
+		for id, ch := range c.pending {
+			ch <- pluginFrame{Type: "result", ID: id, Error: "plugin adapter disconnected"}
+			delete(c.pending, id)
+		}
+		c.mu.Unlock()
+	}()
+
+	if err := c.writeFrame(pluginFrame{Type: "hello", Protocol: pluginProtocol, Name: c.Name()}); err != nil {
+		return
+	}
+
+	// Messages are handled in order off the read loop, so a slow voice
+	// transcription never holds up the results pending sends wait on.
+	inbound := make(chan pluginFrame, 64)
+	defer close(inbound)
+	go func() {
+		for frame := range inbound {
+			c.handleIncomingMessage(ctx, frame)
+		}
+	}()
+
+	for {
+		data, err := conn.read()
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.WarnCF("plugin", "Plugin adapter disconnected", map[string]interface{}{
+					"channel": c.Name(),
+					"error":   err.Error(),
+				})
+			}
+			return
+		}
+
+		var frame pluginFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			logger.WarnCF("plugin", "Invalid frame from plugin adapter", map[string]interface{}{
+				"channel": c.Name(),
+				"error":   err.Error(),
+			})
+			continue
+		}
+		c.handleFrame(ctx, frame, inbound)
+	}
+}
+
+func (c *PluginChannel) handleFrame(ctx context.Context, frame pluginFrame, inbound chan<- pluginFrame) {
+	switch frame.Type {
+	case "hello":
+		if frame.Protocol > pluginProtocol {
+			logger.WarnCF("plugin", "Plugin adapter speaks a newer protocol", map[string]interface{}{
+				"channel":  c.Name(),
+				"protocol": frame.Protocol,
+			})
+		}
+		c.mu.Lock()
+		c.events, c.rich = frame.Events, frame.Rich
+		c.mu.Unlock()
+		logger.InfoCF("plugin", "Plugin adapter connected", map[string]interface{}{
+			"channel": c.Name(),
+			"events":  len(frame.Events),
+			"rich":    frame.Rich,
+		})
+
+	case "message":
+		if frame.SenderID == "" || frame.ChatID == "" {
+			logger.WarnCF("plugin", "Plugin message without sender_id or chat_id", map[string]interface{}{
+				"channel": c.Name(),
+			})
+			return
+		}
+		// Check the allowlist before transcribing anything the sender attached.
+		if !c.IsAllowed(frame.SenderID) {
+			logger.DebugCF("plugin", "Message rejected by allowlist", map[string]interface{}{
+				"channel":   c.Name(),
+				"sender_id": frame.SenderID,
+			})
+			return
+		}
+		select {
+		case inbound <- frame:
+		case <-ctx.Done():
+		}
+
+	case "event":
+		if frame.Event == nil || frame.Event.ChatID == "" {
+			return
+		}
+		c.HandleEvent(frame.SenderID, *frame.Event, frame.Metadata)
+
+	case "result":
+		c.mu.Lock()
+		ch, ok := c.pending[frame.ID]
+		delete(c.pending, frame.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- frame
+		}
+
+	default:
+		logger.DebugCF("plugin", "Ignoring unknown plugin frame", map[string]interface{}{
+			"channel": c.Name(),
+			"type":    frame.Type,
+		})
+	}
+}
+
+func (c *PluginChannel) handleIncomingMessage(ctx context.Context, frame pluginFrame) {
+	content := frame.Content
+
+	// Like the WhatsApp bridge, adapters hand over voice notes as local
+	// files; transcribe them so the agent gets text.
+	hasAudio := false
+	for _, path := range frame.Media {
+		if utils.IsAudioFile(path, "") {
+			hasAudio = true
+			content = appendContent(content, c.transcribeAudio(ctx, path, "voice"))
+		}
+	}
+	c.markVoiceInput(frame.ChatID, hasAudio)
+
+	metadata := make(map[string]string, len(frame.Metadata)+3)
+	for k, v := range frame.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range map[string]string{
+		"message_id":  frame.MessageID,
+		"reply_to_id": frame.ReplyToID,
+		"quoted_text": frame.QuotedText,
+	} {
+		if v != "" {
+			metadata[k] = v
+		}
+	}
+
+	logger.DebugCF("plugin", "Received message", map[string]interface{}{
+		"channel":   c.Name(),
+		"sender_id": frame.SenderID,
+		"chat_id":   frame.ChatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(frame.SenderID, frame.ChatID, content, frame.Media, metadata)
+}
+
+// Send hands msg to the adapter and waits for its result.
+func (c *PluginChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	id := fmt.Sprintf("%d", c.seq.Add(1))
+	result := make(chan pluginFrame, 1)
+
+	c.mu.Lock()
+	if c.conn == nil {
+		c.mu.Unlock()
+		return fmt.Errorf("plugin %s not connected", c.Name())
+	}
+	c.pending[id] = result
+	c.mu.Unlock()
+
+	if err := c.writeFrame(pluginFrame{Type: "send", ID: id, Message: &msg}); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return err
+	}
+
+	select {
+	case res := <-result:
+		if res.Error == "" {
+			return nil
+		}
+		err := fmt.Errorf("plugin %s: %s", c.Name(), res.Error)
+		if res.Permanent {
+			return permanent(err)
+		}
+		return err
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// SupportedEvents returns the event types the adapter declared in its hello.
+func (c *PluginChannel) SupportedEvents() []bus.EventType {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]bus.EventType(nil), c.events...)
+}
+
+func (c *PluginChannel) SendEvent(ctx context.Context, ev bus.Event) error {
+	return c.writeFrame(pluginFrame{Type: "event", Event: &ev})
+}
+
+// RendersRich reports whether the adapter declared it renders buttons,
+// choices and cards itself.
+func (c *PluginChannel) RendersRich() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rich
+}
+
+func (c *PluginChannel) writeFrame(frame pluginFrame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plugin frame: %w", err)
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return fmt.Errorf("plugin %s not connected", c.Name())
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := conn.write(data); err != nil {
+		return fmt.Errorf("failed to write to plugin %s: %w", c.Name(), err)
+	}
+	return nil
+}
+
+// wsPluginConn carries frames as WebSocket text messages.
+type wsPluginConn struct {
+	conn *websocket.Conn
+	once sync.Once
+}
+
+func dialPluginWebSocket(ctx context.Context, url, token string) (*wsPluginConn, error) {
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	conn, _, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+	return &wsPluginConn{conn: conn}, nil
+}
+
+func (w *wsPluginConn) read() ([]byte, error) {
+	_, data, err := w.conn.ReadMessage()
+	return data, err
+}
+
+func (w *wsPluginConn) write(data []byte) error {
+	return w.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (w *wsPluginConn) close() error {
+	var err error
+	w.once.Do(func() { err = w.conn.Close() })
+	return err
+}
+
+// stdioPluginConn carries frames as JSON lines over a child process's
+// stdin and stdout.
+type stdioPluginConn struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	out   *bufio.Scanner
+	once  sync.Once
+}
+
+func startPluginCommand(ctx context.Context, name string, command []string) (*stdioPluginConn, error) {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting plugin command: %w", err)
+	}
+
+	go func() {
+		lines := bufio.NewScanner(stderr)
+		for lines.Scan() {
+			logger.InfoCF("plugin", lines.Text(), map[string]interface{}{
+				"channel": name,
+			})
+		}
+	}()
+
+	out := bufio.NewScanner(stdout)
+	out.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &stdioPluginConn{cmd: cmd, stdin: stdin, out: out}, nil
+}
+
+func (s *stdioPluginConn) read() ([]byte, error) {
+	if s.out.Scan() {
+		return s.out.Bytes(), nil
+	}
+	if err := s.out.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (s *stdioPluginConn) write(data []byte) error {
+	_, err := s.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// close ends the adapter process; a restart starts a fresh one.
+func (s *stdioPluginConn) close() error {
+	var err error
+	s.once.Do(func() {
+		s.stdin.Close()
+		s.cmd.Process.Kill()
+		err = s.cmd.Wait()
+	})
+	return err
+}
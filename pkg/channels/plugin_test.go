@@ -0,0 +1,116 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeAdapter is a plugin adapter that declares typing support, forwards
+// one user message and fails sends to chat "gone".
+func fakeAdapter(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var hello pluginFrame
+		if err := conn.ReadJSON(&hello); err != nil || hello.Type != "hello" || hello.Name != "matrixish" {
+			t.Errorf("gateway hello = %+v, %v", hello, err)
+			return
+		}
+		conn.WriteJSON(pluginFrame{Type: "hello", Protocol: 1, Events: []bus.EventType{bus.EventTypingStart}})
+		conn.WriteJSON(pluginFrame{Type: "message", SenderID: "blocked", ChatID: "room1", Content: "ignored"})
+		conn.WriteJSON(pluginFrame{Type: "message", SenderID: "ann", ChatID: "room1", Content: "hi", MessageID: "e1"})
+
+		for {
+			var frame pluginFrame
+			if err := conn.ReadJSON(&frame); err != nil {
+				return
+			}
+			if frame.Type != "send" {
+				continue
+			}
+			res := pluginFrame{Type: "result", ID: frame.ID}
+			if frame.Message.ChatID == "gone" {
+				res.Error, res.Permanent = "room not found", true
+			}
+			conn.WriteJSON(res)
+		}
+	}))
+}
+
+func TestPluginChannelRoundTrip(t *testing.T) {
+	srv := fakeAdapter(t)
+	defer srv.Close()
+
+	mb := bus.NewMessageBus()
+	defer mb.Close()
+	ch, err := NewPluginChannel(config.PluginChannelConfig{
+		Name:      "matrixish",
+		URL:       "ws" + strings.TrimPrefix(srv.URL, "http"),
+		Token:     "secret",
+		AllowFrom: config.FlexibleStringSlice{"ann"},
+	}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch.Start(ctx)
+	defer ch.Stop(ctx)
+
+	in, ok := mb.ConsumeInbound(ctx)
+	if !ok || in.Channel != "matrixish" || in.SenderID != "ann" || in.Content != "hi" || in.MessageID != "e1" {
+		t.Fatalf("inbound = %+v", in)
+	}
+	if !SupportsEvent(ch, bus.EventTypingStart) || ch.RendersRich() {
+		t.Errorf("capabilities = %v, rich %v", ch.SupportedEvents(), ch.RendersRich())
+	}
+
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "room1", Content: "hello"}); err != nil {
+		t.Errorf("Send: %v", err)
+	}
+	err = ch.Send(ctx, bus.OutboundMessage{ChatID: "gone", Content: "hello"})
+	if perm, _ := classifySendError(err); !perm {
+		t.Errorf("Send to a missing room = %v, want a permanent error", err)
+	}
+}
+
+func TestNewPluginChannelValidatesTransport(t *testing.T) {
+	for _, cfg := range []config.PluginChannelConfig{
+		{URL: "ws://localhost:1"},
+		{Name: "x"},
+		{Name: "x", URL: "ws://localhost:1", Command: []string{"adapter"}},
+	} {
+		if _, err := NewPluginChannel(cfg, nil); err == nil {
+			t.Errorf("NewPluginChannel(%+v) should fail", cfg)
+		}
+	}
+}
+
+func TestPluginFrameWireFormat(t *testing.T) {
+	data, _ := json.Marshal(pluginFrame{Type: "send", ID: "7", Message: &bus.OutboundMessage{ChatID: "c1", Content: "hi"}})
+	var got map[string]interface{}
+	json.Unmarshal(data, &got)
+	msg, _ := got["message"].(map[string]interface{})
+	if got["type"] != "send" || got["id"] != "7" || msg["chat_id"] != "c1" || len(got) != 3 {
+		t.Errorf("send frame = %s", data)
+	}
+}
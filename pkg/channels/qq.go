@@ -3,6 +3,7 @@ package channels
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,7 +16,9 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/documents"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 type QQChannel struct {
@@ -152,7 +155,12 @@ func (c *QQChannel) handleC2CMessage() event.C2CMessageEventHandler {
 
 		// 提取消息内容
 		content := data.Content
-		if content == "" {
+		media, notes, localFiles := c.downloadAttachments(data.Attachments)
+		defer removeFiles(localFiles)
+		for _, note := range notes {
+			content = appendContent(content, note)
+		}
+		if content == "" && len(media) == 0 {
 			logger.DebugC("qq", "Received empty message, ignoring")
 			return nil
 		}
@@ -167,7 +175,7 @@ func (c *QQChannel) handleC2CMessage() event.C2CMessageEventHandler {
 			"message_id": data.ID,
 		}
 
-		c.HandleMessage(senderID, senderID, content, []string{}, metadata)
+		c.HandleMessage(senderID, senderID, content, media, metadata)
 
 		return nil
 	}
@@ -192,7 +200,12 @@ func (c *QQChannel) handleGroupATMessage() event.GroupATMessageEventHandler {
 
 		// 提取消息内容（去掉 @ 机器人部分）
 		content := data.Content
-		if content == "" {
+		media, notes, localFiles := c.downloadAttachments(data.Attachments)
+		defer removeFiles(localFiles)
+		for _, note := range notes {
+			content = appendContent(content, note)
+		}
+		if content == "" && len(media) == 0 {
 			logger.DebugC("qq", "Received empty group message, ignoring")
 			return nil
 		}
@@ -209,12 +222,46 @@ func (c *QQChannel) handleGroupATMessage() event.GroupATMessageEventHandler {
 			"group_id":   data.GroupID,
 		}
 
-		c.HandleMessage(senderID, data.GroupID, content, []string{}, metadata)
+		c.HandleMessage(senderID, data.GroupID, content, media, metadata)
 
 		return nil
 	}
 }
 
+// downloadAttachments 下载消息中的图片和文档附件：图片作为媒体返回，文档入库后以说明文字返回
+func (c *QQChannel) downloadAttachments(attachments []*dto.MessageAttachment) (media, notes, localFiles []string) {
+	for _, att := range attachments {
+		if att == nil || att.URL == "" {
+			continue
+		}
+		isImage := utils.IsImageFile(att.FileName, att.ContentType)
+		if !isImage && !documents.Supported(att.FileName, att.ContentType) {
+			continue
+		}
+
+		url := att.URL
+		if strings.HasPrefix(url, "//") {
+			url = "https:" + url
+		}
+		filename := att.FileName
+		if filename == "" {
+			filename = "image.jpg"
+		}
+
+		localPath := utils.DownloadFile(url, filename, utils.DownloadOptions{LoggerPrefix: "qq"})
+		if localPath == "" {
+			continue
+		}
+		localFiles = append(localFiles, localPath)
+		if isImage {
+			media = append(media, localPath)
+		} else if note := c.ingestDocument(localPath, att.FileName, att.ContentType); note != "" {
+			notes = append(notes, note)
+		}
+	}
+	return media, notes, localFiles
+}
+
 // isDuplicate 检查消息是否重复
 func (c *QQChannel) isDuplicate(messageID string) bool {
 	c.mu.Lock()
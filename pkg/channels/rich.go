@@ -0,0 +1,102 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// RichRenderer is implemented by channels that render buttons, choices
+// and cards natively and report picks as EventChoice. Other channels get
+// them flattened to text with numbered options, and a reply with just the
+// number is turned into the same choice event.
+type RichRenderer interface {
+	RendersRich() bool
+}
+
+// choiceExpecter remembers the numbered options last shown in a chat.
+// BaseChannel provides it.
+type choiceExpecter interface {
+	expectChoices(chatID string, options []bus.Button)
+}
+
+// flattenRich renders a rich message as plain text for channels without
+// native support.
+func flattenRich(channel Channel, msg bus.OutboundMessage) bus.OutboundMessage {
+	if r, ok := channel.(RichRenderer); ok && r.RendersRich() {
+		return msg
+	}
+
+	options := richOptions(msg)
+	if e, ok := channel.(choiceExpecter); ok && len(options) > 0 {
+		e.expectChoices(msg.ChatID, options)
+	}
+	msg.Content = renderRichText(msg)
+	msg.Buttons, msg.Choices, msg.Card = nil, nil, nil
+	return msg
+}
+
+// richOptions returns a message's buttons followed by its choices.
+func richOptions(msg bus.OutboundMessage) []bus.Button {
+	return append(append([]bus.Button(nil), msg.Buttons...), msg.Choices...)
+}
+
+// renderRichText appends the card and numbered options to the content.
+func renderRichText(msg bus.OutboundMessage) string {
+	var parts []string
+	if msg.Content != "" {
+		parts = append(parts, msg.Content)
+	}
+	if card := msg.Card; card != nil {
+		var lines []string
+		if card.Title != "" {
+			lines = append(lines, "**"+card.Title+"**")
+		}
+		for _, line := range []string{card.Text, card.ImageURL, card.URL} {
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+		parts = append(parts, strings.Join(lines, "\n"))
+	}
+	if options := richOptions(msg); len(options) > 0 {
+		var b strings.Builder
+		for i, opt := range options {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, opt.Label)
+		}
+		b.WriteString("Reply with a number to choose.")
+		parts = append(parts, b.String())
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// pickChoice resolves a reply like "2" against the options last shown in
+// a chat.
+func pickChoice(options []bus.Button, reply string) (bus.Button, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(reply), ".")))
+	if err != nil || n < 1 || n > len(options) {
+		return bus.Button{}, false
+	}
+	return options[n-1], true
+}
+
+// truncateBytes shortens s to at most n bytes without splitting a rune, for
+// platform limits on button payloads.
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
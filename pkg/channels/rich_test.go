@@ -0,0 +1,90 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// textChannel is a channel without native rich rendering.
+type textChannel struct {
+	*BaseChannel
+}
+
+func (c *textChannel) Start(ctx context.Context) error                         { return nil }
+func (c *textChannel) Stop(ctx context.Context) error                          { return nil }
+func (c *textChannel) Send(ctx context.Context, msg bus.OutboundMessage) error { return nil }
+
+func TestFlattenRichAndNumericReply(t *testing.T) {
+	mb := bus.NewMessageBus()
+	defer mb.Close()
+	ch := &textChannel{NewBaseChannel("qq", nil, mb, nil)}
+
+	msg := flattenRich(ch, bus.OutboundMessage{
+		ChatID:  "5",
+		Content: "Pick a size",
+		Buttons: []bus.Button{{Label: "Small", Value: "size:s"}, {Label: "Large"}},
+		Card:    &bus.Card{Title: "Pizza", URL: "https://example.com"},
+	})
+	if msg.IsRich() {
+		t.Fatal("flattened message still has rich parts")
+	}
+	for _, want := range []string{"Pick a size", "**Pizza**", "https://example.com", "1. Small", "2. Large"} {
+		if !strings.Contains(msg.Content, want) {
+			t.Errorf("content %q lacks %q", msg.Content, want)
+		}
+	}
+
+	ch.HandleMessage("u1", "5", " 1. ", nil, nil)
+	in, _ := mb.ConsumeInbound(context.Background())
+	if in.Event == nil || in.Event.Type != bus.EventChoice || in.Content != "size:s" {
+		t.Fatalf("numeric reply = %+v", in)
+	}
+
+	// Options are used once; a later number is plain text.
+	ch.HandleMessage("u1", "5", "2", nil, nil)
+	in, _ = mb.ConsumeInbound(context.Background())
+	if in.Event != nil || in.Content != "2" {
+		t.Errorf("second reply = %+v", in)
+	}
+}
+
+func TestDiscordRichMessage(t *testing.T) {
+	var buttons []bus.Button
+	for i := 0; i < 7; i++ {
+		buttons = append(buttons, bus.Button{Label: "b"})
+	}
+	send := discordRichMessage(bus.OutboundMessage{
+		Buttons: buttons,
+		Choices: []bus.Button{{Label: "One", Value: "1"}},
+	})
+	if send.Content == "" {
+		t.Error("components-only message needs content")
+	}
+	if len(send.Components) != 3 {
+		t.Fatalf("rows = %d, want 2 button rows and a menu", len(send.Components))
+	}
+	menu := send.Components[2].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+	if menu.CustomID != "choice" || menu.Options[0].Value != "1" {
+		t.Errorf("menu = %+v", menu)
+	}
+}
+
+func TestBuildLINEMessagesQuickReply(t *testing.T) {
+	msgs := buildLINEMessages(bus.OutboundMessage{
+		Content: "Continue?",
+		Buttons: []bus.Button{{Label: "Yes"}, {Label: "No", Value: "no thanks"}},
+		Card:    &bus.Card{ImageURL: "https://example.com/a.png"},
+	}, "")
+	if len(msgs) != 2 || msgs[0]["type"] != "image" {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	items := msgs[1]["quickReply"].(map[string]interface{})["items"].([]map[string]interface{})
+	if action := items[1]["action"].(map[string]string); action["text"] != "no thanks" || action["label"] != "No" {
+		t.Errorf("quick reply = %+v", action)
+	}
+}
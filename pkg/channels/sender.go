@@ -0,0 +1,409 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mymmrac/telego/telegoapi"
+	"github.com/slack-go/slack"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
+	"github.com/sipeed/picoclaw/pkg/tracing"
+)
+
+const (
+	// sendQueueSize bounds each channel's outbound queue. When it is full
+	// the message goes back to the bus to be offered again later, without
+	// using up a retry, instead of blocking delivery to the other channels.
+	sendQueueSize = 256
+
+	// eventQueueSize bounds each channel's queue of outbound events.
+	eventQueueSize = 64
+
+	// eventTimeout bounds a single Channel.SendEvent.
+	eventTimeout = 15 * time.Second
+
+	// sendAttemptTimeout bounds a single Channel.Send, which may include
+	// synthesizing a voice reply or uploading media.
+	sendAttemptTimeout = 2 * time.Minute
+)
+
+// sendRate allows n sends per period, with bursts of up to n.
+type sendRate struct {
+	n      int
+	period time.Duration
+}
+
+// platformRates are the documented outbound limits per platform: a global
+// rate for the bot and a rate per chat. A zero rate is unlimited.
+var platformRates = map[string]struct{ global, perChat sendRate }{
+	// 30 messages per second overall, about one per second in a single chat.
+	"telegram": {global: sendRate{30, time.Second}, perChat: sendRate{1, time.Second}},
+	// 50 requests per second per bot, 5 messages per 5 seconds per channel.
+	"discord": {global: sendRate{50, time.Second}, perChat: sendRate{5, 5 * time.Second}},
+	// chat.postMessage allows about one message per second per channel.
+	"slack": {perChat: sendRate{1, time.Second}},
+}
+
+// SendStats is a point-in-time snapshot of a channel's outbound delivery,
+// for /health.
+type SendStats struct {
+	QueueDepth   int       `json:"queue_depth"`
+	Sent         int64     `json:"sent"`
+	Failed       int64     `json:"failed"`
+	Retried      int64     `json:"retried"`
+	DeadLettered int64     `json:"dead_lettered"`
+	LastError    string    `json:"last_error,omitempty"`
+	LastErrorAt  time.Time `json:"last_error_at,omitempty"`
+}
+
+// permanentError marks a send failure that retrying cannot fix, such as an
+// invalid chat ID.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent wraps err so the sender dead-letters the message right away.
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// classifySendError reports whether a send failure is permanent and, for
+// rate limit errors, how long the platform asked us to wait.
+func classifySendError(err error) (isPermanent bool, retryAfter time.Duration) {
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		return true, 0
+	}
+
+	var tgErr *telegoapi.Error
+	if errors.As(err, &tgErr) {
+		switch {
+		case tgErr.ErrorCode == http.StatusTooManyRequests:
+			if tgErr.Parameters != nil {
+				retryAfter = time.Duration(tgErr.Parameters.RetryAfter) * time.Second
+			}
+			return false, retryAfter
+		case tgErr.ErrorCode >= 400 && tgErr.ErrorCode < 500:
+			// Chat not found, bot blocked by the user, message malformed.
+			return true, 0
+		}
+		return false, 0
+	}
+
+	var dcLimit *discordgo.RateLimitError
+	if errors.As(err, &dcLimit) && dcLimit.RateLimit != nil && dcLimit.TooManyRequests != nil {
+		return false, dcLimit.RetryAfter
+	}
+	var dcErr *discordgo.RESTError
+	if errors.As(err, &dcErr) && dcErr.Response != nil {
+		code := dcErr.Response.StatusCode
+		return code >= 400 && code < 500 && code != http.StatusTooManyRequests, 0
+	}
+
+	var slLimit *slack.RateLimitedError
+	if errors.As(err, &slLimit) {
+		return false, slLimit.RetryAfter
+	}
+	var slErr slack.SlackErrorResponse
+	if errors.As(err, &slErr) {
+		switch slErr.Err {
+		case "ratelimited", "internal_error", "fatal_error", "request_timeout", "service_unavailable":
+			return false, 0
+		}
+		return true, 0
+	}
+
+	// Network errors, timeouts and channels that are reconnecting.
+	return false, 0
+}
+
+// tokenBucket is a rate limiter that hands out reservations: every send
+// takes a token, and the returned delay is how long to wait for it.
+type tokenBucket struct {
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(r sendRate, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(r.n) / r.period.Seconds(),
+		burst:  float64(r.n),
+		tokens: float64(r.n),
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// idle reports whether the bucket has refilled completely.
+func (b *tokenBucket) idle(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// sendLimiter paces a channel's sends to its platform's limits.
+type sendLimiter struct {
+	mu          sync.Mutex
+	global      *tokenBucket
+	perChat     sendRate
+	chats       map[string]*tokenBucket
+	pausedUntil time.Time
+}
+
+func newSendLimiter(channel string) *sendLimiter {
+	rates := platformRates[channel]
+	l := &sendLimiter{perChat: rates.perChat, chats: make(map[string]*tokenBucket)}
+	if rates.global.n > 0 {
+		l.global = newTokenBucket(rates.global, time.Now())
+	}
+	return l
+}
+
+// wait blocks until a message to chatID may be sent.
+func (l *sendLimiter) wait(ctx context.Context, chatID string) error {
+	l.mu.Lock()
+	now := time.Now()
+	var delay time.Duration
+	if l.pausedUntil.After(now) {
+		delay = l.pausedUntil.Sub(now)
+	}
+	if l.global != nil {
+		delay = max(delay, l.global.reserve(now))
+	}
+	if l.perChat.n > 0 {
+		b, ok := l.chats[chatID]
+		if !ok {
+			if len(l.chats) >= 1024 {
+				l.pruneLocked(now)
+			}
+			b = newTokenBucket(l.perChat, now)
+			l.chats[chatID] = b
+		}
+		delay = max(delay, b.reserve(now))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pause holds all sends for d, after the platform answered with a rate
+// limit error.
+func (l *sendLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+func (l *sendLimiter) pruneLocked(now time.Time) {
+	for id, b := range l.chats {
+		if b.idle(now) {
+			delete(l.chats, id)
+		}
+	}
+}
+
+// channelSender owns one channel's outbound queue and delivers it from its
+// own goroutine, so a slow or failing channel never holds up the others.
+// Transient failures go back to the bus, which retries them with
+// exponential backoff; permanent ones are dead-lettered.
+type channelSender struct {
+	name    string
+	channel Channel
+	bus     *bus.MessageBus
+	queue   chan bus.OutboundMessage
+	events  chan bus.Event
+	limiter *sendLimiter
+	// prepare runs before each send; the manager uses it to deliver
+	// reasoning ahead of the answer and to flatten rich messages.
+	prepare func(ctx context.Context, msg bus.OutboundMessage) bus.OutboundMessage
+
+	mu    sync.Mutex
+	stats SendStats
+}
+
+func newChannelSender(name string, channel Channel, mb *bus.MessageBus) *channelSender {
+	return &channelSender{
+		name:    name,
+		channel: channel,
+		bus:     mb,
+		queue:   make(chan bus.OutboundMessage, sendQueueSize),
+		events:  make(chan bus.Event, eventQueueSize),
+		limiter: newSendLimiter(name),
+	}
+}
+
+// enqueue queues msg without blocking and reports whether there was room.
+func (s *channelSender) enqueue(msg bus.OutboundMessage) bool {
+	select {
+	case s.queue <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueueEvent queues ev without blocking; events that do not fit are
+// dropped since they are only hints.
+func (s *channelSender) enqueueEvent(ev bus.Event) bool {
+	select {
+	case s.events <- ev:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *channelSender) run(ctx context.Context) {
+	go s.runEvents(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-s.queue:
+			if err := s.limiter.wait(ctx, msg.ChatID); err != nil {
+				// Shutting down; a durable bus replays the message on restart.
+				return
+			}
+			s.deliver(ctx, msg)
+		}
+	}
+}
+
+// runEvents delivers events in order, separately from messages so a
+// typing indicator never waits behind a rate-limited reply.
+func (s *channelSender) runEvents(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-s.events:
+			sender, ok := s.channel.(EventSender)
+			if !ok {
+				continue
+			}
+			evCtx, cancel := context.WithTimeout(ctx, eventTimeout)
+			if err := sender.SendEvent(evCtx, ev); err != nil {
+				logger.WarnCF("channels", "Error sending event to channel", map[string]interface{}{
+					"channel": s.name,
+					"chat_id": ev.ChatID,
+					"type":    string(ev.Type),
+					"error":   err.Error(),
+				})
+			}
+			cancel()
+		}
+	}
+}
+
+func (s *channelSender) deliver(ctx context.Context, msg bus.OutboundMessage) {
+	ctx, span := tracing.Start(tracing.Extract(ctx, msg.Trace), "channel.send",
+		attribute.String("picoclaw.channel", s.name),
+		attribute.String("picoclaw.chat_id", msg.ChatID),
+	)
+	sendCtx, cancel := context.WithTimeout(ctx, sendAttemptTimeout)
+	defer cancel()
+
+	if s.prepare != nil {
+		msg = s.prepare(sendCtx, msg)
+	}
+
+	err := s.channel.Send(sendCtx, msg)
+	tracing.End(span, err)
+	if err == nil {
+		s.bus.Ack(msg.ID)
+		s.mu.Lock()
+		s.stats.Sent++
+		s.mu.Unlock()
+		metrics.MessagesOutbound.Inc(s.name, "sent")
+		return
+	}
+
+	isPermanent, retryAfter := classifySendError(err)
+	logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
+		"channel":   s.name,
+		"chat_id":   msg.ChatID,
+		"permanent": isPermanent,
+		"error":     err.Error(),
+	})
+	if retryAfter > 0 {
+		s.limiter.pause(retryAfter)
+	}
+
+	retried := false
+	if isPermanent {
+		s.bus.DeadLetter(msg, s.bus.Attempts(msg.ID)+1, err)
+	} else {
+		retried = s.bus.Nack(msg, err)
+	}
+	metrics.MessagesOutbound.Inc(s.name, "failed")
+	if !retried {
+		metrics.MessagesOutbound.Inc(s.name, "dead_lettered")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Failed++
+	if retried {
+		s.stats.Retried++
+	} else {
+		s.stats.DeadLettered++
+	}
+	s.stats.LastError = err.Error()
+	s.stats.LastErrorAt = time.Now()
+}
+
+// requeue hands a message the queue had no room for back to the bus. It
+// was never attempted, so it does not use up one of its retries.
+func (s *channelSender) requeue(msg bus.OutboundMessage) {
+	s.bus.Defer(msg)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Retried++
+}
+
+func (s *channelSender) snapshot() SendStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.QueueDepth = len(s.queue)
+	return stats
+}
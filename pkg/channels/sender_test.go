@@ -0,0 +1,294 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego/telegoapi"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeChannel records sends and fails them with errs, in order.
+type fakeChannel struct {
+	mu    sync.Mutex
+	sent  []bus.OutboundMessage
+	errs  []error
+	block chan struct{}
+}
+
+func (f *fakeChannel) Name() string                    { return "fake" }
+func (f *fakeChannel) Start(ctx context.Context) error { return nil }
+func (f *fakeChannel) Stop(ctx context.Context) error  { return nil }
+func (f *fakeChannel) IsRunning() bool                 { return true }
+func (f *fakeChannel) IsAllowed(senderID string) bool  { return true }
+
+func (f *fakeChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if f.block != nil {
+		select {
+		case <-f.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func (f *fakeChannel) sentCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sent)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSlowChannelDoesNotBlockOthers(t *testing.T) {
+	mb := bus.NewMessageBus()
+	defer mb.Close()
+	m, err := NewManager(config.DefaultConfig(), mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow := &fakeChannel{block: make(chan struct{})}
+	fast := &fakeChannel{}
+	m.RegisterChannel("slow", slow)
+	m.RegisterChannel("fast", fast)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.StartAll(ctx)
+
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "slow", ChatID: "1", Content: "a"})
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "fast", ChatID: "1", Content: "b"})
+	waitFor(t, func() bool { return fast.sentCount() == 1 })
+
+	close(slow.block)
+	waitFor(t, func() bool { return slow.sentCount() == 1 })
+	waitFor(t, func() bool { return m.GetSendStats()["slow"].Sent == 1 })
+}
+
+func TestSenderRetriesTransientAndDeadLettersPermanent(t *testing.T) {
+	mb := bus.NewMessageBus()
+	defer mb.Close()
+	ch := &fakeChannel{errs: []error{
+		errors.New("connection reset"),
+		permanent(errors.New("chat not found")),
+	}}
+	s := newChannelSender("fake", ch, mb)
+	ctx := context.Background()
+
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "fake", ChatID: "1", Content: "a"})
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "fake", ChatID: "1", Content: "b"})
+	first, _ := mb.SubscribeOutbound(ctx)
+	second, _ := mb.SubscribeOutbound(ctx)
+
+	s.deliver(ctx, first)
+	if got := mb.Attempts(first.ID); got != 1 {
+		t.Errorf("attempts after transient failure = %d, want 1", got)
+	}
+	s.deliver(ctx, second)
+	dead := mb.DeadLetters()
+	if len(dead) != 1 || dead[0].Message.ID != second.ID {
+		t.Fatalf("dead letters = %+v", dead)
+	}
+
+	stats := s.snapshot()
+	if stats.Failed != 2 || stats.Retried != 1 || stats.DeadLettered != 1 || stats.LastError != "chat not found" {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestClassifySendError(t *testing.T) {
+	tooMany := &telegoapi.Error{ErrorCode: 429, Parameters: &telegoapi.ResponseParameters{RetryAfter: 7}}
+	tests := []struct {
+		name       string
+		err        error
+		permanent  bool
+		retryAfter time.Duration
+	}{
+		{"network", errors.New("dial tcp: timeout"), false, 0},
+		{"marked permanent", permanent(errors.New("bad id")), true, 0},
+		{"telegram rate limit", fmt.Errorf("api: %w", tooMany), false, 7 * time.Second},
+		{"telegram forbidden", fmt.Errorf("api: %w", &telegoapi.Error{ErrorCode: 403}), true, 0},
+		{"telegram server error", &telegoapi.Error{ErrorCode: 502}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perm, after := classifySendError(tt.err)
+			if perm != tt.permanent || after != tt.retryAfter {
+				t.Errorf("classifySendError = (%v, %v), want (%v, %v)", perm, after, tt.permanent, tt.retryAfter)
+			}
+		})
+	}
+}
+
+// Shared fixtures for the channel tests that run against a fake server.
+
+// newTestBus returns a message bus closed when the test ends.
+func newTestBus(t *testing.T) *bus.MessageBus {
+	t.Helper()
+	mb := bus.NewMessageBus()
+	t.Cleanup(mb.Close)
+	return mb
+}
+
+// startTestChannel starts ch and stops it when the test ends.
+func startTestChannel(t *testing.T, ch Channel) {
+	t.Helper()
+	if err := ch.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ch.Stop(context.Background()) })
+}
+
+// nextInbound waits for the next message the channel published.
+func nextInbound(t *testing.T, mb *bus.MessageBus) bus.InboundMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	in, ok := mb.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	return in
+}
+
+// assertPermanentSendError sends to chatID and checks that ch fails with an
+// error the sender dead-letters instead of retrying. It returns the error
+// for protocol-specific checks.
+func assertPermanentSendError(t *testing.T, ch Channel, chatID string) error {
+	t.Helper()
+	err := ch.Send(context.Background(), bus.OutboundMessage{Channel: ch.Name(), ChatID: chatID, Content: "hi"})
+	if isPermanent, _ := classifySendError(err); !isPermanent {
+		t.Errorf("Send(%q) = %v, want a permanent error", chatID, err)
+	}
+	return err
+}
+
+func TestTokenBucketPacesSends(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(sendRate{2, time.Second}, now)
+	if b.reserve(now) != 0 || b.reserve(now) != 0 {
+		t.Fatal("burst should pass without waiting")
+	}
+	if d := b.reserve(now); d != 500*time.Millisecond {
+		t.Errorf("third send waits %v, want 500ms", d)
+	}
+	if d := b.reserve(now.Add(time.Second)); d != 0 {
+		t.Errorf("after refill waits %v, want 0", d)
+	}
+}
+
+// fakeEventChannel handles typing events only.
+type fakeEventChannel struct {
+	fakeChannel
+	got chan bus.Event
+}
+
+func (f *fakeEventChannel) SupportedEvents() []bus.EventType {
+	return []bus.EventType{bus.EventTypingStart, bus.EventTypingStop}
+}
+
+func (f *fakeEventChannel) SendEvent(ctx context.Context, ev bus.Event) error {
+	f.got <- ev
+	return nil
+}
+
+func TestManagerRoutesSupportedEvents(t *testing.T) {
+	mb := bus.NewMessageBus()
+	defer mb.Close()
+	m, err := NewManager(config.DefaultConfig(), mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := &fakeEventChannel{got: make(chan bus.Event, 4)}
+	m.RegisterChannel("fake", ch)
+	m.RegisterChannel("plain", &fakeChannel{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.StartAll(ctx)
+
+	if !m.SupportsEvent("fake", bus.EventTypingStart) || m.SupportsEvent("fake", bus.EventReaction) || m.SupportsEvent("plain", bus.EventTypingStart) {
+		t.Error("SupportsEvent does not match the declared capabilities")
+	}
+
+	mb.PublishEvent(bus.Event{Type: bus.EventReaction, Channel: "fake", ChatID: "1"})
+	mb.PublishEvent(bus.Event{Type: bus.EventTypingStart, Channel: "plain", ChatID: "1"})
+	mb.PublishEvent(bus.Event{Type: bus.EventTypingStart, Channel: "fake", ChatID: "1"})
+	mb.PublishEvent(bus.Event{Type: bus.EventTypingStop, Channel: "fake", ChatID: "1"})
+
+	for _, want := range []bus.EventType{bus.EventTypingStart, bus.EventTypingStop} {
+		select {
+		case ev := <-ch.got:
+			if ev.Type != want {
+				t.Errorf("got %s, want %s", ev.Type, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("no %s event delivered", want)
+		}
+	}
+}
+
+func TestManagerDisableAndEnableChannel(t *testing.T) {
+	mb := bus.NewMessageBus()
+	defer mb.Close()
+	m, err := NewManager(config.DefaultConfig(), mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := &fakeChannel{}
+	m.RegisterChannel("fake", ch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.StartAll(ctx)
+
+	if err := m.DisableChannel(ctx, "fake"); err != nil {
+		t.Fatal(err)
+	}
+	if entry := m.GetStatus()["fake"].(map[string]interface{}); entry["enabled"] != false {
+		t.Errorf("status = %v, want disabled", entry)
+	}
+
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "fake", ChatID: "1", Content: "while off"})
+	waitFor(t, func() bool { return len(mb.DeadLetters()) == 1 })
+	dead := mb.DeadLetters()[0]
+	if dead.Error != `channel "fake" is disabled` {
+		t.Errorf("dead letter error = %q", dead.Error)
+	}
+
+	if err := m.EnableChannel("fake"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mb.Requeue(dead.Message.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return ch.sentCount() == 1 })
+
+	if err := m.DisableChannel(ctx, "missing"); err == nil {
+		t.Error("DisableChannel(missing) should fail")
+	}
+}
@@ -0,0 +1,710 @@
+package channels
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+const (
+	// signalCallTimeout bounds one JSON-RPC call; sends with large
+	// attachments are the slow ones.
+	signalCallTimeout = 2 * time.Minute
+
+	// signalMaxAttachment is the largest outbound file we attach; Signal
+	// itself refuses anything over 100 MB.
+	signalMaxAttachment = 100 << 20
+
+	// signalGroupPrefix marks group chat IDs; direct chats are the peer's
+	// phone number or UUID.
+	signalGroupPrefix = "group:"
+)
+
+// SignalChannel implements the Channel interface for Signal through a
+// signal-cli daemon, speaking JSON-RPC over its UNIX or TCP socket: one
+// JSON object per line, with incoming messages as "receive" notifications.
+type SignalChannel struct {
+	*BaseChannel
+	config config.SignalConfig
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	connMu sync.Mutex
+	conn   net.Conn
+
+	nextID    atomic.Int64
+	pendingMu sync.Mutex
+	pending   map[string]chan signalResponse
+
+	// Notifications are handled in order by one worker, off the read
+	// loop, since handling them makes calls of its own.
+	queueMu    sync.Mutex
+	queue      []json.RawMessage
+	queueReady chan struct{}
+
+	typing sync.Map // chatID -> context.CancelFunc
+}
+
+type signalResponse struct {
+	Result json.RawMessage
+	Err    error
+}
+
+// signalRPCError is an error returned by signal-cli.
+type signalRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *signalRPCError) Error() string {
+	return fmt.Sprintf("signal-cli: %s (code %d)", e.Message, e.Code)
+}
+
+type signalEnvelope struct {
+	SourceNumber string             `json:"sourceNumber"`
+	SourceUUID   string             `json:"sourceUuid"`
+	SourceName   string             `json:"sourceName"`
+	DataMessage  *signalDataMessage `json:"dataMessage"`
+}
+
+type signalDataMessage struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+	GroupInfo *struct {
+		GroupID string `json:"groupId"`
+	} `json:"groupInfo"`
+	Attachments []struct {
+		ID          string `json:"id"`
+		ContentType string `json:"contentType"`
+		Filename    string `json:"filename"`
+	} `json:"attachments"`
+	Quote *struct {
+		ID           int64  `json:"id"`
+		AuthorNumber string `json:"authorNumber"`
+		AuthorUUID   string `json:"authorUuid"`
+		Text         string `json:"text"`
+	} `json:"quote"`
+	Reaction *struct {
+		Emoji               string `json:"emoji"`
+		TargetAuthorNumber  string `json:"targetAuthorNumber"`
+		TargetAuthorUUID    string `json:"targetAuthorUuid"`
+		TargetSentTimestamp int64  `json:"targetSentTimestamp"`
+		IsRemove            bool   `json:"isRemove"`
+	} `json:"reaction"`
+}
+
+// NewSignalChannel creates a Signal channel for a signal-cli daemon.
+func NewSignalChannel(cfg config.SignalConfig, messageBus *bus.MessageBus) (*SignalChannel, error) {
+	if cfg.Socket == "" {
+		return nil, fmt.Errorf("signal socket is required")
+	}
+
+	base := NewBaseChannel("signal", cfg, messageBus, cfg.AllowFrom)
+
+	return &SignalChannel{
+		BaseChannel: base,
+		config:      cfg,
+		pending:     make(map[string]chan signalResponse),
+		queueReady:  make(chan struct{}, 1),
+	}, nil
+}
+
+// Start connects to the daemon and starts handling its notifications.
+func (c *SignalChannel) Start(ctx context.Context) error {
+	logger.InfoC("signal", "Starting Signal channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	conn, err := c.dial()
+	if err != nil {
+		return fmt.Errorf("failed to connect to signal-cli: %w", err)
+	}
+
+	c.setConn(conn)
+	go c.run(conn)
+	go c.processNotifications()
+
+	c.setRunning(true)
+	logger.InfoCF("signal", "Signal channel started", map[string]interface{}{
+		"socket":  c.config.Socket,
+		"account": c.config.Account,
+	})
+	return nil
+}
+
+func (c *SignalChannel) Stop(ctx context.Context) error {
+	logger.InfoC("signal", "Stopping Signal channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.connMu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.connMu.Unlock()
+
+	c.setRunning(false)
+	logger.InfoC("signal", "Signal channel stopped")
+	return nil
+}
+
+// dial connects to a UNIX socket path or a TCP host:port.
+func (c *SignalChannel) dial() (net.Conn, error) {
+	network := "tcp"
+	if strings.Contains(c.config.Socket, "/") {
+		network = "unix"
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	return dialer.DialContext(c.ctx, network, c.config.Socket)
+}
+
+// run reads from the daemon until the channel stops, reconnecting with
+// backoff when the connection drops.
+func (c *SignalChannel) run(conn net.Conn) {
+	backoff := time.Second
+	for {
+		if conn != nil {
+			started := time.Now()
+			err := c.readLoop(conn)
+			if c.ctx.Err() != nil {
+				return
+			}
+			if time.Since(started) > time.Minute {
+				backoff = time.Second
+			}
+			logger.WarnCF("signal", "Lost connection to signal-cli, reconnecting", map[string]interface{}{
+				"error":    fmt.Sprint(err),
+				"retry_in": backoff.String(),
+			})
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+
+		var err error
+		if conn, err = c.dial(); err != nil {
+			logger.WarnCF("signal", "Failed to connect to signal-cli", map[string]interface{}{
+				"error": err.Error(),
+			})
+			conn = nil
+			continue
+		}
+		c.setConn(conn)
+	}
+}
+
+func (c *SignalChannel) setConn(conn net.Conn) {
+	c.connMu.Lock()
+	c.conn = conn
+	c.connMu.Unlock()
+}
+
+// readLoop dispatches responses to their callers and queues notifications
+// until the connection fails. Calls still waiting then fail.
+func (c *SignalChannel) readLoop(conn net.Conn) error {
+	defer func() {
+		c.setConn(nil)
+		conn.Close()
+
+		c.pendingMu.Lock()
+		for id, ch := range c.pending {
+			ch <- signalResponse{Err: fmt.Errorf("connection to signal-cli lost")}
+			delete(c.pending, id)
+		}
+		c.pendingMu.Unlock()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+
+		var frame struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  *signalRPCError `json:"error"`
+		}
+		if err := json.Unmarshal(line, &frame); err != nil {
+			logger.WarnCF("signal", "Invalid JSON-RPC frame", map[string]interface{}{
+				"error": err.Error(),
+			})
+			continue
+		}
+
+		if frame.Method == "receive" {
+			c.queueMu.Lock()
+			c.queue = append(c.queue, frame.Params)
+			c.queueMu.Unlock()
+			select {
+			case c.queueReady <- struct{}{}:
+			default:
+			}
+			continue
+		}
+
+		var id string
+		if json.Unmarshal(frame.ID, &id) != nil {
+			continue
+		}
+		c.pendingMu.Lock()
+		ch, ok := c.pending[id]
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+		if ok {
+			resp := signalResponse{Result: frame.Result}
+			if frame.Error != nil {
+				resp.Err = frame.Error
+			}
+			ch <- resp
+		}
+	}
+}
+
+// call makes a JSON-RPC call and decodes its result into out.
+func (c *SignalChannel) call(ctx context.Context, method string, params map[string]interface{}, out interface{}) error {
+	if c.config.Account != "" {
+		params["account"] = c.config.Account
+	}
+	id := strconv.FormatInt(c.nextID.Add(1), 10)
+	data, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan signalResponse, 1)
+	c.pendingMu.Lock()
+	c.pending[id] = ch
+	c.pendingMu.Unlock()
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}()
+
+	c.connMu.Lock()
+	if c.conn == nil {
+		c.connMu.Unlock()
+		return fmt.Errorf("not connected to signal-cli")
+	}
+	_, err = c.conn.Write(append(data, '\n'))
+	c.connMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, signalCallTimeout)
+	defer cancel()
+	select {
+	case resp := <-ch:
+		if resp.Err != nil {
+			return resp.Err
+		}
+		if out != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, out)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("signal-cli %s: %w", method, ctx.Err())
+	}
+}
+
+func (c *SignalChannel) processNotifications() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.queueReady:
+		}
+		for {
+			c.queueMu.Lock()
+			if len(c.queue) == 0 {
+				c.queueMu.Unlock()
+				break
+			}
+			params := c.queue[0]
+			c.queue = c.queue[1:]
+			c.queueMu.Unlock()
+
+			var notification struct {
+				Account  string         `json:"account"`
+				Envelope signalEnvelope `json:"envelope"`
+			}
+			if err := json.Unmarshal(params, &notification); err != nil {
+				continue
+			}
+			// A daemon serving several accounts reports messages for all
+			// of them.
+			if c.config.Account != "" && notification.Account != "" && notification.Account != c.config.Account {
+				continue
+			}
+			c.handleEnvelope(notification.Envelope)
+		}
+	}
+}
+
+func (c *SignalChannel) handleEnvelope(env signalEnvelope) {
+	dm := env.DataMessage
+	if dm == nil {
+		return // typing, receipts and sync messages
+	}
+
+	address := env.SourceNumber
+	if address == "" {
+		address = env.SourceUUID
+	}
+	if address == "" || address == c.config.Account {
+		return
+	}
+	// Either the number or the UUID can be on the allowlist.
+	senderID := address
+	if env.SourceNumber != "" && env.SourceUUID != "" {
+		senderID = env.SourceNumber + "|" + env.SourceUUID
+	}
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("signal", "Message rejected by allowlist", map[string]interface{}{
+			"sender": senderID,
+		})
+		return
+	}
+
+	chatID := address
+	if dm.GroupInfo != nil {
+		chatID = signalGroupPrefix + dm.GroupInfo.GroupID
+	}
+
+	if r := dm.Reaction; r != nil {
+		if r.IsRemove {
+			return
+		}
+		c.HandleEvent(senderID, bus.Event{
+			Type:      bus.EventReaction,
+			ChatID:    chatID,
+			MessageID: signalMessageID(r.TargetSentTimestamp, firstNonEmpty(r.TargetAuthorNumber, r.TargetAuthorUUID)),
+			Content:   r.Emoji,
+		}, map[string]string{
+			"user_id": senderID,
+		})
+		return
+	}
+
+	metadata := map[string]string{
+		"message_id":  signalMessageID(dm.Timestamp, address),
+		"sender_name": env.SourceName,
+		"platform":    "signal",
+	}
+	if q := dm.Quote; q != nil {
+		metadata["reply_to_id"] = signalMessageID(q.ID, firstNonEmpty(q.AuthorNumber, q.AuthorUUID))
+		metadata["quoted_text"] = q.Text
+	}
+
+	text := dm.Message
+	var mediaPaths []string
+	hasAudio := false
+	for _, att := range dm.Attachments {
+		name := att.Filename
+		if name == "" {
+			name = att.ID
+		}
+		localPath := c.downloadAttachment(att.ID, name, chatID)
+		if localPath == "" {
+			text = appendContent(text, fmt.Sprintf("[file: %s (download failed)]", name))
+			continue
+		}
+		defer os.Remove(localPath)
+		mediaPaths = append(mediaPaths, localPath)
+
+		switch {
+		case utils.IsAudioFile(name, att.ContentType):
+			hasAudio = true
+			text = appendContent(text, c.transcribeAudio(c.ctx, localPath, "voice"))
+		case strings.HasPrefix(att.ContentType, "image/"):
+			text = appendContent(text, fmt.Sprintf("[image: %s]", name))
+		default:
+			text = appendContent(text, fmt.Sprintf("[file: %s]", name))
+		}
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	c.markVoiceInput(chatID, hasAudio)
+
+	logger.DebugCF("signal", "Received message", map[string]interface{}{
+		"sender_id": senderID,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(text, 50),
+	})
+
+	c.HandleMessage(senderID, chatID, text, mediaPaths, metadata)
+}
+
+// downloadAttachment fetches an attachment from the daemon, which works
+// whether or not it shares our filesystem.
+func (c *SignalChannel) downloadAttachment(id, name, chatID string) string {
+	params := signalTarget(chatID, false)
+	params["id"] = id
+	var result struct {
+		Data string `json:"data"`
+	}
+	if err := c.call(c.ctx, "getAttachment", params, &result); err != nil {
+		logger.ErrorCF("signal", "Failed to fetch attachment", map[string]interface{}{
+			"id":    id,
+			"error": err.Error(),
+		})
+		return ""
+	}
+	data, err := base64.StdEncoding.DecodeString(result.Data)
+	if err != nil {
+		return ""
+	}
+	if filepath.Ext(name) == "" {
+		if exts, _ := mime.ExtensionsByType(http.DetectContentType(data)); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	return utils.SaveMedia(bytes.NewReader(data), name, "signal")
+}
+
+func (c *SignalChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("signal channel not running")
+	}
+	if msg.ChatID == "" || msg.ChatID == signalGroupPrefix {
+		return permanent(fmt.Errorf("invalid signal chat ID: %q", msg.ChatID))
+	}
+	c.stopTyping(msg.ChatID)
+
+	params := signalTarget(msg.ChatID, true)
+	// In groups, quote the message being answered so it is clear who the
+	// reply is for.
+	if strings.HasPrefix(msg.ChatID, signalGroupPrefix) && msg.ReplyTo != "" {
+		if ts, author, ok := parseSignalMessageID(msg.ReplyTo); ok {
+			params["quoteTimestamp"] = ts
+			params["quoteAuthor"] = author
+		}
+	}
+
+	if audioPath := c.voiceReply(ctx, msg, voice.FormatMP3); audioPath != "" {
+		uri, err := signalAttachmentURI(audioPath)
+		os.Remove(audioPath)
+		if err == nil {
+			params["attachments"] = []string{uri}
+			if err = c.call(ctx, "send", params, nil); err == nil {
+				return nil
+			}
+		}
+		logger.ErrorCF("signal", "Failed to send voice reply, falling back to text", map[string]interface{}{
+			"error": err.Error(),
+		})
+		delete(params, "attachments")
+	}
+
+	var attachments []string
+	for _, ref := range msg.Media {
+		uri, err := signalAttachmentURI(ref)
+		if err != nil {
+			logger.ErrorCF("signal", "Failed to attach media", map[string]interface{}{
+				"media": utils.Truncate(ref, 80),
+				"error": err.Error(),
+			})
+			continue
+		}
+		attachments = append(attachments, uri)
+	}
+	if msg.Content == "" && len(attachments) == 0 {
+		return nil
+	}
+	params["message"] = msg.Content
+	if len(attachments) > 0 {
+		params["attachments"] = attachments
+	}
+
+	if err := c.call(ctx, "send", params, nil); err != nil {
+		return signalSendError(err)
+	}
+
+	logger.DebugCF("signal", "Message sent", map[string]interface{}{
+		"chat_id": msg.ChatID,
+	})
+	return nil
+}
+
+// signalSendError marks errors about the request itself, such as an
+// unknown group or a malformed recipient, as permanent.
+func signalSendError(err error) error {
+	var rpcErr *signalRPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code <= -32600 && rpcErr.Code >= -32602 {
+		return permanent(err)
+	}
+	return err
+}
+
+// SupportedEvents lists the outbound events Signal handles.
+func (c *SignalChannel) SupportedEvents() []bus.EventType {
+	return []bus.EventType{bus.EventTypingStart, bus.EventTypingStop, bus.EventReaction}
+}
+
+func (c *SignalChannel) SendEvent(ctx context.Context, ev bus.Event) error {
+	switch ev.Type {
+	case bus.EventTypingStart:
+		c.startTyping(ev.ChatID)
+	case bus.EventTypingStop:
+		c.stopTyping(ev.ChatID)
+	case bus.EventReaction:
+		ts, author, ok := parseSignalMessageID(ev.MessageID)
+		if !ok {
+			return permanent(fmt.Errorf("invalid signal message ID: %q", ev.MessageID))
+		}
+		params := signalTarget(ev.ChatID, true)
+		params["emoji"] = ev.Content
+		params["targetAuthor"] = author
+		params["targetTimestamp"] = ts
+		return c.call(ctx, "sendReaction", params, nil)
+	}
+	return nil
+}
+
+// startTyping keeps the typing indicator up (Signal clients drop it after
+// fifteen seconds) until typing stops, a reply is sent, or five minutes
+// pass.
+func (c *SignalChannel) startTyping(chatID string) {
+	c.stopTyping(chatID)
+	ctx, cancel := context.WithTimeout(c.ctx, 5*time.Minute)
+	c.typing.Store(chatID, cancel)
+
+	go func() {
+		defer c.call(context.Background(), "sendTyping", signalTypingParams(chatID, true), nil)
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			if err := c.call(ctx, "sendTyping", signalTypingParams(chatID, false), nil); err != nil && ctx.Err() == nil {
+				logger.ErrorCF("signal", "Failed to send typing indicator", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *SignalChannel) stopTyping(chatID string) {
+	if cancel, ok := c.typing.LoadAndDelete(chatID); ok {
+		cancel.(context.CancelFunc)()
+	}
+}
+
+func signalTypingParams(chatID string, stop bool) map[string]interface{} {
+	params := signalTarget(chatID, true)
+	params["stop"] = stop
+	return params
+}
+
+// signalTarget returns the parameters addressing a chat: a group ID, or a
+// recipient (a list of them when several is allowed).
+func signalTarget(chatID string, recipientList bool) map[string]interface{} {
+	if groupID, ok := strings.CutPrefix(chatID, signalGroupPrefix); ok {
+		return map[string]interface{}{"groupId": groupID}
+	}
+	if recipientList {
+		return map[string]interface{}{"recipient": []string{chatID}}
+	}
+	return map[string]interface{}{"recipient": chatID}
+}
+
+// signalMessageID names a message the way Signal does: by its sent
+// timestamp and its author.
+func signalMessageID(timestamp int64, author string) string {
+	return fmt.Sprintf("%d:%s", timestamp, author)
+}
+
+func parseSignalMessageID(id string) (timestamp int64, author string, ok bool) {
+	ts, author, found := strings.Cut(id, ":")
+	if !found || author == "" {
+		return 0, "", false
+	}
+	timestamp, err := strconv.ParseInt(ts, 10, 64)
+	return timestamp, author, err == nil
+}
+
+// signalAttachmentURI turns a local path or URL into the data URI form
+// signal-cli accepts, so the daemon need not share our filesystem.
+func signalAttachmentURI(ref string) (string, error) {
+	if strings.HasPrefix(ref, "data:") {
+		return ref, nil
+	}
+	localPath := ref
+	if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+		localPath = utils.DownloadFile(ref, filepath.Base(ref), utils.DownloadOptions{LoggerPrefix: "signal"})
+		if localPath == "" {
+			return "", fmt.Errorf("download failed")
+		}
+		defer os.Remove(localPath)
+	}
+
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > signalMaxAttachment {
+		return "", fmt.Errorf("%s is too large to send (%d bytes)", filepath.Base(localPath), info.Size())
+	}
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return "", err
+	}
+
+	name := utils.DownloadedFilename(localPath)
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return fmt.Sprintf("data:%s;filename=%s;base64,%s", mimeType, name, base64.StdEncoding.EncodeToString(data)), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
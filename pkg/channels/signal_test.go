@@ -0,0 +1,219 @@
+package channels
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeSignalCLI stands in for a signal-cli daemon on a TCP socket: it
+// answers every call, rejects sends to "+0" as invalid and records the
+// calls on requests.
+type fakeSignalCLI struct {
+	net.Listener
+	requests chan signalTestRequest
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+type signalTestRequest struct {
+	Method string                 `json:"method"`
+	Params map[string]interface{} `json:"params"`
+}
+
+func newFakeSignalCLI(t *testing.T) *fakeSignalCLI {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeSignalCLI{Listener: l, requests: make(chan signalTestRequest, 50)}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conn = conn
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeSignalCLI) serve(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req struct {
+			ID string `json:"id"`
+			signalTestRequest
+		}
+		json.Unmarshal(scanner.Bytes(), &req)
+		f.requests <- req.signalTestRequest
+
+		result := `{"timestamp":1700000009999}`
+		switch {
+		case req.Method == "getAttachment":
+			result = fmt.Sprintf(`{"data":%q}`, base64.StdEncoding.EncodeToString([]byte("ID3 fake audio")))
+		case req.Method == "send" && fmt.Sprint(req.Params["recipient"]) == "[+0]":
+			f.write(fmt.Sprintf(`{"jsonrpc":"2.0","id":%q,"error":{"code":-32602,"message":"Invalid recipient"}}`, req.ID))
+			continue
+		}
+		f.write(fmt.Sprintf(`{"jsonrpc":"2.0","id":%q,"result":%s}`, req.ID, result))
+	}
+}
+
+func (f *fakeSignalCLI) write(line string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.conn.Write([]byte(line + "\n"))
+}
+
+// receive pushes an incoming message to the channel, on one line as
+// signal-cli does.
+func (f *fakeSignalCLI) receive(envelope string) {
+	var compact bytes.Buffer
+	json.Compact(&compact, []byte(envelope))
+	f.write(`{"jsonrpc":"2.0","method":"receive","params":{"account":"+15550000000","envelope":` + compact.String() + `}}`)
+}
+
+// next returns the next call to method, skipping others.
+func (f *fakeSignalCLI) next(t *testing.T, method string) signalTestRequest {
+	t.Helper()
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case req := <-f.requests:
+			if req.Method == method {
+				return req
+			}
+		case <-timeout:
+			t.Fatalf("no %s call", method)
+		}
+	}
+}
+
+func startTestSignal(t *testing.T) (*SignalChannel, *bus.MessageBus, *fakeSignalCLI) {
+	t.Helper()
+	daemon := newFakeSignalCLI(t)
+	mb := newTestBus(t)
+	c, err := NewSignalChannel(config.SignalConfig{
+		Socket:    daemon.Addr().String(),
+		Account:   "+15550000000",
+		AllowFrom: config.FlexibleStringSlice{"+15551111111"},
+	}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startTestChannel(t, c)
+	return c, mb, daemon
+}
+
+func TestSignalDirectAndGroupMessages(t *testing.T) {
+	c, mb, daemon := startTestSignal(t)
+
+	daemon.receive(`{"sourceNumber":"+15559999999","sourceUuid":"u-9","dataMessage":{"timestamp":1700000000000,"message":"hi"}}`)
+	daemon.receive(`{"sourceNumber":"+15551111111","sourceUuid":"u-1","sourceName":"Ann","dataMessage":{
+		"timestamp":1700000001000,"message":null,
+		"attachments":[{"id":"att1","contentType":"audio/aac","filename":null}]}}`)
+
+	in := nextInbound(t, mb)
+	if in.ChatID != "+15551111111" || in.SenderID != "+15551111111|u-1" || in.Content != "[voice]" || len(in.Media) != 1 {
+		t.Fatalf("inbound = %+v", in)
+	}
+	if in.MessageID != "1700000001000:+15551111111" {
+		t.Errorf("MessageID = %q", in.MessageID)
+	}
+	fetch := daemon.next(t, "getAttachment")
+	if fetch.Params["id"] != "att1" || fetch.Params["recipient"] != "+15551111111" || fetch.Params["account"] != "+15550000000" {
+		t.Errorf("getAttachment params = %v", fetch.Params)
+	}
+
+	daemon.receive(`{"sourceNumber":"+15551111111","sourceUuid":"u-1","dataMessage":{
+		"timestamp":1700000002000,"message":"what about this?","groupInfo":{"groupId":"Z3JvdXA=","type":"DELIVER"},
+		"quote":{"id":1700000000500,"authorNumber":"+15552222222","authorUuid":"u-2","text":"lunch at noon"}}}`)
+	in = nextInbound(t, mb)
+	if in.ChatID != "group:Z3JvdXA=" || in.Content != "what about this?" {
+		t.Fatalf("inbound = %+v", in)
+	}
+	if in.ReplyToID != "1700000000500:+15552222222" || in.QuotedText != "lunch at noon" {
+		t.Errorf("reply context = %q, %q", in.ReplyToID, in.QuotedText)
+	}
+
+	if err := c.Send(context.Background(), bus.OutboundMessage{Channel: "signal", ChatID: in.ChatID, Content: "Noon works.", ReplyTo: in.MessageID}); err != nil {
+		t.Fatal(err)
+	}
+	send := daemon.next(t, "send")
+	if send.Params["groupId"] != "Z3JvdXA=" || send.Params["message"] != "Noon works." ||
+		send.Params["quoteTimestamp"] != float64(1700000002000) || send.Params["quoteAuthor"] != "+15551111111" {
+		t.Errorf("send params = %v", send.Params)
+	}
+}
+
+func TestSignalReactionsAndTyping(t *testing.T) {
+	c, mb, daemon := startTestSignal(t)
+
+	daemon.receive(`{"sourceNumber":"+15551111111","dataMessage":{"timestamp":1700000003000,
+		"reaction":{"emoji":"👍","targetAuthorNumber":"+15550000000","targetSentTimestamp":1700000002500,"isRemove":false}}}`)
+	in := nextInbound(t, mb)
+	if in.Event == nil || in.Event.Type != bus.EventReaction || in.Event.Content != "👍" ||
+		in.Event.MessageID != "1700000002500:+15550000000" || in.ChatID != "+15551111111" {
+		t.Fatalf("inbound = %+v, event = %+v", in, in.Event)
+	}
+
+	if err := c.SendEvent(context.Background(), bus.Event{Type: bus.EventReaction, ChatID: "+15551111111", MessageID: "1700000001000:+15551111111", Content: "❤️"}); err != nil {
+		t.Fatal(err)
+	}
+	reaction := daemon.next(t, "sendReaction")
+	if reaction.Params["emoji"] != "❤️" || reaction.Params["targetAuthor"] != "+15551111111" ||
+		reaction.Params["targetTimestamp"] != float64(1700000001000) || fmt.Sprint(reaction.Params["recipient"]) != "[+15551111111]" {
+		t.Errorf("sendReaction params = %v", reaction.Params)
+	}
+
+	c.SendEvent(context.Background(), bus.Event{Type: bus.EventTypingStart, ChatID: "group:Z3JvdXA="})
+	if typing := daemon.next(t, "sendTyping"); typing.Params["stop"] != false || typing.Params["groupId"] != "Z3JvdXA=" {
+		t.Errorf("sendTyping params = %v", typing.Params)
+	}
+	c.SendEvent(context.Background(), bus.Event{Type: bus.EventTypingStop, ChatID: "group:Z3JvdXA="})
+	if typing := daemon.next(t, "sendTyping"); typing.Params["stop"] != true {
+		t.Errorf("sendTyping params = %v", typing.Params)
+	}
+}
+
+func TestSignalSendMediaAndErrors(t *testing.T) {
+	c, _, daemon := startTestSignal(t)
+
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("buy milk"), 0o644)
+	if err := c.Send(context.Background(), bus.OutboundMessage{Channel: "signal", ChatID: "+15551111111", Content: "Here you go", Media: []string{path}}); err != nil {
+		t.Fatal(err)
+	}
+	send := daemon.next(t, "send")
+	attachments, _ := send.Params["attachments"].([]interface{})
+	want := "data:text/plain;filename=notes.txt;base64," + base64.StdEncoding.EncodeToString([]byte("buy milk"))
+	if len(attachments) != 1 || attachments[0] != want {
+		t.Errorf("attachments = %v", attachments)
+	}
+
+	if err := assertPermanentSendError(t, c, "+0"); !strings.Contains(fmt.Sprint(err), "Invalid recipient") {
+		t.Errorf("Send = %v, want the daemon's error message", err)
+	}
+}
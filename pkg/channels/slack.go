@@ -6,7 +6,6 @@ import (
 	"os"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
@@ -25,10 +24,12 @@ type SlackChannel struct {
 	api          *slack.Client
 	socketClient *socketmode.Client
 	botUserID    string
-	transcriber  *voice.GroqTranscriber
 	ctx          context.Context
 	cancel       context.CancelFunc
 	pendingAcks  sync.Map
+
+	parentsMu     sync.Mutex
+	threadParents map[string]string // "channel/thread_ts" -> parent message text
 }
 
 type slackMessageRef struct {
@@ -58,10 +59,6 @@ func NewSlackChannel(cfg config.SlackConfig, messageBus *bus.MessageBus) (*Slack
 	}, nil
 }
 
-func (c *SlackChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
-	c.transcriber = transcriber
-}
-
 func (c *SlackChannel) Start(ctx context.Context) error {
 	logger.InfoC("slack", "Starting Slack channel (Socket Mode)")
 
@@ -114,20 +111,42 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 
 	channelID, threadTS := parseSlackChatID(msg.ChatID)
 	if channelID == "" {
-		return fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
+		return permanent(fmt.Errorf("invalid slack chat ID: %s", msg.ChatID))
+	}
+
+	sentVoice := false
+	if audioPath := c.voiceReply(ctx, msg, voice.FormatMP3); audioPath != "" {
+		err := c.sendVoice(ctx, channelID, threadTS, audioPath)
+		os.Remove(audioPath)
+		if err == nil {
+			sentVoice = true
+		} else {
+			logger.ErrorCF("slack", "Failed to send voice reply, falling back to text", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
 	}
 
-	opts := []slack.MsgOption{
-		slack.MsgOptionText(msg.Content, false),
-	}
+	if !sentVoice {
+		opts := []slack.MsgOption{
+			slack.MsgOptionText(msg.Content, false),
+		}
+		if msg.IsRich() {
+			// The text stays as the notification fallback.
+			opts = []slack.MsgOption{
+				slack.MsgOptionText(renderRichText(msg), false),
+				slack.MsgOptionBlocks(slackRichBlocks(msg)...),
+			}
+		}
 
-	if threadTS != "" {
-		opts = append(opts, slack.MsgOptionTS(threadTS))
-	}
+		if threadTS != "" {
+			opts = append(opts, slack.MsgOptionTS(threadTS))
+		}
 
-	_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
-	if err != nil {
-		return fmt.Errorf("failed to send slack message: %w", err)
+		_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to send slack message: %w", err)
+		}
 	}
 
 	if ref, ok := c.pendingAcks.LoadAndDelete(msg.ChatID); ok {
@@ -146,6 +165,24 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	return nil
 }
 
+// sendVoice uploads a spoken answer as an audio file (needs the files:write
+// scope).
+func (c *SlackChannel) sendVoice(ctx context.Context, channelID, threadTS, audioPath string) error {
+	info, err := os.Stat(audioPath)
+	if err != nil {
+		return fmt.Errorf("opening voice file: %w", err)
+	}
+	_, err = c.api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+		File:            audioPath,
+		FileSize:        int(info.Size()),
+		Filename:        "reply.mp3",
+		Title:           "Voice reply",
+		Channel:         channelID,
+		ThreadTimestamp: threadTS,
+	})
+	return err
+}
+
 func (c *SlackChannel) eventLoop() {
 	for {
 		select {
@@ -164,6 +201,9 @@ func (c *SlackChannel) eventLoop() {
 				if event.Request != nil {
 					c.socketClient.Ack(*event.Request)
 				}
+				if callback, ok := event.Data.(slack.InteractionCallback); ok {
+					c.handleInteraction(callback)
+				}
 			}
 		}
 	}
@@ -184,10 +224,176 @@ func (c *SlackChannel) handleEventsAPI(event socketmode.Event) {
 		c.handleMessageEvent(ev)
 	case *slackevents.AppMentionEvent:
 		c.handleAppMention(ev)
+	case *slackevents.ReactionAddedEvent:
+		c.handleReactionAdded(ev)
+	}
+}
+
+func (c *SlackChannel) handleReactionAdded(ev *slackevents.ReactionAddedEvent) {
+	if ev.User == c.botUserID || ev.Item.Channel == "" {
+		return
+	}
+	c.HandleEvent(ev.User, bus.Event{
+		Type:      bus.EventReaction,
+		ChatID:    ev.Item.Channel,
+		MessageID: ev.Item.Timestamp,
+		Content:   ev.Reaction,
+	}, map[string]string{
+		"user_id": ev.User,
+	})
+}
+
+// handleMessageChanged publishes an edit of a user's message.
+func (c *SlackChannel) handleMessageChanged(ev *slackevents.MessageEvent) {
+	edited := ev.Message
+	if edited == nil || edited.User == "" || edited.User == c.botUserID || edited.BotID != "" {
+		return
+	}
+	chatID := ev.Channel
+	if edited.ThreadTimestamp != "" && edited.ThreadTimestamp != edited.Timestamp {
+		chatID = ev.Channel + "/" + edited.ThreadTimestamp
+	}
+	c.HandleEvent(edited.User, bus.Event{
+		Type:      bus.EventEdit,
+		ChatID:    chatID,
+		MessageID: edited.Timestamp,
+		Content:   c.stripBotMention(edited.Text),
+	}, map[string]string{
+		"user_id": edited.User,
+	})
+}
+
+// RendersRich reports that Slack shows buttons, choices and cards as Block
+// Kit blocks.
+func (c *SlackChannel) RendersRich() bool {
+	return true
+}
+
+// slackRichBlocks lays out a card, the text, buttons and a select menu for
+// choices (Slack allows 25 buttons per actions block and 100 options).
+func slackRichBlocks(msg bus.OutboundMessage) []slack.Block {
+	var blocks []slack.Block
+	if card := msg.Card; card != nil {
+		if card.Title != "" {
+			blocks = append(blocks, slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, utils.Truncate(card.Title, 150), false, false)))
+		}
+		if text := strings.TrimSpace(card.Text + "\n" + card.URL); text != "" {
+			blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+		}
+		if card.ImageURL != "" {
+			blocks = append(blocks, slack.NewImageBlock(card.ImageURL, card.Title, "", nil))
+		}
+	}
+	if msg.Content != "" {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, utils.Truncate(msg.Content, 3000), false, false), nil, nil))
+	}
+
+	var elements []slack.BlockElement
+	for i, b := range msg.Buttons {
+		if i == 25 {
+			break
+		}
+		elements = append(elements, slack.NewButtonBlockElement(
+			fmt.Sprintf("choice_%d", i), truncateBytes(b.Payload(), 2000),
+			slack.NewTextBlockObject(slack.PlainTextType, utils.Truncate(b.Label, 75), false, false)))
+	}
+	if len(elements) > 0 {
+		blocks = append(blocks, slack.NewActionBlock("", elements...))
+	}
+
+	if len(msg.Choices) > 0 {
+		var options []*slack.OptionBlockObject
+		for i, b := range msg.Choices {
+			if i == 100 {
+				break
+			}
+			options = append(options, slack.NewOptionBlockObject(
+				utils.Truncate(b.Payload(), 150),
+				slack.NewTextBlockObject(slack.PlainTextType, utils.Truncate(b.Label, 75), false, false), nil))
+		}
+		menu := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic,
+			slack.NewTextBlockObject(slack.PlainTextType, "Choose…", false, false), "choice_select", options...)
+		blocks = append(blocks, slack.NewActionBlock("", menu))
 	}
+	return blocks
+}
+
+// handleInteraction turns a press on one of our buttons or a pick from our
+// select menu into a choice event, and strips the blocks from the message so
+// the choice cannot be made twice.
+func (c *SlackChannel) handleInteraction(callback slack.InteractionCallback) {
+	if callback.Type != slack.InteractionTypeBlockActions {
+		return
+	}
+	var payload string
+	for _, action := range callback.ActionCallback.BlockActions {
+		if !strings.HasPrefix(action.ActionID, "choice_") {
+			continue
+		}
+		payload = action.Value
+		if action.SelectedOption.Value != "" {
+			payload = action.SelectedOption.Value
+		}
+		break
+	}
+	if payload == "" {
+		return
+	}
+
+	channelID := callback.Channel.ID
+	if channelID == "" {
+		channelID = callback.Container.ChannelID
+	}
+	chatID := channelID
+	if threadTS := callback.Container.ThreadTs; threadTS != "" {
+		chatID = channelID + "/" + threadTS
+	}
+	messageTS := callback.Container.MessageTs
+
+	if messageTS != "" && callback.Message.Text != "" {
+		c.api.UpdateMessage(channelID, messageTS, slack.MsgOptionText(callback.Message.Text, false))
+	}
+
+	c.HandleEvent(callback.User.ID, bus.Event{
+		Type:      bus.EventChoice,
+		ChatID:    chatID,
+		MessageID: messageTS,
+		Content:   payload,
+	}, map[string]string{
+		"user_id": callback.User.ID,
+	})
+}
+
+// SupportedEvents lists the outbound events Slack handles. Bots cannot show
+// a typing indicator over the Events API.
+func (c *SlackChannel) SupportedEvents() []bus.EventType {
+	return []bus.EventType{bus.EventEdit, bus.EventDelete, bus.EventReaction}
+}
+
+func (c *SlackChannel) SendEvent(ctx context.Context, ev bus.Event) error {
+	channelID, _ := parseSlackChatID(ev.ChatID)
+	switch ev.Type {
+	case bus.EventEdit:
+		_, _, _, err := c.api.UpdateMessageContext(ctx, channelID, ev.MessageID, slack.MsgOptionText(ev.Content, false))
+		return err
+	case bus.EventDelete:
+		_, _, err := c.api.DeleteMessageContext(ctx, channelID, ev.MessageID)
+		return err
+	case bus.EventReaction:
+		return c.api.AddReactionContext(ctx, strings.Trim(ev.Content, ":"), slack.ItemRef{
+			Channel:   channelID,
+			Timestamp: ev.MessageID,
+		})
+	}
+	return nil
 }
 
 func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
+	// Edits carry the author on the nested message, not the event.
+	if ev.SubType == "message_changed" {
+		c.handleMessageChanged(ev)
+		return
+	}
 	if ev.User == c.botUserID || ev.User == "" {
 		return
 	}
@@ -244,6 +450,7 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		}
 	}()
 
+	hasAudio := false
 	if ev.Message != nil && len(ev.Message.Files) > 0 {
 		for _, file := range ev.Message.Files {
 			localPath := c.downloadSlackFile(file)
@@ -253,17 +460,9 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 			localFiles = append(localFiles, localPath)
 			mediaPaths = append(mediaPaths, localPath)
 
-			if utils.IsAudioFile(file.Name, file.Mimetype) && c.transcriber != nil && c.transcriber.IsAvailable() {
-				ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
-				defer cancel()
-				result, err := c.transcriber.Transcribe(ctx, localPath)
-
-				if err != nil {
-					logger.ErrorCF("slack", "Voice transcription failed", map[string]interface{}{"error": err.Error()})
-					content += fmt.Sprintf("\n[audio: %s (transcription failed)]", file.Name)
-				} else {
-					content += fmt.Sprintf("\n[voice transcription: %s]", result.Text)
-				}
+			if utils.IsAudioFile(file.Name, file.Mimetype) {
+				hasAudio = true
+				content += "\n" + c.transcribeAudio(c.ctx, localPath, "audio: "+file.Name)
 			} else {
 				content += fmt.Sprintf("\n[file: %s]", file.Name)
 			}
@@ -273,6 +472,7 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 	if strings.TrimSpace(content) == "" {
 		return
 	}
+	c.markVoiceInput(chatID, hasAudio)
 
 	metadata := map[string]string{
 		"message_ts": messageTS,
@@ -280,6 +480,7 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		"thread_ts":  threadTS,
 		"platform":   "slack",
 	}
+	c.addThreadParent(metadata, channelID, threadTS, messageTS)
 
 	logger.DebugCF("slack", "Received message", map[string]interface{}{
 		"sender_id":  senderID,
@@ -291,6 +492,51 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
 }
 
+// addThreadParent records a thread reply as replying to the thread's
+// parent message, with the parent's text as the quote.
+func (c *SlackChannel) addThreadParent(metadata map[string]string, channelID, threadTS, messageTS string) {
+	metadata["message_id"] = messageTS
+	if threadTS == "" || threadTS == messageTS {
+		return
+	}
+	metadata["reply_to_id"] = threadTS
+	metadata["quoted_text"] = c.threadParentText(channelID, threadTS)
+}
+
+// threadParentText fetches the first message of a thread, caching it since
+// every reply in the thread asks for the same one.
+func (c *SlackChannel) threadParentText(channelID, threadTS string) string {
+	key := channelID + "/" + threadTS
+	c.parentsMu.Lock()
+	text, ok := c.threadParents[key]
+	c.parentsMu.Unlock()
+	if ok {
+		return text
+	}
+
+	msgs, _, _, err := c.api.GetConversationRepliesContext(c.ctx, &slack.GetConversationRepliesParameters{
+		ChannelID: channelID,
+		Timestamp: threadTS,
+		Limit:     1,
+	})
+	if err != nil || len(msgs) == 0 {
+		logger.DebugCF("slack", "Failed to fetch thread parent", map[string]interface{}{
+			"chat_id": key,
+			"error":   fmt.Sprintf("%v", err),
+		})
+		return ""
+	}
+	text = msgs[0].Text
+
+	c.parentsMu.Lock()
+	if c.threadParents == nil || len(c.threadParents) >= 500 {
+		c.threadParents = make(map[string]string)
+	}
+	c.threadParents[key] = text
+	c.parentsMu.Unlock()
+	return text
+}
+
 func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 	if ev.User == c.botUserID {
 		return
@@ -331,6 +577,7 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 		"platform":   "slack",
 		"is_mention": "true",
 	}
+	c.addThreadParent(metadata, channelID, threadTS, messageTS)
 
 	c.HandleMessage(senderID, chatID, content, nil, metadata)
 }
@@ -2,14 +2,12 @@ package channels
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -45,10 +43,8 @@ type TelegramChannel struct {
 	config       config.TelegramConfig
 	appConfig    *config.Config
 	chatIDs      map[string]int64
-	transcriber  *voice.GroqTranscriber
 	placeholders sync.Map // chatID -> messageID
 	stopThinking sync.Map // chatID -> thinkingCancel
-	voiceInput   sync.Map // chatID -> bool (true if last input was voice/audio)
 }
 
 var defaultModels = []string{
@@ -98,16 +94,11 @@ func NewTelegramChannel(cfg config.TelegramConfig, bus *bus.MessageBus, appConfi
 		config:       cfg,
 		appConfig:    appConfig,
 		chatIDs:      make(map[string]int64),
-		transcriber:  nil,
 		placeholders: sync.Map{},
 		stopThinking: sync.Map{},
 	}, nil
 }
 
-func (c *TelegramChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
-	c.transcriber = transcriber
-}
-
 func (c *TelegramChannel) Start(ctx context.Context) error {
 	logger.InfoC("telegram", "Starting Telegram bot (polling mode)...")
 
@@ -121,7 +112,7 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 func (c *TelegramChannel) startPolling(ctx context.Context) error {
 	updates, err := c.bot.UpdatesViaLongPolling(ctx, &telego.GetUpdatesParams{
 		Timeout:        30,
-		AllowedUpdates: []string{"message", "callback_query"},
+		AllowedUpdates: []string{"message", "edited_message", "message_reaction", "callback_query"},
 	})
 	if err != nil {
 		return fmt.Errorf("failed to start long polling: %w", err)
@@ -144,10 +135,15 @@ func (c *TelegramChannel) startPolling(ctx context.Context) error {
 					c.reconnectPolling(ctx)
 					return
 				}
-				if update.CallbackQuery != nil {
+				switch {
+				case update.CallbackQuery != nil:
 					c.handleCallbackQuery(ctx, update)
-				} else if update.Message != nil {
+				case update.Message != nil:
 					c.handleMessage(ctx, update)
+				case update.EditedMessage != nil:
+					c.handleEditedMessage(update.EditedMessage)
+				case update.MessageReaction != nil:
+					c.handleReaction(update.MessageReaction)
 				}
 			}
 		}
@@ -191,9 +187,6 @@ func (c *TelegramChannel) Stop(ctx context.Context) error {
 	return nil
 }
 
-// ttsMaxChars is the max plain-text length for a response to be sent as voice.
-const ttsMaxChars = 300
-
 func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if !c.IsRunning() {
 		return fmt.Errorf("telegram bot not running")
@@ -201,24 +194,15 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 
 	chatID, err := parseChatID(msg.ChatID)
 	if err != nil {
-		return fmt.Errorf("invalid chat ID: %w", err)
+		return permanent(fmt.Errorf("invalid chat ID: %w", err))
 	}
 
-	// Stop thinking animation
-	if stop, ok := c.stopThinking.Load(msg.ChatID); ok {
-		if cf, ok := stop.(*thinkingCancel); ok && cf != nil {
-			cf.Cancel()
-		}
-		c.stopThinking.Delete(msg.ChatID)
-	}
+	// Stop the thinking animation and delete the placeholder before
+	// sending voice or text
+	c.stopThinkingFor(ctx, chatID, msg.ChatID)
 
-	// Delete placeholder before sending voice or text
-	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
-		c.placeholders.Delete(msg.ChatID)
-		_ = c.bot.DeleteMessage(ctx, &telego.DeleteMessageParams{
-			ChatID:    tu.ID(chatID),
-			MessageID: pID.(int),
-		})
+	if msg.IsRich() {
+		return c.sendRich(ctx, chatID, msg)
 	}
 
 	// Send media as photos or documents based on file type
@@ -266,27 +250,23 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		}
 	}
 
-	// Only reply with voice if the user sent a voice/audio message
-	if _, wasVoice := c.voiceInput.LoadAndDelete(msg.ChatID); wasVoice {
-		plainText := stripMarkdown(msg.Content)
-		if len(plainText) > 0 && len(plainText) <= ttsMaxChars && !containsCode(msg.Content) {
-			voiceErr := c.sendVoice(ctx, chatID, plainText)
-			if voiceErr == nil {
-				return nil
-			}
-			logger.ErrorCF("telegram", "TTS failed, falling back to text", map[string]interface{}{
-				"error": voiceErr.Error(),
-			})
+	if audioPath := c.voiceReply(ctx, msg, voice.FormatOpus); audioPath != "" {
+		voiceErr := c.sendVoice(ctx, chatID, audioPath)
+		os.Remove(audioPath)
+		if voiceErr == nil {
+			return nil
 		}
+		logger.ErrorCF("telegram", "Failed to send voice reply, falling back to text", map[string]interface{}{
+			"error": voiceErr.Error(),
+		})
 	}
 
-	// Send as text, splitting if necessary (Telegram limit: 4096 chars)
-	htmlContent := markdownToTelegramHTML(msg.Content)
-	chunks := splitMessage(htmlContent, 4096)
-
-	for _, chunk := range chunks {
+	for i, chunk := range telegramTextChunks(msg.Content, msg.Reasoning) {
 		tgMsg := tu.Message(tu.ID(chatID), chunk)
 		tgMsg.ParseMode = telego.ModeHTML
+		if i == 0 {
+			tgMsg.ReplyParameters = telegramReplyTo(chatID, msg.ReplyTo)
+		}
 
 		if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
 			logger.ErrorCF("telegram", "HTML parse failed, falling back to plain text", map[string]interface{}{
@@ -302,26 +282,142 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	return nil
 }
 
-// sendVoice converts text to speech and sends as a Telegram voice message.
-func (c *TelegramChannel) sendVoice(ctx context.Context, chatID int64, text string) error {
-	tmpMP3 := filepath.Join(os.TempDir(), fmt.Sprintf("chango_tts_%d.mp3", time.Now().UnixNano()))
-	tmpFile := filepath.Join(os.TempDir(), fmt.Sprintf("chango_tts_%d.ogg", time.Now().UnixNano()))
-	defer os.Remove(tmpMP3)
-	defer os.Remove(tmpFile)
+// Chunks are measured in bytes, never fewer than the UTF-16 units Telegram
+// counts, so a chunk that fits also fits when resent as plain text.
+const (
+	telegramMaxMessage   = 4096
+	telegramMaxReasoning = 3500 // runes of reasoning kept before escaping
+)
+
+// telegramTextChunks converts content to Telegram HTML split at the message
+// limit. Collapsed reasoning rides on the first chunk as an expandable
+// quote, or goes ahead on its own when there is no room for it. Long
+// reasoning is truncated so the quote always fits in one message.
+func telegramTextChunks(content, reasoning string) []string {
+	chunks := splitMessage(markdownToTelegramHTML(content), telegramMaxMessage)
+	if reasoning == "" {
+		return chunks
+	}
+
+	var quote string
+	for n := telegramMaxReasoning; ; n = n * 3 / 4 {
+		quote = "<blockquote expandable>💭 " + escapeHTML(utils.Truncate(reasoning, n)) + "</blockquote>"
+		if len(quote) <= telegramMaxMessage {
+			break
+		}
+	}
 
-	// Use edge-tts CLI directly (installed via pip in container)
-	ttsCmd := exec.CommandContext(ctx, "edge-tts", "--voice", "es-AR-TomasNeural", "--text", text, "--write-media", tmpMP3)
-	if output, err := ttsCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("edge-tts failed: %w: %s", err, string(output))
+	if len(quote)+1+len(chunks[0]) <= telegramMaxMessage {
+		chunks[0] = quote + "\n" + chunks[0]
+		return chunks
 	}
+	return append([]string{quote}, chunks...)
+}
 
-	// Convert MP3 to OGG for Telegram voice
-	ffCmd := exec.CommandContext(ctx, "ffmpeg", "-y", "-i", tmpMP3, "-c:a", "libopus", "-b:a", "64k", tmpFile)
-	if output, err := ffCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("ffmpeg failed: %w: %s", err, string(output))
+// telegramReplyTo threads a reply to the triggering message in group chats,
+// where several conversations interleave. Private chats stay unthreaded.
+func telegramReplyTo(chatID int64, replyTo string) *telego.ReplyParameters {
+	if chatID >= 0 || replyTo == "" {
+		return nil
+	}
+	id, err := strconv.Atoi(replyTo)
+	if err != nil {
+		return nil
+	}
+	return &telego.ReplyParameters{MessageID: id, AllowSendingWithoutReply: true}
+}
+
+// RendersRich reports that Telegram shows buttons and choices as an inline
+// keyboard.
+func (c *TelegramChannel) RendersRich() bool {
+	return true
+}
+
+// sendRich sends a message with an inline keyboard: buttons three to a row,
+// choices one per row, and the card's link as a final URL button. A card
+// image goes out as a photo with the text as its caption.
+func (c *TelegramChannel) sendRich(ctx context.Context, chatID int64, msg bus.OutboundMessage) error {
+	var rows [][]telego.InlineKeyboardButton
+	var row []telego.InlineKeyboardButton
+	for _, b := range msg.Buttons {
+		row = append(row, telegramChoiceButton(b))
+		if len(row) == 3 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	for _, b := range msg.Choices {
+		rows = append(rows, tu.InlineKeyboardRow(telegramChoiceButton(b)))
+	}
+
+	text := msg.Content
+	if card := msg.Card; card != nil {
+		cardText := card.Text
+		if card.Title != "" {
+			cardText = strings.TrimSpace("**" + card.Title + "**\n" + card.Text)
+		}
+		text = strings.TrimSpace(text + "\n\n" + cardText)
+		if card.URL != "" {
+			rows = append(rows, tu.InlineKeyboardRow(tu.InlineKeyboardButton("🔗 Open").WithURL(card.URL)))
+		}
+	}
+	var markup *telego.InlineKeyboardMarkup
+	if len(rows) > 0 {
+		markup = tu.InlineKeyboard(rows...)
+	}
+
+	if card := msg.Card; card != nil && card.ImageURL != "" {
+		photo := &telego.SendPhotoParams{
+			ChatID:      tu.ID(chatID),
+			Photo:       tu.FileFromURL(card.ImageURL),
+			Caption:     markdownToTelegramHTML(utils.Truncate(text, 1024)),
+			ParseMode:   telego.ModeHTML,
+			ReplyMarkup: markup,
+		}
+		_, err := c.bot.SendPhoto(ctx, photo)
+		if err == nil {
+			return nil
+		}
+		logger.ErrorCF("telegram", "Failed to send card image, falling back to text", map[string]interface{}{
+			"error": err.Error(),
+		})
+		text = strings.TrimSpace(text + "\n" + card.ImageURL)
+	}
+
+	if text == "" {
+		text = "👇"
 	}
+	tgMsg := tu.Message(tu.ID(chatID), markdownToTelegramHTML(utils.Truncate(text, 4096)))
+	tgMsg.ParseMode = telego.ModeHTML
+	if markup != nil {
+		tgMsg.ReplyMarkup = markup
+	}
+	if _, err := c.bot.SendMessage(ctx, tgMsg); err != nil {
+		tgMsg.ParseMode = ""
+		tgMsg.Text = utils.Truncate(text, 4096)
+		_, err = c.bot.SendMessage(ctx, tgMsg)
+		return err
+	}
+	return nil
+}
+
+// telegramChoiceButton makes an inline button whose callback data is the
+// payload, cut to Telegram's 64-byte limit.
+func telegramChoiceButton(b bus.Button) telego.InlineKeyboardButton {
+	return tu.InlineKeyboardButton(b.Label).WithCallbackData(truncateBytes(b.Payload(), 64))
+}
 
-	voiceFile, err := os.Open(tmpFile)
+// RendersReasoning reports that Telegram shows reasoning as an expandable blockquote.
+func (c *TelegramChannel) RendersReasoning() bool {
+	return true
+}
+
+// sendVoice sends an Ogg/Opus file as a Telegram voice message.
+func (c *TelegramChannel) sendVoice(ctx context.Context, chatID int64, audioPath string) error {
+	voiceFile, err := os.Open(audioPath)
 	if err != nil {
 		return fmt.Errorf("opening voice file: %w", err)
 	}
@@ -422,11 +518,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 		photoPath := c.downloadPhoto(ctx, photo.FileID)
 		if photoPath != "" {
 			localFiles = append(localFiles, photoPath)
-			// Read and base64-encode the image so it survives temp file cleanup
-			if imgData, err := os.ReadFile(photoPath); err == nil {
-				dataURI := "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(imgData)
-				mediaPaths = append(mediaPaths, dataURI)
-			}
+			mediaPaths = append(mediaPaths, photoPath)
 			if content != "" {
 				content += "\n"
 			}
@@ -435,13 +527,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 	}
 
 	// Track whether this input is voice/audio for TTS response
-	isVoiceInput := message.Voice != nil || message.Audio != nil
-	voiceKey := fmt.Sprintf("%d", chatID)
-	if isVoiceInput {
-		c.voiceInput.Store(voiceKey, true)
-	} else {
-		c.voiceInput.Delete(voiceKey)
-	}
+	c.markVoiceInput(fmt.Sprintf("%d", chatID), message.Voice != nil || message.Audio != nil)
 
 	if message.Voice != nil {
 		voicePath := c.downloadFile(ctx, message.Voice.FileID, ".ogg")
@@ -449,32 +535,10 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 			localFiles = append(localFiles, voicePath)
 			mediaPaths = append(mediaPaths, voicePath)
 
-			transcribedText := ""
-			if c.transcriber != nil && c.transcriber.IsAvailable() {
-				ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-				defer cancel()
-
-				result, err := c.transcriber.Transcribe(ctx, voicePath)
-				if err != nil {
-					logger.ErrorCF("telegram", "Voice transcription failed", map[string]interface{}{
-						"error": err.Error(),
-						"path":  voicePath,
-					})
-					transcribedText = fmt.Sprintf("[voice (transcription failed)]")
-				} else {
-					transcribedText = fmt.Sprintf("[voice transcription: %s]", result.Text)
-					logger.InfoCF("telegram", "Voice transcribed successfully", map[string]interface{}{
-						"text": result.Text,
-					})
-				}
-			} else {
-				transcribedText = fmt.Sprintf("[voice]")
-			}
-
 			if content != "" {
 				content += "\n"
 			}
-			content += transcribedText
+			content += c.transcribeAudio(ctx, voicePath, "voice")
 		}
 	}
 
@@ -503,26 +567,12 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 				fileName = message.Document.FileName
 			}
 
-			// Extract text from PDFs using pdftotext
-			if mimeType == "application/pdf" || strings.HasSuffix(strings.ToLower(fileName), ".pdf") {
-				pdfText := c.extractPDFText(docPath)
-				if pdfText != "" {
-					if content != "" {
-						content += "\n"
-					}
-					content += fmt.Sprintf("[PDF: %s]\n%s", fileName, pdfText)
-				} else {
-					if content != "" {
-						content += "\n"
-					}
-					content += fmt.Sprintf("[PDF: %s - no se pudo extraer texto]", fileName)
-				}
+			// Documents are extracted and stored; other files pass through as media
+			if note := c.ingestDocument(docPath, fileName, mimeType); note != "" {
+				content = appendContent(content, note)
 			} else {
 				mediaPaths = append(mediaPaths, docPath)
-				if content != "" {
-					content += "\n"
-				}
-				content += fmt.Sprintf("[file: %s]", fileName)
+				content = appendContent(content, fmt.Sprintf("[file: %s]", fileName))
 			}
 		}
 	}
@@ -537,32 +587,6 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 		"preview":   utils.Truncate(content, 50),
 	})
 
-	// Thinking indicator
-	err := c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping))
-	if err != nil {
-		logger.ErrorCF("telegram", "Failed to send chat action", map[string]interface{}{
-			"error": err.Error(),
-		})
-	}
-
-	// Stop any previous thinking animation
-	chatIDStr := fmt.Sprintf("%d", chatID)
-	if prevStop, ok := c.stopThinking.Load(chatIDStr); ok {
-		if cf, ok := prevStop.(*thinkingCancel); ok && cf != nil {
-			cf.Cancel()
-		}
-	}
-
-	// Create cancel function for thinking state
-	_, thinkCancel := context.WithTimeout(ctx, 5*time.Minute)
-	c.stopThinking.Store(chatIDStr, &thinkingCancel{fn: thinkCancel})
-
-	pMsg, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(chatID), "Thinking... 💭"))
-	if err == nil {
-		pID := pMsg.MessageID
-		c.placeholders.Store(chatIDStr, pID)
-	}
-
 	metadata := map[string]string{
 		"message_id": fmt.Sprintf("%d", message.MessageID),
 		"user_id":    fmt.Sprintf("%d", user.ID),
@@ -570,10 +594,29 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 		"first_name": user.FirstName,
 		"is_group":   fmt.Sprintf("%t", message.Chat.Type != "private"),
 	}
+	if reply := message.ReplyToMessage; reply != nil {
+		metadata["reply_to_id"] = fmt.Sprintf("%d", reply.MessageID)
+		metadata["quoted_text"] = telegramQuotedText(message)
+	}
 
 	c.HandleMessage(senderID, fmt.Sprintf("%d", chatID), content, mediaPaths, metadata)
 }
 
+// telegramQuotedText returns the part of the replied-to message the user
+// quoted, or all of its text or caption.
+func telegramQuotedText(message *telego.Message) string {
+	if message.Quote != nil && message.Quote.Text != "" {
+		return message.Quote.Text
+	}
+	if reply := message.ReplyToMessage; reply != nil {
+		if reply.Text != "" {
+			return reply.Text
+		}
+		return reply.Caption
+	}
+	return ""
+}
+
 func (c *TelegramChannel) downloadPhoto(ctx context.Context, fileID string) string {
 	file, err := c.bot.GetFile(ctx, &telego.GetFileParams{FileID: fileID})
 	if err != nil {
@@ -613,31 +656,6 @@ func (c *TelegramChannel) downloadFile(ctx context.Context, fileID, ext string)
 	return c.downloadFileWithInfo(file, ext)
 }
 
-// extractPDFText uses pdftotext to extract text from a PDF file.
-// Returns extracted text (truncated to 15000 chars to avoid context overflow).
-func (c *TelegramChannel) extractPDFText(pdfPath string) string {
-	cmd := exec.Command("pdftotext", "-layout", pdfPath, "-")
-	output, err := cmd.Output()
-	if err != nil {
-		logger.ErrorCF("telegram", "Failed to extract PDF text", map[string]interface{}{
-			"path":  pdfPath,
-			"error": err.Error(),
-		})
-		return ""
-	}
-
-	text := strings.TrimSpace(string(output))
-	if len(text) > 15000 {
-		text = text[:15000] + "\n\n[... texto truncado, PDF muy largo ...]"
-	}
-
-	logger.InfoCF("telegram", "PDF text extracted", map[string]interface{}{
-		"path":  pdfPath,
-		"chars": len(text),
-	})
-	return text
-}
-
 func (c *TelegramChannel) sendModelMenu(ctx context.Context, chatID int64) {
 	models := c.appConfig.Agents.Defaults.AvailableModels
 	if len(models) == 0 {
@@ -667,7 +685,11 @@ func (c *TelegramChannel) sendModelMenu(ctx context.Context, chatID int64) {
 
 func (c *TelegramChannel) handleCallbackQuery(ctx context.Context, update telego.Update) {
 	query := update.CallbackQuery
-	if query == nil || !strings.HasPrefix(query.Data, "model:") {
+	if query == nil {
+		return
+	}
+	if !strings.HasPrefix(query.Data, "model:") {
+		c.handleChoice(ctx, query)
 		return
 	}
 
@@ -703,6 +725,188 @@ func (c *TelegramChannel) handleCallbackQuery(ctx context.Context, update telego
 	})
 }
 
+// handleChoice publishes a press on an inline keyboard button as a choice
+// event carrying the button's callback data.
+func (c *TelegramChannel) handleChoice(ctx context.Context, query *telego.CallbackQuery) {
+	_ = c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID))
+	if query.Message == nil {
+		return
+	}
+
+	// Remove the keyboard so the choice cannot be made twice.
+	_, _ = c.bot.EditMessageReplyMarkup(ctx, &telego.EditMessageReplyMarkupParams{
+		ChatID:    tu.ID(query.Message.GetChat().ID),
+		MessageID: query.Message.GetMessageID(),
+	})
+
+	ev := bus.Event{
+		Type:      bus.EventChoice,
+		ChatID:    fmt.Sprintf("%d", query.Message.GetChat().ID),
+		MessageID: fmt.Sprintf("%d", query.Message.GetMessageID()),
+		Content:   query.Data,
+	}
+	c.HandleEvent(telegramSenderID(query.From), ev, map[string]string{
+		"user_id":  fmt.Sprintf("%d", query.From.ID),
+		"username": query.From.Username,
+	})
+}
+
+func (c *TelegramChannel) handleEditedMessage(message *telego.Message) {
+	if message.From == nil {
+		return
+	}
+	text := message.Text
+	if text == "" {
+		text = message.Caption
+	}
+	ev := bus.Event{
+		Type:      bus.EventEdit,
+		ChatID:    fmt.Sprintf("%d", message.Chat.ID),
+		MessageID: fmt.Sprintf("%d", message.MessageID),
+		Content:   text,
+	}
+	c.HandleEvent(telegramSenderID(*message.From), ev, map[string]string{
+		"user_id":  fmt.Sprintf("%d", message.From.ID),
+		"username": message.From.Username,
+	})
+}
+
+func (c *TelegramChannel) handleReaction(reaction *telego.MessageReactionUpdated) {
+	if reaction.User == nil {
+		return
+	}
+	// Only added emoji reactions are reported; removals carry no emoji.
+	emoji := ""
+	for _, r := range reaction.NewReaction {
+		if e, ok := r.(*telego.ReactionTypeEmoji); ok {
+			emoji = e.Emoji
+			break
+		}
+	}
+	if emoji == "" {
+		return
+	}
+	ev := bus.Event{
+		Type:      bus.EventReaction,
+		ChatID:    fmt.Sprintf("%d", reaction.Chat.ID),
+		MessageID: fmt.Sprintf("%d", reaction.MessageID),
+		Content:   emoji,
+	}
+	c.HandleEvent(telegramSenderID(*reaction.User), ev, map[string]string{
+		"user_id":  fmt.Sprintf("%d", reaction.User.ID),
+		"username": reaction.User.Username,
+	})
+}
+
+// telegramSenderID formats a user as "id|username", the sender ID used for
+// allowlist checks.
+func telegramSenderID(user telego.User) string {
+	if user.Username != "" {
+		return fmt.Sprintf("%d|%s", user.ID, user.Username)
+	}
+	return fmt.Sprintf("%d", user.ID)
+}
+
+// SupportedEvents lists the outbound events Telegram handles.
+func (c *TelegramChannel) SupportedEvents() []bus.EventType {
+	return []bus.EventType{bus.EventTypingStart, bus.EventTypingStop, bus.EventEdit, bus.EventDelete, bus.EventReaction}
+}
+
+func (c *TelegramChannel) SendEvent(ctx context.Context, ev bus.Event) error {
+	chatID, err := parseChatID(ev.ChatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	switch ev.Type {
+	case bus.EventTypingStart:
+		c.startThinking(chatID, ev.ChatID)
+		return nil
+	case bus.EventTypingStop:
+		c.stopThinkingFor(ctx, chatID, ev.ChatID)
+		return nil
+	}
+
+	messageID, err := strconv.Atoi(ev.MessageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID %q", ev.MessageID)
+	}
+	switch ev.Type {
+	case bus.EventEdit:
+		_, err = c.bot.EditMessageText(ctx, &telego.EditMessageTextParams{
+			ChatID:    tu.ID(chatID),
+			MessageID: messageID,
+			Text:      markdownToTelegramHTML(ev.Content),
+			ParseMode: telego.ModeHTML,
+		})
+	case bus.EventDelete:
+		err = c.bot.DeleteMessage(ctx, &telego.DeleteMessageParams{ChatID: tu.ID(chatID), MessageID: messageID})
+	case bus.EventReaction:
+		err = c.bot.SetMessageReaction(ctx, &telego.SetMessageReactionParams{
+			ChatID:    tu.ID(chatID),
+			MessageID: messageID,
+			Reaction:  []telego.ReactionType{&telego.ReactionTypeEmoji{Type: telego.ReactionEmoji, Emoji: ev.Content}},
+		})
+	}
+	return err
+}
+
+// startThinking shows a "Thinking..." placeholder and keeps the typing
+// action alive (Telegram clears it after five seconds) until the reply is
+// sent, typing stops, or five minutes pass.
+func (c *TelegramChannel) startThinking(chatID int64, chatIDStr string) {
+	// Stop any previous thinking animation
+	if prevStop, ok := c.stopThinking.Load(chatIDStr); ok {
+		if cf, ok := prevStop.(*thinkingCancel); ok && cf != nil {
+			cf.Cancel()
+		}
+	}
+
+	thinkCtx, thinkCancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	c.stopThinking.Store(chatIDStr, &thinkingCancel{fn: thinkCancel})
+
+	go func() {
+		ticker := time.NewTicker(4 * time.Second)
+		defer ticker.Stop()
+		for {
+			err := c.bot.SendChatAction(thinkCtx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping))
+			if err != nil && thinkCtx.Err() == nil {
+				logger.ErrorCF("telegram", "Failed to send chat action", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			select {
+			case <-thinkCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	if _, ok := c.placeholders.Load(chatIDStr); ok {
+		return
+	}
+	pMsg, err := c.bot.SendMessage(thinkCtx, tu.Message(tu.ID(chatID), "Thinking... 💭"))
+	if err == nil {
+		c.placeholders.Store(chatIDStr, pMsg.MessageID)
+	}
+}
+
+// stopThinkingFor ends the typing action and removes the placeholder.
+func (c *TelegramChannel) stopThinkingFor(ctx context.Context, chatID int64, chatIDStr string) {
+	if stop, ok := c.stopThinking.LoadAndDelete(chatIDStr); ok {
+		if cf, ok := stop.(*thinkingCancel); ok && cf != nil {
+			cf.Cancel()
+		}
+	}
+	if pID, ok := c.placeholders.LoadAndDelete(chatIDStr); ok {
+		_ = c.bot.DeleteMessage(ctx, &telego.DeleteMessageParams{
+			ChatID:    tu.ID(chatID),
+			MessageID: pID.(int),
+		})
+	}
+}
+
 // splitMessage splits a message into chunks that fit within Telegram's character limit.
 // It tries to split at paragraph boundaries (\n\n), then at line breaks (\n),
 // and as a last resort at the exact limit.
@@ -0,0 +1,38 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTelegramTextChunks(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		reasoning string
+	}{
+		{name: "plain answer", content: "Hello"},
+		{name: "short reasoning", content: "Hello", reasoning: "thinking"},
+		{name: "long reasoning", content: "Hello", reasoning: strings.Repeat("a", 10000)},
+		{name: "long escaped reasoning", content: "Hello", reasoning: strings.Repeat("<&>", 5000)},
+		{name: "long multibyte reasoning", content: "Hello", reasoning: strings.Repeat("思", 5000)},
+		{name: "long reasoning and answer", content: strings.Repeat("b", 5000), reasoning: strings.Repeat("a", 10000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := telegramTextChunks(tt.content, tt.reasoning)
+			for i, c := range chunks {
+				if len(c) > telegramMaxMessage {
+					t.Errorf("chunk %d is %d bytes, over the %d limit", i, len(c), telegramMaxMessage)
+				}
+			}
+			if got := strings.Join(chunks, ""); !strings.HasSuffix(got, tt.content) {
+				t.Error("answer missing from chunks")
+			}
+			if tt.reasoning != "" && !strings.HasPrefix(chunks[0], "<blockquote expandable>") {
+				t.Errorf("first chunk = %.40q, want the reasoning quote", chunks[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,471 @@
+package channels
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+//go:embed webui
+var webUI embed.FS
+
+const (
+	// maxWebFrame bounds a browser frame; uploaded images travel inline.
+	maxWebFrame = 16 << 20
+
+	// webAuthTimeout is how long a new connection has to log in.
+	webAuthTimeout = 10 * time.Second
+
+	// webPingInterval keeps idle connections open through proxies.
+	webPingInterval = 30 * time.Second
+
+	// maxWebSessions and maxWebMessages bound the stored transcripts; the
+	// least recently used sessions and the oldest messages go first.
+	maxWebSessions = 100
+	maxWebMessages = 200
+
+	// maxStoredMedia is the largest inline image kept in a transcript.
+	maxStoredMedia = 512 << 10
+)
+
+// webSessionID keeps browser-chosen session IDs safe for session keys and
+// file names.
+var webSessionID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// WebChannel is the built-in browser chat. The gateway serves its page and
+// WebSocket (see Register); every browser logged in with the token is the
+// same user, and each conversation in the sidebar is its own session.
+//
+// Frames are JSON objects with a "type". The browser sends "auth" (with
+// "token") first, then "message" (session, content, media as data URIs)
+// and "history" (session). The channel answers "ready" with the session
+// list, and pushes "message", "event" (typing and tool progress),
+// "sessions" and "history" frames.
+type WebChannel struct {
+	*BaseChannel
+	config   config.WebChatConfig
+	upgrader websocket.Upgrader
+	storeDir string
+
+	clientsMu sync.Mutex
+	clients   map[*webClient]struct{}
+
+	mu       sync.Mutex
+	sessions map[string]*webSession
+	// saveMu orders transcript writes, which happen outside mu so a slow
+	// disk never holds up the session list or history.
+	saveMu sync.Mutex
+}
+
+type webClient struct {
+	conn *websocket.Conn
+	mu   sync.Mutex // serializes writes
+}
+
+func (wc *webClient) write(frame webFrame) error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return wc.conn.WriteJSON(frame)
+}
+
+type webFrame struct {
+	Type      string           `json:"type"`
+	Token     string           `json:"token,omitempty"`
+	Session   string           `json:"session,omitempty"`
+	Content   string           `json:"content,omitempty"`
+	Reasoning string           `json:"reasoning,omitempty"`
+	Media     []string         `json:"media,omitempty"`
+	Event     *bus.Event       `json:"event,omitempty"`
+	Sessions  []webSessionInfo `json:"sessions,omitempty"`
+	Messages  []webMessage     `json:"messages,omitempty"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// webSession is one conversation's transcript as the browser shows it.
+type webSession struct {
+	ID       string       `json:"id"`
+	Title    string       `json:"title"`
+	Updated  time.Time    `json:"updated"`
+	Messages []webMessage `json:"messages"`
+}
+
+type webSessionInfo struct {
+	ID      string    `json:"id"`
+	Title   string    `json:"title"`
+	Updated time.Time `json:"updated"`
+}
+
+type webMessage struct {
+	Role      string    `json:"role"` // "user" or "assistant"
+	Content   string    `json:"content"`
+	Reasoning string    `json:"reasoning,omitempty"`
+	Media     []string  `json:"media,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// NewWebChannel creates the browser chat. Each session's transcript is kept
+// in its own file under storeDir so the session list survives restarts; an
+// empty dir keeps them in memory.
+func NewWebChannel(cfg config.WebChatConfig, messageBus *bus.MessageBus, storeDir string) (*WebChannel, error) {
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("web chat token is required")
+	}
+	if cfg.Path == "" {
+		cfg.Path = "/chat"
+	}
+	cfg.Path = "/" + strings.Trim(cfg.Path, "/")
+
+	c := &WebChannel{
+		BaseChannel: NewBaseChannel("web", cfg, messageBus, nil),
+		config:      cfg,
+		storeDir:    storeDir,
+		clients:     make(map[*webClient]struct{}),
+		sessions:    make(map[string]*webSession),
+	}
+	c.load()
+	return c, nil
+}
+
+// Register mounts the chat page at the configured path and its WebSocket
+// at <path>/ws.
+func (c *WebChannel) Register(mux *http.ServeMux) {
+	assets, _ := fs.Sub(webUI, "webui")
+	base := c.config.Path
+	mux.Handle(base+"/", http.StripPrefix(base+"/", http.FileServer(http.FS(assets))))
+	mux.HandleFunc(base+"/ws", c.serveWS)
+	mux.HandleFunc(base, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, base+"/", http.StatusMovedPermanently)
+	})
+}
+
+// Path is where the chat page is served.
+func (c *WebChannel) Path() string {
+	return c.config.Path
+}
+
+func (c *WebChannel) Start(ctx context.Context) error {
+	c.setRunning(true)
+	logger.InfoCF("web", "Web chat channel started", map[string]interface{}{
+		"path": c.config.Path,
+	})
+	return nil
+}
+
+func (c *WebChannel) Stop(ctx context.Context) error {
+	c.clientsMu.Lock()
+	for client := range c.clients {
+		client.conn.Close()
+	}
+	c.clientsMu.Unlock()
+	c.setRunning(false)
+	return nil
+}
+
+// Send records the reply in the session's transcript and pushes it to every
+// open browser. With no browser open it is shown on the next visit.
+func (c *WebChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	media := webMedia(msg.Media)
+	c.record(msg.ChatID, webMessage{Role: "assistant", Content: msg.Content, Reasoning: msg.Reasoning, Media: media})
+	c.broadcast(webFrame{Type: "message", Session: msg.ChatID, Content: msg.Content, Reasoning: msg.Reasoning, Media: media})
+	return nil
+}
+
+// RendersReasoning reports that the page shows reasoning in a collapsible
+// block.
+func (c *WebChannel) RendersReasoning() bool {
+	return true
+}
+
+func (c *WebChannel) SupportedEvents() []bus.EventType {
+	return []bus.EventType{bus.EventTypingStart, bus.EventTypingStop, bus.EventToolCall}
+}
+
+func (c *WebChannel) SendEvent(ctx context.Context, ev bus.Event) error {
+	c.broadcast(webFrame{Type: "event", Session: ev.ChatID, Event: &ev})
+	return nil
+}
+
+func (c *WebChannel) serveWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := c.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxWebFrame)
+
+	conn.SetReadDeadline(time.Now().Add(webAuthTimeout))
+	var auth webFrame
+	if err := conn.ReadJSON(&auth); err != nil || auth.Type != "auth" || !secretEqual(auth.Token, c.config.Token) {
+		logger.WarnCF("web", "Web chat login rejected", map[string]interface{}{
+			"remote": r.RemoteAddr,
+		})
+		conn.WriteJSON(webFrame{Type: "error", Error: "unauthorized"})
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	client := &webClient{conn: conn}
+	c.clientsMu.Lock()
+	c.clients[client] = struct{}{}
+	c.clientsMu.Unlock()
+	defer func() {
+		c.clientsMu.Lock()
+		delete(c.clients, client)
+		c.clientsMu.Unlock()
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(webPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+			}
+		}
+	}()
+
+	client.write(webFrame{Type: "ready", Sessions: c.sessionList()})
+
+	for {
+		var frame webFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			return
+		}
+		if !webSessionID.MatchString(frame.Session) {
+			client.write(webFrame{Type: "error", Error: "invalid session id"})
+			continue
+		}
+
+		switch frame.Type {
+		case "message":
+			media := webUploads(frame.Media)
+			if strings.TrimSpace(frame.Content) == "" && len(media) == 0 {
+				continue
+			}
+			c.record(frame.Session, webMessage{Role: "user", Content: frame.Content, Media: media})
+			c.broadcast(webFrame{Type: "sessions", Sessions: c.sessionList()})
+			c.HandleMessage("web", frame.Session, frame.Content, media, nil)
+		case "history":
+			client.write(webFrame{Type: "history", Session: frame.Session, Messages: c.history(frame.Session)})
+		default:
+			client.write(webFrame{Type: "error", Error: fmt.Sprintf("unknown frame type %q", frame.Type)})
+		}
+	}
+}
+
+func (c *WebChannel) broadcast(frame webFrame) {
+	c.clientsMu.Lock()
+	clients := make([]*webClient, 0, len(c.clients))
+	for client := range c.clients {
+		clients = append(clients, client)
+	}
+	c.clientsMu.Unlock()
+
+	for _, client := range clients {
+		if err := client.write(frame); err != nil {
+			client.conn.Close()
+		}
+	}
+}
+
+// webUploads keeps only inline images from a browser message. Anything else
+// would be read as a local path or fetched as a URL by the gateway.
+func webUploads(media []string) []string {
+	var out []string
+	for _, ref := range media {
+		if !strings.HasPrefix(ref, "data:image/") {
+			logger.WarnCF("web", "Dropping non-image upload", map[string]interface{}{
+				"media": utils.Truncate(ref, 80),
+			})
+			continue
+		}
+		out = append(out, ref)
+	}
+	return out
+}
+
+// webMedia makes outbound media loadable by the browser: URLs pass through,
+// local images are inlined and anything else is dropped.
+func webMedia(media []string) []string {
+	var out []string
+	for _, ref := range media {
+		switch {
+		case strings.HasPrefix(ref, "http://"), strings.HasPrefix(ref, "https://"), strings.HasPrefix(ref, "data:"):
+			out = append(out, ref)
+		case utils.IsImageRef(ref):
+			dataURI, err := utils.ImageDataURI(ref)
+			if err != nil {
+				logger.WarnCF("web", "Failed to load image, dropping it", map[string]interface{}{
+					"media": utils.Truncate(ref, 80),
+					"error": err.Error(),
+				})
+				continue
+			}
+			out = append(out, dataURI)
+		}
+	}
+	return out
+}
+
+// record appends a message to a session's transcript, creating the session
+// on its first message, and saves that session.
+func (c *WebChannel) record(id string, msg webMessage) {
+	msg.Time = time.Now()
+	kept := msg.Media[:0:0]
+	for _, ref := range msg.Media {
+		if len(ref) <= maxStoredMedia {
+			kept = append(kept, ref)
+		}
+	}
+	msg.Media = kept
+
+	c.mu.Lock()
+	sess, ok := c.sessions[id]
+	if !ok {
+		sess = &webSession{ID: id}
+		c.sessions[id] = sess
+	}
+	evicted := c.evictLocked()
+	if sess.Title == "" && msg.Role == "user" {
+		sess.Title = utils.Truncate(strings.Join(strings.Fields(msg.Content), " "), 60)
+	}
+	sess.Updated = msg.Time
+	sess.Messages = append(sess.Messages, msg)
+	if len(sess.Messages) > maxWebMessages {
+		sess.Messages = sess.Messages[len(sess.Messages)-maxWebMessages:]
+	}
+	snapshot := *sess
+	snapshot.Messages = append([]webMessage(nil), sess.Messages...)
+	// Take saveMu before releasing mu so writes land in record order.
+	c.saveMu.Lock()
+	c.mu.Unlock()
+
+	defer c.saveMu.Unlock()
+	c.save(&snapshot)
+	for _, old := range evicted {
+		c.remove(old)
+	}
+}
+
+// evictLocked drops the least recently used sessions beyond maxWebSessions
+// and returns their IDs.
+func (c *WebChannel) evictLocked() []string {
+	var evicted []string
+	for len(c.sessions) > maxWebSessions {
+		var oldest *webSession
+		for _, sess := range c.sessions {
+			if oldest == nil || sess.Updated.Before(oldest.Updated) {
+				oldest = sess
+			}
+		}
+		delete(c.sessions, oldest.ID)
+		evicted = append(evicted, oldest.ID)
+	}
+	return evicted
+}
+
+// sessionList returns the sessions, most recent first.
+func (c *WebChannel) sessionList() []webSessionInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := make([]webSessionInfo, 0, len(c.sessions))
+	for _, sess := range c.sessions {
+		list = append(list, webSessionInfo{ID: sess.ID, Title: sess.Title, Updated: sess.Updated})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Updated.After(list[j].Updated) })
+	return list
+}
+
+func (c *WebChannel) history(id string) []webMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sess, ok := c.sessions[id]; ok {
+		return append([]webMessage(nil), sess.Messages...)
+	}
+	return nil
+}
+
+func (c *WebChannel) load() {
+	if c.storeDir == "" {
+		return
+	}
+	paths, _ := filepath.Glob(filepath.Join(c.storeDir, "*.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var sess webSession
+		if err := json.Unmarshal(data, &sess); err != nil || !webSessionID.MatchString(sess.ID) {
+			logger.WarnCF("web", "Failed to load web chat session", map[string]interface{}{
+				"path": path,
+			})
+			continue
+		}
+		c.sessions[sess.ID] = &sess
+	}
+	for _, id := range c.evictLocked() {
+		c.remove(id)
+	}
+}
+
+// save writes one session's transcript; callers hold saveMu.
+func (c *WebChannel) save(sess *webSession) {
+	if c.storeDir == "" {
+		return
+	}
+	data, err := json.Marshal(sess)
+	if err == nil {
+		err = os.MkdirAll(c.storeDir, 0755)
+	}
+	path := filepath.Join(c.storeDir, sess.ID+".json")
+	tmpPath := path + ".tmp"
+	if err == nil {
+		err = os.WriteFile(tmpPath, data, 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		logger.WarnCF("web", "Failed to save web chat session", map[string]interface{}{
+			"session": sess.ID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// remove deletes an evicted session's transcript.
+func (c *WebChannel) remove(id string) {
+	if c.storeDir == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(c.storeDir, id+".json")); err != nil && !os.IsNotExist(err) {
+		logger.WarnCF("web", "Failed to remove web chat session", map[string]interface{}{
+			"session": id,
+			"error":   err.Error(),
+		})
+	}
+}
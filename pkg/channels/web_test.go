@@ -0,0 +1,135 @@
+package channels
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func dialWebChat(t *testing.T, srv *httptest.Server, token string) (*websocket.Conn, webFrame) {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/chat/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.WriteJSON(webFrame{Type: "auth", Token: token})
+	var reply webFrame
+	conn.ReadJSON(&reply)
+	return conn, reply
+}
+
+func TestWebChannelChat(t *testing.T) {
+	mb := bus.NewMessageBus()
+	defer mb.Close()
+	store := filepath.Join(t.TempDir(), "web", "sessions")
+	ch, err := NewWebChannel(config.WebChatConfig{Token: "letmein"}, mb, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	ch.Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/chat/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "app.js") {
+		t.Errorf("page = %.200s", page)
+	}
+
+	if _, reply := dialWebChat(t, srv, "wrong"); reply.Type != "error" {
+		t.Errorf("wrong token: reply = %+v, want an error", reply)
+	}
+
+	conn, ready := dialWebChat(t, srv, "letmein")
+	if ready.Type != "ready" || len(ready.Sessions) != 0 {
+		t.Fatalf("ready = %+v", ready)
+	}
+
+	conn.WriteJSON(webFrame{Type: "message", Session: "s1", Content: "What is on my\ncalendar?"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	in, ok := mb.ConsumeInbound(ctx)
+	if !ok || in.Channel != "web" || in.ChatID != "s1" || in.SessionKey != "web:s1" {
+		t.Fatalf("inbound = %+v", in)
+	}
+	var sessions webFrame
+	conn.ReadJSON(&sessions)
+	if sessions.Type != "sessions" || len(sessions.Sessions) != 1 || sessions.Sessions[0].Title != "What is on my calendar?" {
+		t.Errorf("sessions = %+v", sessions)
+	}
+
+	ch.SendEvent(ctx, bus.Event{Type: bus.EventToolCall, ChatID: "s1", Content: "calendar", Metadata: map[string]string{"status": "running"}})
+	var ev webFrame
+	conn.ReadJSON(&ev)
+	if ev.Type != "event" || ev.Event == nil || ev.Event.Content != "calendar" {
+		t.Errorf("event = %+v", ev)
+	}
+
+	ch.Send(ctx, bus.OutboundMessage{ChatID: "s1", Content: "**Nothing** today", Reasoning: "checked"})
+	var reply webFrame
+	conn.ReadJSON(&reply)
+	if reply.Type != "message" || reply.Session != "s1" || reply.Content != "**Nothing** today" || reply.Reasoning != "checked" {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	conn.WriteJSON(webFrame{Type: "history", Session: "s1"})
+	var history webFrame
+	conn.ReadJSON(&history)
+	if len(history.Messages) != 2 || history.Messages[0].Role != "user" || history.Messages[1].Role != "assistant" {
+		t.Errorf("history = %+v", history)
+	}
+
+	conn.WriteJSON(webFrame{Type: "history", Session: "../etc"})
+	var bad webFrame
+	conn.ReadJSON(&bad)
+	if bad.Type != "error" {
+		t.Errorf("invalid session: reply = %+v", bad)
+	}
+
+	if _, err := os.Stat(filepath.Join(store, "s1.json")); err != nil {
+		t.Errorf("session transcript not saved on its own: %v", err)
+	}
+	reloaded, err := NewWebChannel(config.WebChatConfig{Token: "letmein"}, mb, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.history("s1"); len(got) != 2 {
+		t.Errorf("reloaded history = %+v", got)
+	}
+}
+
+func TestNewWebChannelRequiresToken(t *testing.T) {
+	if _, err := NewWebChannel(config.WebChatConfig{}, nil, ""); err == nil {
+		t.Error("expected an error without a token")
+	}
+}
+
+func TestWebUploadsKeepOnlyInlineImages(t *testing.T) {
+	got := webUploads([]string{
+		"data:image/png;base64,iVBORw0KGgo=",
+		"/root/.picoclaw/config.json",
+		"http://169.254.169.254/latest/meta-data/notes.txt",
+		"data:text/plain;base64,c2VjcmV0",
+	})
+	if len(got) != 1 || got[0] != "data:image/png;base64,iVBORw0KGgo=" {
+		t.Errorf("webUploads = %v, want only the inline image", got)
+	}
+}
@@ -1,44 +1,118 @@
 package channels
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
+// Webhook reply modes. By default a webhook is fire-and-forget: the request
+// is acknowledged at once and the agent's reply is only logged.
+const (
+	webhookModeSync  = "sync"  // wait for the reply and return it in the response
+	webhookModeAsync = "async" // acknowledge with a job ID, POST the reply to callback_url
+)
+
+const (
+	// webhookJobTTL is how long finished jobs stay available for polling.
+	webhookJobTTL = time.Hour
+
+	// maxWebhookJobs bounds the job table; the oldest jobs go first.
+	maxWebhookJobs = 1000
+
+	// maxWebhookBody bounds a request body.
+	maxWebhookBody = 1 << 20
+)
+
 // WebhookChannel receives external events via HTTP POST and routes them to the agent.
-// Responses from the agent are logged but not sent back (fire-and-forget);
-// the agent's response will be routed to the last active channel (e.g. Telegram) via the bus.
+// In the default mode responses are logged but not sent back (fire-and-forget).
+// A request can instead ask to wait for the reply ("sync"), or to have it
+// POSTed to a callback URL ("async"); both can also be polled by job ID.
 type WebhookChannel struct {
 	*BaseChannel
 	config     config.WebhookConfig
 	httpServer *http.Server
+	client     *http.Client
+
+	replays replayGuard
+
+	mu   sync.Mutex
+	jobs map[string]*webhookJob
 }
 
 type webhookPayload struct {
 	Source   string            `json:"source"`
-	Event   string            `json:"event"`
-	Content string            `json:"content"`
+	Event    string            `json:"event"`
+	Content  string            `json:"content"`
 	Metadata map[string]string `json:"metadata,omitempty"`
+
+	Mode        string `json:"mode,omitempty"`         // "", "sync" or "async"
+	CallbackURL string `json:"callback_url,omitempty"` // required for "async"
+	Timeout     int    `json:"timeout,omitempty"`      // seconds to wait in "sync" mode
+}
+
+// webhookJob tracks one sync or async request until the agent replies.
+type webhookJob struct {
+	ID          string    `json:"job_id"`
+	Status      string    `json:"status"` // "pending" or "done"
+	Source      string    `json:"source,omitempty"`
+	Event       string    `json:"event,omitempty"`
+	Reply       string    `json:"reply,omitempty"`
+	Reasoning   string    `json:"reasoning,omitempty"`
+	Media       []string  `json:"media,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+
+	sourceName  string // configured source that created the job, if any
+	callbackURL string
+	done        chan struct{}
 }
 
 // NewWebhookChannel creates a new webhook channel instance.
 func NewWebhookChannel(cfg config.WebhookConfig, messageBus *bus.MessageBus) (*WebhookChannel, error) {
+	for name, src := range cfg.Sources {
+		if name == "" || name == "jobs" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid webhook source name %q", name)
+		}
+		if src.Adapter != "" && webhookAdapters[src.Adapter] == nil {
+			return nil, fmt.Errorf("webhook source %s: unknown adapter %q", name, src.Adapter)
+		}
+		if src.Secret == "" {
+			return nil, fmt.Errorf("webhook source %s: secret is required", name)
+		}
+	}
+
 	base := NewBaseChannel("webhook", cfg, messageBus, nil) // no allowList, auth is via bearer token
 
-	return &WebhookChannel{
+	c := &WebhookChannel{
 		BaseChannel: base,
 		config:      cfg,
-	}, nil
+		jobs:        make(map[string]*webhookJob),
+	}
+	// No proxy: callbacks must be dialed by dialCallback to be checked.
+	c.client = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{DialContext: c.dialCallback},
+	}
+	return c, nil
 }
 
 // Start launches the HTTP webhook server.
@@ -46,11 +120,10 @@ func (c *WebhookChannel) Start(ctx context.Context) error {
 	logger.InfoC("webhook", "Starting webhook channel")
 
 	mux := http.NewServeMux()
-	path := c.config.Path
-	if path == "" {
-		path = "/webhook/inbound"
-	}
+	path := c.basePath()
 	mux.HandleFunc(path, c.handler)
+	mux.HandleFunc(path+"/", c.handler) // per-source endpoints
+	mux.HandleFunc(path+"/jobs/", c.jobHandler)
 
 	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
 	c.httpServer = &http.Server{
@@ -94,15 +167,149 @@ func (c *WebhookChannel) Stop(ctx context.Context) error {
 	return nil
 }
 
-// Send logs outbound messages (webhook is fire-and-forget, responses go to other channels).
+// Send completes the job a reply belongs to. Replies to fire-and-forget
+// webhooks are only logged. A failed callback is returned as an error so the
+// bus retries it with backoff.
 func (c *WebhookChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
-	logger.DebugCF("webhook", "Webhook outbound (logged only)", map[string]interface{}{
-		"chat_id":     msg.ChatID,
-		"content_len": len(msg.Content),
+	job := c.completeJob(msg)
+	if job == nil {
+		logger.DebugCF("webhook", "Webhook outbound (logged only)", map[string]interface{}{
+			"chat_id":     msg.ChatID,
+			"content_len": len(msg.Content),
+		})
+		return nil
+	}
+	if job.callbackURL == "" {
+		return nil
+	}
+	return c.postCallback(ctx, job)
+}
+
+// RendersReasoning reports that webhook jobs carry reasoning in their own
+// field.
+func (c *WebhookChannel) RendersReasoning() bool {
+	return true
+}
+
+// completeJob records msg as the reply to its job, if it has one that is
+// still waiting.
+func (c *WebhookChannel) completeJob(msg bus.OutboundMessage) *webhookJob {
+	_, jobID, ok := strings.Cut(msg.ChatID, "/")
+	if !ok {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, ok := c.jobs[jobID]
+	if !ok {
+		return nil
+	}
+	// With reasoning_display "separate" the reasoning comes ahead of the
+	// answer; keep it with the job rather than mistaking it for the reply.
+	if reasoning, ok := strings.CutPrefix(msg.Content, reasoningPrefix); ok && job.Status != "done" {
+		job.Reasoning = reasoning
+		return nil
+	}
+	if job.Status != "done" {
+		job.Status = "done"
+		job.Reply = msg.Content
+		if msg.Reasoning != "" {
+			job.Reasoning = msg.Reasoning
+		}
+		job.Media = msg.Media
+		job.CompletedAt = time.Now()
+		close(job.done)
+	}
+	snapshot := *job
+	return &snapshot
+}
+
+// postCallback delivers an async job's reply to its callback URL.
+func (c *WebhookChannel) postCallback(ctx context.Context, job *webhookJob) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return permanent(fmt.Errorf("invalid callback URL: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if errors.Is(err, errCallbackBlocked) {
+			return permanent(err)
+		}
+		return fmt.Errorf("webhook callback failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("webhook callback returned %s", resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return permanent(err)
+		}
+		return err
+	}
+	logger.InfoCF("webhook", "Delivered webhook reply to callback", map[string]interface{}{
+		"job_id": job.ID,
 	})
 	return nil
 }
 
+// errCallbackBlocked marks callbacks refused for their address.
+var errCallbackBlocked = errors.New("callback address not allowed")
+
+// callbackAddrs resolves a callback host, refusing loopback, private and
+// link-local addresses unless the host is listed in callback_hosts. It
+// returns nil addresses for listed hosts, which are dialed as given.
+func (c *WebhookChannel) callbackAddrs(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if slices.ContainsFunc(c.config.CallbackHosts, func(h string) bool { return strings.EqualFold(h, host) }) {
+		return nil, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("resolving callback host %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", errCallbackBlocked, host, addr.IP)
+		}
+	}
+	return addrs, nil
+}
+
+// dialCallback checks the address it actually connects to, so a host that
+// resolves differently by the time the reply is ready (DNS rebinding) or a
+// redirect cannot reach internal services either.
+func (c *WebhookChannel) dialCallback(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := c.callbackAddrs(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	if addrs == nil {
+		return d.DialContext(ctx, network, addr)
+	}
+	return d.DialContext(ctx, network, net.JoinHostPort(addrs[0].IP.String(), port))
+}
+
+// cgnatNet is the shared address space carriers use (RFC 6598).
+var cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip is routable on the internet.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() || cgnatNet.Contains(ip))
+}
+
 // handler processes incoming webhook POST requests.
 func (c *WebhookChannel) handler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -110,18 +317,7 @@ func (c *WebhookChannel) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate bearer token if configured
-	if c.config.Secret != "" {
-		auth := r.Header.Get("Authorization")
-		expected := "Bearer " + c.config.Secret
-		if !strings.EqualFold(auth, expected) {
-			logger.WarnC("webhook", "Invalid or missing bearer token")
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-	}
-
-	body, err := io.ReadAll(r.Body)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
 	if err != nil {
 		logger.ErrorCF("webhook", "Failed to read request body", map[string]interface{}{
 			"error": err.Error(),
@@ -130,13 +326,60 @@ func (c *WebhookChannel) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sourceName := strings.Trim(strings.TrimPrefix(r.URL.Path, c.basePath()), "/")
 	var payload webhookPayload
-	if err := json.Unmarshal(body, &payload); err != nil {
-		logger.ErrorCF("webhook", "Failed to parse webhook payload", map[string]interface{}{
-			"error": err.Error(),
-		})
-		http.Error(w, "Bad request", http.StatusBadRequest)
-		return
+	if sourceName == "" {
+		if !c.authorized(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			logger.ErrorCF("webhook", "Failed to parse webhook payload", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if err := c.checkGenericSource(payload.Source); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	} else {
+		src, ok := c.config.Sources[sourceName]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if err := c.authenticate(src, r, body); err != nil {
+			logger.WarnCF("webhook", "Webhook authentication failed", map[string]interface{}{
+				"source": sourceName,
+				"error":  err.Error(),
+			})
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if src.Adapter == "" {
+			err = json.Unmarshal(body, &payload)
+		} else {
+			var relevant bool
+			payload, relevant, err = webhookAdapters[src.Adapter](r.Header, body)
+			if err == nil && !relevant {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"status":"ignored"}`))
+				return
+			}
+		}
+		if err != nil {
+			logger.ErrorCF("webhook", "Failed to parse webhook payload", map[string]interface{}{
+				"source": sourceName,
+				"error":  err.Error(),
+			})
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		// The endpoint, not the body, says who is calling.
+		payload.Source = sourceName
 	}
 
 	if payload.Content == "" {
@@ -144,22 +387,203 @@ func (c *WebhookChannel) handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	switch payload.Mode {
+	case "":
+	case webhookModeSync, webhookModeAsync:
+		// Replies only go back to authenticated callers.
+		if sourceName == "" && c.config.Secret == "" {
+			http.Error(w, "sync and async modes require a webhook secret", http.StatusForbidden)
+			return
+		}
+	default:
+		http.Error(w, "mode must be sync or async", http.StatusBadRequest)
+		return
+	}
+	if payload.Mode == webhookModeAsync {
+		u, err := url.Parse(payload.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "callback_url must be an http(s) URL in async mode", http.StatusBadRequest)
+			return
+		}
+		if _, err := c.callbackAddrs(r.Context(), u.Hostname()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	logger.InfoCF("webhook", "Received webhook event", map[string]interface{}{
 		"source":  payload.Source,
 		"event":   payload.Event,
+		"mode":    payload.Mode,
 		"preview": utils.Truncate(payload.Content, 80),
 	})
 
-	// Return 200 OK immediately
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"ok"}`))
+	if payload.Mode == "" {
+		// Return 200 OK immediately
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"ok"}`))
+
+		// Process event asynchronously
+		go c.processEvent(payload, "")
+		return
+	}
+
+	job := c.newJob(payload, sourceName)
+	c.processEvent(payload, job.ID)
+
+	if payload.Mode == webhookModeSync {
+		timer := time.NewTimer(c.syncTimeout(payload.Timeout))
+		defer timer.Stop()
+		select {
+		case <-job.done:
+			c.writeJob(w, http.StatusOK, job.ID)
+			return
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	c.writeJob(w, http.StatusAccepted, job.ID)
+}
 
-	// Process event asynchronously
-	go c.processEvent(payload)
+// checkGenericSource keeps callers of the generic endpoint out of the
+// sessions of configured sources: a source named after one, or with the
+// separators of session and chat IDs, could otherwise write into them.
+func (c *WebhookChannel) checkGenericSource(source string) error {
+	if strings.ContainsAny(source, ":/") {
+		return fmt.Errorf("source must not contain ':' or '/'")
+	}
+	for name := range c.config.Sources {
+		if strings.EqualFold(source, name) {
+			return fmt.Errorf("source %q has its own endpoint", source)
+		}
+	}
+	return nil
+}
+
+// jobHandler serves GET <path>/jobs/<id> for polling a job's reply.
+func (c *WebhookChannel) jobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if job, ok := c.job(id); ok && !c.canPoll(r, job) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	c.writeJob(w, http.StatusOK, id)
+}
+
+// authorized checks the shared bearer token of the generic endpoint, if
+// one is configured.
+func (c *WebhookChannel) authorized(r *http.Request) bool {
+	if c.config.Secret == "" {
+		return true
+	}
+	if !secretEqual(bearerToken(r), c.config.Secret) {
+		logger.WarnC("webhook", "Invalid or missing bearer token")
+		return false
+	}
+	return true
+}
+
+// canPoll reports whether r may read job: with the shared token, or with
+// the secret of the source that created it.
+func (c *WebhookChannel) canPoll(r *http.Request, job webhookJob) bool {
+	token := bearerToken(r)
+	if c.config.Secret != "" && secretEqual(token, c.config.Secret) {
+		return true
+	}
+	if src, ok := c.config.Sources[job.sourceName]; ok {
+		return secretEqual(token, src.Secret)
+	}
+	return c.config.Secret == ""
+}
+
+// basePath is the generic endpoint; sources live below it.
+func (c *WebhookChannel) basePath() string {
+	path := strings.TrimSuffix(c.config.Path, "/")
+	if path == "" {
+		path = "/webhook/inbound"
+	}
+	return path
+}
+
+// syncTimeout is how long a sync request waits: what it asked for, capped
+// by the configured maximum.
+func (c *WebhookChannel) syncTimeout(requested int) time.Duration {
+	limit := c.config.SyncTimeout
+	if limit <= 0 {
+		limit = 60
+	}
+	if requested > 0 && requested < limit {
+		limit = requested
+	}
+	return time.Duration(limit) * time.Second
+}
+
+func (c *WebhookChannel) newJob(payload webhookPayload, sourceName string) *webhookJob {
+	job := &webhookJob{
+		ID:          uuid.New().String(),
+		Status:      "pending",
+		Source:      payload.Source,
+		Event:       payload.Event,
+		CreatedAt:   time.Now(),
+		sourceName:  sourceName,
+		callbackURL: payload.CallbackURL,
+		done:        make(chan struct{}),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneJobsLocked(job.CreatedAt)
+	c.jobs[job.ID] = job
+	return job
+}
+
+// pruneJobsLocked drops expired jobs, and the oldest ones when the table
+// is full.
+func (c *WebhookChannel) pruneJobsLocked(now time.Time) {
+	var oldest *webhookJob
+	for id, job := range c.jobs {
+		if now.Sub(job.CreatedAt) > webhookJobTTL {
+			delete(c.jobs, id)
+		} else if oldest == nil || job.CreatedAt.Before(oldest.CreatedAt) {
+			oldest = job
+		}
+	}
+	if len(c.jobs) >= maxWebhookJobs && oldest != nil {
+		delete(c.jobs, oldest.ID)
+	}
+}
+
+// job returns a copy of the job with the given ID.
+func (c *WebhookChannel) job(id string) (webhookJob, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	job, ok := c.jobs[id]
+	if !ok {
+		return webhookJob{}, false
+	}
+	return *job, true
+}
+
+func (c *WebhookChannel) writeJob(w http.ResponseWriter, status int, id string) {
+	snapshot, ok := c.job(id)
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(snapshot)
 }
 
 // processEvent routes the webhook payload to the agent via the message bus.
-func (c *WebhookChannel) processEvent(payload webhookPayload) {
+// Replies to a job come back on a chat ID carrying the job ID, while the
+// conversation history stays shared per source and event.
+func (c *WebhookChannel) processEvent(payload webhookPayload, jobID string) {
 	// Build a descriptive message for the agent
 	content := fmt.Sprintf("[Webhook: %s/%s] %s", payload.Source, payload.Event, payload.Content)
 
@@ -176,5 +600,18 @@ func (c *WebhookChannel) processEvent(payload webhookPayload) {
 		metadata[k] = v
 	}
 
-	c.HandleMessage(senderID, chatID, content, nil, metadata)
+	if jobID == "" {
+		c.HandleMessage(senderID, chatID, content, nil, metadata)
+		return
+	}
+	metadata["job_id"] = jobID
+	metrics.MessagesInbound.Inc(c.Name())
+	c.bus.PublishInbound(bus.InboundMessage{
+		Channel:    c.Name(),
+		SenderID:   senderID,
+		ChatID:     chatID + "/" + jobID,
+		Content:    content,
+		SessionKey: fmt.Sprintf("%s:%s", c.Name(), chatID),
+		Metadata:   metadata,
+	})
 }
@@ -0,0 +1,395 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// webhookAdapter turns a platform's native webhook into a concise prompt
+// for the agent. ok is false for events not worth waking the agent for,
+// such as GitHub's ping.
+type webhookAdapter func(header http.Header, body []byte) (payload webhookPayload, ok bool, err error)
+
+var webhookAdapters = map[string]webhookAdapter{
+	"github":        adaptGitHub,
+	"gitlab":        adaptGitLab,
+	"grafana":       adaptAlertmanager,
+	"alertmanager":  adaptAlertmanager,
+	"homeassistant": adaptHomeAssistant,
+}
+
+const (
+	// maxAdapterCommits and maxAdapterAlerts bound the lists in a prompt.
+	maxAdapterCommits = 5
+	maxAdapterAlerts  = 10
+
+	// maxAdapterTextChars bounds free text such as comments.
+	maxAdapterTextChars = 500
+)
+
+func adaptGitHub(header http.Header, body []byte) (webhookPayload, bool, error) {
+	var p struct {
+		Action     string `json:"action"`
+		Ref        string `json:"ref"`
+		Compare    string `json:"compare"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		Sender struct {
+			Login string `json:"login"`
+		} `json:"sender"`
+		Commits []struct {
+			Message string `json:"message"`
+		} `json:"commits"`
+		PullRequest *struct {
+			Number  int    `json:"number"`
+			Title   string `json:"title"`
+			HTMLURL string `json:"html_url"`
+			Merged  bool   `json:"merged"`
+		} `json:"pull_request"`
+		Issue *struct {
+			Number  int    `json:"number"`
+			Title   string `json:"title"`
+			HTMLURL string `json:"html_url"`
+		} `json:"issue"`
+		Comment *struct {
+			Body    string `json:"body"`
+			HTMLURL string `json:"html_url"`
+		} `json:"comment"`
+		WorkflowRun *struct {
+			Name       string `json:"name"`
+			HeadBranch string `json:"head_branch"`
+			Conclusion string `json:"conclusion"`
+			HTMLURL    string `json:"html_url"`
+		} `json:"workflow_run"`
+		Release *struct {
+			TagName string `json:"tag_name"`
+			HTMLURL string `json:"html_url"`
+		} `json:"release"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return webhookPayload{}, false, err
+	}
+
+	event := header.Get("X-GitHub-Event")
+	repo, who := p.Repository.FullName, p.Sender.Login
+	var content, link string
+
+	switch {
+	case event == "ping":
+		return webhookPayload{}, false, nil
+	case event == "push":
+		branch := strings.TrimPrefix(p.Ref, "refs/heads/")
+		content = fmt.Sprintf("%s pushed %d commit(s) to %s in %s:", who, len(p.Commits), branch, repo)
+		content += commitLines(len(p.Commits), func(i int) string { return p.Commits[i].Message })
+		link = p.Compare
+	case event == "pull_request" && p.PullRequest != nil:
+		action := p.Action
+		if action == "closed" && p.PullRequest.Merged {
+			action = "merged"
+		}
+		content = fmt.Sprintf("%s %s pull request #%d in %s: %s", who, action, p.PullRequest.Number, repo, p.PullRequest.Title)
+		link = p.PullRequest.HTMLURL
+	case event == "issue_comment" && p.Issue != nil && p.Comment != nil:
+		content = fmt.Sprintf("%s commented on #%d (%s) in %s: %s", who, p.Issue.Number, p.Issue.Title, repo,
+			utils.Truncate(p.Comment.Body, maxAdapterTextChars))
+		link = p.Comment.HTMLURL
+	case event == "issues" && p.Issue != nil:
+		content = fmt.Sprintf("%s %s issue #%d in %s: %s", who, p.Action, p.Issue.Number, repo, p.Issue.Title)
+		link = p.Issue.HTMLURL
+	case event == "workflow_run" && p.WorkflowRun != nil:
+		// Only finished runs are interesting; requested and in_progress
+		// would double the traffic.
+		if p.Action != "completed" {
+			return webhookPayload{}, false, nil
+		}
+		run := p.WorkflowRun
+		content = fmt.Sprintf("Workflow %q on %s in %s finished: %s", run.Name, run.HeadBranch, repo, run.Conclusion)
+		link = run.HTMLURL
+	case event == "release" && p.Release != nil:
+		content = fmt.Sprintf("%s %s release %s in %s", who, p.Action, p.Release.TagName, repo)
+		link = p.Release.HTMLURL
+	default:
+		content = fmt.Sprintf("GitHub %s event in %s by %s", strings.TrimSpace(event+" "+p.Action), repo, who)
+	}
+
+	return webhookPayload{
+		Event:   event,
+		Content: withLink(content, link),
+		Metadata: map[string]string{
+			"repository": repo,
+			"delivery":   header.Get("X-GitHub-Delivery"),
+			"url":        link,
+		},
+	}, true, nil
+}
+
+// gitlabActions turns GitLab's object_attributes.action into a past-tense
+// verb.
+var gitlabActions = map[string]string{
+	"open":     "opened",
+	"close":    "closed",
+	"reopen":   "reopened",
+	"update":   "updated",
+	"merge":    "merged",
+	"approved": "approved",
+}
+
+func adaptGitLab(header http.Header, body []byte) (webhookPayload, bool, error) {
+	var p struct {
+		ObjectKind string `json:"object_kind"`
+		UserName   string `json:"user_name"`
+		Ref        string `json:"ref"`
+		User       struct {
+			Name string `json:"name"`
+		} `json:"user"`
+		Project struct {
+			PathWithNamespace string `json:"path_with_namespace"`
+			WebURL            string `json:"web_url"`
+		} `json:"project"`
+		Commits []struct {
+			Message string `json:"message"`
+		} `json:"commits"`
+		TotalCommitsCount int `json:"total_commits_count"`
+		ObjectAttributes  struct {
+			ID     int    `json:"id"`
+			IID    int    `json:"iid"`
+			Title  string `json:"title"`
+			URL    string `json:"url"`
+			Action string `json:"action"`
+			Status string `json:"status"`
+			Ref    string `json:"ref"`
+			Note   string `json:"note"`
+		} `json:"object_attributes"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return webhookPayload{}, false, err
+	}
+
+	project := p.Project.PathWithNamespace
+	attrs := p.ObjectAttributes
+	who := p.User.Name
+	if who == "" {
+		who = p.UserName
+	}
+	action := gitlabActions[attrs.Action]
+	if action == "" {
+		action = attrs.Action
+	}
+	var content, link string
+
+	switch p.ObjectKind {
+	case "push", "tag_push":
+		ref := strings.TrimPrefix(strings.TrimPrefix(p.Ref, "refs/heads/"), "refs/tags/")
+		content = fmt.Sprintf("%s pushed %d commit(s) to %s in %s:", who, p.TotalCommitsCount, ref, project)
+		content += commitLines(len(p.Commits), func(i int) string { return p.Commits[i].Message })
+	case "merge_request":
+		content = fmt.Sprintf("%s %s merge request !%d in %s: %s", who, action, attrs.IID, project, attrs.Title)
+		link = attrs.URL
+	case "issue":
+		content = fmt.Sprintf("%s %s issue #%d in %s: %s", who, action, attrs.IID, project, attrs.Title)
+		link = attrs.URL
+	case "note":
+		content = fmt.Sprintf("%s commented in %s: %s", who, project, utils.Truncate(attrs.Note, maxAdapterTextChars))
+		link = attrs.URL
+	case "pipeline":
+		switch attrs.Status {
+		case "success", "failed", "canceled":
+		default:
+			return webhookPayload{}, false, nil
+		}
+		content = fmt.Sprintf("Pipeline for %s in %s finished: %s", attrs.Ref, project, attrs.Status)
+		link = fmt.Sprintf("%s/-/pipelines/%d", p.Project.WebURL, attrs.ID)
+	default:
+		content = fmt.Sprintf("GitLab %s event in %s by %s", p.ObjectKind, project, who)
+	}
+
+	event := p.ObjectKind
+	if event == "" {
+		event = header.Get("X-Gitlab-Event")
+	}
+	return webhookPayload{
+		Event:   event,
+		Content: withLink(content, link),
+		Metadata: map[string]string{
+			"project": project,
+			"url":     link,
+		},
+	}, true, nil
+}
+
+// adaptAlertmanager handles Prometheus Alertmanager notifications and
+// Grafana alerting, which posts the same format.
+func adaptAlertmanager(header http.Header, body []byte) (webhookPayload, bool, error) {
+	var p struct {
+		Status string `json:"status"`
+		Alerts []struct {
+			Status       string            `json:"status"`
+			Labels       map[string]string `json:"labels"`
+			Annotations  map[string]string `json:"annotations"`
+			GeneratorURL string            `json:"generatorURL"`
+		} `json:"alerts"`
+		CommonLabels map[string]string `json:"commonLabels"`
+		ExternalURL  string            `json:"externalURL"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return webhookPayload{}, false, err
+	}
+	if len(p.Alerts) == 0 {
+		return webhookPayload{}, false, nil
+	}
+
+	name := p.CommonLabels["alertname"]
+	if name == "" {
+		name = p.Alerts[0].Labels["alertname"]
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s:%d] %s", strings.ToUpper(p.Status), len(p.Alerts), name)
+	for i, alert := range p.Alerts {
+		if i == maxAdapterAlerts {
+			fmt.Fprintf(&b, "\n- … and %d more", len(p.Alerts)-i)
+			break
+		}
+		line := alert.Labels["alertname"]
+		if instance := alert.Labels["instance"]; instance != "" {
+			line += " on " + instance
+		}
+		if severity := alert.Labels["severity"]; severity != "" {
+			line += " (" + severity + ")"
+		}
+		if alert.Status != p.Status {
+			line += " [" + alert.Status + "]"
+		}
+		summary := alert.Annotations["summary"]
+		if summary == "" {
+			summary = alert.Annotations["description"]
+		}
+		if summary != "" {
+			line += ": " + utils.Truncate(summary, maxAdapterTextChars)
+		}
+		b.WriteString("\n- " + line)
+	}
+
+	return webhookPayload{
+		Event:   "alert",
+		Content: withLink(b.String(), p.ExternalURL),
+		Metadata: map[string]string{
+			"status":    p.Status,
+			"alertname": name,
+			"labels":    formatLabels(p.CommonLabels),
+		},
+	}, true, nil
+}
+
+// adaptHomeAssistant handles what a Home Assistant rest_command or
+// automation sends: a ready message, or an entity's state change.
+func adaptHomeAssistant(header http.Header, body []byte) (webhookPayload, bool, error) {
+	var p struct {
+		Event        string          `json:"event"`
+		EventType    string          `json:"event_type"`
+		Message      string          `json:"message"`
+		Content      string          `json:"content"`
+		EntityID     string          `json:"entity_id"`
+		FriendlyName string          `json:"friendly_name"`
+		State        json.RawMessage `json:"state"`
+		OldState     json.RawMessage `json:"old_state"`
+		NewState     json.RawMessage `json:"new_state"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return webhookPayload{}, false, err
+	}
+
+	event := p.Event
+	if event == "" {
+		event = p.EventType
+	}
+	content := p.Message
+	if content == "" {
+		content = p.Content
+	}
+	if content == "" && p.EntityID != "" {
+		name := p.FriendlyName
+		if name == "" {
+			name = p.EntityID
+		}
+		to := haState(p.NewState)
+		if to == "" {
+			to = haState(p.State)
+		}
+		if from := haState(p.OldState); from != "" {
+			content = fmt.Sprintf("%s changed from %s to %s", name, from, to)
+		} else {
+			content = fmt.Sprintf("%s is now %s", name, to)
+		}
+		if event == "" {
+			event = "state_changed"
+		}
+	}
+	if content == "" {
+		return webhookPayload{}, false, fmt.Errorf("home assistant payload needs message or entity_id")
+	}
+	if event == "" {
+		event = "event"
+	}
+
+	return webhookPayload{
+		Event:    event,
+		Content:  content,
+		Metadata: map[string]string{"entity_id": p.EntityID},
+	}, true, nil
+}
+
+// haState reads a state given either as a plain string or as a Home
+// Assistant state object ({"state": "on", ...}).
+func haState(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var obj struct {
+		State string `json:"state"`
+	}
+	json.Unmarshal(raw, &obj)
+	return obj.State
+}
+
+// commitLines lists the first lines of up to maxAdapterCommits commit
+// messages.
+func commitLines(n int, message func(i int) string) string {
+	var b strings.Builder
+	for i := 0; i < n && i < maxAdapterCommits; i++ {
+		first, _, _ := strings.Cut(message(i), "\n")
+		b.WriteString("\n- " + first)
+	}
+	if n > maxAdapterCommits {
+		fmt.Fprintf(&b, "\n- … and %d more", n-maxAdapterCommits)
+	}
+	return b.String()
+}
+
+func withLink(content, link string) string {
+	if link == "" {
+		return content
+	}
+	return content + "\n" + link
+}
+
+func formatLabels(labels map[string]string) string {
+	parts := make([]string, 0, len(labels))
+	for k, v := range labels {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
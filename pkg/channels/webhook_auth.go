@@ -0,0 +1,171 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Webhook source authentication schemes.
+const (
+	webhookAuthBearer      = "bearer"
+	webhookAuthHMAC        = "hmac"
+	webhookAuthTimestamped = "timestamped"
+	webhookAuthToken       = "token"
+)
+
+// webhookSignatureTolerance is how far a timestamped signature may be from
+// our clock; older ones are rejected as replays.
+const webhookSignatureTolerance = 5 * time.Minute
+
+// sourceAuth returns the scheme a source authenticates with.
+func sourceAuth(src config.WebhookSourceConfig) string {
+	if src.Auth != "" {
+		return src.Auth
+	}
+	switch src.Adapter {
+	case "github":
+		return webhookAuthHMAC
+	case "gitlab":
+		return webhookAuthToken
+	}
+	return webhookAuthBearer
+}
+
+// authenticate checks a request to a configured source against its secret.
+func (c *WebhookChannel) authenticate(src config.WebhookSourceConfig, r *http.Request, body []byte) error {
+	if src.Secret == "" {
+		return fmt.Errorf("source has no secret configured")
+	}
+
+	switch scheme := sourceAuth(src); scheme {
+	case webhookAuthBearer:
+		if !secretEqual(bearerToken(r), src.Secret) {
+			return fmt.Errorf("invalid or missing bearer token")
+		}
+	case webhookAuthToken:
+		if !secretEqual(r.Header.Get("X-Gitlab-Token"), src.Secret) {
+			return fmt.Errorf("invalid or missing X-Gitlab-Token")
+		}
+	case webhookAuthHMAC:
+		if !verifyHubSignature(src.Secret, body, r.Header.Get("X-Hub-Signature-256")) {
+			return fmt.Errorf("invalid or missing X-Hub-Signature-256")
+		}
+	case webhookAuthTimestamped:
+		header := r.Header.Get("X-Webhook-Signature")
+		if header == "" {
+			header = r.Header.Get("Stripe-Signature")
+		}
+		return c.replays.verify(src.Secret, body, header, time.Now())
+	default:
+		return fmt.Errorf("unknown auth scheme %q", scheme)
+	}
+	return nil
+}
+
+func secretEqual(got, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
+	}
+	return auth[7:]
+}
+
+// verifyHubSignature checks a GitHub-style "sha256=<hex hmac of body>".
+func verifyHubSignature(secret string, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// replayGuard verifies Stripe-style signatures, "t=<unix>,v1=<hex>" over
+// "<t>.<body>", and remembers the ones it accepted until they go stale so
+// a captured request cannot be sent again.
+type replayGuard struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func (g *replayGuard) verify(secret string, body []byte, header string, now time.Time) error {
+	var ts int64
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			ts, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			sigs = append(sigs, value)
+		}
+	}
+	if ts == 0 || len(sigs) == 0 {
+		return fmt.Errorf("invalid or missing signature header")
+	}
+	signedAt := time.Unix(ts, 0)
+	if now.Sub(signedAt).Abs() > webhookSignatureTolerance {
+		return fmt.Errorf("signature timestamp outside tolerance")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", ts)
+	mac.Write(body)
+	want := mac.Sum(nil)
+
+	for _, sig := range sigs {
+		got, err := hex.DecodeString(sig)
+		if err != nil || !hmac.Equal(got, want) {
+			continue
+		}
+		if !g.firstUse(sig, now) {
+			return fmt.Errorf("signature already used")
+		}
+		return nil
+	}
+	return fmt.Errorf("signature mismatch")
+}
+
+func (g *replayGuard) firstUse(sig string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.seen == nil {
+		g.seen = make(map[string]time.Time)
+	}
+	for s, at := range g.seen {
+		if now.Sub(at) > 2*webhookSignatureTolerance {
+			delete(g.seen, s)
+		}
+	}
+	if _, ok := g.seen[sig]; ok {
+		return false
+	}
+	g.seen[sig] = now
+	return true
+}
@@ -0,0 +1,319 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestWebhook(t *testing.T) (*WebhookChannel, *bus.MessageBus) {
+	t.Helper()
+	mb := bus.NewMessageBus()
+	t.Cleanup(mb.Close)
+	c, err := NewWebhookChannel(config.WebhookConfig{
+		Path:          "/webhook/inbound",
+		Secret:        "s3cret",
+		SyncTimeout:   5,
+		CallbackHosts: config.FlexibleStringSlice{"127.0.0.1"},
+	}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, mb
+}
+
+func postWebhook(c *WebhookChannel, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhook/inbound", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	c.handler(rec, req)
+	return rec
+}
+
+// replyToNext answers the next inbound message the way the agent loop does.
+func replyToNext(t *testing.T, c *WebhookChannel, mb *bus.MessageBus, reply string) bus.InboundMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	in, ok := mb.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	if err := c.Send(ctx, bus.OutboundMessage{Channel: "webhook", ChatID: in.ChatID, Content: reply}); err != nil {
+		t.Errorf("Send: %v", err)
+	}
+	return in
+}
+
+func TestWebhookSyncModeReturnsReply(t *testing.T) {
+	c, mb := newTestWebhook(t)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- postWebhook(c, `{"source":"ha","event":"ask","content":"Is the door locked?","mode":"sync"}`)
+	}()
+	in := replyToNext(t, c, mb, "Yes, locked.")
+	if in.SessionKey != "webhook:webhook:ha:ask" {
+		t.Errorf("session key = %q, want the shared per-event session", in.SessionKey)
+	}
+
+	rec := <-done
+	var job webhookJob
+	json.Unmarshal(rec.Body.Bytes(), &job)
+	if rec.Code != http.StatusOK || job.Status != "done" || job.Reply != "Yes, locked." {
+		t.Errorf("response = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestWebhookSyncModeTimesOutToJob(t *testing.T) {
+	c, mb := newTestWebhook(t)
+
+	rec := postWebhook(c, `{"source":"n8n","event":"run","content":"slow task","mode":"sync","timeout":1}`)
+	var job webhookJob
+	json.Unmarshal(rec.Body.Bytes(), &job)
+	if rec.Code != http.StatusAccepted || job.Status != "pending" || job.ID == "" {
+		t.Fatalf("response = %d %s", rec.Code, rec.Body)
+	}
+
+	replyToNext(t, c, mb, "finished")
+	req := httptest.NewRequest(http.MethodGet, "/webhook/inbound/jobs/"+job.ID, nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	poll := httptest.NewRecorder()
+	c.jobHandler(poll, req)
+	json.Unmarshal(poll.Body.Bytes(), &job)
+	if poll.Code != http.StatusOK || job.Status != "done" || job.Reply != "finished" {
+		t.Errorf("poll = %d %s", poll.Code, poll.Body)
+	}
+}
+
+func TestWebhookAsyncModePostsCallback(t *testing.T) {
+	got := make(chan webhookJob, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var job webhookJob
+		json.NewDecoder(r.Body).Decode(&job)
+		got <- job
+	}))
+	defer callback.Close()
+
+	c, mb := newTestWebhook(t)
+	rec := postWebhook(c, `{"source":"script","event":"ask","content":"hi","mode":"async","callback_url":"`+callback.URL+`"}`)
+	var accepted webhookJob
+	json.Unmarshal(rec.Body.Bytes(), &accepted)
+	if rec.Code != http.StatusAccepted || accepted.ID == "" {
+		t.Fatalf("response = %d %s", rec.Code, rec.Body)
+	}
+
+	replyToNext(t, c, mb, "hello back")
+	select {
+	case job := <-got:
+		if job.ID != accepted.ID || job.Reply != "hello back" || job.Status != "done" {
+			t.Errorf("callback = %+v", job)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("callback not called")
+	}
+}
+
+func TestWebhookRejectsBadModes(t *testing.T) {
+	c, _ := newTestWebhook(t)
+	for _, body := range []string{
+		`{"content":"x","mode":"later"}`,
+		`{"content":"x","mode":"async"}`,
+		`{"content":"x","mode":"async","callback_url":"file:///etc/passwd"}`,
+		`{"content":"x","mode":"async","callback_url":"http://169.254.169.254/latest/meta-data"}`,
+		`{"content":"x","mode":"async","callback_url":"http://localhost:8080/"}`,
+		`{"content":"x","mode":"async","callback_url":"http://10.0.0.5/hook"}`,
+	} {
+		if rec := postWebhook(c, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestWebhookRepliesRequireSecret(t *testing.T) {
+	mb := bus.NewMessageBus()
+	defer mb.Close()
+	c, err := NewWebhookChannel(config.WebhookConfig{Path: "/webhook/inbound"}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{
+		`{"content":"x","mode":"sync"}`,
+		`{"content":"x","mode":"async","callback_url":"https://example.com/hook"}`,
+	} {
+		if rec := postWebhook(c, body); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: status %d, want 403", body, rec.Code)
+		}
+	}
+}
+
+func TestWebhookCallbackDialRefusesInternalAddresses(t *testing.T) {
+	c, _ := newTestWebhook(t)
+	c.config.CallbackHosts = nil
+	_, err := c.dialCallback(context.Background(), "tcp", "127.0.0.1:80")
+	if !errors.Is(err, errCallbackBlocked) {
+		t.Errorf("dialCallback(127.0.0.1) = %v, want blocked", err)
+	}
+}
+
+func sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookSourceAuthentication(t *testing.T) {
+	mb := bus.NewMessageBus()
+	defer mb.Close()
+	c, err := NewWebhookChannel(config.WebhookConfig{
+		Path: "/hooks",
+		Sources: map[string]config.WebhookSourceConfig{
+			"gh":     {Secret: "ghs", Adapter: "github"},
+			"lab":    {Secret: "gls", Adapter: "gitlab"},
+			"ha":     {Secret: "has", Adapter: "homeassistant"},
+			"stripe": {Secret: "sts", Auth: "timestamped"},
+		},
+	}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const ghBody = `{"zen":"hi"}`
+	const labBody = `{"object_kind":"push"}`
+	const haBody = `{"message":"Doorbell rang"}`
+	const stBody = `{"content":"paid","source":"spoofed"}`
+	now := time.Now().Unix()
+	stSig := fmt.Sprintf("t=%d,v1=%s", now, sign("sts", fmt.Sprintf("%d.%s", now, stBody)))
+	staleAt := now - 3600
+	staleSig := fmt.Sprintf("t=%d,v1=%s", staleAt, sign("sts", fmt.Sprintf("%d.%s", staleAt, stBody)))
+
+	tests := []struct {
+		name, path, body, header, value string
+		want                            int
+	}{
+		{"github signed", "/hooks/gh", ghBody, "X-Hub-Signature-256", "sha256=" + sign("ghs", ghBody), http.StatusOK},
+		{"github bad signature", "/hooks/gh", ghBody, "X-Hub-Signature-256", "sha256=" + sign("wrong", ghBody), http.StatusUnauthorized},
+		{"gitlab token", "/hooks/lab", labBody, "X-Gitlab-Token", "gls", http.StatusOK},
+		{"gitlab wrong token", "/hooks/lab", labBody, "X-Gitlab-Token", "nope", http.StatusUnauthorized},
+		{"home assistant bearer", "/hooks/ha", haBody, "Authorization", "Bearer has", http.StatusOK},
+		{"home assistant other source's secret", "/hooks/ha", haBody, "Authorization", "Bearer ghs", http.StatusUnauthorized},
+		{"timestamped", "/hooks/stripe", stBody, "Stripe-Signature", stSig, http.StatusOK},
+		{"timestamped replay", "/hooks/stripe", stBody, "Stripe-Signature", stSig, http.StatusUnauthorized},
+		{"timestamped stale", "/hooks/stripe", stBody, "Stripe-Signature", staleSig, http.StatusUnauthorized},
+		{"unknown source", "/hooks/other", haBody, "Authorization", "Bearer has", http.StatusNotFound},
+		{"generic posing as source", "/hooks", `{"content":"x","source":"GH"}`, "Authorization", "", http.StatusForbidden},
+		{"generic with separator", "/hooks", `{"content":"x","source":"gh:push"}`, "Authorization", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		req.Header.Set(tt.header, tt.value)
+		req.Header.Set("X-GitHub-Event", "ping")
+		rec := httptest.NewRecorder()
+		c.handler(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// Fire-and-forget events are published in the background, in any order.
+	senders := map[string]bool{}
+	for range 3 {
+		in, ok := mb.ConsumeInbound(ctx)
+		if !ok {
+			t.Fatalf("inbound senders so far: %v", senders)
+		}
+		senders[in.SenderID] = true
+	}
+	for _, want := range []string{"lab", "ha", "stripe"} {
+		if !senders["webhook:"+want] {
+			t.Errorf("senders = %v, want the source named by the endpoint (%s)", senders, want)
+		}
+	}
+}
+
+func TestNewWebhookChannelValidatesSources(t *testing.T) {
+	for _, sources := range []map[string]config.WebhookSourceConfig{
+		{"jobs": {Secret: "x"}},
+		{"gh": {Secret: "x", Adapter: "bitbucket"}},
+		{"gh": {Adapter: "github"}},
+	} {
+		if _, err := NewWebhookChannel(config.WebhookConfig{Sources: sources}, nil); err == nil {
+			t.Errorf("sources %+v should be rejected", sources)
+		}
+	}
+}
+
+func TestWebhookAdapters(t *testing.T) {
+	header := func(k, v string) http.Header {
+		h := http.Header{}
+		h.Set(k, v)
+		return h
+	}
+	tests := []struct {
+		name    string
+		adapter string
+		header  http.Header
+		body    string
+		event   string
+		content string
+	}{
+		{
+			"github push", "github", header("X-GitHub-Event", "push"),
+			`{"ref":"refs/heads/main","compare":"https://gh/c","repository":{"full_name":"acme/app"},"sender":{"login":"ann"},
+			  "commits":[{"message":"Fix login\n\nDetails"},{"message":"Bump deps"}]}`,
+			"push", "ann pushed 2 commit(s) to main in acme/app:\n- Fix login\n- Bump deps\nhttps://gh/c",
+		},
+		{
+			"github merged pull request", "github", header("X-GitHub-Event", "pull_request"),
+			`{"action":"closed","repository":{"full_name":"acme/app"},"sender":{"login":"bob"},
+			  "pull_request":{"number":7,"title":"Add cache","html_url":"https://gh/pr/7","merged":true}}`,
+			"pull_request", "bob merged pull request #7 in acme/app: Add cache\nhttps://gh/pr/7",
+		},
+		{
+			"gitlab merge request", "gitlab", http.Header{},
+			`{"object_kind":"merge_request","user":{"name":"Cy"},"project":{"path_with_namespace":"g/p"},
+			  "object_attributes":{"iid":3,"title":"Refactor","url":"https://gl/mr/3","action":"open"}}`,
+			"merge_request", "Cy opened merge request !3 in g/p: Refactor\nhttps://gl/mr/3",
+		},
+		{
+			"alertmanager", "alertmanager", http.Header{},
+			`{"status":"firing","externalURL":"https://am","commonLabels":{"alertname":"HighCPU"},"alerts":[
+			  {"status":"firing","labels":{"alertname":"HighCPU","instance":"pi","severity":"critical"},"annotations":{"summary":"CPU at 97%"}}]}`,
+			"alert", "[FIRING:1] HighCPU\n- HighCPU on pi (critical): CPU at 97%\nhttps://am",
+		},
+		{
+			"home assistant state change", "homeassistant", http.Header{},
+			`{"entity_id":"lock.front_door","friendly_name":"Front door","old_state":{"state":"locked"},"new_state":"unlocked"}`,
+			"state_changed", "Front door changed from locked to unlocked",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok, err := webhookAdapters[tt.adapter](tt.header, []byte(tt.body))
+			if err != nil || !ok {
+				t.Fatalf("adapter = %v, %v", ok, err)
+			}
+			if p.Event != tt.event || p.Content != tt.content {
+				t.Errorf("got %q / %q\nwant %q / %q", p.Event, p.Content, tt.event, tt.content)
+			}
+		})
+	}
+
+	if _, ok, _ := adaptGitHub(header("X-GitHub-Event", "workflow_run"), []byte(`{"action":"in_progress","workflow_run":{}}`)); ok {
+		t.Error("an unfinished workflow run should be ignored")
+	}
+}
@@ -0,0 +1,279 @@
+// PicoClaw web chat. Speaks the frame protocol documented on WebChannel
+// in pkg/channels/web.go.
+(function () {
+  'use strict';
+
+  const $ = (id) => document.getElementById(id);
+  const TOKEN_KEY = 'picoclaw.token';
+  const SESSION_KEY = 'picoclaw.session';
+  const MAX_IMAGE_BYTES = 8 << 20;
+
+  let ws = null;
+  let sessions = [];
+  let current = localStorage.getItem(SESSION_KEY) || newSessionID();
+  let pending = []; // data URIs of images to send
+  let retry = 1000;
+
+  function newSessionID() {
+    return 's' + Date.now().toString(36) + Math.random().toString(36).slice(2, 8);
+  }
+
+  // --- markdown ---------------------------------------------------------
+
+  function escapeHTML(s) {
+    return s.replace(/[&<>"']/g, (c) => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' }[c]));
+  }
+
+  function inline(s) {
+    return s
+      .replace(/`([^`]+)`/g, '<code>$1</code>')
+      .replace(/\*\*([^*]+)\*\*/g, '<strong>$1</strong>')
+      .replace(/(^|[^*])\*([^*\s][^*]*)\*/g, '$1<em>$2</em>')
+      .replace(/\[([^\]]+)\]\((https?:\/\/[^\s)]+)\)/g, '<a href="$2" target="_blank" rel="noopener">$1</a>');
+  }
+
+  // renderMarkdown handles the subset chat replies use: fenced code,
+  // headings, lists, bold, italics, inline code and links. Input is escaped
+  // first, so only the tags produced here reach the page.
+  function renderMarkdown(text) {
+    const out = [];
+    const blocks = escapeHTML(text).split(/^```[^\n]*\n?/m);
+    blocks.forEach((block, i) => {
+      if (i % 2 === 1) {
+        out.push('<pre><code>' + block.replace(/\n$/, '') + '</code></pre>');
+        return;
+      }
+      let list = null;
+      let para = [];
+      const flush = () => {
+        if (para.length) out.push('<p>' + inline(para.join('<br>')) + '</p>');
+        para = [];
+        if (list) out.push('</' + list + '>');
+        list = null;
+      };
+      block.split('\n').forEach((line) => {
+        let m;
+        if ((m = line.match(/^(#{1,6})\s+(.*)$/))) {
+          flush();
+          out.push('<h' + m[1].length + '>' + inline(m[2]) + '</h' + m[1].length + '>');
+        } else if ((m = line.match(/^\s*(?:[-*]|(\d+)\.)\s+(.*)$/))) {
+          const tag = m[1] ? 'ol' : 'ul';
+          if (para.length || list !== tag) flush();
+          if (!list) { out.push('<' + tag + '>'); list = tag; }
+          out.push('<li>' + inline(m[2]) + '</li>');
+        } else if (line.trim() === '') {
+          flush();
+        } else {
+          if (list) flush();
+          para.push(line);
+        }
+      });
+      flush();
+    });
+    return out.join('');
+  }
+
+  // --- rendering --------------------------------------------------------
+
+  function scrollDown() {
+    const box = $('messages');
+    box.scrollTop = box.scrollHeight;
+  }
+
+  function addMessage(msg) {
+    const div = document.createElement('div');
+    div.className = 'msg ' + msg.role;
+    if (msg.reasoning) {
+      const details = document.createElement('details');
+      details.innerHTML = '<summary>Reasoning</summary>';
+      const body = document.createElement('div');
+      body.textContent = msg.reasoning;
+      details.appendChild(body);
+      div.appendChild(details);
+    }
+    const content = document.createElement('div');
+    content.innerHTML = msg.role === 'assistant' ? renderMarkdown(msg.content || '') : escapeHTML(msg.content || '').replace(/\n/g, '<br>');
+    div.appendChild(content);
+    (msg.media || []).forEach((src) => {
+      if (!/^(data:image\/|https?:)/.test(src)) return;
+      const img = document.createElement('img');
+      img.src = src;
+      div.appendChild(img);
+    });
+    $('messages').appendChild(div);
+    scrollDown();
+  }
+
+  function addToolLine(ev) {
+    const status = (ev.metadata && ev.metadata.status) || 'running';
+    const icon = { running: '⚙', done: '✓', failed: '✗' }[status] || '⚙';
+    const args = ev.metadata && ev.metadata.args ? ' ' + ev.metadata.args : '';
+    const div = document.createElement('div');
+    div.className = 'tool';
+    div.textContent = icon + ' ' + ev.content + (status === 'running' ? args : ' ' + status);
+    $('messages').appendChild(div);
+    scrollDown();
+  }
+
+  function renderSessions() {
+    const list = $('sessions');
+    list.innerHTML = '';
+    const shown = sessions.some((s) => s.id === current) ? sessions : [{ id: current, title: 'New chat' }].concat(sessions);
+    shown.forEach((s) => {
+      const li = document.createElement('li');
+      li.textContent = s.title || 'New chat';
+      li.title = s.title || '';
+      if (s.id === current) li.className = 'active';
+      li.onclick = () => openSession(s.id);
+      list.appendChild(li);
+    });
+  }
+
+  function openSession(id) {
+    current = id;
+    localStorage.setItem(SESSION_KEY, id);
+    $('messages').innerHTML = '';
+    $('status').textContent = '';
+    renderSessions();
+    send({ type: 'history', session: id });
+  }
+
+  // --- connection -------------------------------------------------------
+
+  function send(frame) {
+    if (ws && ws.readyState === WebSocket.OPEN) ws.send(JSON.stringify(frame));
+  }
+
+  function showLogin(error) {
+    $('app').hidden = true;
+    $('login').hidden = false;
+    $('login-error').textContent = error || '';
+    $('token').focus();
+  }
+
+  function connect() {
+    const token = localStorage.getItem(TOKEN_KEY);
+    if (!token) return showLogin();
+
+    const url = (location.protocol === 'https:' ? 'wss://' : 'ws://') + location.host + location.pathname.replace(/\/$/, '') + '/ws';
+    ws = new WebSocket(url);
+    let rejected = false;
+
+    ws.onopen = () => ws.send(JSON.stringify({ type: 'auth', token }));
+    ws.onmessage = (e) => {
+      const frame = JSON.parse(e.data);
+      switch (frame.type) {
+        case 'ready':
+          retry = 1000;
+          $('login').hidden = true;
+          $('app').hidden = false;
+          sessions = frame.sessions || [];
+          openSession(current);
+          break;
+        case 'sessions':
+          sessions = frame.sessions || [];
+          renderSessions();
+          break;
+        case 'history':
+          if (frame.session !== current) break;
+          $('messages').innerHTML = '';
+          (frame.messages || []).forEach(addMessage);
+          break;
+        case 'message':
+          if (frame.session !== current) break;
+          $('status').textContent = '';
+          addMessage({ role: 'assistant', content: frame.content, reasoning: frame.reasoning, media: frame.media });
+          break;
+        case 'event':
+          if (frame.session !== current || !frame.event) break;
+          if (frame.event.type === 'typing_start') $('status').textContent = 'PicoClaw is working…';
+          if (frame.event.type === 'typing_stop') $('status').textContent = '';
+          if (frame.event.type === 'tool_call') addToolLine(frame.event);
+          break;
+        case 'error':
+          if (frame.error === 'unauthorized') {
+            rejected = true;
+            localStorage.removeItem(TOKEN_KEY);
+            showLogin('Invalid token');
+          } else {
+            $('status').textContent = frame.error;
+          }
+          break;
+      }
+    };
+    ws.onclose = () => {
+      if (rejected) return;
+      $('status').textContent = 'Disconnected, reconnecting…';
+      setTimeout(connect, retry);
+      retry = Math.min(retry * 2, 30000);
+    };
+  }
+
+  // --- input ------------------------------------------------------------
+
+  function renderAttachments() {
+    const box = $('attachments');
+    box.innerHTML = '';
+    pending.forEach((src, i) => {
+      const img = document.createElement('img');
+      img.src = src;
+      img.title = 'Remove';
+      img.onclick = () => { pending.splice(i, 1); renderAttachments(); };
+      box.appendChild(img);
+    });
+  }
+
+  $('file').onchange = (e) => {
+    Array.from(e.target.files).forEach((file) => {
+      if (file.size > MAX_IMAGE_BYTES) {
+        $('status').textContent = file.name + ' is too large';
+        return;
+      }
+      const reader = new FileReader();
+      reader.onload = () => { pending.push(reader.result); renderAttachments(); };
+      reader.readAsDataURL(file);
+    });
+    e.target.value = '';
+  };
+
+  $('composer').onsubmit = (e) => {
+    e.preventDefault();
+    const input = $('input');
+    const content = input.value.trim();
+    if (!content && !pending.length) return;
+    addMessage({ role: 'user', content, media: pending });
+    send({ type: 'message', session: current, content, media: pending });
+    input.value = '';
+    input.style.height = '';
+    pending = [];
+    renderAttachments();
+  };
+
+  $('input').onkeydown = (e) => {
+    if (e.key === 'Enter' && !e.shiftKey) {
+      e.preventDefault();
+      $('composer').requestSubmit();
+    }
+  };
+  $('input').oninput = (e) => {
+    e.target.style.height = '';
+    e.target.style.height = e.target.scrollHeight + 'px';
+  };
+
+  $('new-chat').onclick = () => openSession(newSessionID());
+
+  $('login-form').onsubmit = (e) => {
+    e.preventDefault();
+    localStorage.setItem(TOKEN_KEY, $('token').value);
+    $('token').value = '';
+    connect();
+  };
+
+  $('logout').onclick = () => {
+    localStorage.removeItem(TOKEN_KEY);
+    if (ws) { ws.onclose = null; ws.close(); }
+    showLogin();
+  };
+
+  connect();
+})();
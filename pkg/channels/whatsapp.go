@@ -2,9 +2,11 @@ package channels
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"sync"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
 type WhatsAppChannel struct {
@@ -79,6 +82,28 @@ func (c *WhatsAppChannel) Stop(ctx context.Context) error {
 }
 
 func (c *WhatsAppChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	payload := map[string]interface{}{
+		"type":    "message",
+		"to":      msg.ChatID,
+		"content": msg.Content,
+	}
+
+	// Synthesize before taking the connection lock; it can take seconds.
+	if c.config.VoiceReplies {
+		if audioPath := c.voiceReply(ctx, msg, voice.FormatOpus); audioPath != "" {
+			audio, err := os.ReadFile(audioPath)
+			os.Remove(audioPath)
+			if err == nil {
+				payload = map[string]interface{}{
+					"type":     "voice",
+					"to":       msg.ChatID,
+					"mimetype": "audio/ogg; codecs=opus",
+					"data":     base64.StdEncoding.EncodeToString(audio),
+				}
+			}
+		}
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -86,12 +111,6 @@ func (c *WhatsAppChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		return fmt.Errorf("whatsapp connection not established")
 	}
 
-	payload := map[string]interface{}{
-		"type":    "message",
-		"to":      msg.ChatID,
-		"content": msg.Content,
-	}
-
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
@@ -138,18 +157,24 @@ func (c *WhatsAppChannel) listen(ctx context.Context) {
 			}
 
 			if msgType == "message" {
-				c.handleIncomingMessage(msg)
+				c.handleIncomingMessage(ctx, msg)
 			}
 		}
 	}
 }
 
-func (c *WhatsAppChannel) handleIncomingMessage(msg map[string]interface{}) {
+func (c *WhatsAppChannel) handleIncomingMessage(ctx context.Context, msg map[string]interface{}) {
 	senderID, ok := msg["from"].(string)
 	if !ok {
 		return
 	}
 
+	// Check the allowlist before transcribing voice notes.
+	if !c.IsAllowed(senderID) {
+		log.Printf("WhatsApp message from %s rejected by allowlist", senderID)
+		return
+	}
+
 	chatID, ok := msg["chat"].(string)
 	if !ok {
 		chatID = senderID
@@ -170,6 +195,21 @@ func (c *WhatsAppChannel) handleIncomingMessage(msg map[string]interface{}) {
 		}
 	}
 
+	// The bridge saves voice notes next to us; transcribe them so the agent
+	// gets text rather than an opaque file path.
+	hasAudio := false
+	for _, path := range mediaPaths {
+		if utils.IsAudioFile(path, "") {
+			hasAudio = true
+			if content != "" {
+				content += "\n"
+			}
+			content += c.transcribeAudio(ctx, path, "voice")
+		}
+	}
+
+	c.markVoiceInput(chatID, hasAudio)
+
 	metadata := make(map[string]string)
 	if messageID, ok := msg["id"].(string); ok {
 		metadata["message_id"] = messageID
@@ -53,6 +53,10 @@ type Config struct {
 	Devices   DevicesConfig   `json:"devices"`
 	Sentinel  SentinelConfig  `json:"sentinel"`
 	Council   CouncilConfig   `json:"council"`
+	Cost      CostConfig      `json:"cost"`
+	Voice     VoiceConfig     `json:"voice"`
+	Bus       BusConfig       `json:"bus"`
+	Tracing   TracingConfig   `json:"tracing"`
 	mu        sync.RWMutex
 }
 
@@ -69,6 +73,8 @@ type AgentDefaults struct {
 	MaxTokens           int      `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
 	Temperature         float64  `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
 	MaxToolIterations   int      `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	ReasoningBudget     int      `json:"reasoning_budget" env:"PICOCLAW_AGENTS_DEFAULTS_REASONING_BUDGET"`   // tokens, 0 disables extended thinking
+	ReasoningDisplay    string   `json:"reasoning_display" env:"PICOCLAW_AGENTS_DEFAULTS_REASONING_DISPLAY"` // off, collapsed or separate
 }
 
 type ChannelsConfig struct {
@@ -83,12 +89,22 @@ type ChannelsConfig struct {
 	LINE     LINEConfig     `json:"line"`
 	OneBot   OneBotConfig   `json:"onebot"`
 	Webhook  WebhookConfig  `json:"webhook"`
+	Web      WebChatConfig  `json:"web"`
+	Matrix   MatrixConfig   `json:"matrix"`
+	Email    EmailConfig    `json:"email"`
+	Signal   SignalConfig   `json:"signal"`
+	// Plugins are out-of-process adapters speaking the plugin channel
+	// protocol (see pkg/channels/plugin.go), one named channel each.
+	Plugins []PluginChannelConfig `json:"plugins"`
 }
 
 type WhatsAppConfig struct {
 	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_WHATSAPP_ENABLED"`
 	BridgeURL string              `json:"bridge_url" env:"PICOCLAW_CHANNELS_WHATSAPP_BRIDGE_URL"`
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_WHATSAPP_ALLOW_FROM"`
+	// VoiceReplies sends spoken answers as "voice" frames; the bridge must
+	// support them, so this is opt-in.
+	VoiceReplies bool `json:"voice_replies" env:"PICOCLAW_CHANNELS_WHATSAPP_VOICE_REPLIES"`
 }
 
 type TelegramConfig struct {
@@ -166,6 +182,101 @@ type WebhookConfig struct {
 	Port    int    `json:"port" env:"PICOCLAW_CHANNELS_WEBHOOK_PORT"`
 	Path    string `json:"path" env:"PICOCLAW_CHANNELS_WEBHOOK_PATH"`
 	Secret  string `json:"secret" env:"PICOCLAW_CHANNELS_WEBHOOK_SECRET"`
+	// SyncTimeout caps, in seconds, how long a "sync" request waits for
+	// the agent's reply before answering 202 with a job to poll.
+	SyncTimeout int `json:"sync_timeout" env:"PICOCLAW_CHANNELS_WEBHOOK_SYNC_TIMEOUT"`
+	// CallbackHosts may receive "async" callbacks even though they resolve
+	// to loopback, private or link-local addresses, which are refused
+	// otherwise.
+	CallbackHosts FlexibleStringSlice `json:"callback_hosts" env:"PICOCLAW_CHANNELS_WEBHOOK_CALLBACK_HOSTS"`
+	// Sources get their own endpoints at <path>/<name>, each with its own
+	// credentials and optionally a payload adapter.
+	Sources map[string]WebhookSourceConfig `json:"sources,omitempty"`
+}
+
+// WebChatConfig enables the built-in browser chat, served by the gateway's
+// HTTP server at Path. Token is required: the browser logs in with it.
+type WebChatConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_CHANNELS_WEB_ENABLED"`
+	Path    string `json:"path" env:"PICOCLAW_CHANNELS_WEB_PATH"`
+	Token   string `json:"token" env:"PICOCLAW_CHANNELS_WEB_TOKEN"`
+}
+
+// MatrixConfig logs in to a Matrix homeserver with an existing account's
+// access token. Rooms are chat IDs; AutoJoin accepts invites from allowed
+// users, and ThreadReplies answers every top-level message in a thread of
+// its own. For end-to-end encrypted rooms, point Homeserver at a Pantalaimon
+// proxy, which encrypts and decrypts on the bot's behalf.
+type MatrixConfig struct {
+	Enabled       bool                `json:"enabled" env:"PICOCLAW_CHANNELS_MATRIX_ENABLED"`
+	Homeserver    string              `json:"homeserver" env:"PICOCLAW_CHANNELS_MATRIX_HOMESERVER"`
+	AccessToken   string              `json:"access_token" env:"PICOCLAW_CHANNELS_MATRIX_ACCESS_TOKEN"`
+	AutoJoin      bool                `json:"auto_join" env:"PICOCLAW_CHANNELS_MATRIX_AUTO_JOIN"`
+	ThreadReplies bool                `json:"thread_replies" env:"PICOCLAW_CHANNELS_MATRIX_THREAD_REPLIES"`
+	AllowFrom     FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_MATRIX_ALLOW_FROM"`
+}
+
+// EmailConfig watches an IMAP mailbox and answers over SMTP. Username and
+// Password log in to both servers; Address is the From address of replies
+// and defaults to Username. Port 993 (IMAP) and 465 (SMTP) use implicit
+// TLS, other ports STARTTLS when the server offers it. PollInterval is in
+// seconds and also bounds how long an IMAP IDLE waits between checks.
+//
+// From headers are easy to forge, so AllowFrom only counts mail that the
+// receiving server identified by AuthservID vouches for in its
+// Authentication-Results header (a DMARC pass, or a DKIM pass for the
+// sender's domain). Without AuthservID a non-empty AllowFrom is refused
+// unless AllowUnauthenticated accepts that risk.
+type EmailConfig struct {
+	Enabled              bool                `json:"enabled" env:"PICOCLAW_CHANNELS_EMAIL_ENABLED"`
+	IMAPHost             string              `json:"imap_host" env:"PICOCLAW_CHANNELS_EMAIL_IMAP_HOST"`
+	IMAPPort             int                 `json:"imap_port" env:"PICOCLAW_CHANNELS_EMAIL_IMAP_PORT"`
+	SMTPHost             string              `json:"smtp_host" env:"PICOCLAW_CHANNELS_EMAIL_SMTP_HOST"`
+	SMTPPort             int                 `json:"smtp_port" env:"PICOCLAW_CHANNELS_EMAIL_SMTP_PORT"`
+	Username             string              `json:"username" env:"PICOCLAW_CHANNELS_EMAIL_USERNAME"`
+	Password             string              `json:"password" env:"PICOCLAW_CHANNELS_EMAIL_PASSWORD"`
+	Address              string              `json:"address" env:"PICOCLAW_CHANNELS_EMAIL_ADDRESS"`
+	Mailbox              string              `json:"mailbox" env:"PICOCLAW_CHANNELS_EMAIL_MAILBOX"`
+	PollInterval         int                 `json:"poll_interval" env:"PICOCLAW_CHANNELS_EMAIL_POLL_INTERVAL"`
+	AllowFrom            FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_EMAIL_ALLOW_FROM"`
+	AuthservID           string              `json:"authserv_id" env:"PICOCLAW_CHANNELS_EMAIL_AUTHSERV_ID"`
+	AllowUnauthenticated bool                `json:"allow_unauthenticated" env:"PICOCLAW_CHANNELS_EMAIL_ALLOW_UNAUTHENTICATED"`
+}
+
+// SignalConfig talks to a signal-cli daemon over its JSON-RPC interface.
+// Socket is the path of its UNIX socket (--socket) or the host:port of its
+// TCP listener (--tcp). Account is the bot's phone number, needed when the
+// daemon serves several accounts. AllowFrom takes phone numbers or UUIDs.
+type SignalConfig struct {
+	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_SIGNAL_ENABLED"`
+	Socket    string              `json:"socket" env:"PICOCLAW_CHANNELS_SIGNAL_SOCKET"`
+	Account   string              `json:"account" env:"PICOCLAW_CHANNELS_SIGNAL_ACCOUNT"`
+	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_SIGNAL_ALLOW_FROM"`
+}
+
+// WebhookSourceConfig authenticates one webhook source. Auth is "bearer"
+// (Authorization: Bearer <secret>), "hmac" (GitHub's X-Hub-Signature-256),
+// "timestamped" (Stripe-style "t=<unix>,v1=<hmac>" signatures, rejected
+// when stale or replayed) or "token" (GitLab's X-Gitlab-Token); empty picks
+// the adapter's native scheme, or bearer. Adapter is "github", "gitlab",
+// "grafana", "alertmanager" or "homeassistant"; empty expects the generic
+// JSON payload.
+type WebhookSourceConfig struct {
+	Secret  string `json:"secret"`
+	Auth    string `json:"auth,omitempty"`
+	Adapter string `json:"adapter,omitempty"`
+}
+
+// PluginChannelConfig runs a channel adapter out of process. Set URL to
+// dial an adapter's WebSocket, or Command to start one that talks JSON
+// lines over stdin and stdout.
+type PluginChannelConfig struct {
+	Enabled   bool                `json:"enabled"`
+	Name      string              `json:"name"`
+	URL       string              `json:"url,omitempty"`
+	Token     string              `json:"token,omitempty"` // sent as a bearer token when dialing URL
+	Command   []string            `json:"command,omitempty"`
+	AllowFrom FlexibleStringSlice `json:"allow_from"`
 }
 
 type HeartbeatConfig struct {
@@ -196,6 +307,79 @@ type CouncilConfig struct {
 	Members []CouncilMemberConfig `json:"members"`
 }
 
+// CostConfig prices LLM usage and caps spend. Budgets are in USD; 0 disables.
+type CostConfig struct {
+	Prices         map[string]ModelPrice `json:"prices"` // keyed by "provider/model" or "model"
+	DailyBudget    float64               `json:"daily_budget" env:"PICOCLAW_COST_DAILY_BUDGET"`
+	MonthlyBudget  float64               `json:"monthly_budget" env:"PICOCLAW_COST_MONTHLY_BUDGET"`
+	OverBudget     string                `json:"over_budget" env:"PICOCLAW_COST_OVER_BUDGET"` // "warn", "downgrade" or "block"
+	DowngradeModel string                `json:"downgrade_model" env:"PICOCLAW_COST_DOWNGRADE_MODEL"`
+}
+
+// BusConfig controls message delivery guarantees. With Persistent set, the
+// gateway journals every message under <workspace>/bus until it is handled,
+// letters. MaxAttempts bounds outbound send retries and how often an
+// unhandled inbound message is replayed (0 uses the default).
+// letters. MaxAttempts bounds outbound send retries (0 uses the default).
+type BusConfig struct {
+	Persistent  bool `json:"persistent" env:"PICOCLAW_BUS_PERSISTENT"`
+	MaxAttempts int  `json:"max_attempts" env:"PICOCLAW_BUS_MAX_ATTEMPTS"`
+}
+
+// TracingConfig exports OpenTelemetry traces over OTLP/HTTP. Endpoint is
+// the collector as host:port or a full URL; empty falls back to the
+// OTEL_EXPORTER_OTLP_* environment variables and then localhost:4318.
+// SampleRatio is the share of turns traced, from 0 to 1.
+type TracingConfig struct {
+	Enabled     bool              `json:"enabled" env:"PICOCLAW_TRACING_ENABLED"`
+	Endpoint    string            `json:"endpoint" env:"PICOCLAW_TRACING_ENDPOINT"`
+	Insecure    bool              `json:"insecure" env:"PICOCLAW_TRACING_INSECURE"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	SampleRatio float64           `json:"sample_ratio" env:"PICOCLAW_TRACING_SAMPLE_RATIO"`
+}
+
+// VoiceConfig selects the speech-to-text backend for voice messages.
+// Transcriber is "groq", "openai" (any OpenAI-compatible
+// /audio/transcriptions endpoint, e.g. a local whisper server via APIBase),
+// "whisper_cpp" or "none"; empty uses Groq when a Groq API key is set.
+type VoiceConfig struct {
+	Transcriber      string    `json:"transcriber" env:"PICOCLAW_VOICE_TRANSCRIBER"`
+	APIBase          string    `json:"api_base,omitempty" env:"PICOCLAW_VOICE_API_BASE"`
+	APIKey           string    `json:"api_key,omitempty" env:"PICOCLAW_VOICE_API_KEY"`
+	Model            string    `json:"model,omitempty" env:"PICOCLAW_VOICE_MODEL"`
+	Language         string    `json:"language,omitempty" env:"PICOCLAW_VOICE_LANGUAGE"` // ISO-639-1 hint, empty auto-detects
+	WhisperCppBinary string    `json:"whisper_cpp_binary,omitempty" env:"PICOCLAW_VOICE_WHISPER_CPP_BINARY"`
+	WhisperCppModel  string    `json:"whisper_cpp_model,omitempty" env:"PICOCLAW_VOICE_WHISPER_CPP_MODEL"`
+	TTS              TTSConfig `json:"tts"`
+}
+
+// TTSConfig selects the text-to-speech backend for voice replies.
+// Provider is "edge" (edge-tts CLI), "piper" (local piper CLI, Voice is a
+// model path and other voices are model names in PiperModels, by default
+// Voice's directory), "openai" (any OpenAI-compatible /audio/speech endpoint) or
+// "none". Reply is the default mode: "auto" answers voice messages by
+// voice, "always" speaks every answer, "off" never does; users override it
+// per chat with /voice.
+type TTSConfig struct {
+	Provider    string            `json:"provider" env:"PICOCLAW_VOICE_TTS_PROVIDER"`
+	Voice       string            `json:"voice" env:"PICOCLAW_VOICE_TTS_VOICE"`
+	Voices      map[string]string `json:"voices,omitempty"` // language -> voice, used for per-user languages
+	Reply       string            `json:"reply" env:"PICOCLAW_VOICE_TTS_REPLY"`
+	MaxChars    int               `json:"max_chars" env:"PICOCLAW_VOICE_TTS_MAX_CHARS"` // longer answers are sent as text
+	APIBase     string            `json:"api_base,omitempty" env:"PICOCLAW_VOICE_TTS_API_BASE"`
+	APIKey      string            `json:"api_key,omitempty" env:"PICOCLAW_VOICE_TTS_API_KEY"`
+	Model       string            `json:"model,omitempty" env:"PICOCLAW_VOICE_TTS_MODEL"`
+	PiperBinary string            `json:"piper_binary,omitempty" env:"PICOCLAW_VOICE_TTS_PIPER_BINARY"`
+	PiperModels string            `json:"piper_models,omitempty" env:"PICOCLAW_VOICE_TTS_PIPER_MODELS"`
+}
+
+// ModelPrice is the USD price per million tokens.
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+	Cached float64 `json:"cached"` // cached prompt tokens; 0 falls back to Input
+}
+
 type ProvidersConfig struct {
 	Anthropic     ProviderConfig `json:"anthropic"`
 	OpenAI        ProviderConfig `json:"openai"`
@@ -217,11 +401,38 @@ type ProviderConfig struct {
 	Proxy       string `json:"proxy,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_PROXY"`
 	AuthMethod  string `json:"auth_method,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_AUTH_METHOD"`
 	ConnectMode string `json:"connect_mode,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_CONNECT_MODE"` //only for Github Copilot, `stdio` or `grpc`
+	RPM         int    `json:"rpm,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_RPM"`                   // requests per minute, 0 = unlimited
+	TPM         int    `json:"tpm,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_TPM"`                   // tokens per minute, 0 = unlimited
 }
 
 type GatewayConfig struct {
-	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
-	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	Host  string      `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
+	Port  int         `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	API   APIConfig   `json:"api"`
+	Admin AdminConfig `json:"admin"`
+}
+
+// AdminConfig enables the /admin REST API on the gateway. Requests carry
+// Token as a bearer token; the API will not start without one.
+type AdminConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_GATEWAY_ADMIN_ENABLED"`
+	Token   string `json:"token" env:"PICOCLAW_GATEWAY_ADMIN_TOKEN"`
+}
+
+// APIConfig enables the OpenAI-compatible /v1 endpoints on the gateway.
+// Each key gets its own session; Profiles name lists of tools a key may
+// use, and a key without a profile may use them all.
+type APIConfig struct {
+	Enabled  bool                `json:"enabled" env:"PICOCLAW_GATEWAY_API_ENABLED"`
+	Keys     []APIKeyConfig      `json:"keys"`
+	Profiles map[string][]string `json:"profiles,omitempty"`
+}
+
+type APIKeyConfig struct {
+	Name    string `json:"name"`
+	Key     string `json:"key"`
+	Session string `json:"session,omitempty"` // defaults to "api:<name>"
+	Profile string `json:"profile,omitempty"`
 }
 
 type BraveConfig struct {
@@ -268,6 +479,8 @@ func DefaultConfig() *Config {
 				MaxTokens:           8192,
 				Temperature:         0.7,
 				MaxToolIterations:   20,
+				ReasoningBudget:     0,
+				ReasoningDisplay:    "off",
 			},
 		},
 		Channels: ChannelsConfig{
@@ -336,11 +549,34 @@ func DefaultConfig() *Config {
 				AllowFrom:          FlexibleStringSlice{},
 			},
 			Webhook: WebhookConfig{
+				Enabled:     false,
+				Host:        "0.0.0.0",
+				Port:        18792,
+				Path:        "/webhook/inbound",
+				Secret:      "",
+				SyncTimeout: 60,
+			},
+			Web: WebChatConfig{
 				Enabled: false,
-				Host:    "0.0.0.0",
-				Port:    18792,
-				Path:    "/webhook/inbound",
-				Secret:  "",
+				Path:    "/chat",
+			},
+			Matrix: MatrixConfig{
+				Enabled:   false,
+				AutoJoin:  true,
+				AllowFrom: FlexibleStringSlice{},
+			},
+			Email: EmailConfig{
+				Enabled:      false,
+				IMAPPort:     993,
+				SMTPPort:     587,
+				Mailbox:      "INBOX",
+				PollInterval: 60,
+				AllowFrom:    FlexibleStringSlice{},
+			},
+			Signal: SignalConfig{
+				Enabled:   false,
+				Socket:    "127.0.0.1:7583",
+				AllowFrom: FlexibleStringSlice{},
 			},
 		},
 		Providers: ProvidersConfig{
@@ -392,6 +628,20 @@ func DefaultConfig() *Config {
 		Council: CouncilConfig{
 			Enabled: false,
 		},
+		Cost: CostConfig{
+			OverBudget: "warn",
+		},
+		Voice: VoiceConfig{
+			TTS: TTSConfig{
+				Provider: "edge",
+				Voice:    "es-AR-TomasNeural",
+				Reply:    "auto",
+				MaxChars: 1500,
+			},
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+		},
 	}
 }
 
@@ -417,6 +667,22 @@ func LoadConfig(path string) (*Config, error) {
 	return cfg, nil
 }
 
+// ReloadCost re-reads the config file at path and replaces the cost
+// section, returning it for the tracker to apply. Other sections are read
+// without locking while turns run (and some, like the model, change at
+// runtime), so they only take effect on restart.
+func (c *Config) ReloadCost(path string) (CostConfig, error) {
+	fresh, err := LoadConfig(path)
+	if err != nil {
+		return CostConfig{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Cost = fresh.Cost
+	return fresh.Cost, nil
+}
+
 func SaveConfig(path string, cfg *Config) error {
 	cfg.mu.RLock()
 	defer cfg.mu.RUnlock()
@@ -470,6 +736,40 @@ func (c *Config) GetAPIKey() string {
 	return ""
 }
 
+// GetProvider returns the config for a provider by its config key
+// ("anthropic", "openrouter", ...).
+func (c *Config) GetProvider(name string) (ProviderConfig, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	switch name {
+	case "anthropic":
+		return c.Providers.Anthropic, true
+	case "openai":
+		return c.Providers.OpenAI, true
+	case "openrouter":
+		return c.Providers.OpenRouter, true
+	case "groq":
+		return c.Providers.Groq, true
+	case "zhipu":
+		return c.Providers.Zhipu, true
+	case "vllm":
+		return c.Providers.VLLM, true
+	case "gemini":
+		return c.Providers.Gemini, true
+	case "nvidia":
+		return c.Providers.Nvidia, true
+	case "moonshot":
+		return c.Providers.Moonshot, true
+	case "shengsuanyun":
+		return c.Providers.ShengSuanYun, true
+	case "deepseek":
+		return c.Providers.DeepSeek, true
+	case "github_copilot":
+		return c.Providers.GitHubCopilot, true
+	}
+	return ProviderConfig{}, false
+}
+
 func (c *Config) GetAPIBase() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -177,3 +179,34 @@ func TestConfig_Complete(t *testing.T) {
 		t.Error("Heartbeat should be enabled by default")
 	}
 }
+
+// TestReloadCost verifies ReloadCost picks up cost changes only and rejects
+// bad files
+func TestReloadCost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"agents":{"defaults":{"reasoning_display":"off"}}}`), 0644)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(path, []byte(`{"agents":{"defaults":{"reasoning_display":"collapsed"}},"cost":{"daily_budget":5}}`), 0644)
+	cost, err := cfg.ReloadCost(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.DailyBudget != 5 || cfg.Cost.DailyBudget != 5 {
+		t.Errorf("after ReloadCost: daily_budget %v, config %v", cost.DailyBudget, cfg.Cost.DailyBudget)
+	}
+	if cfg.Agents.Defaults.ReasoningDisplay != "off" {
+		t.Error("ReloadCost changed a section other than cost")
+	}
+
+	os.WriteFile(path, []byte(`{not json`), 0644)
+	if _, err := cfg.ReloadCost(path); err == nil {
+		t.Error("ReloadCost should fail on invalid JSON")
+	}
+	if cfg.Cost.DailyBudget != 5 {
+		t.Error("a failed ReloadCost changed the config")
+	}
+}
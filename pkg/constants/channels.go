@@ -7,6 +7,7 @@ var InternalChannels = map[string]bool{
 	"cli":      true,
 	"system":   true,
 	"subagent": true,
+	"api":      true, // replies go back over HTTP, not the bus
 }
 
 // IsInternalChannel returns true if the channel is an internal channel.
@@ -11,10 +11,12 @@ import (
 
 	"github.com/mymmrac/telego"
 	tu "github.com/mymmrac/telego/telegoutil"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tracing"
 )
 
 // MemberResponse holds a single council member's response.
@@ -139,7 +141,12 @@ func (c *Council) Deliberate(ctx context.Context, question string) ([]MemberResp
 			{Role: "user", Content: userContent},
 		}
 
-		response, err := c.runMember(ctx, member, msgs)
+		memberCtx, span := tracing.Start(ctx, "council.member",
+			attribute.String("picoclaw.council.member", member.Name),
+			attribute.String("gen_ai.request.model", member.Model),
+		)
+		response, err := c.runMember(memberCtx, member, msgs)
+		tracing.End(span, err)
 		if err != nil {
 			logger.ErrorCF("council", "Member deliberation failed",
 				map[string]interface{}{"name": member.Name, "error": err.Error()})
@@ -12,6 +12,7 @@ import (
 
 	"github.com/adhocore/gronx"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
 )
 
 type CronSchedule struct {
@@ -223,6 +224,7 @@ func (cs *CronService) executeJobByID(jobID string) {
 		job.State.LastStatus = "ok"
 		job.State.LastError = ""
 	}
+	metrics.CronRuns.Inc(job.State.LastStatus)
 
 	// Compute next run time
 	if job.Schedule.Kind == "at" {
@@ -0,0 +1,329 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package documents extracts text from attachments (PDF, DOCX, XLSX, CSV,
+// HTML, plain text), splits it into pages and stores it in the workspace so
+// the agent can page through or search long documents instead of having them
+// truncated into the prompt.
+package documents
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// PageSize is the target page length in characters: large enough to keep
+// paragraphs together, small enough that a few pages fit in one turn.
+const PageSize = 4000
+
+// Document is the metadata of an ingested document.
+type Document struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	MimeType  string    `json:"mime_type,omitempty"`
+	Chars     int       `json:"chars"`
+	Pages     int       `json:"pages"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Match is a search hit within a document page.
+type Match struct {
+	DocID   string `json:"doc_id"`
+	DocName string `json:"doc_name"`
+	Page    int    `json:"page"`
+	Score   int    `json:"score"`
+	Snippet string `json:"snippet"`
+}
+
+// Store keeps documents under <workspace>/documents/<id>/, one meta.json
+// plus one text file per page.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewStore(workspace string) *Store {
+	return &Store{dir: filepath.Join(workspace, "documents")}
+}
+
+// Ingest extracts the text of the file at filePath and stores it paginated.
+// name is the original filename shown to the user and the agent.
+func (s *Store) Ingest(filePath, name, mimeType string) (*Document, error) {
+	text, err := Extract(filePath, name, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	return s.Add(name, mimeType, text)
+}
+
+// Add stores already extracted text as a new document.
+func (s *Store) Add(name, mimeType, text string) (*Document, error) {
+	pages := Chunk(text, PageSize)
+	doc := &Document{
+		ID:        "doc_" + uuid.New().String()[:8],
+		Name:      name,
+		MimeType:  mimeType,
+		Chars:     utf8.RuneCountInString(text),
+		Pages:     len(pages),
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docDir := filepath.Join(s.dir, doc.ID)
+	if err := os.MkdirAll(docDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating document directory: %w", err)
+	}
+	for i, page := range pages {
+		if err := os.WriteFile(s.pagePath(doc.ID, i+1), []byte(page), 0644); err != nil {
+			os.RemoveAll(docDir)
+			return nil, fmt.Errorf("writing page %d: %w", i+1, err)
+		}
+	}
+	meta, _ := json.MarshalIndent(doc, "", "  ")
+	if err := os.WriteFile(filepath.Join(docDir, "meta.json"), meta, 0644); err != nil {
+		os.RemoveAll(docDir)
+		return nil, fmt.Errorf("writing document metadata: %w", err)
+	}
+	return doc, nil
+}
+
+// Get returns a document's metadata.
+func (s *Store) Get(id string) (*Document, error) {
+	if !validID(id) {
+		return nil, fmt.Errorf("document %q not found", id)
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, id, "meta.json"))
+	if err != nil {
+		return nil, fmt.Errorf("document %q not found", id)
+	}
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("reading document %q: %w", id, err)
+	}
+	return &doc, nil
+}
+
+// List returns all documents, newest first.
+func (s *Store) List() ([]*Document, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []*Document
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if doc, err := s.Get(e.Name()); err == nil {
+			docs = append(docs, doc)
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].CreatedAt.After(docs[j].CreatedAt) })
+	return docs, nil
+}
+
+// Page returns page n (1-based) of a document.
+func (s *Store) Page(id string, n int) (string, *Document, error) {
+	doc, err := s.Get(id)
+	if err != nil {
+		return "", nil, err
+	}
+	if n < 1 || n > doc.Pages {
+		return "", doc, fmt.Errorf("page %d out of range (document has %d pages)", n, doc.Pages)
+	}
+	data, err := os.ReadFile(s.pagePath(id, n))
+	if err != nil {
+		return "", doc, fmt.Errorf("reading page %d: %w", n, err)
+	}
+	return string(data), doc, nil
+}
+
+// Search scores pages by how often the query terms occur (case-insensitive)
+// and returns the best limit matches. An empty id searches all documents.
+func (s *Store) Search(id, query string, limit int) ([]Match, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty search query")
+	}
+
+	var docs []*Document
+	if id != "" {
+		doc, err := s.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		docs = []*Document{doc}
+	} else {
+		var err error
+		if docs, err = s.List(); err != nil {
+			return nil, err
+		}
+	}
+
+	var matches []Match
+	for _, doc := range docs {
+		for n := 1; n <= doc.Pages; n++ {
+			data, err := os.ReadFile(s.pagePath(doc.ID, n))
+			if err != nil {
+				continue
+			}
+			text := string(data)
+			lower := strings.ToLower(text)
+
+			score, first := 0, -1
+			for _, term := range terms {
+				score += strings.Count(lower, term)
+				if i := strings.Index(lower, term); i >= 0 && (first < 0 || i < first) {
+					first = i
+				}
+			}
+			if score == 0 {
+				continue
+			}
+			matches = append(matches, Match{
+				DocID:   doc.ID,
+				DocName: doc.Name,
+				Page:    n,
+				Score:   score,
+				Snippet: snippet(text, lower, first),
+			})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// Delete removes a document and its pages.
+func (s *Store) Delete(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.RemoveAll(filepath.Join(s.dir, id))
+}
+
+func (s *Store) pagePath(id string, n int) string {
+	return filepath.Join(s.dir, id, fmt.Sprintf("page-%04d.txt", n))
+}
+
+// validID rejects anything that could escape the documents directory.
+func validID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\.`)
+}
+
+// snippet returns about 300 characters of text around byte offset at,
+// which indexes lower (the lowercased text).
+func snippet(text, lower string, at int) string {
+	const radius = 150
+	if len(lower) != len(text) {
+		// Lowercasing changed byte lengths; fall back to the page start.
+		at = 0
+	}
+	start := max(at-radius, 0)
+	end := min(at+radius, len(text))
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	s := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		s = "..." + s
+	}
+	if end < len(text) {
+		s += "..."
+	}
+	return s
+}
+
+// Chunk splits text into pages of at most size characters, preferring
+// paragraph, then line, then word boundaries.
+func Chunk(text string, size int) []string {
+	var pages []string
+	var current strings.Builder
+
+	flush := func() {
+		if page := strings.TrimSpace(current.String()); page != "" {
+			pages = append(pages, page)
+		}
+		current.Reset()
+	}
+
+	for _, para := range strings.Split(text, "\n\n") {
+		if utf8.RuneCountInString(para) > size {
+			flush()
+			pages = append(pages, splitLong(para, size)...)
+			continue
+		}
+		if current.Len() > 0 && utf8.RuneCountInString(current.String())+2+utf8.RuneCountInString(para) > size {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(para)
+	}
+	flush()
+
+	if len(pages) == 0 {
+		pages = []string{""}
+	}
+	return pages
+}
+
+// splitLong cuts a single oversized paragraph at the last newline or space
+// before each size boundary.
+func splitLong(text string, size int) []string {
+	var out []string
+	runes := []rune(text)
+	for len(runes) > size {
+		cut := size
+		for _, sep := range []rune{'\n', ' '} {
+			if i := lastIndexRune(runes[:size], sep); i > size/2 {
+				cut = i + 1
+				break
+			}
+		}
+		if piece := strings.TrimSpace(string(runes[:cut])); piece != "" {
+			out = append(out, piece)
+		}
+		runes = runes[cut:]
+	}
+	if piece := strings.TrimSpace(string(runes)); piece != "" {
+		out = append(out, piece)
+	}
+	return out
+}
+
+func lastIndexRune(runes []rune, r rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
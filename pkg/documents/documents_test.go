@@ -0,0 +1,217 @@
+package documents
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChunk(t *testing.T) {
+	para := strings.Repeat("word ", 30) // 150 chars
+	text := strings.Join([]string{para, para, para, para}, "\n\n")
+
+	pages := Chunk(text, 350)
+	if len(pages) != 2 {
+		t.Fatalf("len(pages) = %d, want 2", len(pages))
+	}
+	for i, p := range pages {
+		if len(p) > 350 {
+			t.Errorf("page %d has %d chars, want <= 350", i, len(p))
+		}
+	}
+
+	long := strings.Repeat("abcdefghi ", 100) // one 1000-char paragraph
+	pages = Chunk(long, 300)
+	if len(pages) != 4 {
+		t.Fatalf("len(pages) = %d, want 4", len(pages))
+	}
+	if strings.Join(pages, " ") != strings.TrimSpace(long) {
+		t.Error("splitting a long paragraph should not lose words")
+	}
+}
+
+func TestStore_AddPageSearch(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	text := "Introduction\n\n" + strings.Repeat("filler text ", 400) + "\n\nThe invoice total is 420 EUR."
+	doc, err := store.Add("report.txt", "text/plain", text)
+	if err != nil {
+		t.Fatalf("Add() error: %v", err)
+	}
+	if doc.Pages < 2 {
+		t.Fatalf("Pages = %d, want at least 2", doc.Pages)
+	}
+
+	page, got, err := store.Page(doc.ID, 1)
+	if err != nil {
+		t.Fatalf("Page() error: %v", err)
+	}
+	if got.Name != "report.txt" || !strings.HasPrefix(page, "Introduction") {
+		t.Errorf("page 1 = %q..., doc %+v", page[:20], got)
+	}
+	if _, _, err := store.Page(doc.ID, doc.Pages+1); err == nil {
+		t.Error("expected error for out-of-range page")
+	}
+
+	matches, err := store.Search("", "INVOICE total", 5)
+	if err != nil {
+		t.Fatalf("Search() error: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Page != doc.Pages {
+		t.Fatalf("matches = %+v, want one hit on the last page", matches)
+	}
+	if !strings.Contains(matches[0].Snippet, "420 EUR") {
+		t.Errorf("snippet = %q, want it to contain the match", matches[0].Snippet)
+	}
+
+	docs, _ := store.List()
+	if len(docs) != 1 {
+		t.Errorf("List() = %d docs, want 1", len(docs))
+	}
+	if err := store.Delete(doc.ID); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if _, err := store.Get(doc.ID); err == nil {
+		t.Error("document should be gone after Delete")
+	}
+	if _, err := store.Get("../secrets"); err == nil {
+		t.Error("Get should reject ids with path separators")
+	}
+}
+
+func TestExtract_DOCX(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upload.bin")
+	writeZip(t, path, map[string]string{
+		"word/document.xml": `<?xml version="1.0"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>Hello</w:t></w:r><w:r><w:t xml:space="preserve"> world</w:t></w:r></w:p>
+<w:p><w:r><w:t>Second</w:t><w:tab/><w:t>line</w:t></w:r></w:p>
+</w:body></w:document>`,
+	})
+
+	text, err := Extract(path, "letter.docx", "")
+	if err != nil {
+		t.Fatalf("Extract() error: %v", err)
+	}
+	if text != "Hello world\nSecond\tline" {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestExtract_XLSX(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.xlsx")
+	writeZip(t, path, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Budget" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>Item</t></si><si><t>Cost</t></si><si><r><t>Coff</t></r><r><t>ee</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+<row r="2"><c r="A2" t="s"><v>2</v></c><c r="C2"><v>3.5</v></c></row>
+</sheetData></worksheet>`,
+	})
+
+	text, err := Extract(path, "book.xlsx", "")
+	if err != nil {
+		t.Fatalf("Extract() error: %v", err)
+	}
+	want := "## Sheet: Budget\nItem,Cost\nCoffee,,3.5"
+	if text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+}
+
+func TestExtract_RejectsZipBomb(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bomb.docx")
+	writeZip(t, path, map[string]string{
+		"word/document.xml": strings.Repeat("\x00", maxZipEntry+1),
+	})
+	if _, err := Extract(path, "bomb.docx", ""); err == nil || !strings.Contains(err.Error(), "uncompressed") {
+		t.Errorf("Extract() error = %v, want size limit error", err)
+	}
+}
+
+func TestXLSXRows_ClampsColumns(t *testing.T) {
+	if got := xlsxColumn("XFD1"); got != xlsxMaxColumns-1 {
+		t.Errorf("xlsxColumn(XFD1) = %d, want %d", got, xlsxMaxColumns-1)
+	}
+	if got := xlsxColumn(strings.Repeat("Z", 40) + "1"); got != xlsxMaxColumns {
+		t.Errorf("xlsxColumn(ZZZ...) = %d, want clamped to %d", got, xlsxMaxColumns)
+	}
+
+	rows, err := xlsxRows([]byte(`<worksheet><sheetData>
+<row><c r="A1"><v>1</v></c><c r="ZZZZZZ1"><v>2</v></c></row>
+</sheetData></worksheet>`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || len(rows[0]) != 1 {
+		t.Errorf("rows = %v, want the out-of-range cell dropped", rows)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<worksheet><sheetData>")
+	for i := 0; i < xlsxMaxCells/(xlsxMaxColumns-1)+1; i++ {
+		sb.WriteString(`<row><c r="XFD1"><v>1</v></c></row>`)
+	}
+	sb.WriteString("</sheetData></worksheet>")
+	if _, err := xlsxRows([]byte(sb.String()), nil); err == nil {
+		t.Error("expected an error for a sheet over the cell budget")
+	}
+}
+
+func TestExtract_HTML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "page.html")
+	os.WriteFile(path, []byte(`<html><head><style>p{}</style><script>var x;</script></head>
+<body><h1>Title</h1><p>First   paragraph.</p><p>Second</p></body></html>`), 0644)
+
+	text, err := Extract(path, "page.html", "")
+	if err != nil {
+		t.Fatalf("Extract() error: %v", err)
+	}
+	if text != "Title\nFirst paragraph.\nSecond" {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestSupported(t *testing.T) {
+	tests := []struct {
+		name, mime string
+		want       bool
+	}{
+		{"a.PDF", "", true},
+		{"report", "application/pdf", true},
+		{"data.csv", "", true},
+		{"notes.md", "", true},
+		{"photo.jpg", "image/jpeg", false},
+		{"voice.ogg", "audio/ogg", false},
+	}
+	for _, tt := range tests {
+		if got := Supported(tt.name, tt.mime); got != tt.want {
+			t.Errorf("Supported(%q, %q) = %v, want %v", tt.name, tt.mime, got, tt.want)
+		}
+	}
+}
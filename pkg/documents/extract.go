@@ -0,0 +1,479 @@
+package documents
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	kindPDF  = "pdf"
+	kindDOCX = "docx"
+	kindXLSX = "xlsx"
+	kindCSV  = "csv"
+	kindHTML = "html"
+	kindText = "text"
+)
+
+// Limits on what an uploaded document may cost to extract. Office files are
+// zip archives, so a small upload can decompress to gigabytes, and a cell
+// reference like XFD1048576 would otherwise pad rows to any width.
+const (
+	maxZipEntry    = 50 << 20
+	xlsxMaxColumns = 16384 // column XFD, Excel's limit
+	xlsxMaxCells   = 2_000_000
+	pdfTimeout     = 60 * time.Second
+)
+
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true, ".rst": true, ".log": true,
+	".json": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".xml": true,
+	".go": true, ".py": true, ".js": true, ".ts": true, ".java": true, ".c": true,
+	".h": true, ".cpp": true, ".rs": true, ".sh": true, ".sql": true,
+}
+
+// Supported reports whether Extract can read a file with this name or MIME type.
+func Supported(name, mimeType string) bool {
+	return kindOf(name, mimeType) != ""
+}
+
+func kindOf(name, mimeType string) string {
+	switch ext := strings.ToLower(filepath.Ext(name)); {
+	case ext == ".pdf":
+		return kindPDF
+	case ext == ".docx":
+		return kindDOCX
+	case ext == ".xlsx":
+		return kindXLSX
+	case ext == ".csv", ext == ".tsv":
+		return kindCSV
+	case ext == ".html", ext == ".htm":
+		return kindHTML
+	case textExtensions[ext]:
+		return kindText
+	}
+
+	mimeType = strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	switch {
+	case mimeType == "application/pdf":
+		return kindPDF
+	case mimeType == "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return kindDOCX
+	case mimeType == "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+		return kindXLSX
+	case mimeType == "text/csv", mimeType == "text/tab-separated-values":
+		return kindCSV
+	case mimeType == "text/html":
+		return kindHTML
+	case strings.HasPrefix(mimeType, "text/"), mimeType == "application/json":
+		return kindText
+	}
+	return ""
+}
+
+// Extract returns the plain text of the document at filePath. name and
+// mimeType select the extractor; the file itself may have any name.
+func Extract(filePath, name, mimeType string) (string, error) {
+	var text string
+	var err error
+
+	switch kindOf(name, mimeType) {
+	case kindPDF:
+		text, err = extractPDF(filePath)
+	case kindDOCX:
+		text, err = extractDOCX(filePath)
+	case kindXLSX:
+		text, err = extractXLSX(filePath)
+	case kindHTML:
+		text, err = extractHTML(filePath)
+	case kindCSV, kindText:
+		text, err = extractText(filePath)
+	default:
+		return "", fmt.Errorf("unsupported document type: %s", name)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("no text found in %s", name)
+	}
+	return text, nil
+}
+
+// extractPDF shells out to pdftotext (poppler-utils); there is no pure Go
+// PDF text extractor worth the dependency.
+func extractPDF(filePath string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pdfTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "pdftotext", "-layout", filePath, "-").Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("pdftotext not installed (install poppler-utils)")
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("pdftotext: timed out after %s", pdfTimeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("pdftotext: %w", err)
+	}
+	return string(out), nil
+}
+
+func extractText(filePath string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("file is not UTF-8 text")
+	}
+	return string(data), nil
+}
+
+// extractDOCX walks word/document.xml, keeping paragraph, line and table
+// cell boundaries.
+func extractDOCX(filePath string) (string, error) {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "", fmt.Errorf("opening docx: %w", err)
+	}
+	defer zr.Close()
+
+	data, err := readZipFile(&zr.Reader, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("parsing docx: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				sb.WriteByte('\t')
+			case "br", "cr":
+				sb.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p", "tr":
+				sb.WriteByte('\n')
+			case "tc":
+				sb.WriteByte('\t')
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(t)
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+// extractXLSX renders every worksheet as CSV under a "## Sheet:" heading.
+func extractXLSX(filePath string) (string, error) {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return "", fmt.Errorf("opening xlsx: %w", err)
+	}
+	defer zr.Close()
+
+	shared, err := xlsxSharedStrings(&zr.Reader)
+	if err != nil {
+		return "", err
+	}
+	sheets, err := xlsxSheets(&zr.Reader)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, sheet := range sheets {
+		data, err := readZipFile(&zr.Reader, sheet.path)
+		if err != nil {
+			return "", err
+		}
+		rows, err := xlsxRows(data, shared)
+		if err != nil {
+			return "", fmt.Errorf("parsing sheet %s: %w", sheet.name, err)
+		}
+
+		fmt.Fprintf(&sb, "## Sheet: %s\n", sheet.name)
+		w := csv.NewWriter(&sb)
+		w.WriteAll(rows)
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
+
+type xlsxSheet struct {
+	name string
+	path string
+}
+
+func xlsxSheets(zr *zip.Reader) ([]xlsxSheet, error) {
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+
+	if err := unmarshalZipXML(zr, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if err := unmarshalZipXML(zr, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+
+	targets := make(map[string]string, len(rels.Relationships))
+	for _, r := range rels.Relationships {
+		if strings.HasPrefix(r.Target, "/") {
+			targets[r.ID] = strings.TrimPrefix(r.Target, "/")
+		} else {
+			targets[r.ID] = path.Join("xl", r.Target)
+		}
+	}
+
+	sheets := make([]xlsxSheet, 0, len(workbook.Sheets))
+	for _, s := range workbook.Sheets {
+		if target, ok := targets[s.RID]; ok {
+			sheets = append(sheets, xlsxSheet{name: s.Name, path: target})
+		}
+	}
+	return sheets, nil
+}
+
+func xlsxSharedStrings(zr *zip.Reader) ([]string, error) {
+	var sst struct {
+		Items []struct {
+			Text string   `xml:"t"`
+			Runs []string `xml:"r>t"`
+		} `xml:"si"`
+	}
+	if err := unmarshalZipXML(zr, "xl/sharedStrings.xml", &sst); err != nil {
+		if errors.Is(err, errZipEntryMissing) {
+			return nil, nil // workbooks with only numbers have no shared strings
+		}
+		return nil, err
+	}
+
+	out := make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		out[i] = si.Text + strings.Join(si.Runs, "")
+	}
+	return out, nil
+}
+
+func xlsxRows(data []byte, shared []string) ([][]string, error) {
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(data, &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	cells := 0
+	for _, r := range sheet.Rows {
+		var row []string
+		for i, c := range r.Cells {
+			col := xlsxColumn(c.Ref)
+			if col < 0 {
+				col = i
+			}
+			if col >= xlsxMaxColumns {
+				continue
+			}
+			if cells += max(col+1-len(row), 0); cells > xlsxMaxCells {
+				return nil, fmt.Errorf("sheet has more than %d cells", xlsxMaxCells)
+			}
+			for len(row) < col {
+				row = append(row, "")
+			}
+
+			value := c.Value
+			switch c.Type {
+			case "s":
+				if idx, err := strconv.Atoi(c.Value); err == nil && idx >= 0 && idx < len(shared) {
+					value = shared[idx]
+				}
+			case "inlineStr":
+				value = c.Inline
+			case "b":
+				value = map[string]string{"0": "FALSE", "1": "TRUE"}[c.Value]
+			}
+			if col < len(row) {
+				row[col] = value
+			} else {
+				row = append(row, value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// xlsxColumn converts the letters of a cell reference ("C7") to a 0-based
+// column index, or -1 when absent. Columns past xlsxMaxColumns come back as
+// xlsxMaxColumns.
+func xlsxColumn(ref string) int {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = min(col*26+int(r-'A'+1), xlsxMaxColumns+1)
+		n++
+	}
+	if n == 0 {
+		return -1
+	}
+	return col - 1
+}
+
+var errZipEntryMissing = errors.New("zip entry missing")
+
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, maxZipEntry+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxZipEntry {
+			return nil, fmt.Errorf("%s: larger than %d MB uncompressed", name, maxZipEntry>>20)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%s: %w", name, errZipEntryMissing)
+}
+
+func unmarshalZipXML(zr *zip.Reader, name string, v interface{}) error {
+	data, err := readZipFile(zr, name)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return nil
+}
+
+var htmlBlockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "section": true,
+	"article": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "pre": true, "blockquote": true, "table": true, "ul": true, "ol": true,
+}
+
+func extractHTML(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return HTMLText(f)
+}
+
+// HTMLText returns the visible text of an HTML document, one block element
+// per line.
+func HTMLText(r io.Reader) (string, error) {
+	var sb strings.Builder
+	z := html.NewTokenizer(r)
+	skip := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return collapseBlankLines(sb.String()), nil
+			}
+			return "", fmt.Errorf("parsing html: %w", z.Err())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch tag := string(name); {
+			case tag == "script" || tag == "style" || tag == "noscript":
+				skip++
+			case htmlBlockElements[tag]:
+				sb.WriteByte('\n')
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch tag := string(name); {
+			case tag == "script" || tag == "style" || tag == "noscript":
+				if skip > 0 {
+					skip--
+				}
+			case htmlBlockElements[tag]:
+				sb.WriteByte('\n')
+			}
+		case html.TextToken:
+			if skip == 0 {
+				sb.WriteString(strings.Join(strings.Fields(string(z.Text())), " "))
+				sb.WriteByte(' ')
+			}
+		}
+	}
+}
+
+func collapseBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,396 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package gateway
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adhocore/gronx"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/heartbeat"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/telemetry"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// AdminServices are the parts of the running gateway the admin API manages.
+type AdminServices struct {
+	Channels   *channels.Manager
+	Sessions   *session.SessionManager
+	Tools      *tools.ToolRegistry
+	Cron       *cron.CronService
+	Telemetry  *telemetry.Tracker
+	Heartbeat  *heartbeat.HeartbeatService
+	ReloadCost func() error // re-reads the config file and applies its prices and budgets
+}
+
+// AdminAPI serves authenticated runtime management endpoints under /admin:
+//
+//	GET    /admin/channels                  channel status and send stats
+//	POST   /admin/channels/{name}/enable    restart a disabled channel
+//	POST   /admin/channels/{name}/disable   stop a channel
+//	GET    /admin/sessions                  sessions, most recent first
+//	GET    /admin/sessions/{key}/history    a session's messages
+//	DELETE /admin/sessions/{key}/history    clear a session
+//	GET    /admin/cron                      cron jobs
+//	POST   /admin/cron                      add a job
+//	DELETE /admin/cron/{id}                 remove a job
+//	POST   /admin/cron/{id}/enable          enable a job
+//	POST   /admin/cron/{id}/disable         disable a job
+//	GET    /admin/telemetry?days=7          token usage and budget
+//	GET    /admin/tools                     registered tools
+//	POST   /admin/cost/reload               re-read prices and budgets from the config file
+//	POST   /admin/heartbeat                 run a heartbeat now
+type AdminAPI struct {
+	token string
+	svc   AdminServices
+}
+
+func NewAdminAPI(cfg config.AdminConfig, svc AdminServices) (*AdminAPI, error) {
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("admin API token is required")
+	}
+	return &AdminAPI{token: cfg.Token, svc: svc}, nil
+}
+
+// Register mounts the API on mux.
+func (a *AdminAPI) Register(mux *http.ServeMux) {
+	routes := map[string]http.HandlerFunc{
+		"GET /admin/channels":                  a.listChannels,
+		"POST /admin/channels/{name}/enable":   a.enableChannel,
+		"POST /admin/channels/{name}/disable":  a.disableChannel,
+		"GET /admin/sessions":                  a.listSessions,
+		"GET /admin/sessions/{key}/history":    a.sessionHistory,
+		"DELETE /admin/sessions/{key}/history": a.clearSession,
+		"GET /admin/cron":                      a.listCronJobs,
+		"POST /admin/cron":                     a.addCronJob,
+		"DELETE /admin/cron/{id}":              a.removeCronJob,
+		"POST /admin/cron/{id}/enable":         a.enableCronJob,
+		"POST /admin/cron/{id}/disable":        a.disableCronJob,
+		"GET /admin/telemetry":                 a.telemetry,
+		"GET /admin/tools":                     a.listTools,
+		"POST /admin/cost/reload":              a.reloadCost,
+		"POST /admin/heartbeat":                a.triggerHeartbeat,
+	}
+	for pattern, handler := range routes {
+		mux.HandleFunc(pattern, a.authenticated(handler))
+	}
+}
+
+func (a *AdminAPI) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			token = auth[7:]
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			writeAdminError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		if r.Method != http.MethodGet {
+			logger.InfoCF("gateway", "Admin request", map[string]interface{}{
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"remote": r.RemoteAddr,
+			})
+		}
+		next(w, r)
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// unavailable answers 503 when the gateway runs without a service.
+func unavailable(w http.ResponseWriter, ok bool, name string) bool {
+	if !ok {
+		writeAdminError(w, http.StatusServiceUnavailable, name+" is not available")
+	}
+	return !ok
+}
+
+func (a *AdminAPI) listChannels(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.Channels != nil, "channel manager") {
+		return
+	}
+	writeJSON(w, http.StatusOK, a.svc.Channels.GetStatus())
+}
+
+func (a *AdminAPI) enableChannel(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.Channels != nil, "channel manager") {
+		return
+	}
+	name := r.PathValue("name")
+	if err := a.svc.Channels.EnableChannel(name); err != nil {
+		writeAdminError(w, channelErrorStatus(a.svc.Channels, name), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"channel": name, "status": "enabled"})
+}
+
+func (a *AdminAPI) disableChannel(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.Channels != nil, "channel manager") {
+		return
+	}
+	name := r.PathValue("name")
+	if err := a.svc.Channels.DisableChannel(r.Context(), name); err != nil {
+		writeAdminError(w, channelErrorStatus(a.svc.Channels, name), err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"channel": name, "status": "disabled"})
+}
+
+// channelErrorStatus tells a missing channel from one that failed to start
+// or stop.
+func channelErrorStatus(m *channels.Manager, name string) int {
+	if _, ok := m.GetStatus()[name]; !ok {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (a *AdminAPI) listSessions(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.Sessions != nil, "session store") {
+		return
+	}
+	writeJSON(w, http.StatusOK, a.svc.Sessions.List())
+}
+
+func (a *AdminAPI) sessionHistory(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.Sessions != nil, "session store") {
+		return
+	}
+	key := r.PathValue("key")
+	if !a.sessionExists(key) {
+		writeAdminError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"key":      key,
+		"summary":  a.svc.Sessions.GetSummary(key),
+		"messages": a.svc.Sessions.GetHistory(key),
+	})
+}
+
+func (a *AdminAPI) clearSession(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.Sessions != nil, "session store") {
+		return
+	}
+	key := r.PathValue("key")
+	if !a.svc.Sessions.Clear(key) {
+		writeAdminError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"key": key, "status": "cleared"})
+}
+
+func (a *AdminAPI) sessionExists(key string) bool {
+	for _, info := range a.svc.Sessions.List() {
+		if info.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *AdminAPI) listCronJobs(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.Cron != nil, "cron service") {
+		return
+	}
+	jobs := a.svc.Cron.ListJobs(true)
+	if jobs == nil {
+		jobs = []cron.CronJob{}
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// cronJobRequest adds a job running every EverySeconds, on a Cron
+// expression or once At a time.
+type cronJobRequest struct {
+	Name         string `json:"name"`
+	Message      string `json:"message"`
+	EverySeconds int64  `json:"every_seconds,omitempty"`
+	Cron         string `json:"cron,omitempty"`
+	At           string `json:"at,omitempty"` // RFC 3339
+	Deliver      bool   `json:"deliver"`
+	Channel      string `json:"channel,omitempty"`
+	To           string `json:"to,omitempty"`
+}
+
+func (req cronJobRequest) schedule() (cron.CronSchedule, error) {
+	set := 0
+	for _, given := range []bool{req.EverySeconds != 0, req.Cron != "", req.At != ""} {
+		if given {
+			set++
+		}
+	}
+	if set != 1 {
+		return cron.CronSchedule{}, fmt.Errorf("give exactly one of every_seconds, cron or at")
+	}
+
+	switch {
+	case req.EverySeconds != 0:
+		if req.EverySeconds < 0 {
+			return cron.CronSchedule{}, fmt.Errorf("every_seconds must be positive")
+		}
+		everyMS := req.EverySeconds * 1000
+		return cron.CronSchedule{Kind: "every", EveryMS: &everyMS}, nil
+	case req.Cron != "":
+		if !gronx.New().IsValid(req.Cron) {
+			return cron.CronSchedule{}, fmt.Errorf("invalid cron expression %q", req.Cron)
+		}
+		return cron.CronSchedule{Kind: "cron", Expr: req.Cron}, nil
+	default:
+		at, err := time.Parse(time.RFC3339, req.At)
+		if err != nil {
+			return cron.CronSchedule{}, fmt.Errorf("at must be an RFC 3339 time")
+		}
+		if !at.After(time.Now()) {
+			return cron.CronSchedule{}, fmt.Errorf("at must be in the future")
+		}
+		atMS := at.UnixMilli()
+		return cron.CronSchedule{Kind: "at", AtMS: &atMS}, nil
+	}
+}
+
+func (a *AdminAPI) addCronJob(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.Cron != nil, "cron service") {
+		return
+	}
+	var req cronJobRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeAdminError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Name == "" || req.Message == "" {
+		writeAdminError(w, http.StatusBadRequest, "name and message are required")
+		return
+	}
+	schedule, err := req.schedule()
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := a.svc.Cron.AddJob(req.Name, schedule, req.Message, req.Deliver, req.Channel, req.To)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, job)
+}
+
+func (a *AdminAPI) removeCronJob(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.Cron != nil, "cron service") {
+		return
+	}
+	id := r.PathValue("id")
+	if !a.svc.Cron.RemoveJob(id) {
+		writeAdminError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": id, "status": "removed"})
+}
+
+func (a *AdminAPI) enableCronJob(w http.ResponseWriter, r *http.Request) {
+	a.setCronJobEnabled(w, r, true)
+}
+
+func (a *AdminAPI) disableCronJob(w http.ResponseWriter, r *http.Request) {
+	a.setCronJobEnabled(w, r, false)
+}
+
+func (a *AdminAPI) setCronJobEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	if unavailable(w, a.svc.Cron != nil, "cron service") {
+		return
+	}
+	job := a.svc.Cron.EnableJob(r.PathValue("id"), enabled)
+	if job == nil {
+		writeAdminError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (a *AdminAPI) telemetry(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.Telemetry != nil, "telemetry") {
+		return
+	}
+	days := 7
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 30 {
+			writeAdminError(w, http.StatusBadRequest, "days must be between 1 and 30")
+			return
+		}
+		days = n
+	}
+	budget := a.svc.Telemetry.BudgetStatus()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"days": a.svc.Telemetry.GetLastNDays(days),
+		"budget": map[string]interface{}{
+			"daily_spent":   budget.DailySpent,
+			"daily_limit":   budget.DailyLimit,
+			"monthly_spent": budget.MonthlySpent,
+			"monthly_limit": budget.MonthlyLimit,
+			"exceeded":      budget.Exceeded(),
+			"policy":        budget.Policy,
+		},
+	})
+}
+
+func (a *AdminAPI) listTools(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.Tools != nil, "tool registry") {
+		return
+	}
+	names := a.svc.Tools.List()
+	sort.Strings(names)
+	list := make([]map[string]string, 0, len(names))
+	for _, name := range names {
+		if tool, ok := a.svc.Tools.Get(name); ok {
+			list = append(list, map[string]string{"name": name, "description": tool.Description()})
+		}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (a *AdminAPI) reloadCost(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.ReloadCost != nil, "cost reload") {
+		return
+	}
+	if err := a.svc.ReloadCost(); err != nil {
+		writeAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "reloaded",
+		"note":   "cost settings applied; other sections change on restart",
+	})
+}
+
+func (a *AdminAPI) triggerHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if unavailable(w, a.svc.Heartbeat != nil, "heartbeat") {
+		return
+	}
+	if !a.svc.Heartbeat.Trigger() {
+		writeAdminError(w, http.StatusConflict, "a heartbeat is already running")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+}
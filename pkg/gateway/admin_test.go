@@ -0,0 +1,240 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/heartbeat"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/telemetry"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+type stubChannel struct{ running bool }
+
+func (s *stubChannel) Name() string                                            { return "stub" }
+func (s *stubChannel) Start(ctx context.Context) error                         { s.running = true; return nil }
+func (s *stubChannel) Stop(ctx context.Context) error                          { s.running = false; return nil }
+func (s *stubChannel) Send(ctx context.Context, msg bus.OutboundMessage) error { return nil }
+func (s *stubChannel) IsRunning() bool                                         { return s.running }
+func (s *stubChannel) IsAllowed(senderID string) bool                          { return true }
+
+type adminFixture struct {
+	srv      *httptest.Server
+	stub     *stubChannel
+	sessions *session.SessionManager
+	beats    chan string
+	reloads  int
+}
+
+func newAdminFixture(t *testing.T) *adminFixture {
+	t.Helper()
+	workspace := t.TempDir()
+	mb := bus.NewMessageBus()
+	t.Cleanup(mb.Close)
+
+	manager, err := channels.NewManager(config.DefaultConfig(), mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &adminFixture{
+		stub:     &stubChannel{},
+		sessions: session.NewSessionManager(""),
+		beats:    make(chan string, 1),
+	}
+	manager.RegisterChannel("stub", f.stub)
+	manager.StartAll(context.Background())
+
+	registry := tools.NewToolRegistry()
+	registry.Register(tools.NewListDirTool(workspace, true))
+
+	os.WriteFile(filepath.Join(workspace, "HEARTBEAT.md"), []byte("- check the weather"), 0644)
+	hb := heartbeat.NewHeartbeatService(workspace, 30, false)
+	hb.SetHandler(func(prompt, channel, chatID string) *tools.ToolResult {
+		f.beats <- prompt
+		return tools.SilentResult("HEARTBEAT_OK")
+	})
+
+	api, err := NewAdminAPI(config.AdminConfig{Token: "admin-secret"}, AdminServices{
+		Channels:   manager,
+		Sessions:   f.sessions,
+		Tools:      registry,
+		Cron:       cron.NewCronService(filepath.Join(workspace, "cron", "jobs.json"), nil),
+		Telemetry:  telemetry.NewTracker(workspace),
+		Heartbeat:  hb,
+		ReloadCost: func() error { f.reloads++; return nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	api.Register(mux)
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// do sends an authenticated request and decodes the JSON response into out.
+func (f *adminFixture) do(t *testing.T, method, path, body string, out interface{}) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, f.srv.URL+path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func TestAdminAPIRequiresToken(t *testing.T) {
+	f := newAdminFixture(t)
+	resp, err := http.Get(f.srv.URL + "/admin/channels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", resp.StatusCode)
+	}
+	if _, err := NewAdminAPI(config.AdminConfig{}, AdminServices{}); err == nil {
+		t.Error("NewAdminAPI should require a token")
+	}
+}
+
+func TestAdminChannels(t *testing.T) {
+	f := newAdminFixture(t)
+
+	if code := f.do(t, "POST", "/admin/channels/stub/disable", "", nil); code != http.StatusOK || f.stub.running {
+		t.Fatalf("disable: status %d, running %v", code, f.stub.running)
+	}
+	var status map[string]map[string]interface{}
+	f.do(t, "GET", "/admin/channels", "", &status)
+	if status["stub"]["enabled"] != false {
+		t.Errorf("status = %v", status)
+	}
+	if code := f.do(t, "POST", "/admin/channels/stub/enable", "", nil); code != http.StatusOK || !f.stub.running {
+		t.Errorf("enable: status %d, running %v", code, f.stub.running)
+	}
+	if code := f.do(t, "POST", "/admin/channels/nope/enable", "", nil); code != http.StatusNotFound {
+		t.Errorf("unknown channel: status %d, want 404", code)
+	}
+}
+
+func TestAdminSessions(t *testing.T) {
+	f := newAdminFixture(t)
+	f.sessions.AddMessage("telegram:42", "user", "hello")
+
+	var list []session.SessionInfo
+	f.do(t, "GET", "/admin/sessions", "", &list)
+	if len(list) != 1 || list[0].Key != "telegram:42" || list[0].Messages != 1 {
+		t.Fatalf("sessions = %+v", list)
+	}
+
+	var history struct {
+		Messages []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	f.do(t, "GET", "/admin/sessions/telegram:42/history", "", &history)
+	if len(history.Messages) != 1 || history.Messages[0].Content != "hello" {
+		t.Errorf("history = %+v", history)
+	}
+
+	if code := f.do(t, "DELETE", "/admin/sessions/telegram:42/history", "", nil); code != http.StatusOK {
+		t.Errorf("clear: status %d", code)
+	}
+	if h := f.sessions.GetHistory("telegram:42"); len(h) != 0 {
+		t.Errorf("history after clear = %+v", h)
+	}
+	if code := f.do(t, "GET", "/admin/sessions/nope/history", "", nil); code != http.StatusNotFound {
+		t.Errorf("unknown session: status %d, want 404", code)
+	}
+}
+
+func TestAdminCron(t *testing.T) {
+	f := newAdminFixture(t)
+
+	var job cron.CronJob
+	code := f.do(t, "POST", "/admin/cron", `{"name":"standup","message":"remind me","cron":"0 9 * * 1-5","deliver":true,"channel":"telegram","to":"42"}`, &job)
+	if code != http.StatusCreated || job.ID == "" || job.Schedule.Kind != "cron" {
+		t.Fatalf("add: status %d, job %+v", code, job)
+	}
+
+	for _, body := range []string{
+		`{"name":"x","message":"y"}`,
+		`{"name":"x","message":"y","cron":"not a cron"}`,
+		`{"name":"x","message":"y","every_seconds":60,"cron":"* * * * *"}`,
+		`{"name":"x","message":"y","at":"2001-01-01T00:00:00Z"}`,
+	} {
+		if code := f.do(t, "POST", "/admin/cron", body, nil); code != http.StatusBadRequest {
+			t.Errorf("add %s: status %d, want 400", body, code)
+		}
+	}
+
+	var disabled cron.CronJob
+	f.do(t, "POST", "/admin/cron/"+job.ID+"/disable", "", &disabled)
+	if disabled.Enabled {
+		t.Error("job still enabled after disable")
+	}
+
+	var jobs []cron.CronJob
+	f.do(t, "GET", "/admin/cron", "", &jobs)
+	if len(jobs) != 1 {
+		t.Errorf("jobs = %+v", jobs)
+	}
+	if code := f.do(t, "DELETE", "/admin/cron/"+job.ID, "", nil); code != http.StatusOK {
+		t.Errorf("remove: status %d", code)
+	}
+	if code := f.do(t, "DELETE", "/admin/cron/"+job.ID, "", nil); code != http.StatusNotFound {
+		t.Errorf("remove again: status %d, want 404", code)
+	}
+}
+
+func TestAdminToolsTelemetryReloadAndHeartbeat(t *testing.T) {
+	f := newAdminFixture(t)
+
+	var toolList []map[string]string
+	f.do(t, "GET", "/admin/tools", "", &toolList)
+	if len(toolList) != 1 || toolList[0]["name"] != "list_dir" || toolList[0]["description"] == "" {
+		t.Errorf("tools = %+v", toolList)
+	}
+
+	var usage map[string]interface{}
+	if code := f.do(t, "GET", "/admin/telemetry?days=3", "", &usage); code != http.StatusOK || usage["budget"] == nil {
+		t.Errorf("telemetry: status %d, body %v", code, usage)
+	}
+	if code := f.do(t, "GET", "/admin/telemetry?days=99", "", nil); code != http.StatusBadRequest {
+		t.Errorf("telemetry days=99: status %d, want 400", code)
+	}
+
+	if code := f.do(t, "POST", "/admin/cost/reload", "", nil); code != http.StatusOK || f.reloads != 1 {
+		t.Errorf("reload: status %d, reloads %d", code, f.reloads)
+	}
+
+	if code := f.do(t, "POST", "/admin/heartbeat", "", nil); code != http.StatusAccepted {
+		t.Fatalf("heartbeat: status %d", code)
+	}
+	select {
+	case prompt := <-f.beats:
+		if !strings.Contains(prompt, "check the weather") {
+			t.Errorf("heartbeat prompt = %q", prompt)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("heartbeat did not run")
+	}
+}
@@ -0,0 +1,434 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package gateway serves the gateway's HTTP APIs next to /health.
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// ModelID is the single model the OpenAI-compatible API exposes: the agent
+// itself, whatever LLM it is configured with.
+const ModelID = "picoclaw"
+
+// streamKeepAlive is how often a streaming response sends an SSE comment
+// while the agent works, so proxies do not time the request out.
+const streamKeepAlive = 10 * time.Second
+
+// Agent processes a request with the agent's tools, memory and skills.
+// *agent.AgentLoop implements it.
+type Agent interface {
+	ProcessRequest(ctx context.Context, req agent.DirectRequest) (agent.DirectResponse, error)
+}
+
+// OpenAIAPI serves /v1/chat/completions and /v1/models so OpenAI clients,
+// Open WebUI or IDE plugins can talk to the agent. The agent keeps the
+// conversation itself: only the last user message of a request is used,
+// and history comes from the session the API key maps to. A request's
+// "user" field selects a separate session under that key. Images must be
+// inline data URIs: the agent would otherwise fetch URLs or read local
+// paths on the caller's behalf.
+type OpenAIAPI struct {
+	agent   Agent
+	keys    map[string]apiKey
+	started int64
+
+	mu    sync.Mutex
+	locks map[string]*sessionLock // held only while a request uses the session
+}
+
+// sessionLock serializes requests to one session; refs counts the requests
+// holding or waiting for it, so idle sessions leave the map.
+type sessionLock struct {
+	sync.Mutex
+	refs int
+}
+
+type apiKey struct {
+	name    string
+	session string
+	tools   []string // nil allows all
+}
+
+func NewOpenAIAPI(cfg config.APIConfig, a Agent) (*OpenAIAPI, error) {
+	api := &OpenAIAPI{
+		agent:   a,
+		keys:    make(map[string]apiKey),
+		started: time.Now().Unix(),
+		locks:   make(map[string]*sessionLock),
+	}
+	for _, k := range cfg.Keys {
+		if k.Name == "" || k.Key == "" {
+			return nil, fmt.Errorf("api keys need a name and a key")
+		}
+		key := apiKey{name: k.Name, session: k.Session}
+		if key.session == "" {
+			key.session = "api:" + k.Name
+		}
+		if k.Profile != "" {
+			tools, ok := cfg.Profiles[k.Profile]
+			if !ok {
+				return nil, fmt.Errorf("api key %s: unknown profile %q", k.Name, k.Profile)
+			}
+			key.tools = append([]string{}, tools...)
+		}
+		api.keys[k.Key] = key
+	}
+	return api, nil
+}
+
+// Register mounts the API on mux.
+func (api *OpenAIAPI) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/chat/completions", api.handleChatCompletions)
+	mux.HandleFunc("/v1/models", api.handleModels)
+}
+
+type chatCompletionRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	User     string        `json:"user,omitempty"`
+
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+}
+
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// contentPart is one element of an array message content.
+type contentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+// parseContent splits a message's content into text and image references.
+func parseContent(raw json.RawMessage) (string, []string, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil, nil
+	}
+	var parts []contentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", nil, fmt.Errorf("content must be a string or an array of parts")
+	}
+	var texts, media []string
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			texts = append(texts, part.Text)
+		case "image_url":
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				continue
+			}
+			if !strings.HasPrefix(part.ImageURL.URL, "data:image/") {
+				return "", nil, fmt.Errorf("image_url must be a data:image/ URI")
+			}
+			media = append(media, part.ImageURL.URL)
+		}
+	}
+	return strings.Join(texts, "\n"), media, nil
+}
+
+// authenticate resolves the request's bearer token to its API key,
+// comparing against every key in constant time.
+func (api *OpenAIAPI) authenticate(w http.ResponseWriter, r *http.Request) (apiKey, bool) {
+	var token string
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		token = auth[7:]
+	}
+	var found apiKey
+	ok := false
+	for k, key := range api.keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(k)) == 1 {
+			found, ok = key, true
+		}
+	}
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, "invalid_api_key", "Invalid API key")
+		return apiKey{}, false
+	}
+	return found, true
+}
+
+func (api *OpenAIAPI) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+	if _, ok := api.authenticate(w, r); !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"object": "list",
+		"data": []map[string]interface{}{{
+			"id":       ModelID,
+			"object":   "model",
+			"created":  api.started,
+			"owned_by": "picoclaw",
+		}},
+	})
+}
+
+func (api *OpenAIAPI) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+		return
+	}
+	key, ok := api.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var req chatCompletionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 32<<20)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON body")
+		return
+	}
+	if len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Role != "user" {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "The last message must be from the user")
+		return
+	}
+	content, media, err := parseContent(req.Messages[len(req.Messages)-1].Content)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if strings.TrimSpace(content) == "" && len(media) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "The last message is empty")
+		return
+	}
+
+	session := key.session
+	if req.User != "" {
+		session += ":" + req.User
+	}
+	directReq := agent.DirectRequest{
+		Content:    content,
+		Media:      media,
+		SessionKey: session,
+		Channel:    "api",
+		ChatID:     session,
+		Tools:      key.tools,
+	}
+
+	logger.InfoCF("gateway", "API chat completion", map[string]interface{}{
+		"key":     key.name,
+		"session": session,
+		"stream":  req.Stream,
+		"preview": utils.Truncate(content, 80),
+	})
+
+	id := "chatcmpl-" + uuid.New().String()
+	if req.Stream {
+		api.stream(w, r, id, directReq, req.StreamOptions != nil && req.StreamOptions.IncludeUsage)
+		return
+	}
+
+	reply, err := api.process(r.Context(), directReq)
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, "agent_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   ModelID,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": reply.Content},
+			"finish_reason": "stop",
+		}},
+		"usage": usage(reply.Usage),
+	})
+}
+
+// process runs one request at a time per session, so concurrent requests
+// do not interleave their turns in the history.
+func (api *OpenAIAPI) process(ctx context.Context, req agent.DirectRequest) (agent.DirectResponse, error) {
+	api.mu.Lock()
+	lock := api.locks[req.SessionKey]
+	if lock == nil {
+		lock = &sessionLock{}
+		api.locks[req.SessionKey] = lock
+	}
+	lock.refs++
+	api.mu.Unlock()
+
+	defer func() {
+		api.mu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(api.locks, req.SessionKey)
+		}
+		api.mu.Unlock()
+	}()
+
+	lock.Lock()
+	defer lock.Unlock()
+	metrics.MessagesInbound.Inc(req.Channel)
+	return api.agent.ProcessRequest(ctx, req)
+}
+
+// stream answers with server-sent events. The agent does not produce
+// tokens incrementally: while it works, the stream carries a line per tool
+// it runs and the messages it sends with the message tool, then the reply
+// as one delta. Keep-alive comments fill the gaps.
+func (api *OpenAIAPI) stream(w http.ResponseWriter, r *http.Request, id string, req agent.DirectRequest, includeUsage bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Streaming unsupported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	created := time.Now().Unix()
+	send := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+	chunk := func(choices interface{}, extra map[string]interface{}) {
+		v := map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   ModelID,
+			"choices": choices,
+		}
+		for k, x := range extra {
+			v[k] = x
+		}
+		send(v)
+	}
+	delta := func(d map[string]string, finish interface{}) {
+		chunk([]map[string]interface{}{{"index": 0, "delta": d, "finish_reason": finish}}, nil)
+	}
+
+	delta(map[string]string{"role": "assistant"}, nil)
+
+	// The agent calls back from its own goroutine; progress hands the text
+	// over to this one, which owns the response writer.
+	progress := make(chan string, 16)
+	report := func(text string) {
+		select {
+		case progress <- text:
+		case <-r.Context().Done():
+		}
+	}
+	req.OnToolCall = func(ev bus.Event) {
+		if text := toolProgress(ev); text != "" {
+			report(text)
+		}
+	}
+	req.OnMessage = func(content string) {
+		report(content + "\n\n")
+	}
+
+	type result struct {
+		reply agent.DirectResponse
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reply, err := api.process(r.Context(), req)
+		done <- result{reply, err}
+	}()
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case text := <-progress:
+			delta(map[string]string{"content": text}, nil)
+		case res := <-done:
+			// Callbacks finish before the turn does; send what they left.
+			for len(progress) > 0 {
+				delta(map[string]string{"content": <-progress}, nil)
+			}
+			if res.err != nil {
+				send(apiError(res.err.Error(), "agent_error"))
+			} else {
+				delta(map[string]string{"content": res.reply.Content}, nil)
+				delta(map[string]string{}, "stop")
+				if includeUsage {
+					chunk([]interface{}{}, map[string]interface{}{"usage": usage(res.reply.Usage)})
+				}
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+// toolProgress renders a tool progress event as a line of the streamed
+// reply; finished tools need no line of their own.
+func toolProgress(ev bus.Event) string {
+	switch ev.Metadata["status"] {
+	case "running":
+		return fmt.Sprintf("_Running %s…_\n\n", ev.Content)
+	case "failed":
+		return fmt.Sprintf("_%s failed_\n\n", ev.Content)
+	}
+	return ""
+}
+
+// usage reports a turn's token usage in the OpenAI shape.
+func usage(u providers.UsageInfo) map[string]int {
+	return map[string]int{
+		"prompt_tokens":     u.PromptTokens,
+		"completion_tokens": u.CompletionTokens,
+		"total_tokens":      u.TotalTokens,
+	}
+}
+
+func apiError(message, code string) map[string]interface{} {
+	return map[string]interface{}{
+		"error": map[string]string{"message": message, "type": code, "code": code},
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiError(message, code))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,230 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+type fakeAgent struct {
+	mu   sync.Mutex
+	reqs []agent.DirectRequest
+}
+
+func (f *fakeAgent) ProcessRequest(ctx context.Context, req agent.DirectRequest) (agent.DirectResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reqs = append(f.reqs, req)
+	if req.OnToolCall != nil {
+		req.OnToolCall(bus.Event{Type: bus.EventToolCall, Content: "read_file", Metadata: map[string]string{"status": "running"}})
+		req.OnToolCall(bus.Event{Type: bus.EventToolCall, Content: "read_file", Metadata: map[string]string{"status": "done"}})
+	}
+	if req.OnMessage != nil {
+		req.OnMessage("looking")
+	}
+	return agent.DirectResponse{
+		Content: "echo: " + req.Content,
+		Usage:   providers.UsageInfo{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15},
+	}, nil
+}
+
+func newTestAPI(t *testing.T) (*httptest.Server, *fakeAgent) {
+	t.Helper()
+	fa := &fakeAgent{}
+	api, err := NewOpenAIAPI(config.APIConfig{
+		Keys: []config.APIKeyConfig{
+			{Name: "ide", Key: "k-ide", Profile: "readonly"},
+			{Name: "webui", Key: "k-webui", Session: "shared"},
+		},
+		Profiles: map[string][]string{"readonly": {"read_file", "list_dir"}},
+	}, fa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	api.Register(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, fa
+}
+
+func post(t *testing.T, url, key, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestChatCompletions(t *testing.T) {
+	srv, fa := newTestAPI(t)
+
+	resp := post(t, srv.URL+"/v1/chat/completions", "k-ide", `{"model":"picoclaw","messages":[
+		{"role":"system","content":"ignored"},
+		{"role":"user","content":[{"type":"text","text":"what is this"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AA=="}}]}
+	]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	var out struct {
+		Object  string `json:"object"`
+		Choices []struct {
+			Message struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage map[string]int `json:"usage"`
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	if out.Object != "chat.completion" || len(out.Choices) != 1 || out.Choices[0].Message.Content != "echo: what is this" {
+		t.Fatalf("response = %+v", out)
+	}
+	if out.Usage["prompt_tokens"] != 12 || out.Usage["completion_tokens"] != 3 || out.Usage["total_tokens"] != 15 {
+		t.Errorf("usage = %v, want the turn's usage", out.Usage)
+	}
+
+	got := fa.reqs[0]
+	if got.SessionKey != "api:ide" || got.Channel != "api" || len(got.Media) != 1 {
+		t.Errorf("request = %+v", got)
+	}
+	if strings.Join(got.Tools, ",") != "read_file,list_dir" {
+		t.Errorf("tools = %v, want the readonly profile", got.Tools)
+	}
+
+	post(t, srv.URL+"/v1/chat/completions", "k-webui", `{"messages":[{"role":"user","content":"hi"}],"user":"alice"}`)
+	if got := fa.reqs[1]; got.SessionKey != "shared:alice" || got.Tools != nil {
+		t.Errorf("request = %+v, want session shared:alice with all tools", got)
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	srv, _ := newTestAPI(t)
+
+	resp := post(t, srv.URL+"/v1/chat/completions", "k-ide", `{"stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type = %q", ct)
+	}
+	var body strings.Builder
+	buf := make([]byte, 4096)
+	for {
+		n, err := resp.Body.Read(buf)
+		body.Write(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+
+	var content, finish string
+	var usage map[string]int
+	events := strings.Split(strings.TrimSpace(body.String()), "\n\n")
+	for _, ev := range events[:len(events)-1] {
+		var chunk struct {
+			Choices []struct {
+				Delta        map[string]string `json:"delta"`
+				FinishReason *string           `json:"finish_reason"`
+			} `json:"choices"`
+			Usage map[string]int `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(ev, "data: ")), &chunk); err != nil {
+			t.Fatalf("event %q: %v", ev, err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+			continue
+		}
+		content += chunk.Choices[0].Delta["content"]
+		if chunk.Choices[0].FinishReason != nil {
+			finish = *chunk.Choices[0].FinishReason
+		}
+	}
+	want := "_Running read_file…_\n\nlooking\n\necho: hi"
+	if content != want || finish != "stop" || events[len(events)-1] != "data: [DONE]" {
+		t.Errorf("stream = %q", body.String())
+	}
+	if usage["total_tokens"] != 15 {
+		t.Errorf("usage = %v, want the turn's usage", usage)
+	}
+}
+
+func TestOpenAIAPIRejectsBadRequests(t *testing.T) {
+	srv, fa := newTestAPI(t)
+
+	for _, tc := range []struct {
+		key, body string
+		want      int
+	}{
+		{"wrong", `{"messages":[{"role":"user","content":"hi"}]}`, http.StatusUnauthorized},
+		{"k-ide", `not json`, http.StatusBadRequest},
+		{"k-ide", `{"messages":[{"role":"assistant","content":"hi"}]}`, http.StatusBadRequest},
+		{"k-ide", `{"messages":[{"role":"user","content":"  "}]}`, http.StatusBadRequest},
+		{"k-ide", `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"/home/user/photo.jpg"}}]}]}`, http.StatusBadRequest},
+		{"k-ide", `{"messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"http://10.0.0.1/x.png"}}]}]}`, http.StatusBadRequest},
+	} {
+		if resp := post(t, srv.URL+"/v1/chat/completions", tc.key, tc.body); resp.StatusCode != tc.want {
+			t.Errorf("key %s body %s: status = %d, want %d", tc.key, tc.body, resp.StatusCode, tc.want)
+		}
+	}
+	if len(fa.reqs) != 0 {
+		t.Errorf("agent got %d requests, want none", len(fa.reqs))
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/models", nil)
+	req.Header.Set("Authorization", "Bearer k-webui")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var models struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&models)
+	if len(models.Data) != 1 || models.Data[0].ID != ModelID {
+		t.Errorf("models = %+v", models)
+	}
+}
+
+func TestNewOpenAIAPIRejectsUnknownProfile(t *testing.T) {
+	_, err := NewOpenAIAPI(config.APIConfig{
+		Keys: []config.APIKeyConfig{{Name: "x", Key: "k", Profile: "missing"}},
+	}, &fakeAgent{})
+	if err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+}
+
+func TestOpenAIAPIReleasesSessionLocks(t *testing.T) {
+	api, err := NewOpenAIAPI(config.APIConfig{}, &fakeAgent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for _, session := range []string{"api:a", "api:b", "api:a"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			api.process(context.Background(), agent.DirectRequest{Content: "hi", SessionKey: session, Channel: "api"})
+		}()
+	}
+	wg.Wait()
+	if len(api.locks) != 0 {
+		t.Errorf("%d session locks left after all requests finished", len(api.locks))
+	}
+}
@@ -158,6 +158,31 @@ func (hs *HeartbeatService) executeHeartbeat() {
 	}
 	defer hs.executing.Store(false)
 
+	hs.mu.RLock()
+	running := hs.enabled && hs.stopChan != nil
+	hs.mu.RUnlock()
+	if !running {
+		return
+	}
+
+	hs.beat()
+}
+
+// Trigger runs a heartbeat now, in the background, even when periodic
+// heartbeats are disabled. Returns false if one is already running.
+func (hs *HeartbeatService) Trigger() bool {
+	if !hs.executing.CompareAndSwap(false, true) {
+		return false
+	}
+	go func() {
+		defer hs.executing.Store(false)
+		hs.beat()
+	}()
+	return true
+}
+
+// beat builds the prompt, runs the handler and delivers its result.
+func (hs *HeartbeatService) beat() {
 	// Panic recovery to prevent silent goroutine death
 	defer func() {
 		if r := recover(); r != nil {
@@ -166,18 +191,9 @@ func (hs *HeartbeatService) executeHeartbeat() {
 	}()
 
 	hs.mu.RLock()
-	enabled := hs.enabled
 	handler := hs.handler
-	if !hs.enabled || hs.stopChan == nil {
-		hs.mu.RUnlock()
-		return
-	}
 	hs.mu.RUnlock()
 
-	if !enabled {
-		return
-	}
-
 	logger.DebugC("heartbeat", "Executing heartbeat")
 
 	prompt := hs.buildPrompt()
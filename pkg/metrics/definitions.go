@@ -0,0 +1,46 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package metrics
+
+// The metrics the gateway exports. Packages update them where the event
+// happens; gauges that sample state are refreshed through OnScrape.
+var (
+	MessagesInbound = NewCounterVec("picoclaw_messages_inbound_total",
+		"Messages received from users, by channel.", "channel")
+	MessagesOutbound = NewCounterVec("picoclaw_messages_outbound_total",
+		"Outbound send attempts, by channel and result (sent, failed, dead_lettered).", "channel", "result")
+	BusQueueDepth = NewGaugeVec("picoclaw_bus_queue_depth",
+		"Messages waiting in the message bus, by queue (inbound, outbound, events).", "queue")
+
+	LLMRequestDuration = NewHistogramVec("picoclaw_llm_request_duration_seconds",
+		"LLM call latency, by provider and model.", nil, "provider", "model")
+	LLMErrors = NewCounterVec("picoclaw_llm_errors_total",
+		"Failed LLM calls, by provider and model.", "provider", "model")
+	LLMTokens = NewCounterVec("picoclaw_llm_tokens_total",
+		"Tokens used, by model, feature and type (prompt, completion).", "model", "feature", "type")
+
+	ToolCalls = NewCounterVec("picoclaw_tool_calls_total",
+		"Tool executions, by tool and result (ok, error).", "tool", "result")
+	ToolDuration = NewHistogramVec("picoclaw_tool_duration_seconds",
+		"Tool execution time, by tool.", nil, "tool")
+
+	CronRuns = NewCounterVec("picoclaw_cron_runs_total",
+		"Cron job runs, by status (ok, error).", "status")
+
+	SentinelCPUTemp = NewGaugeVec("picoclaw_sentinel_cpu_temp_celsius",
+		"CPU temperature at the last sentinel reading.")
+	SentinelRAMUsed = NewGaugeVec("picoclaw_sentinel_ram_used_percent",
+		"RAM in use at the last sentinel reading.")
+	SentinelRAMAvailable = NewGaugeVec("picoclaw_sentinel_ram_available_megabytes",
+		"Available RAM at the last sentinel reading.")
+	SentinelDiskUsed = NewGaugeVec("picoclaw_sentinel_disk_used_percent",
+		"Root filesystem usage at the last sentinel reading.")
+	SentinelDiskFree = NewGaugeVec("picoclaw_sentinel_disk_free_gigabytes",
+		"Free root filesystem space at the last sentinel reading.")
+	SentinelUptime = NewGaugeVec("picoclaw_sentinel_uptime_seconds",
+		"Process uptime at the last sentinel reading.")
+)
@@ -0,0 +1,309 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package metrics keeps process-wide counters, gauges and histograms and
+// serves them in the Prometheus text exposition format. It implements just
+// the subset the gateway needs, so the binary stays free of the Prometheus
+// client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds, sized for tool runs
+// and LLM calls that take anywhere from milliseconds to minutes.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// metric is one metric family in the registry.
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []metric
+	collectors []func()
+)
+
+func register(m metric) {
+	registryMu.Lock()
+	registry = append(registry, m)
+	registryMu.Unlock()
+}
+
+// OnScrape registers fn to run before every scrape, for gauges that sample
+// state (queue lengths, for example) rather than being updated as it changes.
+func OnScrape(fn func()) {
+	registryMu.Lock()
+	collectors = append(collectors, fn)
+	registryMu.Unlock()
+}
+
+// family is what counters, gauges and histograms share: a name, help text
+// and the label names every series must supply values for.
+type family struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (f *family) header(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, kind)
+}
+
+// labelPairs renders {a="x",b="y"}, with extra appended after the family's
+// own labels (the histogram's le).
+func (f *family) labelPairs(values []string, extra ...string) string {
+	if len(f.labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, l := range f.labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, "%s=\"%s\"", l, escapeLabel(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if sb.Len() > 1 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, "%s=\"%s\"", extra[i], escapeLabel(extra[i+1]))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// series holds the values of one label combination.
+type series struct {
+	labels []string
+	value  float64
+}
+
+// valueVec is the storage behind counters and gauges.
+type valueVec struct {
+	family
+	kind string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newValueVec(kind, name, help string, labels []string) *valueVec {
+	v := &valueVec{family: family{name: name, help: help, labels: labels}, kind: kind, series: map[string]*series{}}
+	register(v)
+	return v
+}
+
+func (v *valueVec) update(values []string, fn func(*series)) {
+	k := v.key(values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[k]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		v.series[k] = s
+	}
+	fn(s)
+}
+
+func (v *valueVec) get(values []string) float64 {
+	k := v.key(values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.series[k]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (v *valueVec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.header(w, v.kind)
+	for _, k := range sortedKeys(v.series) {
+		s := v.series[k]
+		fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelPairs(s.labels), formatFloat(s.value))
+	}
+}
+
+// CounterVec is a monotonically increasing count per label combination.
+type CounterVec struct{ v *valueVec }
+
+// NewCounterVec registers a counter. Label values are passed positionally
+// to Inc and Add in the order of labels.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{v: newValueVec("counter", name, help, labels)}
+}
+
+func (c *CounterVec) Inc(labels ...string) { c.Add(1, labels...) }
+
+// Add increases the counter; negative deltas are ignored.
+func (c *CounterVec) Add(delta float64, labels ...string) {
+	if delta < 0 {
+		return
+	}
+	c.v.update(labels, func(s *series) { s.value += delta })
+}
+
+// Value returns the current count, for tests.
+func (c *CounterVec) Value(labels ...string) float64 { return c.v.get(labels) }
+
+// GaugeVec is a value per label combination that can go up and down.
+type GaugeVec struct{ v *valueVec }
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{v: newValueVec("gauge", name, help, labels)}
+}
+
+func (g *GaugeVec) Set(value float64, labels ...string) {
+	g.v.update(labels, func(s *series) { s.value = value })
+}
+
+// Value returns the current value, for tests.
+func (g *GaugeVec) Value(labels ...string) float64 { return g.v.get(labels) }
+
+// HistogramVec counts observations into cumulative buckets per label
+// combination.
+type HistogramVec struct {
+	family
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram; nil buckets uses DefaultBuckets.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &HistogramVec{
+		family:  family{name: name, help: help, labels: labels},
+		buckets: append([]float64(nil), buckets...),
+		series:  map[string]*histogram{},
+	}
+	sort.Float64s(h.buckets)
+	register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labels ...string) {
+	k := h.key(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[k]
+	if !ok {
+		s = &histogram{labels: append([]string(nil), labels...), counts: make([]uint64, len(h.buckets))}
+		h.series[k] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+// Count returns how many values were observed, for tests.
+func (h *HistogramVec) Count(labels ...string) uint64 {
+	k := h.key(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[k]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w, "histogram")
+	for _, k := range sortedKeys(h.series) {
+		s := h.series[k]
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(s.labels, "le", formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(s.labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(s.labels), s.count)
+	}
+}
+
+// Handler serves every registered metric in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registryMu.Lock()
+		fns := append([]func(){}, collectors...)
+		families := append([]metric{}, registry...)
+		registryMu.Unlock()
+
+		for _, fn := range fns {
+			fn()
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		for _, m := range families {
+			m.write(bw)
+		}
+		bw.Flush()
+	})
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
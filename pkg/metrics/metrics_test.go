@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	return string(body)
+}
+
+func TestExposition(t *testing.T) {
+	counter := NewCounterVec("test_requests_total", "Requests.\nSecond line.", "channel", "result")
+	counter.Inc("telegram", "sent")
+	counter.Add(2, "telegram", "sent")
+	counter.Add(-5, "telegram", "sent")
+	counter.Inc(`we"ird\`, "failed")
+
+	gauge := NewGaugeVec("test_queue_depth", "Queue depth.", "queue")
+	OnScrape(func() { gauge.Set(7, "inbound") })
+
+	hist := NewHistogramVec("test_duration_seconds", "Duration.", []float64{1, 0.1}, "tool")
+	hist.Observe(0.05, "exec")
+	hist.Observe(0.5, "exec")
+	hist.Observe(3, "exec")
+
+	body := scrape(t)
+	for _, want := range []string{
+		"# HELP test_requests_total Requests.\\nSecond line.\n# TYPE test_requests_total counter\n",
+		`test_requests_total{channel="telegram",result="sent"} 3`,
+		`test_requests_total{channel="we\"ird\\",result="failed"} 1`,
+		"# TYPE test_queue_depth gauge\n",
+		`test_queue_depth{queue="inbound"} 7`,
+		"# TYPE test_duration_seconds histogram\n",
+		`test_duration_seconds_bucket{tool="exec",le="0.1"} 1`,
+		`test_duration_seconds_bucket{tool="exec",le="1"} 2`,
+		`test_duration_seconds_bucket{tool="exec",le="+Inf"} 3`,
+		`test_duration_seconds_sum{tool="exec"} 3.55`,
+		`test_duration_seconds_count{tool="exec"} 3`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+	if got := counter.Value("telegram", "sent"); got != 3 {
+		t.Errorf("Value = %v, want 3", got)
+	}
+	if got := hist.Count("exec"); got != 3 {
+		t.Errorf("Count = %d, want 3", got)
+	}
+}
+
+func TestUnlabelledGauge(t *testing.T) {
+	g := NewGaugeVec("test_uptime_seconds", "Uptime.")
+	g.Set(42)
+	if body := scrape(t); !strings.Contains(body, "\ntest_uptime_seconds 42\n") {
+		t.Errorf("body:\n%s", body)
+	}
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	c := NewCounterVec("test_panics_total", "Panics.", "a")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	c.Inc("a", "b")
+}
@@ -0,0 +1,207 @@
+package providers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	// claudeCliMCPServer is the MCP server name picoclaw registers with the
+	// CLI; the CLI exposes its tools as mcp__<server>__<tool>.
+	claudeCliMCPServer     = "picoclaw"
+	claudeCliMCPToolPrefix = "mcp__" + claudeCliMCPServer + "__"
+)
+
+// claudeCliMCPBridge is a minimal MCP server (Streamable HTTP transport,
+// plain JSON responses) on localhost. Each CLI session gets its own URL and
+// a random bearer token, so other local processes can neither list the tools
+// nor answer for the CLI; a tools/call blocks until the agent loop has
+// executed the tool and passed the result back through Chat.
+type claudeCliMCPBridge struct {
+	listener net.Listener
+	server   *http.Server
+	lookup   func(key string) *claudeCliSession
+}
+
+// claudeCliMCPCall is a tools/call request waiting for its result.
+type claudeCliMCPCall struct {
+	name  string
+	args  map[string]interface{}
+	reply chan claudeCliMCPResult
+}
+
+type claudeCliMCPResult struct {
+	text    string
+	isError bool
+}
+
+func newClaudeCliMCPBridge(lookup func(key string) *claudeCliSession) (*claudeCliMCPBridge, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &claudeCliMCPBridge{listener: listener, lookup: lookup}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mcp/", b.handle)
+	b.server = &http.Server{Handler: mux}
+	go b.server.Serve(listener)
+	return b, nil
+}
+
+func (b *claudeCliMCPBridge) url(key string) string {
+	return fmt.Sprintf("http://%s/mcp/%s", b.listener.Addr(), key)
+}
+
+func (b *claudeCliMCPBridge) close() {
+	b.server.Close()
+}
+
+// newClaudeCliMCPToken returns a random bearer token for one session.
+func newClaudeCliMCPToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (b *claudeCliMCPBridge) handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		// No server-initiated stream
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := b.lookup(strings.TrimPrefix(r.URL.Path, "/mcp/"))
+	if s == nil {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if s.mcpToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.mcpToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req mcpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON-RPC request", http.StatusBadRequest)
+		return
+	}
+
+	// Notifications get no response body
+	if len(req.ID) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	result, rpcErr := b.dispatch(r, s, req)
+
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	if rpcErr != nil {
+		resp["error"] = rpcErr
+	} else {
+		resp["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (b *claudeCliMCPBridge) dispatch(r *http.Request, s *claudeCliSession, req mcpRequest) (interface{}, *mcpError) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		if params.ProtocolVersion == "" {
+			params.ProtocolVersion = "2025-03-26"
+		}
+		return map[string]interface{}{
+			"protocolVersion": params.ProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": claudeCliMCPServer, "version": "1.0"},
+		}, nil
+
+	case "ping":
+		return map[string]interface{}{}, nil
+
+	case "tools/list":
+		tools := s.getTools()
+		list := make([]map[string]interface{}, 0, len(tools))
+		for _, t := range tools {
+			if t.Type != "function" {
+				continue
+			}
+			schema := t.Function.Parameters
+			if schema == nil {
+				schema = map[string]interface{}{"type": "object"}
+			}
+			list = append(list, map[string]interface{}{
+				"name":        t.Function.Name,
+				"description": t.Function.Description,
+				"inputSchema": schema,
+			})
+		}
+		return map[string]interface{}{"tools": list}, nil
+
+	case "tools/call":
+		var params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &mcpError{Code: -32602, Message: "invalid params"}
+		}
+		if params.Arguments == nil {
+			params.Arguments = map[string]interface{}{}
+		}
+
+		call := &claudeCliMCPCall{
+			name:  params.Name,
+			args:  params.Arguments,
+			reply: make(chan claudeCliMCPResult, 1),
+		}
+		select {
+		case s.calls <- call:
+		case <-r.Context().Done():
+			return nil, &mcpError{Code: -32603, Message: "request cancelled"}
+		}
+
+		select {
+		case res := <-call.reply:
+			return map[string]interface{}{
+				"content": []map[string]string{{"type": "text", "text": res.text}},
+				"isError": res.isError,
+			}, nil
+		case <-r.Context().Done():
+			return nil, &mcpError{Code: -32603, Message: "request cancelled"}
+		}
+	}
+
+	return nil, &mcpError{Code: -32601, Message: "method not found: " + req.Method}
+}
@@ -1,68 +1,369 @@
 package providers
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// claudeCliMaxSessions caps live CLI processes; the least recently used
+	// idle one is stopped to make room for a new session.
+	claudeCliMaxSessions = 8
+	// claudeCliIdleTimeout stops processes no turn has used for a while,
+	// including ones left waiting on tool results the agent gave up on.
+	claudeCliIdleTimeout = 30 * time.Minute
 )
 
 // ClaudeCliProvider implements LLMProvider using the claude CLI as a subprocess.
+//
+// The CLI runs in streaming JSON mode with one persistent process per
+// session, so it keeps its own conversation state between turns. picoclaw
+// tools are exposed to it natively over a local MCP bridge: when the CLI
+// calls one, Chat returns it as a regular tool call and the next Chat (with
+// the tool result) answers the pending MCP request and resumes the stream.
+// Idle processes are stopped after claudeCliIdleTimeout and at most
+// claudeCliMaxSessions are kept; Close stops the rest.
 type ClaudeCliProvider struct {
-	command   string
-	workspace string
+	command     string
+	workspace   string
+	maxSessions int
+	idleTimeout time.Duration
+
+	mu          sync.Mutex
+	sessions    map[string]*claudeCliSession
+	bridge      *claudeCliMCPBridge
+	stopJanitor chan struct{}
 }
 
 // NewClaudeCliProvider creates a new Claude CLI provider.
 func NewClaudeCliProvider(workspace string) *ClaudeCliProvider {
 	return &ClaudeCliProvider{
-		command:   "claude",
-		workspace: workspace,
+		command:     "claude",
+		workspace:   workspace,
+		maxSessions: claudeCliMaxSessions,
+		idleTimeout: claudeCliIdleTimeout,
+		sessions:    make(map[string]*claudeCliSession),
 	}
 }
 
-// Chat implements LLMProvider.Chat by executing the claude CLI.
+var claudeCliEphemeralID atomic.Int64
+
+// Chat implements LLMProvider.Chat by driving a claude CLI session.
 func (p *ClaudeCliProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
-	systemPrompt := p.buildSystemPrompt(messages, tools)
-	prompt := p.messagesToPrompt(messages)
+	// Tool results for calls the CLI is waiting on resume that session.
+	if results := trailingToolResults(messages); len(results) > 0 {
+		if s := p.sessionAwaiting(results[0].ToolCallID); s != nil {
+			s.setTools(tools)
+			resp, err := s.resume(ctx, results)
+			return p.finish(s, resp, err)
+		}
+	}
+
+	key, _ := options[SessionKeyOption].(string)
+	ephemeral := key == ""
+	if ephemeral {
+		key = fmt.Sprintf("ephemeral-%d", claudeCliEphemeralID.Add(1))
+	}
+
+	s, prompt, err := p.sessionFor(key, ephemeral, messages, tools, model)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.send(ctx, prompt, newUserImages(messages))
+	return p.finish(s, resp, err)
+}
+
+// GetDefaultModel returns the default model identifier.
+func (p *ClaudeCliProvider) GetDefaultModel() string {
+	return "claude-code"
+}
+
+// Close stops all CLI sessions and the MCP bridge.
+func (p *ClaudeCliProvider) Close() {
+	p.mu.Lock()
+	sessions := p.sessions
+	p.sessions = make(map[string]*claudeCliSession)
+	bridge := p.bridge
+	p.bridge = nil
+	if p.stopJanitor != nil {
+		close(p.stopJanitor)
+		p.stopJanitor = nil
+	}
+	p.mu.Unlock()
+
+	for _, s := range sessions {
+		s.close()
+	}
+	if bridge != nil {
+		bridge.close()
+	}
+}
+
+// sessionFor returns a running session for key and the prompt to send it:
+// just the new user input when the session already holds the history, or the
+// whole conversation when a fresh process has to be seeded. The lookup and
+// spawn happen under p.mu so concurrent turns on one key share a process.
+func (p *ClaudeCliProvider) sessionFor(key string, ephemeral bool, messages []Message, tools []ToolDefinition, model string) (*claudeCliSession, string, error) {
+	turns := countNonSystem(messages)
+	first := firstNonSystem(messages)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	p.evictLocked(now)
+
+	// Reuse only if the process is alive and the caller's history is a
+	// continuation of what the process has seen (not reset or summarized).
+	// A session still waiting on tool results belongs to a tool loop the
+	// agent abandoned; restarting it fails those calls instead of leaving
+	// the CLI blocked on them.
+	s := p.sessions[key]
+	if s != nil && s.alive() && s.model == model && s.first == first && turns > s.turns && !s.hasInflight() {
+		s.setTools(tools)
+		s.turns = turns
+		s.active++
+		s.lastUsed = now
+		return s, newUserInput(messages), nil
+	}
+	if s != nil {
+		p.dropLocked(s)
+	}
+
+	var mcpURL string
+	if len(tools) > 0 {
+		if p.bridge == nil {
+			bridge, err := newClaudeCliMCPBridge(p.lookupSession)
+			if err != nil {
+				return nil, "", fmt.Errorf("starting MCP bridge: %w", err)
+			}
+			p.bridge = bridge
+		}
+		mcpURL = p.bridge.url(key)
+	}
+
+	s, err := p.startSession(key, p.buildSystemPrompt(messages), model, mcpURL)
+	if err != nil {
+		return nil, "", err
+	}
+	s.setTools(tools)
+	s.first = first
+	s.turns = turns
+	s.ephemeral = ephemeral
+	s.active = 1
+	s.lastUsed = now
+
+	p.sessions[key] = s
+	if p.stopJanitor == nil {
+		p.stopJanitor = make(chan struct{})
+		go p.janitor(p.stopJanitor)
+	}
+
+	return s, p.messagesToPrompt(messages), nil
+}
+
+// finish drops ephemeral and broken sessions once a turn is complete.
+func (p *ClaudeCliProvider) finish(s *claudeCliSession, resp *LLMResponse, err error) (*LLMResponse, error) {
+	p.mu.Lock()
+	s.active--
+	s.lastUsed = time.Now()
+	p.mu.Unlock()
+
+	if err != nil || (s.ephemeral && len(resp.ToolCalls) == 0) {
+		p.drop(s)
+	}
+	return resp, err
+}
+
+func (p *ClaudeCliProvider) drop(s *claudeCliSession) {
+	p.mu.Lock()
+	p.dropLocked(s)
+	p.mu.Unlock()
+}
+
+// dropLocked removes and stops s. Caller must hold p.mu.
+func (p *ClaudeCliProvider) dropLocked(s *claudeCliSession) {
+	if p.sessions[s.key] == s {
+		delete(p.sessions, s.key)
+	}
+	s.close()
+}
+
+// evictLocked stops sessions idle for longer than the idle timeout, then
+// the least recently used ones until there is room for another session.
+// Sessions in a Chat call or waiting on tool results are not evicted to
+// make room. Caller must hold p.mu.
+func (p *ClaudeCliProvider) evictLocked(now time.Time) {
+	for _, s := range p.sessions {
+		if s.active == 0 && now.Sub(s.lastUsed) > p.idleTimeout {
+			p.dropLocked(s)
+		}
+	}
+
+	for len(p.sessions) >= p.maxSessions {
+		var oldest *claudeCliSession
+		for _, s := range p.sessions {
+			if s.active > 0 || s.hasInflight() {
+				continue
+			}
+			if oldest == nil || s.lastUsed.Before(oldest.lastUsed) {
+				oldest = s
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		p.dropLocked(oldest)
+	}
+}
+
+// janitor enforces the idle timeout while no new sessions are started.
+func (p *ClaudeCliProvider) janitor(stop <-chan struct{}) {
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			p.evictLocked(now)
+			p.mu.Unlock()
+		}
+	}
+}
 
-	args := []string{"-p", "--output-format", "json", "--dangerously-skip-permissions", "--no-chrome"}
+func (p *ClaudeCliProvider) sessionAwaiting(toolCallID string) *claudeCliSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.sessions {
+		if s.awaiting(toolCallID) {
+			s.active++
+			s.lastUsed = time.Now()
+			return s
+		}
+	}
+	return nil
+}
+
+func (p *ClaudeCliProvider) lookupSession(key string) *claudeCliSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sessions[key]
+}
+
+// startSession spawns a CLI process in streaming JSON mode.
+func (p *ClaudeCliProvider) startSession(key, systemPrompt, model, mcpURL string) (*claudeCliSession, error) {
+	args := []string{
+		"-p",
+		"--input-format", "stream-json",
+		"--output-format", "stream-json",
+		"--verbose",
+		"--dangerously-skip-permissions",
+		"--no-chrome",
+	}
 	if systemPrompt != "" {
 		args = append(args, "--system-prompt", systemPrompt)
 	}
 	if model != "" && model != "claude-code" {
 		args = append(args, "--model", model)
 	}
-	args = append(args, "-") // read from stdin
+	var mcpToken, mcpConfigPath string
+	if mcpURL != "" {
+		var err error
+		if mcpToken, err = newClaudeCliMCPToken(); err != nil {
+			return nil, fmt.Errorf("claude cli error: %w", err)
+		}
+		// The config carries the bridge token, so it goes in a private file
+		// rather than on the command line where ps would show it.
+		if mcpConfigPath, err = writeClaudeCliMCPConfig(mcpURL, mcpToken); err != nil {
+			return nil, fmt.Errorf("claude cli error: %w", err)
+		}
+		args = append(args, "--mcp-config", mcpConfigPath)
+	}
 
-	cmd := exec.CommandContext(ctx, p.command, args...)
+	// Not bound to a request context: the process outlives individual calls.
+	cmd := exec.Command(p.command, args...)
 	if p.workspace != "" {
 		cmd.Dir = p.workspace
 	}
-	cmd.Stdin = bytes.NewReader([]byte(prompt))
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	// picoclaw tools such as the council can run for minutes.
+	cmd.Env = append(os.Environ(), "MCP_TOOL_TIMEOUT=600000")
 
-	if err := cmd.Run(); err != nil {
-		if stderrStr := stderr.String(); stderrStr != "" {
-			return nil, fmt.Errorf("claude cli error: %s", stderrStr)
+	fail := func(err error) (*claudeCliSession, error) {
+		if mcpConfigPath != "" {
+			os.Remove(mcpConfigPath)
 		}
 		return nil, fmt.Errorf("claude cli error: %w", err)
 	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fail(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fail(err)
+	}
+	s := &claudeCliSession{
+		key:           key,
+		model:         model,
+		mcpToken:      mcpToken,
+		mcpConfigPath: mcpConfigPath,
+		cmd:           cmd,
+		stdin:         stdin,
+		events:        make(chan claudeCliEvent, 64),
+		calls:         make(chan *claudeCliMCPCall, 16),
+		exited:        make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	cmd.Stderr = &s.stderr
 
-	return p.parseClaudeCliResponse(stdout.String())
+	if err := cmd.Start(); err != nil {
+		return fail(err)
+	}
+	go s.readEvents(stdout)
+	return s, nil
 }
 
-// GetDefaultModel returns the default model identifier.
-func (p *ClaudeCliProvider) GetDefaultModel() string {
-	return "claude-code"
+// writeClaudeCliMCPConfig writes the --mcp-config file pointing the CLI at
+// the bridge with its bearer token. os.CreateTemp makes it owner-only.
+func writeClaudeCliMCPConfig(url, token string) (string, error) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"mcpServers": map[string]interface{}{
+			claudeCliMCPServer: map[string]interface{}{
+				"type":    "http",
+				"url":     url,
+				"headers": map[string]string{"Authorization": "Bearer " + token},
+			},
+		},
+	})
+	f, err := os.CreateTemp("", "picoclaw-mcp-*.json")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
 }
 
 // messagesToPrompt converts messages to a CLI-compatible prompt string.
+// Used to seed a new process with the conversation so far.
 func (p *ClaudeCliProvider) messagesToPrompt(messages []Message) string {
 	var parts []string
 
@@ -87,8 +388,9 @@ func (p *ClaudeCliProvider) messagesToPrompt(messages []Message) string {
 	return strings.Join(parts, "\n")
 }
 
-// buildSystemPrompt combines system messages and tool definitions.
-func (p *ClaudeCliProvider) buildSystemPrompt(messages []Message, tools []ToolDefinition) string {
+// buildSystemPrompt combines system messages. Tools are not described here:
+// the CLI discovers them over MCP.
+func (p *ClaudeCliProvider) buildSystemPrompt(messages []Message) string {
 	var parts []string
 
 	for _, msg := range messages {
@@ -97,161 +399,464 @@ func (p *ClaudeCliProvider) buildSystemPrompt(messages []Message, tools []ToolDe
 		}
 	}
 
-	if len(tools) > 0 {
-		parts = append(parts, p.buildToolsPrompt(tools))
+	return strings.Join(parts, "\n\n")
+}
+
+// claudeCliSession is one persistent CLI process.
+type claudeCliSession struct {
+	key       string
+	model     string
+	first     string // first non-system message, to detect history resets
+	ephemeral bool
+
+	mcpToken      string // bearer token the MCP bridge expects from this process
+	mcpConfigPath string // --mcp-config file, removed once the process exits
+
+	// Guarded by the provider's mu.
+	turns    int       // non-system messages in the last request
+	active   int       // Chat calls currently using the session
+	lastUsed time.Time // when a Chat call last started or finished
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+	events chan claudeCliEvent
+	calls  chan *claudeCliMCPCall
+	exited chan struct{}
+	done   chan struct{} // closed by close, so readEvents stops delivering
+
+	turnMu sync.Mutex // serializes turns on this process
+
+	mu          sync.Mutex
+	tools       []ToolDefinition
+	pending     []claudeCliToolUse           // tool_use blocks not yet matched to an MCP call
+	unowned     []*claudeCliMCPCall          // MCP calls not yet matched to a tool_use block
+	inflight    map[string]*claudeCliMCPCall // tool_use ID -> call awaiting its result
+	ready       []ToolCall                   // matched calls not yet returned to the caller
+	seenMsgs    map[string]bool              // assistant message IDs already counted for usage
+	reported    UsageInfo                    // usage returned with tool calls this turn
+	sinceReturn UsageInfo                    // usage since the last response
+	text        strings.Builder              // assistant text since the last return
+	parseErr    error                        // first unparseable stdout line
+	waitErr     error                        // process exit status, set before exited closes
+	closed      atomic.Bool
+}
+
+type claudeCliToolUse struct {
+	id   string
+	name string
+	args map[string]interface{}
+	key  string // canonical arguments JSON for matching MCP calls
+}
+
+func (s *claudeCliSession) alive() bool {
+	select {
+	case <-s.exited:
+		return false
+	default:
+		return !s.closed.Load()
 	}
+}
 
-	return strings.Join(parts, "\n\n")
+func (s *claudeCliSession) setTools(tools []ToolDefinition) {
+	s.mu.Lock()
+	s.tools = tools
+	s.mu.Unlock()
+}
+
+func (s *claudeCliSession) getTools() []ToolDefinition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tools
+}
+
+func (s *claudeCliSession) hasInflight() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.inflight) > 0
 }
 
-// buildToolsPrompt creates the tool definitions section for the system prompt.
-func (p *ClaudeCliProvider) buildToolsPrompt(tools []ToolDefinition) string {
-	var sb strings.Builder
+func (s *claudeCliSession) awaiting(toolCallID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.inflight[toolCallID]
+	return ok
+}
 
-	sb.WriteString("## Available Tools\n\n")
-	sb.WriteString("When you need to use a tool, respond with ONLY a JSON object:\n\n")
-	sb.WriteString("```json\n")
-	sb.WriteString(`{"tool_calls":[{"id":"call_xxx","type":"function","function":{"name":"tool_name","arguments":"{...}"}}]}`)
-	sb.WriteString("\n```\n\n")
-	sb.WriteString("CRITICAL: The 'arguments' field MUST be a JSON-encoded STRING.\n\n")
-	sb.WriteString("### Tool Definitions:\n\n")
+// send writes a user message and waits for the next result or tool calls.
+func (s *claudeCliSession) send(ctx context.Context, prompt string, images []ContentPart) (*LLMResponse, error) {
+	s.turnMu.Lock()
+	defer s.turnMu.Unlock()
 
-	for _, tool := range tools {
-		if tool.Type != "function" {
-			continue
+	content := []map[string]interface{}{{"type": "text", "text": prompt}}
+	for _, img := range images {
+		source := map[string]string{"type": "url", "url": img.ImageURL.URL}
+		if mediaType, data, ok := splitDataURI(img.ImageURL.URL); ok {
+			source = map[string]string{"type": "base64", "media_type": mediaType, "data": data}
 		}
-		sb.WriteString(fmt.Sprintf("#### %s\n", tool.Function.Name))
-		if tool.Function.Description != "" {
-			sb.WriteString(fmt.Sprintf("Description: %s\n", tool.Function.Description))
+		content = append(content, map[string]interface{}{"type": "image", "source": source})
+	}
+
+	line, _ := json.Marshal(map[string]interface{}{
+		"type": "user",
+		"message": map[string]interface{}{
+			"role":    "user",
+			"content": content,
+		},
+	})
+	// A write error means the process already exited; await reports why.
+	s.stdin.Write(append(line, '\n'))
+
+	return s.await(ctx)
+}
+
+// resume answers pending MCP calls with tool results and continues the turn.
+func (s *claudeCliSession) resume(ctx context.Context, results []Message) (*LLMResponse, error) {
+	s.turnMu.Lock()
+	defer s.turnMu.Unlock()
+
+	s.mu.Lock()
+	for _, r := range results {
+		if call, ok := s.inflight[r.ToolCallID]; ok {
+			delete(s.inflight, r.ToolCallID)
+			call.reply <- claudeCliMCPResult{text: r.Content}
 		}
-		if len(tool.Function.Parameters) > 0 {
-			paramsJSON, _ := json.Marshal(tool.Function.Parameters)
-			sb.WriteString(fmt.Sprintf("Parameters:\n```json\n%s\n```\n", string(paramsJSON)))
+	}
+	s.mu.Unlock()
+
+	return s.await(ctx)
+}
+
+// await consumes CLI events and MCP calls until the turn ends or every
+// picoclaw tool the model asked for has been requested over MCP.
+func (s *claudeCliSession) await(ctx context.Context) (*LLMResponse, error) {
+	for {
+		if resp := s.takeReady(); resp != nil {
+			return resp, nil
+		}
+
+		select {
+		case ev, ok := <-s.events:
+			if !ok {
+				return nil, s.exitError()
+			}
+			switch ev.Type {
+			case "assistant":
+				s.onAssistant(ev)
+			case "result":
+				return s.onResult(ev.raw)
+			}
+		case call := <-s.calls:
+			s.mu.Lock()
+			s.unowned = append(s.unowned, call)
+			s.match()
+			s.mu.Unlock()
+		case <-ctx.Done():
+			s.close()
+			return nil, ctx.Err()
 		}
-		sb.WriteString("\n")
 	}
+}
+
+func (s *claudeCliSession) onAssistant(ev claudeCliEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return sb.String()
+	if ev.Message.ID != "" && !s.seenMsgs[ev.Message.ID] {
+		if s.seenMsgs == nil {
+			s.seenMsgs = make(map[string]bool)
+		}
+		s.seenMsgs[ev.Message.ID] = true
+		if u := ev.Message.Usage.toUsageInfo(); u != nil {
+			addUsage(&s.sinceReturn, u)
+		}
+	}
+
+	for _, block := range ev.Message.Content {
+		switch block.Type {
+		case "text":
+			s.text.WriteString(block.Text)
+		case "tool_use":
+			name, ok := strings.CutPrefix(block.Name, claudeCliMCPToolPrefix)
+			if !ok {
+				continue // a built-in CLI tool; the CLI runs it itself
+			}
+			var args map[string]interface{}
+			json.Unmarshal(block.Input, &args)
+			if args == nil {
+				args = map[string]interface{}{}
+			}
+			s.pending = append(s.pending, claudeCliToolUse{
+				id:   block.ID,
+				name: name,
+				args: args,
+				key:  canonicalArgs(args),
+			})
+		}
+	}
+	s.match()
+}
+
+// match pairs tool_use blocks with incoming MCP calls by tool name and
+// arguments. Caller must hold s.mu.
+func (s *claudeCliSession) match() {
+	for i := 0; i < len(s.pending); i++ {
+		tu := s.pending[i]
+		for j, call := range s.unowned {
+			if call.name != tu.name || canonicalArgs(call.args) != tu.key {
+				continue
+			}
+			s.unowned = append(s.unowned[:j], s.unowned[j+1:]...)
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			i--
+
+			if s.inflight == nil {
+				s.inflight = make(map[string]*claudeCliMCPCall)
+			}
+			s.inflight[tu.id] = call
+			argsJSON, _ := json.Marshal(tu.args)
+			s.ready = append(s.ready, ToolCall{
+				ID:        tu.id,
+				Type:      "function",
+				Name:      tu.name,
+				Arguments: tu.args,
+				Function:  &FunctionCall{Name: tu.name, Arguments: string(argsJSON)},
+			})
+			break
+		}
+	}
 }
 
-// parseClaudeCliResponse parses the JSON output from the claude CLI.
-func (p *ClaudeCliProvider) parseClaudeCliResponse(output string) (*LLMResponse, error) {
+// takeReady returns a tool-call response once every picoclaw tool_use seen
+// so far has its MCP call.
+func (s *claudeCliSession) takeReady() *LLMResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.ready) == 0 || len(s.pending) > 0 {
+		return nil
+	}
+	resp := &LLMResponse{
+		Content:      strings.TrimSpace(s.text.String()),
+		ToolCalls:    s.ready,
+		FinishReason: "tool_calls",
+	}
+	if s.sinceReturn.TotalTokens > 0 {
+		u := s.sinceReturn
+		resp.Usage = &u
+		addUsage(&s.reported, &u)
+	}
+	s.ready = nil
+	s.text.Reset()
+	s.sinceReturn = UsageInfo{}
+	return resp
+}
+
+// onResult converts the final result event. Its usage covers the whole turn,
+// so usage already reported with tool-call responses is subtracted.
+func (s *claudeCliSession) onResult(raw []byte) (*LLMResponse, error) {
 	var resp claudeCliJSONResponse
-	if err := json.Unmarshal([]byte(output), &resp); err != nil {
+	if err := json.Unmarshal(raw, &resp); err != nil {
 		return nil, fmt.Errorf("failed to parse claude cli response: %w", err)
 	}
-
 	if resp.IsError {
 		return nil, fmt.Errorf("claude cli returned error: %s", resp.Result)
 	}
 
-	toolCalls := p.extractToolCalls(resp.Result)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	finishReason := "stop"
-	content := resp.Result
-	if len(toolCalls) > 0 {
-		finishReason = "tool_calls"
-		content = p.stripToolCallsJSON(resp.Result)
+	// Calls abandoned by the model get an error so the CLI doesn't hang.
+	for id, call := range s.inflight {
+		call.reply <- claudeCliMCPResult{text: "tool call abandoned", isError: true}
+		delete(s.inflight, id)
 	}
-
-	var usage *UsageInfo
-	if resp.Usage.InputTokens > 0 || resp.Usage.OutputTokens > 0 {
-		usage = &UsageInfo{
-			PromptTokens:     resp.Usage.InputTokens + resp.Usage.CacheCreationInputTokens + resp.Usage.CacheReadInputTokens,
-			CompletionTokens: resp.Usage.OutputTokens,
-			TotalTokens:      resp.Usage.InputTokens + resp.Usage.CacheCreationInputTokens + resp.Usage.CacheReadInputTokens + resp.Usage.OutputTokens,
-		}
+	s.pending = nil
+	s.ready = nil
+	s.text.Reset()
+
+	usage := resp.Usage.toUsageInfo()
+	if usage != nil {
+		usage.PromptTokens = max(usage.PromptTokens-s.reported.PromptTokens, 0)
+		usage.CompletionTokens = max(usage.CompletionTokens-s.reported.CompletionTokens, 0)
+		usage.CachedTokens = max(usage.CachedTokens-s.reported.CachedTokens, 0)
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 	}
+	s.reported = UsageInfo{}
+	s.sinceReturn = UsageInfo{}
 
 	return &LLMResponse{
-		Content:      strings.TrimSpace(content),
-		ToolCalls:    toolCalls,
-		FinishReason: finishReason,
+		Content:      strings.TrimSpace(resp.Result),
+		FinishReason: "stop",
 		Usage:        usage,
 	}, nil
 }
 
-// extractToolCalls parses tool call JSON from the response text.
-func (p *ClaudeCliProvider) extractToolCalls(text string) []ToolCall {
-	start := strings.Index(text, `{"tool_calls"`)
-	if start == -1 {
-		return nil
-	}
-
-	end := findMatchingBrace(text, start)
-	if end == start {
-		return nil
+func (s *claudeCliSession) readEvents(stdout io.Reader) {
+	defer close(s.events)
+	defer func() {
+		s.waitErr = s.cmd.Wait()
+		if s.mcpConfigPath != "" {
+			os.Remove(s.mcpConfigPath)
+		}
+		close(s.exited)
+	}()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var ev claudeCliEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			s.mu.Lock()
+			if s.parseErr == nil {
+				s.parseErr = fmt.Errorf("failed to parse claude cli response: %w", err)
+			}
+			s.mu.Unlock()
+			continue
+		}
+		ev.raw = append([]byte(nil), line...)
+		select {
+		case s.events <- ev:
+		case <-s.done:
+			// Nobody reads events any more; keep draining stdout so the
+			// killed process can exit and be reaped.
+		}
 	}
+}
 
-	jsonStr := text[start:end]
+// exitError explains why the process stopped without finishing the turn.
+func (s *claudeCliSession) exitError() error {
+	<-s.exited
+	err := s.waitErr
 
-	var wrapper struct {
-		ToolCalls []struct {
-			ID       string `json:"id"`
-			Type     string `json:"type"`
-			Function struct {
-				Name      string `json:"name"`
-				Arguments string `json:"arguments"`
-			} `json:"function"`
-		} `json:"tool_calls"`
+	if stderr := strings.TrimSpace(s.stderr.String()); stderr != "" {
+		return fmt.Errorf("claude cli error: %s", stderr)
 	}
-
-	if err := json.Unmarshal([]byte(jsonStr), &wrapper); err != nil {
-		return nil
+	s.mu.Lock()
+	parseErr := s.parseErr
+	s.mu.Unlock()
+	if parseErr != nil {
+		return parseErr
+	}
+	if err != nil {
+		return fmt.Errorf("claude cli error: %w", err)
 	}
+	return fmt.Errorf("claude cli error: process exited without a result")
+}
 
-	var result []ToolCall
-	for _, tc := range wrapper.ToolCalls {
-		var args map[string]interface{}
-		json.Unmarshal([]byte(tc.Function.Arguments), &args)
+func (s *claudeCliSession) close() {
+	if !s.closed.CompareAndSwap(false, true) {
+		return
+	}
+	close(s.done)
+	s.stdin.Close()
+	if s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
 
-		result = append(result, ToolCall{
-			ID:        tc.ID,
-			Type:      tc.Type,
-			Name:      tc.Function.Name,
-			Arguments: args,
-			Function: &FunctionCall{
-				Name:      tc.Function.Name,
-				Arguments: tc.Function.Arguments,
-			},
-		})
+	s.mu.Lock()
+	for id, call := range s.inflight {
+		call.reply <- claudeCliMCPResult{text: "session closed", isError: true}
+		delete(s.inflight, id)
+	}
+	for _, call := range s.unowned {
+		call.reply <- claudeCliMCPResult{text: "session closed", isError: true}
 	}
+	s.unowned = nil
+	s.mu.Unlock()
+}
 
-	return result
+func trailingToolResults(messages []Message) []Message {
+	i := len(messages)
+	for i > 0 && messages[i-1].Role == "tool" {
+		i--
+	}
+	return messages[i:]
 }
 
-// stripToolCallsJSON removes tool call JSON from response text.
-func (p *ClaudeCliProvider) stripToolCallsJSON(text string) string {
-	start := strings.Index(text, `{"tool_calls"`)
-	if start == -1 {
-		return text
+// newUserInput returns the user messages after the last assistant reply.
+func newUserInput(messages []Message) string {
+	var parts []string
+	for i := len(messages) - 1; i >= 0 && messages[i].Role != "assistant"; i-- {
+		if messages[i].Role == "user" {
+			parts = append([]string{messages[i].Content}, parts...)
+		}
 	}
+	return strings.Join(parts, "\n")
+}
 
-	end := findMatchingBrace(text, start)
-	if end == start {
-		return text
+// newUserImages returns the image parts of the user messages after the last
+// assistant reply; they are sent as image blocks alongside the prompt.
+func newUserImages(messages []Message) []ContentPart {
+	var images []ContentPart
+	for i := len(messages) - 1; i >= 0 && messages[i].Role != "assistant"; i-- {
+		if messages[i].Role != "user" {
+			continue
+		}
+		var msgImages []ContentPart
+		for _, part := range messages[i].Parts {
+			if part.Type == "image_url" && part.ImageURL != nil {
+				msgImages = append(msgImages, part)
+			}
+		}
+		images = append(msgImages, images...)
 	}
+	return images
+}
 
-	return strings.TrimSpace(text[:start] + text[end:])
+func countNonSystem(messages []Message) int {
+	n := 0
+	for _, m := range messages {
+		if m.Role != "system" {
+			n++
+		}
+	}
+	return n
 }
 
-// findMatchingBrace finds the index after the closing brace matching the opening brace at pos.
-func findMatchingBrace(text string, pos int) int {
-	depth := 0
-	for i := pos; i < len(text); i++ {
-		if text[i] == '{' {
-			depth++
-		} else if text[i] == '}' {
-			depth--
-			if depth == 0 {
-				return i + 1
-			}
+func firstNonSystem(messages []Message) string {
+	for _, m := range messages {
+		if m.Role != "system" {
+			return m.Role + ":" + m.Content
 		}
 	}
-	return pos
+	return ""
 }
 
-// claudeCliJSONResponse represents the JSON output from the claude CLI.
+func addUsage(dst, u *UsageInfo) {
+	dst.PromptTokens += u.PromptTokens
+	dst.CompletionTokens += u.CompletionTokens
+	dst.TotalTokens += u.TotalTokens
+	dst.CachedTokens += u.CachedTokens
+}
+
+func canonicalArgs(args map[string]interface{}) string {
+	data, _ := json.Marshal(args)
+	return string(data)
+}
+
+// claudeCliEvent is one line of the CLI's stream-json output.
+type claudeCliEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		ID      string `json:"id"`
+		Content []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			ID    string          `json:"id"`
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
+		} `json:"content"`
+		Usage claudeCliUsageInfo `json:"usage"`
+	} `json:"message"`
+	raw []byte
+}
+
+// claudeCliJSONResponse represents the result event from the claude CLI.
 // Matches the real claude CLI v2.x output format.
 type claudeCliJSONResponse struct {
 	Type         string             `json:"type"`
@@ -273,3 +878,16 @@ type claudeCliUsageInfo struct {
 	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
 	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 }
+
+func (u claudeCliUsageInfo) toUsageInfo() *UsageInfo {
+	if u.InputTokens == 0 && u.OutputTokens == 0 {
+		return nil
+	}
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return &UsageInfo{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+		CachedTokens:     u.CacheReadInputTokens,
+	}
+}
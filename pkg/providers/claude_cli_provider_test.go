@@ -1,12 +1,18 @@
 package providers
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -183,34 +189,6 @@ func TestChat_IsErrorResponse(t *testing.T) {
 	}
 }
 
-func TestChat_WithToolCallsInResponse(t *testing.T) {
-	mockJSON := `{"type":"result","subtype":"success","is_error":false,"result":"Checking weather.\n{\"tool_calls\":[{\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"get_weather\",\"arguments\":\"{\\\"location\\\":\\\"NYC\\\"}\"}}]}","session_id":"s1","total_cost_usd":0.01,"usage":{"input_tokens":5,"output_tokens":20,"cache_creation_input_tokens":0,"cache_read_input_tokens":0}}`
-	script := createMockCLI(t, mockJSON, "", 0)
-
-	p := NewClaudeCliProvider(t.TempDir())
-	p.command = script
-
-	resp, err := p.Chat(context.Background(), []Message{
-		{Role: "user", Content: "What's the weather?"},
-	}, nil, "", nil)
-
-	if err != nil {
-		t.Fatalf("Chat() error = %v", err)
-	}
-	if resp.FinishReason != "tool_calls" {
-		t.Errorf("FinishReason = %q, want %q", resp.FinishReason, "tool_calls")
-	}
-	if len(resp.ToolCalls) != 1 {
-		t.Fatalf("ToolCalls len = %d, want 1", len(resp.ToolCalls))
-	}
-	if resp.ToolCalls[0].Name != "get_weather" {
-		t.Errorf("ToolCalls[0].Name = %q, want %q", resp.ToolCalls[0].Name, "get_weather")
-	}
-	if resp.ToolCalls[0].Arguments["location"] != "NYC" {
-		t.Errorf("ToolCalls[0].Arguments[location] = %v, want NYC", resp.ToolCalls[0].Arguments["location"])
-	}
-}
-
 func TestChat_StderrError(t *testing.T) {
 	script := createMockCLI(t, "", "Error: rate limited", 1)
 
@@ -424,13 +402,28 @@ func TestCreateProvider_ClaudeCli(t *testing.T) {
 		t.Fatalf("CreateProvider(claude-cli) error = %v", err)
 	}
 
-	cliProvider, ok := provider.(*ClaudeCliProvider)
-	if !ok {
-		t.Fatalf("CreateProvider(claude-cli) returned %T, want *ClaudeCliProvider", provider)
-	}
+	cliProvider := meteredClaudeCli(t, provider)
 	if cliProvider.workspace != "/test/ws" {
 		t.Errorf("workspace = %q, want %q", cliProvider.workspace, "/test/ws")
 	}
+	if got := ProviderName(provider); got != "claude-cli" {
+		t.Errorf("ProviderName = %q, want claude-cli", got)
+	}
+}
+
+// meteredClaudeCli returns the Claude CLI provider CreateProvider wrapped
+// in its metrics.
+func meteredClaudeCli(t *testing.T, provider LLMProvider) *ClaudeCliProvider {
+	t.Helper()
+	metered, ok := provider.(*MeteredProvider)
+	if !ok {
+		t.Fatalf("CreateProvider returned %T, want *MeteredProvider", provider)
+	}
+	cliProvider, ok := metered.provider.(*ClaudeCliProvider)
+	if !ok {
+		t.Fatalf("CreateProvider wrapped %T, want *ClaudeCliProvider", metered.provider)
+	}
+	return cliProvider
 }
 
 func TestCreateProvider_ClaudeCode(t *testing.T) {
@@ -441,9 +434,7 @@ func TestCreateProvider_ClaudeCode(t *testing.T) {
 	if err != nil {
 		t.Fatalf("CreateProvider(claude-code) error = %v", err)
 	}
-	if _, ok := provider.(*ClaudeCliProvider); !ok {
-		t.Fatalf("CreateProvider(claude-code) returned %T, want *ClaudeCliProvider", provider)
-	}
+	meteredClaudeCli(t, provider)
 }
 
 func TestCreateProvider_ClaudeCodec(t *testing.T) {
@@ -454,9 +445,7 @@ func TestCreateProvider_ClaudeCodec(t *testing.T) {
 	if err != nil {
 		t.Fatalf("CreateProvider(claudecode) error = %v", err)
 	}
-	if _, ok := provider.(*ClaudeCliProvider); !ok {
-		t.Fatalf("CreateProvider(claudecode) returned %T, want *ClaudeCliProvider", provider)
-	}
+	meteredClaudeCli(t, provider)
 }
 
 func TestCreateProvider_ClaudeCliDefaultWorkspace(t *testing.T) {
@@ -469,10 +458,7 @@ func TestCreateProvider_ClaudeCliDefaultWorkspace(t *testing.T) {
 		t.Fatalf("CreateProvider error = %v", err)
 	}
 
-	cliProvider, ok := provider.(*ClaudeCliProvider)
-	if !ok {
-		t.Fatalf("returned %T, want *ClaudeCliProvider", provider)
-	}
+	cliProvider := meteredClaudeCli(t, provider)
 	if cliProvider.workspace != "." {
 		t.Errorf("workspace = %q, want %q (default)", cliProvider.workspace, ".")
 	}
@@ -561,7 +547,7 @@ func TestBuildSystemPrompt_NoSystemNoTools(t *testing.T) {
 	messages := []Message{
 		{Role: "user", Content: "Hi"},
 	}
-	got := p.buildSystemPrompt(messages, nil)
+	got := p.buildSystemPrompt(messages)
 	if got != "" {
 		t.Errorf("buildSystemPrompt() = %q, want empty", got)
 	}
@@ -573,7 +559,7 @@ func TestBuildSystemPrompt_SystemOnly(t *testing.T) {
 		{Role: "system", Content: "You are helpful."},
 		{Role: "user", Content: "Hi"},
 	}
-	got := p.buildSystemPrompt(messages, nil)
+	got := p.buildSystemPrompt(messages)
 	if got != "You are helpful." {
 		t.Errorf("buildSystemPrompt() = %q, want %q", got, "You are helpful.")
 	}
@@ -586,7 +572,7 @@ func TestBuildSystemPrompt_MultipleSystemMessages(t *testing.T) {
 		{Role: "system", Content: "Be concise."},
 		{Role: "user", Content: "Hi"},
 	}
-	got := p.buildSystemPrompt(messages, nil)
+	got := p.buildSystemPrompt(messages)
 	if !strings.Contains(got, "You are helpful.") {
 		t.Error("missing first system message")
 	}
@@ -600,109 +586,45 @@ func TestBuildSystemPrompt_MultipleSystemMessages(t *testing.T) {
 	}
 }
 
-func TestBuildSystemPrompt_WithTools(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	messages := []Message{
-		{Role: "system", Content: "You are helpful."},
-	}
-	tools := []ToolDefinition{
-		{
-			Type: "function",
-			Function: ToolFunctionDefinition{
-				Name:        "get_weather",
-				Description: "Get weather for a location",
-				Parameters: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"location": map[string]interface{}{"type": "string"},
-					},
-				},
-			},
-		},
-	}
-	got := p.buildSystemPrompt(messages, tools)
-	if !strings.Contains(got, "You are helpful.") {
-		t.Error("buildSystemPrompt() missing system message")
-	}
-	if !strings.Contains(got, "get_weather") {
-		t.Error("buildSystemPrompt() missing tool definition")
-	}
-	if !strings.Contains(got, "Available Tools") {
-		t.Error("buildSystemPrompt() missing tools header")
-	}
-}
-
-func TestBuildSystemPrompt_ToolsOnlyNoSystem(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	tools := []ToolDefinition{
-		{
-			Type: "function",
-			Function: ToolFunctionDefinition{
-				Name:        "test_tool",
-				Description: "A test tool",
-			},
-		},
-	}
-	got := p.buildSystemPrompt(nil, tools)
-	if !strings.Contains(got, "test_tool") {
-		t.Error("should include tool definitions even without system messages")
-	}
-}
-
-// --- buildToolsPrompt tests ---
-
-func TestBuildToolsPrompt_SkipsNonFunction(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	tools := []ToolDefinition{
-		{Type: "other", Function: ToolFunctionDefinition{Name: "skip_me"}},
-		{Type: "function", Function: ToolFunctionDefinition{Name: "include_me", Description: "Included"}},
-	}
-	got := p.buildToolsPrompt(tools)
-	if strings.Contains(got, "skip_me") {
-		t.Error("buildToolsPrompt() should skip non-function tools")
-	}
-	if !strings.Contains(got, "include_me") {
-		t.Error("buildToolsPrompt() should include function tools")
+func TestClaudeCliSession_CloseWithFullBufferReapsProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	cmd := exec.Command("sh", "-c", `i=0; while [ $i -lt 200 ]; do echo '{"type":"system"}'; i=$((i+1)); done; cat`)
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	s := &claudeCliSession{
+		cmd:    cmd,
+		stdin:  stdin,
+		events: make(chan claudeCliEvent, 1),
+		exited: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
 	}
-}
+	go s.readEvents(stdout)
 
-func TestBuildToolsPrompt_NoDescription(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	tools := []ToolDefinition{
-		{Type: "function", Function: ToolFunctionDefinition{Name: "bare_tool"}},
-	}
-	got := p.buildToolsPrompt(tools)
-	if !strings.Contains(got, "bare_tool") {
-		t.Error("should include tool name")
-	}
-	if strings.Contains(got, "Description:") {
-		t.Error("should not include Description: line when empty")
-	}
-}
+	// Let the reader fill the buffer and block, then close with nobody reading.
+	time.Sleep(50 * time.Millisecond)
+	s.close()
 
-func TestBuildToolsPrompt_NoParameters(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	tools := []ToolDefinition{
-		{Type: "function", Function: ToolFunctionDefinition{
-			Name:        "no_params_tool",
-			Description: "A tool with no parameters",
-		}},
-	}
-	got := p.buildToolsPrompt(tools)
-	if strings.Contains(got, "Parameters:") {
-		t.Error("should not include Parameters: section when nil")
+	select {
+	case <-s.exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("readEvents blocked after close; process not reaped")
 	}
 }
 
-// --- parseClaudeCliResponse tests ---
+// --- onResult tests ---
 
-func TestParseClaudeCliResponse_TextOnly(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
+func TestOnResult_TextOnly(t *testing.T) {
+	s := &claudeCliSession{}
 	output := `{"type":"result","subtype":"success","is_error":false,"result":"Hello, world!","session_id":"abc123","total_cost_usd":0.01,"duration_ms":500,"usage":{"input_tokens":10,"output_tokens":20,"cache_creation_input_tokens":0,"cache_read_input_tokens":0}}`
 
-	resp, err := p.parseClaudeCliResponse(output)
+	resp, err := s.onResult([]byte(output))
 	if err != nil {
-		t.Fatalf("parseClaudeCliResponse() error = %v", err)
+		t.Fatalf("onResult() error = %v", err)
 	}
 	if resp.Content != "Hello, world!" {
 		t.Errorf("Content = %q, want %q", resp.Content, "Hello, world!")
@@ -724,11 +646,27 @@ func TestParseClaudeCliResponse_TextOnly(t *testing.T) {
 	}
 }
 
-func TestParseClaudeCliResponse_EmptyResult(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
+func TestOnResult_SubtractsReportedUsage(t *testing.T) {
+	s := &claudeCliSession{reported: UsageInfo{PromptTokens: 4, CompletionTokens: 5}}
+	output := `{"type":"result","result":"done","usage":{"input_tokens":10,"output_tokens":20}}`
+
+	resp, err := s.onResult([]byte(output))
+	if err != nil {
+		t.Fatalf("onResult() error = %v", err)
+	}
+	if resp.Usage == nil || resp.Usage.PromptTokens != 6 || resp.Usage.CompletionTokens != 15 || resp.Usage.TotalTokens != 21 {
+		t.Errorf("Usage = %+v, want 6 prompt + 15 completion", resp.Usage)
+	}
+	if s.reported != (UsageInfo{}) {
+		t.Errorf("reported = %+v, want reset", s.reported)
+	}
+}
+
+func TestOnResult_EmptyResult(t *testing.T) {
+	s := &claudeCliSession{}
 	output := `{"type":"result","subtype":"success","is_error":false,"result":"","session_id":"abc"}`
 
-	resp, err := p.parseClaudeCliResponse(output)
+	resp, err := s.onResult([]byte(output))
 	if err != nil {
 		t.Fatalf("error = %v", err)
 	}
@@ -740,11 +678,11 @@ func TestParseClaudeCliResponse_EmptyResult(t *testing.T) {
 	}
 }
 
-func TestParseClaudeCliResponse_IsError(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
+func TestOnResult_IsError(t *testing.T) {
+	s := &claudeCliSession{}
 	output := `{"type":"result","subtype":"error","is_error":true,"result":"Something went wrong","session_id":"abc"}`
 
-	_, err := p.parseClaudeCliResponse(output)
+	_, err := s.onResult([]byte(output))
 	if err == nil {
 		t.Fatal("expected error when is_error=true")
 	}
@@ -753,11 +691,11 @@ func TestParseClaudeCliResponse_IsError(t *testing.T) {
 	}
 }
 
-func TestParseClaudeCliResponse_NoUsage(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
+func TestOnResult_NoUsage(t *testing.T) {
+	s := &claudeCliSession{}
 	output := `{"type":"result","subtype":"success","is_error":false,"result":"hi","session_id":"s"}`
 
-	resp, err := p.parseClaudeCliResponse(output)
+	resp, err := s.onResult([]byte(output))
 	if err != nil {
 		t.Fatalf("error = %v", err)
 	}
@@ -766,9 +704,9 @@ func TestParseClaudeCliResponse_NoUsage(t *testing.T) {
 	}
 }
 
-func TestParseClaudeCliResponse_InvalidJSON(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	_, err := p.parseClaudeCliResponse("not json")
+func TestOnResult_InvalidJSON(t *testing.T) {
+	s := &claudeCliSession{}
+	_, err := s.onResult([]byte("not json"))
 	if err == nil {
 		t.Fatal("expected error for invalid JSON")
 	}
@@ -777,46 +715,11 @@ func TestParseClaudeCliResponse_InvalidJSON(t *testing.T) {
 	}
 }
 
-func TestParseClaudeCliResponse_WithToolCalls(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	output := `{"type":"result","subtype":"success","is_error":false,"result":"Let me check.\n{\"tool_calls\":[{\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"get_weather\",\"arguments\":\"{\\\"location\\\":\\\"Tokyo\\\"}\"}}]}","session_id":"abc123","total_cost_usd":0.01}`
-
-	resp, err := p.parseClaudeCliResponse(output)
-	if err != nil {
-		t.Fatalf("error = %v", err)
-	}
-	if resp.FinishReason != "tool_calls" {
-		t.Errorf("FinishReason = %q, want %q", resp.FinishReason, "tool_calls")
-	}
-	if len(resp.ToolCalls) != 1 {
-		t.Fatalf("ToolCalls = %d, want 1", len(resp.ToolCalls))
-	}
-	tc := resp.ToolCalls[0]
-	if tc.Name != "get_weather" {
-		t.Errorf("Name = %q, want %q", tc.Name, "get_weather")
-	}
-	if tc.Function == nil {
-		t.Fatal("Function is nil")
-	}
-	if tc.Function.Name != "get_weather" {
-		t.Errorf("Function.Name = %q, want %q", tc.Function.Name, "get_weather")
-	}
-	if tc.Arguments["location"] != "Tokyo" {
-		t.Errorf("Arguments[location] = %v, want Tokyo", tc.Arguments["location"])
-	}
-	if strings.Contains(resp.Content, "tool_calls") {
-		t.Errorf("Content should not contain tool_calls JSON, got %q", resp.Content)
-	}
-	if resp.Content != "Let me check." {
-		t.Errorf("Content = %q, want %q", resp.Content, "Let me check.")
-	}
-}
-
-func TestParseClaudeCliResponse_WhitespaceResult(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
+func TestOnResult_WhitespaceResult(t *testing.T) {
+	s := &claudeCliSession{}
 	output := `{"type":"result","subtype":"success","is_error":false,"result":"  hello  \n  ","session_id":"s"}`
 
-	resp, err := p.parseClaudeCliResponse(output)
+	resp, err := s.onResult([]byte(output))
 	if err != nil {
 		t.Fatalf("error = %v", err)
 	}
@@ -825,157 +728,286 @@ func TestParseClaudeCliResponse_WhitespaceResult(t *testing.T) {
 	}
 }
 
-// --- extractToolCalls tests ---
+// --- Streaming session tests ---
 
-func TestExtractToolCalls_NoToolCalls(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	got := p.extractToolCalls("Just a regular response.")
-	if len(got) != 0 {
-		t.Errorf("extractToolCalls() = %d, want 0", len(got))
+// createStreamingMockCLI wraps the test binary as a fake claude CLI that
+// speaks stream-json and calls picoclaw tools over the MCP bridge.
+func createStreamingMockCLI(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("mock CLI scripts not supported on Windows")
 	}
-}
 
-func TestExtractToolCalls_WithToolCalls(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	text := `Here's the result:
-{"tool_calls":[{"id":"call_1","type":"function","function":{"name":"test","arguments":"{}"}}]}`
+	script := filepath.Join(t.TempDir(), "claude")
+	content := fmt.Sprintf("#!/bin/sh\nGO_WANT_CLAUDE_CLI_HELPER=1 exec '%s' -test.run=TestClaudeCliHelperProcess -- \"$@\"\n", os.Args[0])
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
 
-	got := p.extractToolCalls(text)
-	if len(got) != 1 {
-		t.Fatalf("extractToolCalls() = %d, want 1", len(got))
+// TestClaudeCliHelperProcess is not a real test: it is the fake CLI process.
+// The first user message triggers a get_weather tool call over MCP; later
+// messages are answered directly with a turn counter.
+func TestClaudeCliHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_CLAUDE_CLI_HELPER") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	var mcpURL, mcpAuth string
+	args := os.Args
+	for i, a := range args {
+		if a == "--mcp-config" && i+1 < len(args) {
+			var cfg struct {
+				MCPServers map[string]struct {
+					URL     string            `json:"url"`
+					Headers map[string]string `json:"headers"`
+				} `json:"mcpServers"`
+			}
+			data, _ := os.ReadFile(args[i+1])
+			json.Unmarshal(data, &cfg)
+			mcpURL = cfg.MCPServers["picoclaw"].URL
+			mcpAuth = cfg.MCPServers["picoclaw"].Headers["Authorization"]
+		}
 	}
-	if got[0].ID != "call_1" {
-		t.Errorf("ID = %q, want %q", got[0].ID, "call_1")
+
+	emit := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		fmt.Println(string(data))
 	}
-	if got[0].Name != "test" {
-		t.Errorf("Name = %q, want %q", got[0].Name, "test")
+	rpc := func(method string, params interface{}) map[string]interface{} {
+		body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+		req, _ := http.NewRequest(http.MethodPost, mcpURL, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", mcpAuth)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "MCP %s: status %d", method, resp.StatusCode)
+			os.Exit(1)
+		}
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return out
 	}
-	if got[0].Type != "function" {
-		t.Errorf("Type = %q, want %q", got[0].Type, "function")
+	usage := map[string]int{"input_tokens": 10, "output_tokens": 5}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for turn := 1; scanner.Scan(); turn++ {
+		if turn > 1 {
+			emit(map[string]interface{}{"type": "result", "result": fmt.Sprintf("turn %d", turn), "usage": usage})
+			continue
+		}
+
+		emit(map[string]interface{}{"type": "assistant", "message": map[string]interface{}{
+			"id": "msg_1",
+			"content": []map[string]interface{}{
+				{"type": "text", "text": "Checking."},
+				{"type": "tool_use", "id": "toolu_1", "name": "mcp__picoclaw__get_weather", "input": map[string]string{"city": "SF"}},
+			},
+			"usage": usage,
+		}})
+
+		rpc("initialize", map[string]string{"protocolVersion": "2025-03-26"})
+		list := rpc("tools/list", nil)
+		tools := list["result"].(map[string]interface{})["tools"].([]interface{})
+		if len(tools) != 1 {
+			fmt.Fprintf(os.Stderr, "tools/list returned %d tools", len(tools))
+			os.Exit(1)
+		}
+		call := rpc("tools/call", map[string]interface{}{"name": "get_weather", "arguments": map[string]string{"city": "SF"}})
+		content := call["result"].(map[string]interface{})["content"].([]interface{})
+		text := content[0].(map[string]interface{})["text"].(string)
+
+		emit(map[string]interface{}{"type": "result", "result": "Weather: " + text,
+			"usage": map[string]int{"input_tokens": 30, "output_tokens": 12}})
 	}
 }
 
-func TestExtractToolCalls_InvalidJSON(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	got := p.extractToolCalls(`{"tool_calls":invalid}`)
-	if len(got) != 0 {
-		t.Errorf("extractToolCalls() with invalid JSON = %d, want 0", len(got))
+func TestClaudeCliMCPBridge_RequiresToken(t *testing.T) {
+	s := &claudeCliSession{key: "telegram:1", mcpToken: "secret"}
+	bridge, err := newClaudeCliMCPBridge(func(key string) *claudeCliSession {
+		if key == s.key {
+			return s
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
 	}
-}
+	defer bridge.close()
 
-func TestExtractToolCalls_MultipleToolCalls(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	text := `{"tool_calls":[{"id":"call_1","type":"function","function":{"name":"read_file","arguments":"{\"path\":\"/tmp/test\"}"}},{"id":"call_2","type":"function","function":{"name":"write_file","arguments":"{\"path\":\"/tmp/out\",\"content\":\"hello\"}"}}]}`
+	body := `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`
+	for _, tt := range []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, bridge.url(s.key), strings.NewReader(body))
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("Authorization %q: status %d, want %d", tt.auth, resp.StatusCode, tt.want)
+		}
+	}
+}
 
-	got := p.extractToolCalls(text)
-	if len(got) != 2 {
-		t.Fatalf("extractToolCalls() = %d, want 2", len(got))
+func TestChat_NativeToolCallAndSessionReuse(t *testing.T) {
+	p := NewClaudeCliProvider(t.TempDir())
+	p.command = createStreamingMockCLI(t)
+	defer p.Close()
+
+	ctx := context.Background()
+	opts := map[string]interface{}{SessionKeyOption: "telegram:1"}
+	tools := []ToolDefinition{{
+		Type: "function",
+		Function: ToolFunctionDefinition{
+			Name:       "get_weather",
+			Parameters: map[string]interface{}{"type": "object"},
+		},
+	}}
+	messages := []Message{
+		{Role: "system", Content: "Be helpful."},
+		{Role: "user", Content: "Weather in SF?"},
 	}
-	if got[0].Name != "read_file" {
-		t.Errorf("[0].Name = %q, want %q", got[0].Name, "read_file")
+
+	resp, err := p.Chat(ctx, messages, tools, "", opts)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
 	}
-	if got[1].Name != "write_file" {
-		t.Errorf("[1].Name = %q, want %q", got[1].Name, "write_file")
+	if resp.FinishReason != "tool_calls" || len(resp.ToolCalls) != 1 {
+		t.Fatalf("got %q with %d tool calls, want one tool call", resp.FinishReason, len(resp.ToolCalls))
 	}
-	// Verify arguments were parsed
-	if got[0].Arguments["path"] != "/tmp/test" {
-		t.Errorf("[0].Arguments[path] = %v, want /tmp/test", got[0].Arguments["path"])
+	tc := resp.ToolCalls[0]
+	if tc.ID != "toolu_1" || tc.Name != "get_weather" || tc.Arguments["city"] != "SF" {
+		t.Errorf("ToolCall = %+v, want toolu_1 get_weather(city=SF)", tc)
 	}
-	if got[1].Arguments["content"] != "hello" {
-		t.Errorf("[1].Arguments[content] = %v, want hello", got[1].Arguments["content"])
+	if resp.Content != "Checking." {
+		t.Errorf("Content = %q, want %q", resp.Content, "Checking.")
 	}
-}
-
-func TestExtractToolCalls_UnmatchedBrace(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	got := p.extractToolCalls(`{"tool_calls":[{"id":"call_1"`)
-	if len(got) != 0 {
-		t.Errorf("extractToolCalls() with unmatched brace = %d, want 0", len(got))
+	if resp.Usage == nil || resp.Usage.TotalTokens != 15 {
+		t.Errorf("Usage = %+v, want 15 total tokens", resp.Usage)
 	}
-}
 
-func TestExtractToolCalls_ToolCallArgumentsParsing(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	text := `{"tool_calls":[{"id":"c1","type":"function","function":{"name":"fn","arguments":"{\"num\":42,\"flag\":true,\"name\":\"test\"}"}}]}`
-
-	got := p.extractToolCalls(text)
-	if len(got) != 1 {
-		t.Fatalf("len = %d, want 1", len(got))
+	messages = append(messages,
+		Message{Role: "assistant", Content: resp.Content, ToolCalls: resp.ToolCalls},
+		Message{Role: "tool", Content: "Sunny", ToolCallID: tc.ID},
+	)
+	resp, err = p.Chat(ctx, messages, tools, "", opts)
+	if err != nil {
+		t.Fatalf("Chat() with tool result error = %v", err)
 	}
-	// Verify different argument types
-	if got[0].Arguments["num"] != float64(42) {
-		t.Errorf("Arguments[num] = %v (%T), want 42", got[0].Arguments["num"], got[0].Arguments["num"])
+	if resp.Content != "Weather: Sunny" {
+		t.Errorf("Content = %q, want %q", resp.Content, "Weather: Sunny")
 	}
-	if got[0].Arguments["flag"] != true {
-		t.Errorf("Arguments[flag] = %v, want true", got[0].Arguments["flag"])
+	// Result usage covers the whole turn; the tool-call step was already reported.
+	if resp.Usage == nil || resp.Usage.TotalTokens != 27 {
+		t.Errorf("Usage = %+v, want 27 total tokens", resp.Usage)
 	}
-	if got[0].Arguments["name"] != "test" {
-		t.Errorf("Arguments[name] = %v, want test", got[0].Arguments["name"])
+
+	messages = append(messages,
+		Message{Role: "assistant", Content: resp.Content},
+		Message{Role: "user", Content: "Thanks"},
+	)
+	resp, err = p.Chat(ctx, messages, tools, "", opts)
+	if err != nil {
+		t.Fatalf("Chat() second turn error = %v", err)
 	}
-	// Verify raw arguments string is preserved in FunctionCall
-	if got[0].Function.Arguments == "" {
-		t.Error("Function.Arguments should contain raw JSON string")
+	if resp.Content != "turn 2" {
+		t.Errorf("Content = %q, want %q (same process should be reused)", resp.Content, "turn 2")
 	}
 }
 
-// --- stripToolCallsJSON tests ---
-
-func TestStripToolCallsJSON(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	text := `Let me check the weather.
-{"tool_calls":[{"id":"call_1","type":"function","function":{"name":"test","arguments":"{}"}}]}
-Done.`
-
-	got := p.stripToolCallsJSON(text)
-	if strings.Contains(got, "tool_calls") {
-		t.Errorf("should remove tool_calls JSON, got %q", got)
-	}
-	if !strings.Contains(got, "Let me check the weather.") {
-		t.Errorf("should keep text before, got %q", got)
+func TestChat_EvictsLeastRecentlyUsedSession(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock CLI scripts not supported on Windows")
 	}
-	if !strings.Contains(got, "Done.") {
-		t.Errorf("should keep text after, got %q", got)
+	script := filepath.Join(t.TempDir(), "claude")
+	content := "#!/bin/sh\nwhile read line; do echo '{\"type\":\"result\",\"result\":\"ok\"}'; done\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
 	}
-}
 
-func TestStripToolCallsJSON_NoToolCalls(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	text := "Just regular text."
-	got := p.stripToolCallsJSON(text)
-	if got != text {
-		t.Errorf("stripToolCallsJSON() = %q, want %q", got, text)
+	p := NewClaudeCliProvider(t.TempDir())
+	p.command = script
+	p.maxSessions = 2
+	defer p.Close()
+
+	messages := []Message{{Role: "user", Content: "Hi"}}
+	for _, key := range []string{"a", "b", "c"} {
+		opts := map[string]interface{}{SessionKeyOption: key}
+		if _, err := p.Chat(context.Background(), messages, nil, "", opts); err != nil {
+			t.Fatalf("Chat(%s) error = %v", key, err)
+		}
 	}
-}
 
-func TestStripToolCallsJSON_OnlyToolCalls(t *testing.T) {
-	p := NewClaudeCliProvider("/workspace")
-	text := `{"tool_calls":[{"id":"c1","type":"function","function":{"name":"fn","arguments":"{}"}}]}`
-	got := p.stripToolCallsJSON(text)
-	if got != "" {
-		t.Errorf("stripToolCallsJSON() = %q, want empty", got)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.sessions) != 2 || p.sessions["a"] != nil {
+		keys := make([]string, 0, len(p.sessions))
+		for k := range p.sessions {
+			keys = append(keys, k)
+		}
+		t.Errorf("sessions = %v, want [b c]", keys)
 	}
 }
 
-// --- findMatchingBrace tests ---
+func TestChat_ConcurrentTurnsShareSession(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock CLI scripts not supported on Windows")
+	}
+	script := filepath.Join(t.TempDir(), "claude")
+	content := "#!/bin/sh\nwhile read line; do echo '{\"type\":\"result\",\"result\":\"ok\"}'; done\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
 
-func TestFindMatchingBrace(t *testing.T) {
-	tests := []struct {
-		text string
-		pos  int
-		want int
-	}{
-		{`{"a":1}`, 0, 7},
-		{`{"a":{"b":2}}`, 0, 13},
-		{`text {"a":1} more`, 5, 12},
-		{`{unclosed`, 0, 0},      // no match returns pos
-		{`{}`, 0, 2},             // empty object
-		{`{{{}}}`, 0, 6},         // deeply nested
-		{`{"a":"b{c}d"}`, 0, 13}, // braces in strings (simplified matcher)
-	}
-	for _, tt := range tests {
-		got := findMatchingBrace(tt.text, tt.pos)
-		if got != tt.want {
-			t.Errorf("findMatchingBrace(%q, %d) = %d, want %d", tt.text, tt.pos, got, tt.want)
+	p := NewClaudeCliProvider(t.TempDir())
+	p.command = script
+	defer p.Close()
+
+	started := make(map[*claudeCliSession]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			messages := []Message{{Role: "user", Content: "Hi"}}
+			for j := 0; j < n; j++ {
+				messages = append(messages, Message{Role: "assistant", Content: "ok"}, Message{Role: "user", Content: "again"})
+			}
+			s, _, err := p.sessionFor("same", false, messages, nil, "")
+			if err != nil {
+				t.Errorf("sessionFor() error = %v", err)
+				return
+			}
+			mu.Lock()
+			started[s] = true
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	// Histories of different lengths may restart the session, but every
+	// replaced process must have been stopped, never leaked.
+	for s := range started {
+		if p.lookupSession("same") != s && s.alive() {
+			t.Error("replaced session is still running")
 		}
 	}
 }
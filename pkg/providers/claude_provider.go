@@ -69,6 +69,10 @@ func buildClaudeParams(messages []Message, tools []ToolDefinition, model string,
 				anthropicMessages = append(anthropicMessages,
 					anthropic.NewUserMessage(anthropic.NewToolResultBlock(msg.ToolCallID, msg.Content, false)),
 				)
+			} else if len(msg.Parts) > 0 {
+				anthropicMessages = append(anthropicMessages,
+					anthropic.NewUserMessage(translatePartsForClaude(msg.Parts)...),
+				)
 			} else {
 				anthropicMessages = append(anthropicMessages,
 					anthropic.NewUserMessage(anthropic.NewTextBlock(msg.Content)),
@@ -76,12 +80,25 @@ func buildClaudeParams(messages []Message, tools []ToolDefinition, model string,
 			}
 		case "assistant":
 			if len(msg.ToolCalls) > 0 {
-				var blocks []anthropic.ContentBlockParamUnion
+				// Thinking blocks must precede text and tool_use blocks, unchanged.
+				blocks := translateThinkingForClaude(msg.ThinkingBlocks)
 				if msg.Content != "" {
 					blocks = append(blocks, anthropic.NewTextBlock(msg.Content))
 				}
 				for _, tc := range msg.ToolCalls {
-					blocks = append(blocks, anthropic.NewToolUseBlock(tc.ID, tc.Arguments, tc.Name))
+					name, args := tc.Name, tc.Arguments
+					if tc.Function != nil {
+						if name == "" {
+							name = tc.Function.Name
+						}
+						if args == nil && tc.Function.Arguments != "" {
+							json.Unmarshal([]byte(tc.Function.Arguments), &args)
+						}
+					}
+					if args == nil {
+						args = map[string]interface{}{}
+					}
+					blocks = append(blocks, anthropic.NewToolUseBlock(tc.ID, args, name))
 				}
 				anthropicMessages = append(anthropicMessages, anthropic.NewAssistantMessage(blocks...))
 			} else {
@@ -111,7 +128,17 @@ func buildClaudeParams(messages []Message, tools []ToolDefinition, model string,
 		params.System = system
 	}
 
-	if temp, ok := options["temperature"].(float64); ok {
+	if budget := reasoningBudget(options); budget > 0 {
+		// Anthropic requires budget_tokens >= 1024 and < max_tokens, and
+		// rejects any temperature other than the default while thinking.
+		if budget < 1024 {
+			budget = 1024
+		}
+		if int64(budget) >= maxTokens {
+			params.MaxTokens = int64(budget) + maxTokens
+		}
+		params.Thinking = anthropic.ThinkingConfigParamOfEnabled(int64(budget))
+	} else if temp, ok := options["temperature"].(float64); ok {
 		params.Temperature = anthropic.Float(temp)
 	}
 
@@ -122,6 +149,45 @@ func buildClaudeParams(messages []Message, tools []ToolDefinition, model string,
 	return params, nil
 }
 
+// translatePartsForClaude maps multimodal parts to text and image blocks.
+// Data URIs become base64 sources; other URLs are fetched by Anthropic.
+func translatePartsForClaude(parts []ContentPart) []anthropic.ContentBlockParamUnion {
+	blocks := make([]anthropic.ContentBlockParamUnion, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				blocks = append(blocks, anthropic.NewTextBlock(part.Text))
+			}
+		case "image_url":
+			if part.ImageURL == nil {
+				continue
+			}
+			if mediaType, data, ok := splitDataURI(part.ImageURL.URL); ok {
+				blocks = append(blocks, anthropic.NewImageBlockBase64(mediaType, data))
+			} else {
+				blocks = append(blocks, anthropic.NewImageBlock(anthropic.URLImageSourceParam{URL: part.ImageURL.URL}))
+			}
+		}
+	}
+	if len(blocks) == 0 {
+		blocks = append(blocks, anthropic.NewTextBlock(""))
+	}
+	return blocks
+}
+
+func translateThinkingForClaude(thinking []ThinkingBlock) []anthropic.ContentBlockParamUnion {
+	blocks := make([]anthropic.ContentBlockParamUnion, 0, len(thinking))
+	for _, tb := range thinking {
+		if tb.Data != "" {
+			blocks = append(blocks, anthropic.NewRedactedThinkingBlock(tb.Data))
+		} else {
+			blocks = append(blocks, anthropic.NewThinkingBlock(tb.Signature, tb.Thinking))
+		}
+	}
+	return blocks
+}
+
 func translateToolsForClaude(tools []ToolDefinition) []anthropic.ToolUnionParam {
 	result := make([]anthropic.ToolUnionParam, 0, len(tools))
 	for _, t := range tools {
@@ -149,11 +215,18 @@ func translateToolsForClaude(tools []ToolDefinition) []anthropic.ToolUnionParam
 }
 
 func parseClaudeResponse(resp *anthropic.Message) *LLMResponse {
-	var content string
+	var content, reasoning string
+	var thinking []ThinkingBlock
 	var toolCalls []ToolCall
 
 	for _, block := range resp.Content {
 		switch block.Type {
+		case "thinking":
+			tb := block.AsThinking()
+			reasoning += tb.Thinking
+			thinking = append(thinking, ThinkingBlock{Thinking: tb.Thinking, Signature: tb.Signature})
+		case "redacted_thinking":
+			thinking = append(thinking, ThinkingBlock{Data: block.AsRedactedThinking().Data})
 		case "text":
 			tb := block.AsText()
 			content += tb.Text
@@ -181,14 +254,21 @@ func parseClaudeResponse(resp *anthropic.Message) *LLMResponse {
 		finishReason = "stop"
 	}
 
+	// Anthropic reports cache reads and writes separately from input_tokens;
+	// fold them in so PromptTokens means the same thing for every provider.
+	promptTokens := resp.Usage.InputTokens + resp.Usage.CacheReadInputTokens + resp.Usage.CacheCreationInputTokens
+
 	return &LLMResponse{
-		Content:      content,
-		ToolCalls:    toolCalls,
-		FinishReason: finishReason,
+		Content:        content,
+		Reasoning:      reasoning,
+		ThinkingBlocks: thinking,
+		ToolCalls:      toolCalls,
+		FinishReason:   finishReason,
 		Usage: &UsageInfo{
-			PromptTokens:     int(resp.Usage.InputTokens),
+			PromptTokens:     int(promptTokens),
 			CompletionTokens: int(resp.Usage.OutputTokens),
-			TotalTokens:      int(resp.Usage.InputTokens + resp.Usage.OutputTokens),
+			TotalTokens:      int(promptTokens + resp.Usage.OutputTokens),
+			CachedTokens:     int(resp.Usage.CacheReadInputTokens),
 		},
 	}
 }
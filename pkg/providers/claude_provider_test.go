@@ -31,6 +31,35 @@ func TestBuildClaudeParams_BasicMessage(t *testing.T) {
 	}
 }
 
+func TestBuildClaudeParams_ImageParts(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "What is this?", Parts: []ContentPart{
+			{Type: "text", Text: "What is this?"},
+			{Type: "image_url", ImageURL: &ImageURL{URL: "data:image/png;base64,iVBORw0KGgo="}},
+			{Type: "image_url", ImageURL: &ImageURL{URL: "https://example.com/cat.jpg"}},
+		}},
+	}
+	params, err := buildClaudeParams(messages, nil, "claude-sonnet-4-5-20250929", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("buildClaudeParams() error: %v", err)
+	}
+
+	blocks := params.Messages[0].Content
+	if len(blocks) != 3 {
+		t.Fatalf("len(Content) = %d, want 3", len(blocks))
+	}
+	if blocks[0].OfText == nil || blocks[0].OfText.Text != "What is this?" {
+		t.Errorf("Content[0] should be the text block")
+	}
+	b64 := blocks[1].OfImage.Source.OfBase64
+	if b64 == nil || b64.MediaType != "image/png" || b64.Data != "iVBORw0KGgo=" {
+		t.Errorf("Content[1] = %+v, want base64 png source", blocks[1].OfImage)
+	}
+	if u := blocks[2].OfImage.Source.OfURL; u == nil || u.URL != "https://example.com/cat.jpg" {
+		t.Errorf("Content[2] should be a URL image source")
+	}
+}
+
 func TestBuildClaudeParams_SystemMessage(t *testing.T) {
 	messages := []Message{
 		{Role: "system", Content: "You are helpful"},
@@ -102,6 +131,62 @@ func TestBuildClaudeParams_WithTools(t *testing.T) {
 	}
 }
 
+func TestBuildClaudeParams_ReasoningBudget(t *testing.T) {
+	params, err := buildClaudeParams([]Message{{Role: "user", Content: "Hi"}}, nil, "claude-sonnet-4-5-20250929", map[string]interface{}{
+		"max_tokens":          4096,
+		"temperature":         0.7,
+		ReasoningBudgetOption: 8192,
+	})
+	if err != nil {
+		t.Fatalf("buildClaudeParams() error: %v", err)
+	}
+	if params.Thinking.OfEnabled == nil {
+		t.Fatal("Thinking not enabled")
+	}
+	if params.Thinking.OfEnabled.BudgetTokens != 8192 {
+		t.Errorf("BudgetTokens = %d, want 8192", params.Thinking.OfEnabled.BudgetTokens)
+	}
+	if params.MaxTokens <= 8192 {
+		t.Errorf("MaxTokens = %d, want > budget", params.MaxTokens)
+	}
+	if params.Temperature.Valid() {
+		t.Error("Temperature should not be set while thinking")
+	}
+}
+
+func TestBuildClaudeParams_ThinkingBlocksPreserved(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "What's the weather?"},
+		{
+			Role:           "assistant",
+			ThinkingBlocks: []ThinkingBlock{{Thinking: "need weather", Signature: "sig"}, {Data: "opaque"}},
+			ToolCalls: []ToolCall{{
+				ID:       "call_1",
+				Type:     "function",
+				Function: &FunctionCall{Name: "get_weather", Arguments: `{"city":"SF"}`},
+			}},
+		},
+		{Role: "tool", Content: "Sunny", ToolCallID: "call_1"},
+	}
+	params, err := buildClaudeParams(messages, nil, "claude-sonnet-4-5-20250929", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("buildClaudeParams() error: %v", err)
+	}
+	blocks := params.Messages[1].Content
+	if len(blocks) != 3 {
+		t.Fatalf("len(Content) = %d, want 3", len(blocks))
+	}
+	if blocks[0].OfThinking == nil || blocks[0].OfThinking.Signature != "sig" {
+		t.Errorf("first block should be signed thinking, got %+v", blocks[0])
+	}
+	if blocks[1].OfRedactedThinking == nil || blocks[1].OfRedactedThinking.Data != "opaque" {
+		t.Errorf("second block should be redacted thinking, got %+v", blocks[1])
+	}
+	if blocks[2].OfToolUse == nil || blocks[2].OfToolUse.Name != "get_weather" {
+		t.Errorf("third block should be tool_use get_weather, got %+v", blocks[2])
+	}
+}
+
 func TestParseClaudeResponse_TextOnly(t *testing.T) {
 	resp := &anthropic.Message{
 		Content: []anthropic.ContentBlockUnion{},
@@ -9,6 +9,7 @@ import (
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
 	"github.com/openai/openai-go/v3/responses"
+	"github.com/openai/openai-go/v3/shared"
 	"github.com/sipeed/picoclaw/pkg/auth"
 )
 
@@ -97,6 +98,13 @@ func buildCodexParams(messages []Message, tools []ToolDefinition, model string,
 						Output: responses.ResponseInputItemFunctionCallOutputOutputUnionParam{OfString: openai.Opt(msg.Content)},
 					},
 				})
+			} else if len(msg.Parts) > 0 {
+				inputItems = append(inputItems, responses.ResponseInputItemUnionParam{
+					OfMessage: &responses.EasyInputMessageParam{
+						Role:    responses.EasyInputMessageRoleUser,
+						Content: responses.EasyInputMessageContentUnionParam{OfInputItemContentList: translatePartsForCodex(msg.Parts)},
+					},
+				})
 			} else {
 				inputItems = append(inputItems, responses.ResponseInputItemUnionParam{
 					OfMessage: &responses.EasyInputMessageParam{
@@ -179,6 +187,13 @@ func buildCodexParams(messages []Message, tools []ToolDefinition, model string,
 		}
 	}
 
+	if budget := reasoningBudget(options); budget > 0 && isReasoningModel(model) {
+		params.Reasoning = shared.ReasoningParam{
+			Effort:  shared.ReasoningEffort(reasoningEffort(budget)),
+			Summary: shared.ReasoningSummaryAuto,
+		}
+	}
+
 	if len(tools) > 0 {
 		params.Tools = translateToolsForCodex(tools)
 	}
@@ -186,6 +201,37 @@ func buildCodexParams(messages []Message, tools []ToolDefinition, model string,
 	return params
 }
 
+// translatePartsForCodex maps multimodal parts to input_text and
+// input_image items; the Responses API accepts data URIs as image URLs.
+func translatePartsForCodex(parts []ContentPart) responses.ResponseInputMessageContentListParam {
+	content := make(responses.ResponseInputMessageContentListParam, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				content = append(content, responses.ResponseInputContentUnionParam{
+					OfInputText: &responses.ResponseInputTextParam{Text: part.Text},
+				})
+			}
+		case "image_url":
+			if part.ImageURL == nil {
+				continue
+			}
+			detail := responses.ResponseInputImageDetail(part.ImageURL.Detail)
+			if detail == "" {
+				detail = responses.ResponseInputImageDetailAuto
+			}
+			content = append(content, responses.ResponseInputContentUnionParam{
+				OfInputImage: &responses.ResponseInputImageParam{
+					ImageURL: openai.String(part.ImageURL.URL),
+					Detail:   detail,
+				},
+			})
+		}
+	}
+	return content
+}
+
 func translateToolsForCodex(tools []ToolDefinition) []responses.ToolUnionParam {
 	result := make([]responses.ToolUnionParam, 0, len(tools))
 	for _, t := range tools {
@@ -203,11 +249,18 @@ func translateToolsForCodex(tools []ToolDefinition) []responses.ToolUnionParam {
 }
 
 func parseCodexResponse(resp *responses.Response) *LLMResponse {
-	var content strings.Builder
+	var content, reasoning strings.Builder
 	var toolCalls []ToolCall
 
 	for _, item := range resp.Output {
 		switch item.Type {
+		case "reasoning":
+			for _, s := range item.Summary {
+				if reasoning.Len() > 0 {
+					reasoning.WriteString("\n\n")
+				}
+				reasoning.WriteString(s.Text)
+			}
 		case "message":
 			for _, c := range item.Content {
 				if c.Type == "output_text" {
@@ -241,11 +294,13 @@ func parseCodexResponse(resp *responses.Response) *LLMResponse {
 			PromptTokens:     int(resp.Usage.InputTokens),
 			CompletionTokens: int(resp.Usage.OutputTokens),
 			TotalTokens:      int(resp.Usage.TotalTokens),
+			CachedTokens:     int(resp.Usage.InputTokensDetails.CachedTokens),
 		}
 	}
 
 	return &LLMResponse{
 		Content:      content.String(),
+		Reasoning:    reasoning.String(),
 		ToolCalls:    toolCalls,
 		FinishReason: finishReason,
 		Usage:        usage,
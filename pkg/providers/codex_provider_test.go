@@ -29,6 +29,32 @@ func TestBuildCodexParams_BasicMessage(t *testing.T) {
 	}
 }
 
+func TestBuildCodexParams_ImageParts(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "Describe", Parts: []ContentPart{
+			{Type: "text", Text: "Describe"},
+			{Type: "image_url", ImageURL: &ImageURL{URL: "data:image/jpeg;base64,/9j/4AAQ", Detail: "low"}},
+		}},
+	}
+	params := buildCodexParams(messages, nil, "gpt-4o", map[string]interface{}{})
+
+	msg := params.Input.OfInputItemList[0].OfMessage
+	if msg == nil {
+		t.Fatal("expected a user message input item")
+	}
+	content := msg.Content.OfInputItemContentList
+	if len(content) != 2 {
+		t.Fatalf("len(content) = %d, want 2", len(content))
+	}
+	if content[0].OfInputText == nil || content[0].OfInputText.Text != "Describe" {
+		t.Errorf("content[0] should be input_text")
+	}
+	img := content[1].OfInputImage
+	if img == nil || img.ImageURL.Or("") != "data:image/jpeg;base64,/9j/4AAQ" || img.Detail != "low" {
+		t.Errorf("content[1] = %+v, want input_image with data URI", img)
+	}
+}
+
 func TestBuildCodexParams_SystemAsInstructions(t *testing.T) {
 	messages := []Message{
 		{Role: "system", Content: "You are helpful"},
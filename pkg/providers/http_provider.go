@@ -26,6 +26,7 @@ type HTTPProvider struct {
 	apiKey     string
 	apiBase    string
 	httpClient *http.Client
+	limiter    *RateLimiter // optional, paused from rate-limit response headers
 }
 
 func NewHTTPProvider(apiKey, apiBase, proxy string) *HTTPProvider {
@@ -91,29 +92,49 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 		}
 	}
 
+	if budget := reasoningBudget(options); budget > 0 {
+		if strings.Contains(p.apiBase, "openrouter.ai") {
+			requestBody["reasoning"] = map[string]interface{}{"max_tokens": budget}
+		} else if isReasoningModel(model) {
+			requestBody["reasoning_effort"] = reasoningEffort(budget)
+		}
+	}
+
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// Retry loop with exponential backoff
+	// Retry loop with exponential backoff, or the server's Retry-After when given
 	maxRetries := 3
 	backoffs := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second}
 
 	var resp *http.Response
 	var body []byte
 	var lastErr error
+	var serverBackoff time.Duration
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		if attempt > 0 {
+			backoff := backoffs[attempt-1]
+			if serverBackoff > 0 {
+				backoff = serverBackoff
+			}
 			logger.WarnCF("provider", "Retrying LLM request", map[string]interface{}{
 				"attempt": attempt + 1,
-				"backoff": backoffs[attempt-1].String(),
+				"backoff": backoff.String(),
 			})
 			select {
 			case <-ctx.Done():
 				return nil, ctx.Err()
-			case <-time.After(backoffs[attempt-1]):
+			case <-time.After(backoff):
+			}
+			// Each retry is another request against the provider's limits;
+			// the caller already reserved the token estimate.
+			if p.limiter != nil {
+				if _, err := p.limiter.Acquire(ctx, 0); err != nil {
+					return nil, err
+				}
 			}
 		}
 
@@ -146,10 +167,12 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 			return nil, fmt.Errorf("failed to read response after %d attempts: %w", maxRetries, err)
 		}
 
+		serverBackoff = p.observeRateLimit(resp)
+
 		// Retry on rate limit or server errors
 		if resp.StatusCode == 429 || resp.StatusCode >= 500 {
 			lastErr = fmt.Errorf("API request failed (status %d)", resp.StatusCode)
-			if attempt < maxRetries-1 {
+			if attempt < maxRetries-1 && serverBackoff <= maxRetryAfter {
 				continue
 			}
 		}
@@ -171,8 +194,10 @@ func (p *HTTPProvider) parseResponse(body []byte) (*LLMResponse, error) {
 	var apiResponse struct {
 		Choices []struct {
 			Message struct {
-				Content   string `json:"content"`
-				ToolCalls []struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"` // DeepSeek, vLLM, Moonshot
+				Reasoning        string `json:"reasoning"`         // OpenRouter
+				ToolCalls        []struct {
 					ID       string `json:"id"`
 					Type     string `json:"type"`
 					Function *struct {
@@ -183,7 +208,12 @@ func (p *HTTPProvider) parseResponse(body []byte) (*LLMResponse, error) {
 			} `json:"message"`
 			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
-		Usage *UsageInfo `json:"usage"`
+		Usage *struct {
+			UsageInfo
+			PromptTokensDetails struct {
+				CachedTokens int `json:"cached_tokens"`
+			} `json:"prompt_tokens_details"`
+		} `json:"usage"`
 	}
 
 	if err := json.Unmarshal(body, &apiResponse); err != nil {
@@ -229,14 +259,74 @@ func (p *HTTPProvider) parseResponse(body []byte) (*LLMResponse, error) {
 		})
 	}
 
+	reasoning := choice.Message.ReasoningContent
+	if reasoning == "" {
+		reasoning = choice.Message.Reasoning
+	}
+	content := choice.Message.Content
+	if reasoning == "" {
+		content, reasoning = splitThinkTags(content)
+	}
+
+	var usage *UsageInfo
+	if apiResponse.Usage != nil {
+		u := apiResponse.Usage.UsageInfo
+		if u.CachedTokens == 0 {
+			u.CachedTokens = apiResponse.Usage.PromptTokensDetails.CachedTokens
+		}
+		usage = &u
+	}
+
 	return &LLMResponse{
-		Content:      choice.Message.Content,
+		Content:      content,
+		Reasoning:    reasoning,
 		ToolCalls:    toolCalls,
 		FinishReason: choice.FinishReason,
-		Usage:        apiResponse.Usage,
+		Usage:        usage,
 	}, nil
 }
 
+// splitThinkTags separates a leading <think>...</think> section, which some
+// open-weight reasoning models (Qwen, DeepSeek R1 distills) emit inline,
+// from the answer.
+func splitThinkTags(content string) (answer, reasoning string) {
+	trimmed := strings.TrimSpace(content)
+	if !strings.HasPrefix(trimmed, "<think>") {
+		return content, ""
+	}
+	end := strings.Index(trimmed, "</think>")
+	if end == -1 {
+		return content, ""
+	}
+	reasoning = strings.TrimSpace(trimmed[len("<think>"):end])
+	answer = strings.TrimSpace(trimmed[end+len("</think>"):])
+	return answer, reasoning
+}
+
+// maxRetryAfter is the longest server-supplied delay a request waits out
+// before retrying; a longer one fails the request and leaves the shared rate
+// limiter paused for the full duration.
+const maxRetryAfter = 60 * time.Second
+
+// observeRateLimit reads Retry-After and x-ratelimit-* headers, pauses the
+// shared limiter accordingly, and returns the server-requested retry delay.
+func (p *HTTPProvider) observeRateLimit(resp *http.Response) time.Duration {
+	var wait time.Duration
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		wait = retryAfter(resp.Header)
+	}
+	if reset := rateLimitReset(resp.Header); reset > wait {
+		wait = reset
+	}
+	if p.limiter != nil {
+		p.limiter.Pause(wait)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return 0
+	}
+	return wait
+}
+
 func (p *HTTPProvider) GetDefaultModel() string {
 	return ""
 }
@@ -263,7 +353,78 @@ func createCodexAuthProvider() (LLMProvider, error) {
 	return NewCodexProviderWithTokenSource(cred.AccessToken, cred.AccountID, createCodexTokenSource()), nil
 }
 
+// CreateProvider builds the configured provider, meters it and, for remote
+// APIs, wraps it in the provider's shared rate limiter.
 func CreateProvider(cfg *config.Config) (LLMProvider, error) {
+	provider, err := createProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Claude CLI runs locally and manages its own quota.
+	if _, ok := provider.(*ClaudeCliProvider); ok {
+		return NewMeteredProvider(provider, "claude-cli"), nil
+	}
+
+	name := resolveProviderName(cfg, provider)
+	pc, _ := cfg.GetProvider(name)
+	limiter := GetRateLimiter(name, pc.RPM, pc.TPM)
+	if hp, ok := provider.(*HTTPProvider); ok {
+		hp.limiter = limiter
+	}
+	return NewRateLimitedProvider(NewMeteredProvider(provider, name), limiter), nil
+}
+
+// resolveProviderName returns the config key of the provider that
+// createProvider picked, from the explicit setting or the API endpoint.
+func resolveProviderName(cfg *config.Config, provider LLMProvider) string {
+	switch strings.ToLower(cfg.Agents.Defaults.Provider) {
+	case "openai", "gpt":
+		return "openai"
+	case "anthropic", "claude":
+		return "anthropic"
+	case "zhipu", "glm":
+		return "zhipu"
+	case "gemini", "google":
+		return "gemini"
+	case "github_copilot", "copilot":
+		return "github_copilot"
+	case "":
+	default:
+		return strings.ToLower(cfg.Agents.Defaults.Provider)
+	}
+
+	switch p := provider.(type) {
+	case *ClaudeProvider:
+		return "anthropic"
+	case *CodexProvider:
+		return "openai"
+	case *HTTPProvider:
+		hosts := []struct{ host, name string }{
+			{"openrouter.ai", "openrouter"},
+			{"anthropic.com", "anthropic"},
+			{"openai.com", "openai"},
+			{"groq.com", "groq"},
+			{"bigmodel.cn", "zhipu"},
+			{"googleapis.com", "gemini"},
+			{"nvidia.com", "nvidia"},
+			{"moonshot", "moonshot"},
+			{"shengsuanyun", "shengsuanyun"},
+			{"deepseek.com", "deepseek"},
+		}
+		for _, h := range hosts {
+			if strings.Contains(p.apiBase, h.host) {
+				return h.name
+			}
+		}
+		if cfg.Providers.VLLM.APIBase != "" && strings.TrimRight(cfg.Providers.VLLM.APIBase, "/") == p.apiBase {
+			return "vllm"
+		}
+	}
+	return "default"
+}
+
+func createProvider(cfg *config.Config) (LLMProvider, error) {
 	model := cfg.Agents.Defaults.Model
 	providerName := strings.ToLower(cfg.Agents.Defaults.Provider)
 
@@ -0,0 +1,48 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package providers
+
+import (
+	"context"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/metrics"
+)
+
+// MeteredProvider records the latency and failures of every Chat call under
+// the provider's config name. CreateProvider puts it around every provider,
+// inside the rate limiter so queueing time is not counted.
+type MeteredProvider struct {
+	provider LLMProvider
+	name     string
+}
+
+func NewMeteredProvider(provider LLMProvider, name string) *MeteredProvider {
+	return &MeteredProvider{provider: provider, name: name}
+}
+
+func (p *MeteredProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	start := time.Now()
+	resp, err := p.provider.Chat(ctx, messages, tools, model, options)
+	metrics.LLMRequestDuration.Observe(time.Since(start).Seconds(), p.name, model)
+	if err != nil {
+		metrics.LLMErrors.Inc(p.name, model)
+	}
+	return resp, err
+}
+
+func (p *MeteredProvider) GetDefaultModel() string {
+	return p.provider.GetDefaultModel()
+}
+
+// Close releases the wrapped provider's resources, such as the Claude
+// CLI's sessions, if it holds any.
+func (p *MeteredProvider) Close() {
+	if c, ok := p.provider.(interface{ Close() }); ok {
+		c.Close()
+	}
+}
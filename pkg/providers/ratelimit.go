@@ -0,0 +1,328 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package providers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// RateLimiter enforces requests-per-minute and tokens-per-minute limits for a
+// provider over a sliding one-minute window. Callers queue in Acquire until
+// there is capacity; Pause holds the whole queue after a 429 or when the
+// provider reports an exhausted quota.
+type RateLimiter struct {
+	name string
+	rpm  int
+	tpm  int
+
+	turn chan struct{} // held by the caller at the head of the queue
+
+	mu          sync.Mutex
+	window      []*rateEntry
+	pausedUntil time.Time
+	waiting     int
+}
+
+type rateEntry struct {
+	at     time.Time
+	tokens int
+}
+
+// RateLimiterStats is a point-in-time snapshot of a limiter, for /health.
+type RateLimiterStats struct {
+	QueueDepth  int       `json:"queue_depth"`
+	RPM         int       `json:"rpm,omitempty"`
+	TPM         int       `json:"tpm,omitempty"`
+	Requests    int       `json:"requests_last_minute"`
+	Tokens      int       `json:"tokens_last_minute"`
+	PausedUntil time.Time `json:"paused_until,omitempty"`
+}
+
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = map[string]*RateLimiter{}
+)
+
+// GetRateLimiter returns the shared limiter for a provider, creating it on
+// first use. Limits are updated on every call so a config reload takes effect.
+func GetRateLimiter(name string, rpm, tpm int) *RateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	l, ok := rateLimiters[name]
+	if !ok {
+		l = &RateLimiter{name: name, turn: make(chan struct{}, 1)}
+		rateLimiters[name] = l
+	}
+	l.mu.Lock()
+	l.rpm, l.tpm = rpm, tpm
+	l.mu.Unlock()
+	return l
+}
+
+// GetRateLimiterStats returns a snapshot of every provider limiter.
+func GetRateLimiterStats() map[string]RateLimiterStats {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	stats := make(map[string]RateLimiterStats, len(rateLimiters))
+	for name, l := range rateLimiters {
+		stats[name] = l.Stats()
+	}
+	return stats
+}
+
+// Acquire blocks until the request fits within the limits, queueing behind
+// earlier callers. estimatedTokens is reserved against TPM; the returned
+// release func corrects it with the actual usage once known (pass 0 to keep
+// the estimate).
+func (l *RateLimiter) Acquire(ctx context.Context, estimatedTokens int) (func(actualTokens int), error) {
+	l.mu.Lock()
+	l.waiting++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+
+	select {
+	case l.turn <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-l.turn }()
+
+	for {
+		l.mu.Lock()
+		entry, wait := l.reserve(time.Now(), estimatedTokens)
+		l.mu.Unlock()
+
+		if entry != nil {
+			return func(actualTokens int) {
+				if actualTokens <= 0 {
+					return
+				}
+				l.mu.Lock()
+				entry.tokens = actualTokens
+				l.mu.Unlock()
+			}, nil
+		}
+
+		logger.DebugCF("provider", "Rate limit reached, queueing request",
+			map[string]interface{}{
+				"provider": l.name,
+				"wait":     wait.String(),
+			})
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Pause holds all queued requests for d, e.g. after a Retry-After response.
+func (l *RateLimiter) Pause(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	until := time.Now().Add(d)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+		logger.WarnCF("provider", "Provider rate limited, pausing requests",
+			map[string]interface{}{
+				"provider": l.name,
+				"pause":    d.String(),
+			})
+	}
+}
+
+// Stats returns a snapshot of the limiter state.
+func (l *RateLimiter) Stats() RateLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	stats := RateLimiterStats{
+		QueueDepth: l.waiting,
+		RPM:        l.rpm,
+		TPM:        l.tpm,
+		Requests:   len(l.window),
+	}
+	for _, e := range l.window {
+		stats.Tokens += e.tokens
+	}
+	if l.pausedUntil.After(now) {
+		stats.PausedUntil = l.pausedUntil
+	}
+	return stats
+}
+
+// reserve records a request if it fits, or returns how long to wait.
+// Caller must hold l.mu.
+func (l *RateLimiter) reserve(now time.Time, tokens int) (*rateEntry, time.Duration) {
+	if now.Before(l.pausedUntil) {
+		return nil, l.pausedUntil.Sub(now)
+	}
+
+	l.prune(now)
+
+	if l.rpm > 0 && len(l.window) >= l.rpm {
+		return nil, l.window[0].at.Add(time.Minute).Sub(now)
+	}
+
+	if l.tpm > 0 && len(l.window) > 0 {
+		used := 0
+		for _, e := range l.window {
+			used += e.tokens
+		}
+		// A single request larger than the whole budget still goes through
+		// once the window is empty rather than blocking forever.
+		if used+tokens > l.tpm {
+			return nil, l.window[0].at.Add(time.Minute).Sub(now)
+		}
+	}
+
+	entry := &rateEntry{at: now, tokens: tokens}
+	l.window = append(l.window, entry)
+	return entry, 0
+}
+
+// prune drops entries older than one minute. Caller must hold l.mu.
+func (l *RateLimiter) prune(now time.Time) {
+	cutoff := now.Add(-time.Minute)
+	i := 0
+	for i < len(l.window) && !l.window[i].at.After(cutoff) {
+		i++
+	}
+	l.window = l.window[i:]
+}
+
+// RateLimitedProvider queues every Chat call through a shared RateLimiter so
+// the agent loop, subagents, council and summarizer share one budget.
+type RateLimitedProvider struct {
+	provider LLMProvider
+	limiter  *RateLimiter
+}
+
+func NewRateLimitedProvider(provider LLMProvider, limiter *RateLimiter) *RateLimitedProvider {
+	return &RateLimitedProvider{provider: provider, limiter: limiter}
+}
+
+// ProviderName returns the config name of the provider behind p, for
+// attributing usage and spend, or "" when it is not known.
+func ProviderName(p LLMProvider) string {
+	switch p := p.(type) {
+	case *RateLimitedProvider:
+		return p.limiter.name
+	case *MeteredProvider:
+		return p.name
+	case *ClaudeCliProvider:
+		return "claude-cli"
+	case *ReplayProvider:
+		if p.provider != nil {
+			return ProviderName(p.provider)
+		}
+	}
+	return ""
+}
+
+func (p *RateLimitedProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	release, err := p.limiter.Acquire(ctx, estimateTokens(messages, options))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.provider.Chat(ctx, messages, tools, model, options)
+	if resp != nil && resp.Usage != nil {
+		release(resp.Usage.TotalTokens)
+	}
+	return resp, err
+}
+
+func (p *RateLimitedProvider) GetDefaultModel() string {
+	return p.provider.GetDefaultModel()
+}
+
+// estimateTokens approximates a request's TPM cost the way providers count
+// it: prompt tokens (~4 chars each) plus the requested max_tokens.
+func estimateTokens(messages []Message, options map[string]interface{}) int {
+	chars := 0
+	for _, m := range messages {
+		chars += len(m.Content)
+		for _, tc := range m.ToolCalls {
+			if tc.Function != nil {
+				chars += len(tc.Function.Arguments)
+			}
+		}
+	}
+	tokens := chars / 4
+	if mt, ok := options["max_tokens"].(int); ok {
+		tokens += mt
+	}
+	return tokens
+}
+
+// retryAfter parses a Retry-After header (seconds or HTTP date).
+func retryAfter(h http.Header) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// rateLimitReset returns how long to wait when the provider reports an
+// exhausted request or token quota via x-ratelimit-* headers (OpenAI, Groq,
+// OpenRouter style), or 0 if quota remains.
+func rateLimitReset(h http.Header) time.Duration {
+	var wait time.Duration
+	for _, kind := range []string{"requests", "tokens"} {
+		if h.Get("x-ratelimit-remaining-"+kind) != "0" {
+			continue
+		}
+		if d := parseResetDuration(h.Get("x-ratelimit-reset-" + kind)); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// parseResetDuration accepts Go-style durations ("6m0s", "1.5s", "20ms") and
+// plain seconds ("12").
+func parseResetDuration(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.Duration(secs * float64(time.Second))
+	}
+	return 0
+}
@@ -0,0 +1,130 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/metrics"
+)
+
+func TestRateLimiter_RPMQueues(t *testing.T) {
+	l := &RateLimiter{name: "test", rpm: 2, turn: make(chan struct{}, 1)}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := l.Acquire(ctx, 0); err != nil {
+			t.Fatalf("Acquire(%d) error: %v", i, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, 0); err == nil {
+		t.Fatal("third Acquire within a minute should block until the context expires")
+	}
+	if got := l.Stats().Requests; got != 2 {
+		t.Errorf("Requests = %d, want 2", got)
+	}
+}
+
+func TestRateLimiter_TPMUsesActualTokens(t *testing.T) {
+	l := &RateLimiter{name: "test", tpm: 1000, turn: make(chan struct{}, 1)}
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx, 900)
+	if err != nil {
+		t.Fatalf("Acquire error: %v", err)
+	}
+	release(100)
+
+	shortCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(shortCtx, 800); err != nil {
+		t.Fatalf("Acquire after release should fit within TPM: %v", err)
+	}
+	if got := l.Stats().Tokens; got != 900 {
+		t.Errorf("Tokens = %d, want 900", got)
+	}
+}
+
+func TestRateLimiter_PauseBlocks(t *testing.T) {
+	l := &RateLimiter{name: "test", turn: make(chan struct{}, 1)}
+	l.Pause(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, 0); err == nil {
+		t.Fatal("Acquire should block while paused")
+	}
+	if l.Stats().PausedUntil.IsZero() {
+		t.Error("PausedUntil should be set")
+	}
+}
+
+func TestRetryAfterHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Retry-After", "7")
+	if got := retryAfter(h); got != 7*time.Second {
+		t.Errorf("retryAfter = %v, want 7s", got)
+	}
+
+	h = http.Header{}
+	h.Set("x-ratelimit-remaining-requests", "0")
+	h.Set("x-ratelimit-reset-requests", "1m30s")
+	h.Set("x-ratelimit-remaining-tokens", "5000")
+	h.Set("x-ratelimit-reset-tokens", "10s")
+	if got := rateLimitReset(h); got != 90*time.Second {
+		t.Errorf("rateLimitReset = %v, want 1m30s", got)
+	}
+}
+
+func TestHTTPProvider_LongRetryAfterFails(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	p := NewHTTPProvider("key", server.URL, "")
+	p.limiter = &RateLimiter{name: "test", turn: make(chan struct{}, 1)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := p.Chat(ctx, []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o", nil); err == nil {
+		t.Fatal("Chat should fail when Retry-After exceeds maxRetryAfter")
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("requests = %d, want 1 (no early retry)", got)
+	}
+	if until := p.limiter.Stats().PausedUntil; time.Until(until) < maxRetryAfter {
+		t.Errorf("limiter paused until %v, want the full Retry-After", until)
+	}
+}
+
+type failingProvider struct{}
+
+func (failingProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	return nil, errors.New("boom")
+}
+
+func (failingProvider) GetDefaultModel() string { return "m" }
+
+func TestMeteredProvider_RecordsCalls(t *testing.T) {
+	p := NewMeteredProvider(failingProvider{}, "metered-test")
+	if _, err := p.Chat(context.Background(), nil, nil, "m", nil); err == nil {
+		t.Fatal("Chat should pass the provider's error through")
+	}
+	if got := metrics.LLMRequestDuration.Count("metered-test", "m"); got != 1 {
+		t.Errorf("observed durations = %d, want 1", got)
+	}
+	if got := metrics.LLMErrors.Value("metered-test", "m"); got != 1 {
+		t.Errorf("errors = %v, want 1", got)
+	}
+}
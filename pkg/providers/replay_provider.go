@@ -0,0 +1,212 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package providers
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ReplayProvider records Chat request/response pairs to a JSONL fixture, or
+// replays them from one without touching the network. Requests are matched by
+// RequestHash; identical requests replay their recorded responses in order.
+type ReplayProvider struct {
+	provider LLMProvider // wrapped provider when recording, nil when replaying
+	path     string
+
+	mu       sync.Mutex
+	fixtures map[string][]*LLMResponse
+	served   map[string]int
+	model    string
+}
+
+// ReplayFixture is one line of a replay JSONL file.
+type ReplayFixture struct {
+	Hash     string       `json:"hash"`
+	Model    string       `json:"model"`
+	Messages []Message    `json:"messages"`
+	Tools    []string     `json:"tools,omitempty"`
+	Response *LLMResponse `json:"response"`
+}
+
+// NewRecordingProvider wraps provider and appends every successful Chat call
+// to the JSONL file at path.
+func NewRecordingProvider(provider LLMProvider, path string) *ReplayProvider {
+	return &ReplayProvider{provider: provider, path: path}
+}
+
+// NewReplayProvider loads fixtures from the JSONL file at path and serves
+// Chat calls from them.
+func NewReplayProvider(path string) (*ReplayProvider, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening replay fixtures: %w", err)
+	}
+	defer f.Close()
+
+	p := &ReplayProvider{
+		path:     path,
+		fixtures: make(map[string][]*LLMResponse),
+		served:   make(map[string]int),
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var fx ReplayFixture
+		if err := json.Unmarshal(scanner.Bytes(), &fx); err != nil {
+			return nil, fmt.Errorf("parsing %s line %d: %w", path, line, err)
+		}
+		p.fixtures[fx.Hash] = append(p.fixtures[fx.Hash], fx.Response)
+		if p.model == "" {
+			p.model = fx.Model
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading replay fixtures: %w", err)
+	}
+	return p, nil
+}
+
+func (p *ReplayProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	hash := RequestHash(messages, tools, model)
+
+	if p.provider == nil {
+		return p.replay(hash)
+	}
+
+	resp, err := p.provider.Chat(ctx, messages, tools, model, options)
+	if err != nil {
+		return resp, err
+	}
+	if err := p.record(ReplayFixture{
+		Hash:     hash,
+		Model:    model,
+		Messages: messages,
+		Tools:    toolNames(tools),
+		Response: resp,
+	}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *ReplayProvider) GetDefaultModel() string {
+	if p.provider != nil {
+		return p.provider.GetDefaultModel()
+	}
+	return p.model
+}
+
+func (p *ReplayProvider) replay(hash string) (*LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	responses := p.fixtures[hash]
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("replay: no recorded response for request %s in %s", hash[:12], p.path)
+	}
+
+	// Repeats of an identical request beyond what was recorded get the last response.
+	i := min(p.served[hash], len(responses)-1)
+	p.served[hash]++
+	return responses[i], nil
+}
+
+func (p *ReplayProvider) record(fx ReplayFixture) error {
+	data, err := json.Marshal(fx)
+	if err != nil {
+		return fmt.Errorf("encoding replay fixture: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, err := os.OpenFile(p.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening replay fixtures: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("writing replay fixture: %w", err)
+	}
+	return nil
+}
+
+// RequestHash identifies a Chat request for replay. System messages are left
+// out because the system prompt embeds the current time, and tools are
+// reduced to their sorted names so description tweaks and registry order
+// don't invalidate fixtures. Multimodal parts are reduced to their type and
+// a digest of their text or image, so different images hash differently.
+func RequestHash(messages []Message, tools []ToolDefinition, model string) string {
+	type hashedMessage struct {
+		Role       string     `json:"role"`
+		Content    string     `json:"content"`
+		Parts      []string   `json:"parts,omitempty"`
+		ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+		ToolCallID string     `json:"tool_call_id,omitempty"`
+	}
+
+	msgs := make([]hashedMessage, 0, len(messages))
+	for _, m := range messages {
+		if m.Role == "system" {
+			continue
+		}
+		msgs = append(msgs, hashedMessage{
+			Role:       m.Role,
+			Content:    m.Content,
+			Parts:      partDigests(m.Parts),
+			ToolCalls:  m.ToolCalls,
+			ToolCallID: m.ToolCallID,
+		})
+	}
+
+	data, _ := json.Marshal(struct {
+		Model    string          `json:"model"`
+		Messages []hashedMessage `json:"messages"`
+		Tools    []string        `json:"tools"`
+	}{model, msgs, toolNames(tools)})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func partDigests(parts []ContentPart) []string {
+	if len(parts) == 0 {
+		return nil
+	}
+	digests := make([]string, 0, len(parts))
+	for _, p := range parts {
+		data := p.Text
+		if p.ImageURL != nil {
+			data = p.ImageURL.URL
+		}
+		sum := sha256.Sum256([]byte(data))
+		digests = append(digests, p.Type+":"+hex.EncodeToString(sum[:]))
+	}
+	return digests
+}
+
+func toolNames(tools []ToolDefinition) []string {
+	names := make([]string, 0, len(tools))
+	for _, t := range tools {
+		names = append(names, t.Function.Name)
+	}
+	sort.Strings(names)
+	return names
+}
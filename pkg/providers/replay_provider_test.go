@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// scriptedProvider returns its responses in order, one per Chat call.
+type scriptedProvider struct {
+	responses []*LLMResponse
+	calls     int
+}
+
+func (s *scriptedProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	resp := s.responses[s.calls%len(s.responses)]
+	s.calls++
+	return resp, nil
+}
+
+func (s *scriptedProvider) GetDefaultModel() string {
+	return "scripted-model"
+}
+
+func TestReplayProvider_RecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.jsonl")
+	ctx := context.Background()
+
+	inner := &scriptedProvider{responses: []*LLMResponse{
+		{Content: "first", FinishReason: "stop"},
+		{Content: "second", FinishReason: "stop"},
+	}}
+	recorder := NewRecordingProvider(inner, path)
+
+	tools := []ToolDefinition{
+		{Type: "function", Function: ToolFunctionDefinition{Name: "read_file"}},
+		{Type: "function", Function: ToolFunctionDefinition{Name: "list_dir"}},
+	}
+	q1 := []Message{{Role: "system", Content: "time: 10:00"}, {Role: "user", Content: "one"}}
+	q2 := []Message{{Role: "system", Content: "time: 10:00"}, {Role: "user", Content: "two"}}
+
+	if _, err := recorder.Chat(ctx, q1, tools, "m", nil); err != nil {
+		t.Fatalf("record q1: %v", err)
+	}
+	if _, err := recorder.Chat(ctx, q2, tools, "m", nil); err != nil {
+		t.Fatalf("record q2: %v", err)
+	}
+
+	replay, err := NewReplayProvider(path)
+	if err != nil {
+		t.Fatalf("NewReplayProvider() error: %v", err)
+	}
+
+	// System prompt and tool order differ from the recording; both are ignored.
+	reordered := []ToolDefinition{tools[1], tools[0]}
+	q2b := []Message{{Role: "system", Content: "time: 11:30"}, {Role: "user", Content: "two"}}
+	resp, err := replay.Chat(ctx, q2b, reordered, "m", nil)
+	if err != nil {
+		t.Fatalf("replay q2: %v", err)
+	}
+	if resp.Content != "second" {
+		t.Errorf("replayed Content = %q, want %q", resp.Content, "second")
+	}
+
+	if _, err := replay.Chat(ctx, []Message{{Role: "user", Content: "three"}}, tools, "m", nil); err == nil {
+		t.Error("unrecorded request should fail")
+	}
+	if got := replay.GetDefaultModel(); got != "m" {
+		t.Errorf("GetDefaultModel() = %q, want %q", got, "m")
+	}
+}
+
+func TestRequestHash_Parts(t *testing.T) {
+	withImage := func(url string) []Message {
+		return []Message{{Role: "user", Content: "what is this?", Parts: []ContentPart{
+			{Type: "text", Text: "what is this?"},
+			{Type: "image_url", ImageURL: &ImageURL{URL: url}},
+		}}}
+	}
+	cat := RequestHash(withImage("data:image/png;base64,Y2F0"), nil, "m")
+	dog := RequestHash(withImage("data:image/png;base64,ZG9n"), nil, "m")
+	if cat == dog {
+		t.Error("requests with different images should hash differently")
+	}
+	if cat != RequestHash(withImage("data:image/png;base64,Y2F0"), nil, "m") {
+		t.Error("identical requests should hash the same")
+	}
+	textOnly := RequestHash([]Message{{Role: "user", Content: "what is this?"}}, nil, "m")
+	if textOnly == cat {
+		t.Error("a request without the image should hash differently")
+	}
+}
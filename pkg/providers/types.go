@@ -3,6 +3,7 @@ package providers
 import (
 	"context"
 	"encoding/json"
+	"strings"
 )
 
 type ToolCall struct {
@@ -19,16 +20,28 @@ type FunctionCall struct {
 }
 
 type LLMResponse struct {
-	Content      string     `json:"content"`
-	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
-	FinishReason string     `json:"finish_reason"`
-	Usage        *UsageInfo `json:"usage,omitempty"`
+	Content        string          `json:"content"`
+	Reasoning      string          `json:"reasoning,omitempty"`
+	ThinkingBlocks []ThinkingBlock `json:"thinking_blocks,omitempty"`
+	ToolCalls      []ToolCall      `json:"tool_calls,omitempty"`
+	FinishReason   string          `json:"finish_reason"`
+	Usage          *UsageInfo      `json:"usage,omitempty"`
+}
+
+// ThinkingBlock is a provider reasoning block that must be echoed back
+// verbatim in the next request of a tool loop (Anthropic extended thinking).
+// Redacted blocks carry only opaque Data.
+type ThinkingBlock struct {
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
 }
 
 type UsageInfo struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	CachedTokens     int `json:"cached_tokens,omitempty"` // prompt tokens served from the provider's cache (subset of PromptTokens)
 }
 
 // ContentPart represents a part of a multimodal message (text or image).
@@ -44,16 +57,34 @@ type ImageURL struct {
 	Detail string `json:"detail,omitempty"`
 }
 
+// splitDataURI splits a base64 data URI into its media type and base64
+// payload. ok is false for plain URLs.
+func splitDataURI(uri string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(uri, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	mediaType, found2 := strings.CutSuffix(meta, ";base64")
+	if !found || !found2 {
+		return "", "", false
+	}
+	return mediaType, data, true
+}
+
 type Message struct {
-	Role       string        `json:"role"`
-	Content    string        `json:"content"`
-	Parts      []ContentPart `json:"-"` // multimodal parts, serialized via MarshalJSON
-	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`
-	ToolCallID string        `json:"tool_call_id,omitempty"`
+	Role           string          `json:"role"`
+	Content        string          `json:"content"`
+	Parts          []ContentPart   `json:"-"` // multimodal parts, serialized via MarshalJSON
+	ThinkingBlocks []ThinkingBlock `json:"-"` // assistant reasoning to round-trip within a tool loop
+	ToolCalls      []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallID     string          `json:"tool_call_id,omitempty"`
 }
 
 // MarshalJSON custom marshals Message. When Parts is non-empty, content is
 // serialized as an array of content parts (OpenAI multimodal format).
+// ThinkingBlocks are never serialized: OpenAI-compatible APIs reject them and
+// Anthropic only needs them for the turn in progress.
 func (m Message) MarshalJSON() ([]byte, error) {
 	type Alias struct {
 		Role       string      `json:"role"`
@@ -82,6 +113,36 @@ type LLMProvider interface {
 	GetDefaultModel() string
 }
 
+// ReasoningBudgetOption is the Chat options key for the reasoning token budget
+// (int). Providers map it to their native setting: Anthropic thinking
+// budget_tokens, OpenAI reasoning effort. Absent or <= 0 disables reasoning.
+const ReasoningBudgetOption = "reasoning_budget"
+
+// SessionKeyOption is the Chat options key for the caller's session key
+// (string). Stateful providers such as the Claude CLI use it to keep one
+// conversation per session.
+const SessionKeyOption = "session_key"
+
+// reasoningBudget reads ReasoningBudgetOption from Chat options.
+func reasoningBudget(options map[string]interface{}) int {
+	if b, ok := options[ReasoningBudgetOption].(int); ok && b > 0 {
+		return b
+	}
+	return 0
+}
+
+// reasoningEffort maps a token budget to an OpenAI reasoning effort level.
+func reasoningEffort(budget int) string {
+	switch {
+	case budget <= 2048:
+		return "low"
+	case budget <= 8192:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
 type ToolDefinition struct {
 	Type     string                 `json:"type"`
 	Function ToolFunctionDefinition `json:"function"`
@@ -14,6 +14,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
 	"github.com/sipeed/picoclaw/pkg/state"
 )
 
@@ -126,6 +127,13 @@ func (s *Service) collect() {
 	st.RAMTotalMB, st.RAMAvailableMB, st.RAMUsedPercent = readRAM()
 	st.DiskTotalGB, st.DiskFreeGB, st.DiskUsedPercent = readDisk()
 
+	metrics.SentinelCPUTemp.Set(st.CPUTempC)
+	metrics.SentinelRAMUsed.Set(st.RAMUsedPercent)
+	metrics.SentinelRAMAvailable.Set(float64(st.RAMAvailableMB))
+	metrics.SentinelDiskUsed.Set(st.DiskUsedPercent)
+	metrics.SentinelDiskFree.Set(st.DiskFreeGB)
+	metrics.SentinelUptime.Set(float64(st.UptimeSeconds))
+
 	// Check thresholds and build alerts
 	var alerts []string
 	if st.CPUTempC > 80 {
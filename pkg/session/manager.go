@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,8 +16,11 @@ type Session struct {
 	Key      string              `json:"key"`
 	Messages []providers.Message `json:"messages"`
 	Summary  string              `json:"summary,omitempty"`
-	Created  time.Time           `json:"created"`
-	Updated  time.Time           `json:"updated"`
+	// ReasoningBudget overrides the configured reasoning budget for this chat:
+	// 0 inherits the default, -1 disables reasoning, >0 is a token budget.
+	ReasoningBudget int       `json:"reasoning_budget,omitempty"`
+	Created         time.Time `json:"created"`
+	Updated         time.Time `json:"updated"`
 }
 
 type SessionManager struct {
@@ -136,6 +140,28 @@ func (sm *SessionManager) SetSummary(key string, summary string) {
 	}
 }
 
+// GetReasoningBudget returns the per-chat reasoning override (see Session.ReasoningBudget).
+func (sm *SessionManager) GetReasoningBudget(key string) int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return 0
+	}
+	return session.ReasoningBudget
+}
+
+// SetReasoningBudget sets the per-chat reasoning override, creating the session if needed.
+func (sm *SessionManager) SetReasoningBudget(key string, budget int) {
+	session := sm.GetOrCreate(key)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session.ReasoningBudget = budget
+	session.Updated = time.Now()
+}
+
 func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -175,6 +201,52 @@ func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 	session.Updated = time.Now()
 }
 
+// SessionInfo summarizes a session for listings.
+type SessionInfo struct {
+	Key        string    `json:"key"`
+	Messages   int       `json:"messages"`
+	HasSummary bool      `json:"has_summary"`
+	Created    time.Time `json:"created"`
+	Updated    time.Time `json:"updated"`
+}
+
+// List returns every session, most recently updated first.
+func (sm *SessionManager) List() []SessionInfo {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	list := make([]SessionInfo, 0, len(sm.sessions))
+	for _, session := range sm.sessions {
+		list = append(list, SessionInfo{
+			Key:        session.Key,
+			Messages:   len(session.Messages),
+			HasSummary: session.Summary != "",
+			Created:    session.Created,
+			Updated:    session.Updated,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Updated.After(list[j].Updated) })
+	return list
+}
+
+// Clear drops a session's history and summary, keeping its settings, and
+// saves it. Returns false if there is no such session.
+func (sm *SessionManager) Clear(key string) bool {
+	sm.mu.Lock()
+	session, ok := sm.sessions[key]
+	if ok {
+		session.Messages = []providers.Message{}
+		session.Summary = ""
+		session.Updated = time.Now()
+	}
+	sm.mu.Unlock()
+
+	if ok {
+		sm.Save(key)
+	}
+	return ok
+}
+
 // sanitizeFilename converts a session key into a cross-platform safe filename.
 // Session keys use "channel:chatID" (e.g. "telegram:123456") but ':' is the
 // volume separator on Windows, so filepath.Base would misinterpret the key.
@@ -208,10 +280,11 @@ func (sm *SessionManager) Save(key string) error {
 	}
 
 	snapshot := Session{
-		Key:     stored.Key,
-		Summary: stored.Summary,
-		Created: stored.Created,
-		Updated: stored.Updated,
+		Key:             stored.Key,
+		Summary:         stored.Summary,
+		ReasoningBudget: stored.ReasoningBudget,
+		Created:         stored.Created,
+		Updated:         stored.Updated,
 	}
 	if len(stored.Messages) > 0 {
 		snapshot.Messages = make([]providers.Message, len(stored.Messages))
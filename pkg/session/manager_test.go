@@ -72,3 +72,26 @@ func TestSave_RejectsPathTraversal(t *testing.T) {
 		}
 	}
 }
+
+func TestListAndClear(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	sm.AddMessage("telegram:1", "user", "hi")
+	sm.AddMessage("web:s1", "user", "hello")
+	sm.AddMessage("web:s1", "assistant", "hey")
+	sm.SetSummary("web:s1", "greetings")
+
+	list := sm.List()
+	if len(list) != 2 || list[0].Key != "web:s1" || list[0].Messages != 2 || !list[0].HasSummary {
+		t.Fatalf("List() = %+v", list)
+	}
+
+	if !sm.Clear("web:s1") {
+		t.Fatal("Clear(web:s1) = false")
+	}
+	if h := sm.GetHistory("web:s1"); len(h) != 0 || sm.GetSummary("web:s1") != "" {
+		t.Errorf("after Clear: history %v, summary %q", h, sm.GetSummary("web:s1"))
+	}
+	if sm.Clear("missing") {
+		t.Error("Clear(missing) = true")
+	}
+}
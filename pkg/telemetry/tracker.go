@@ -6,10 +6,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
+	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
 // Feature labels for tracking token usage by purpose.
@@ -18,21 +23,59 @@ const (
 	FeatureHeartbeat = "heartbeat"
 	FeatureSummarize = "summarize"
 	FeatureCron      = "cron"
+	FeatureCouncil   = "council"
+	FeatureAPI       = "api"
+)
+
+// Over-budget policies, applied to non-essential features (heartbeat, council).
+const (
+	PolicyWarn      = "warn"
+	PolicyDowngrade = "downgrade"
+	PolicyBlock     = "block"
 )
 
 // FeatureBucket tracks token usage for a single feature.
 type FeatureBucket struct {
-	PromptTokens     int64 `json:"prompt_tokens"`
-	CompletionTokens int64 `json:"completion_tokens"`
-	TotalTokens      int64 `json:"total_tokens"`
-	Calls            int64 `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	CachedTokens     int64   `json:"cached_tokens,omitempty"`
+	Calls            int64   `json:"calls"`
+	CostUSD          float64 `json:"cost_usd,omitempty"`
+}
+
+func (fb *FeatureBucket) add(u *providers.UsageInfo, cost float64) {
+	fb.PromptTokens += int64(u.PromptTokens)
+	fb.CompletionTokens += int64(u.CompletionTokens)
+	fb.TotalTokens += int64(u.TotalTokens)
+	fb.CachedTokens += int64(u.CachedTokens)
+	fb.Calls++
+	fb.CostUSD += cost
 }
 
 // DayBucket tracks token usage for a single day.
 type DayBucket struct {
-	Date     string                    `json:"date"` // "2006-01-02"
-	Features map[string]*FeatureBucket `json:"features"`
-	Totals   FeatureBucket             `json:"totals"`
+	Date      string                    `json:"date"` // "2006-01-02"
+	Features  map[string]*FeatureBucket `json:"features"`
+	Models    map[string]*FeatureBucket `json:"models,omitempty"`
+	Providers map[string]*FeatureBucket `json:"providers,omitempty"`
+	Totals    FeatureBucket             `json:"totals"`
+}
+
+// BudgetStatus reports spend against the configured budgets.
+type BudgetStatus struct {
+	DailySpent   float64
+	DailyLimit   float64
+	MonthlySpent float64
+	MonthlyLimit float64
+	DailyOver    bool
+	MonthlyOver  bool
+	Policy       string
+}
+
+// Exceeded reports whether either budget has been reached.
+func (s BudgetStatus) Exceeded() bool {
+	return s.DailyOver || s.MonthlyOver
 }
 
 // TelemetryData is the on-disk format.
@@ -46,6 +89,11 @@ type Tracker struct {
 	data     *TelemetryData
 	filePath string
 	dirty    bool
+
+	cost        config.CostConfig
+	onBudget    func(BudgetStatus)
+	warnedDay   string // date the daily budget alert last fired
+	warnedMonth string // month the monthly budget alert last fired
 }
 
 // NewTracker creates a tracker that persists to workspace/state/telemetry.json.
@@ -80,35 +128,187 @@ func (t *Tracker) Stop() {
 	t.Flush()
 }
 
-// Record adds token usage for the given feature. Hot path, mutex-only, no I/O.
-func (t *Tracker) Record(feature string, prompt, completion, total int) {
-	if total == 0 && prompt == 0 && completion == 0 {
+// SetCostConfig sets the price table and budgets.
+func (t *Tracker) SetCostConfig(cfg config.CostConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cost = cfg
+}
+
+// SetBudgetAlert registers a callback fired once per day (and once per month)
+// when spend first reaches the daily (or monthly) budget. It runs on its own
+// goroutine, so it may block without holding up the LLM call that crossed
+// the budget.
+func (t *Tracker) SetBudgetAlert(fn func(BudgetStatus)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onBudget = fn
+}
+
+// Record adds token usage for the given feature, provider and model, pricing
+// it from the configured table. provider is the one that served this call
+// (see providers.ProviderName) and may be empty. Hot path, mutex-only, no I/O.
+func (t *Tracker) Record(feature, provider, model string, usage *providers.UsageInfo) {
+	if usage == nil || (usage.TotalTokens == 0 && usage.PromptTokens == 0 && usage.CompletionTokens == 0) {
 		return
 	}
 
-	today := time.Now().Format("2006-01-02")
+	metrics.LLMTokens.Add(float64(usage.PromptTokens), model, feature, "prompt")
+	metrics.LLMTokens.Add(float64(usage.CompletionTokens), model, feature, "completion")
+
+	now := time.Now()
+	today := now.Format("2006-01-02")
+	provider = strings.ToLower(provider)
 
 	t.mu.Lock()
-	defer t.mu.Unlock()
+
+	cost := t.price(provider, model, usage)
 
 	bucket := t.getOrCreateDay(today)
-	fb, ok := bucket.Features[feature]
+	addTo(bucket.Features, feature, usage, cost)
+	if model != "" {
+		if bucket.Models == nil {
+			bucket.Models = make(map[string]*FeatureBucket)
+		}
+		addTo(bucket.Models, model, usage, cost)
+	}
+	if provider != "" {
+		if bucket.Providers == nil {
+			bucket.Providers = make(map[string]*FeatureBucket)
+		}
+		addTo(bucket.Providers, provider, usage, cost)
+	}
+	bucket.Totals.add(usage, cost)
+
+	t.dirty = true
+
+	var alert func(BudgetStatus)
+	var status BudgetStatus
+	if cost > 0 && t.onBudget != nil {
+		status = t.budgetStatus(now)
+		month := now.Format("2006-01")
+		fire := false
+		if status.DailyOver && t.warnedDay != today {
+			t.warnedDay = today
+			fire = true
+		}
+		if status.MonthlyOver && t.warnedMonth != month {
+			t.warnedMonth = month
+			fire = true
+		}
+		if fire {
+			alert = t.onBudget
+		}
+	}
+
+	t.mu.Unlock()
+
+	if alert != nil {
+		go alert(status)
+	}
+}
+
+// BudgetStatus returns current spend against the configured budgets.
+func (t *Tracker) BudgetStatus() BudgetStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.budgetStatus(time.Now())
+}
+
+// Admit applies the over-budget policy to an LLM call. Essential features
+// always run unchanged; non-essential ones (heartbeat, council) are switched
+// to the downgrade model or refused once a budget is exceeded. It returns the
+// model to use and whether the call may proceed.
+func (t *Tracker) Admit(feature, model string) (string, bool) {
+	if feature != FeatureHeartbeat && feature != FeatureCouncil {
+		return model, true
+	}
+
+	status := t.BudgetStatus()
+	if !status.Exceeded() {
+		return model, true
+	}
+
+	switch status.Policy {
+	case PolicyBlock:
+		logger.WarnCF("telemetry", "Budget exceeded, skipping non-essential call",
+			map[string]interface{}{"feature": feature})
+		return model, false
+	case PolicyDowngrade:
+		t.mu.Lock()
+		downgrade := t.cost.DowngradeModel
+		t.mu.Unlock()
+		if downgrade != "" {
+			return downgrade, true
+		}
+	}
+	return model, true
+}
+
+// price returns the USD cost of usage on provider's model, preferring a
+// "provider/model" entry over a bare "model" one. Caller must hold t.mu.
+func (t *Tracker) price(provider, model string, u *providers.UsageInfo) float64 {
+	if len(t.cost.Prices) == 0 || model == "" {
+		return 0
+	}
+	var p config.ModelPrice
+	ok := false
+	if provider != "" {
+		p, ok = t.cost.Prices[provider+"/"+model]
+	}
 	if !ok {
-		fb = &FeatureBucket{}
-		bucket.Features[feature] = fb
+		p, ok = t.cost.Prices[model]
+	}
+	if !ok {
+		return 0
 	}
 
-	fb.PromptTokens += int64(prompt)
-	fb.CompletionTokens += int64(completion)
-	fb.TotalTokens += int64(total)
-	fb.Calls++
+	cachedPrice := p.Cached
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	cached := u.CachedTokens
+	if cached > u.PromptTokens {
+		cached = u.PromptTokens
+	}
+	uncached := u.PromptTokens - cached
 
-	bucket.Totals.PromptTokens += int64(prompt)
-	bucket.Totals.CompletionTokens += int64(completion)
-	bucket.Totals.TotalTokens += int64(total)
-	bucket.Totals.Calls++
+	return (float64(uncached)*p.Input + float64(cached)*cachedPrice + float64(u.CompletionTokens)*p.Output) / 1e6
+}
 
-	t.dirty = true
+// budgetStatus sums spend for the day and month containing now. Caller must hold t.mu.
+func (t *Tracker) budgetStatus(now time.Time) BudgetStatus {
+	today := now.Format("2006-01-02")
+	month := now.Format("2006-01")
+
+	status := BudgetStatus{
+		DailyLimit:   t.cost.DailyBudget,
+		MonthlyLimit: t.cost.MonthlyBudget,
+		Policy:       t.cost.OverBudget,
+	}
+	if status.Policy == "" {
+		status.Policy = PolicyWarn
+	}
+	for _, d := range t.data.Days {
+		if d.Date == today {
+			status.DailySpent += d.Totals.CostUSD
+		}
+		if strings.HasPrefix(d.Date, month) {
+			status.MonthlySpent += d.Totals.CostUSD
+		}
+	}
+	status.DailyOver = status.DailyLimit > 0 && status.DailySpent >= status.DailyLimit
+	status.MonthlyOver = status.MonthlyLimit > 0 && status.MonthlySpent >= status.MonthlyLimit
+	return status
+}
+
+func addTo(m map[string]*FeatureBucket, key string, u *providers.UsageInfo, cost float64) {
+	fb, ok := m[key]
+	if !ok {
+		fb = &FeatureBucket{}
+		m[key] = fb
+	}
+	fb.add(u, cost)
 }
 
 // GetToday returns today's bucket (copy). Returns nil if no data yet.
@@ -151,7 +351,7 @@ func (t *Tracker) Flush() {
 		return
 	}
 
-	t.prune(30)
+	t.prune(31) // keep a full calendar month for the monthly budget
 	t.dirty = false
 
 	data, err := json.MarshalIndent(t.data, "", "  ")
@@ -214,14 +414,23 @@ func (t *Tracker) prune(keepDays int) {
 }
 
 func copyDayBucket(src *DayBucket) *DayBucket {
-	cp := &DayBucket{
-		Date:     src.Date,
-		Totals:   src.Totals,
-		Features: make(map[string]*FeatureBucket, len(src.Features)),
+	return &DayBucket{
+		Date:      src.Date,
+		Totals:    src.Totals,
+		Features:  copyBuckets(src.Features),
+		Models:    copyBuckets(src.Models),
+		Providers: copyBuckets(src.Providers),
 	}
-	for k, v := range src.Features {
+}
+
+func copyBuckets(src map[string]*FeatureBucket) map[string]*FeatureBucket {
+	if src == nil {
+		return nil
+	}
+	cp := make(map[string]*FeatureBucket, len(src))
+	for k, v := range src {
 		fb := *v
-		cp.Features[k] = &fb
+		cp[k] = &fb
 	}
 	return cp
 }
@@ -233,15 +442,54 @@ func FormatDayBucket(b *DayBucket) string {
 	}
 
 	result := fmt.Sprintf("Date: %s\n", b.Date)
-	result += fmt.Sprintf("Total: %d tokens (%d prompt + %d completion) in %d calls\n",
-		b.Totals.TotalTokens, b.Totals.PromptTokens, b.Totals.CompletionTokens, b.Totals.Calls)
-
-	if len(b.Features) > 0 {
-		result += "\nBy feature:\n"
-		for name, fb := range b.Features {
-			result += fmt.Sprintf("  %s: %d tokens (%d prompt + %d completion) in %d calls\n",
-				name, fb.TotalTokens, fb.PromptTokens, fb.CompletionTokens, fb.Calls)
+	result += "Total: " + formatBucket(&b.Totals)
+
+	for _, dim := range []struct {
+		title   string
+		buckets map[string]*FeatureBucket
+	}{
+		{"By feature", b.Features},
+		{"By model", b.Models},
+		{"By provider", b.Providers},
+	} {
+		if len(dim.buckets) == 0 {
+			continue
+		}
+		result += "\n" + dim.title + ":\n"
+		names := make([]string, 0, len(dim.buckets))
+		for name := range dim.buckets {
+			names = append(names, name)
 		}
+		sort.Strings(names)
+		for _, name := range names {
+			result += fmt.Sprintf("  %s: %s", name, formatBucket(dim.buckets[name]))
+		}
+	}
+	return result
+}
+
+// FormatBudgetStatus returns a human-readable summary of spend against budgets.
+func FormatBudgetStatus(s BudgetStatus) string {
+	result := fmt.Sprintf("Today: $%.4f", s.DailySpent)
+	if s.DailyLimit > 0 {
+		result += fmt.Sprintf(" of $%.2f daily budget", s.DailyLimit)
+	}
+	result += fmt.Sprintf("\nThis month: $%.4f", s.MonthlySpent)
+	if s.MonthlyLimit > 0 {
+		result += fmt.Sprintf(" of $%.2f monthly budget", s.MonthlyLimit)
+	}
+	result += "\n"
+	if s.Exceeded() {
+		result += fmt.Sprintf("Budget exceeded (policy: %s)\n", s.Policy)
 	}
 	return result
 }
+
+func formatBucket(fb *FeatureBucket) string {
+	line := fmt.Sprintf("%d tokens (%d prompt + %d completion) in %d calls",
+		fb.TotalTokens, fb.PromptTokens, fb.CompletionTokens, fb.Calls)
+	if fb.CostUSD > 0 {
+		line += fmt.Sprintf(", $%.4f", fb.CostUSD)
+	}
+	return line + "\n"
+}
@@ -0,0 +1,111 @@
+package telemetry
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestTracker_RecordComputesCost(t *testing.T) {
+	tr := NewTracker(t.TempDir())
+	tr.SetCostConfig(config.CostConfig{
+		Prices: map[string]config.ModelPrice{
+			"anthropic/claude-sonnet": {Input: 3, Output: 15, Cached: 0.3},
+		},
+	})
+
+	tr.Record(FeatureChat, "anthropic", "claude-sonnet", &providers.UsageInfo{
+		PromptTokens:     1_000_000,
+		CompletionTokens: 100_000,
+		TotalTokens:      1_100_000,
+		CachedTokens:     500_000,
+	})
+
+	// 500k uncached * $3 + 500k cached * $0.30 + 100k output * $15
+	want := 1.5 + 0.15 + 1.5
+	day := tr.GetToday()
+	if day == nil {
+		t.Fatal("GetToday() = nil")
+	}
+	if math.Abs(day.Totals.CostUSD-want) > 1e-9 {
+		t.Errorf("Totals.CostUSD = %f, want %f", day.Totals.CostUSD, want)
+	}
+	if fb := day.Models["claude-sonnet"]; fb == nil || fb.Calls != 1 {
+		t.Errorf("Models[claude-sonnet] = %+v, want 1 call", fb)
+	}
+	if fb := day.Providers["anthropic"]; fb == nil || math.Abs(fb.CostUSD-want) > 1e-9 {
+		t.Errorf("Providers[anthropic] = %+v, want cost %f", fb, want)
+	}
+}
+
+func TestTracker_RecordAttributesEachProvider(t *testing.T) {
+	tr := NewTracker(t.TempDir())
+	tr.SetCostConfig(config.CostConfig{
+		Prices: map[string]config.ModelPrice{
+			"openrouter/claude-sonnet": {Input: 4, Output: 20},
+			"claude-sonnet":            {Input: 3, Output: 15},
+		},
+	})
+
+	usage := &providers.UsageInfo{PromptTokens: 1_000_000, TotalTokens: 1_000_000}
+	tr.Record(FeatureChat, "Anthropic", "claude-sonnet", usage)
+	tr.Record(FeatureCouncil, "openrouter", "claude-sonnet", usage)
+
+	day := tr.GetToday()
+	if fb := day.Providers["anthropic"]; fb == nil || math.Abs(fb.CostUSD-3) > 1e-9 {
+		t.Errorf("Providers[anthropic] = %+v, want cost 3", fb)
+	}
+	if fb := day.Providers["openrouter"]; fb == nil || math.Abs(fb.CostUSD-4) > 1e-9 {
+		t.Errorf("Providers[openrouter] = %+v, want cost 4", fb)
+	}
+}
+
+func TestTracker_AdmitOverBudget(t *testing.T) {
+	tr := NewTracker(t.TempDir())
+	tr.SetCostConfig(config.CostConfig{
+		Prices:         map[string]config.ModelPrice{"big": {Input: 10, Output: 10}},
+		DailyBudget:    1,
+		OverBudget:     PolicyDowngrade,
+		DowngradeModel: "small",
+	})
+
+	alerts := make(chan BudgetStatus, 2)
+	tr.SetBudgetAlert(func(status BudgetStatus) { alerts <- status })
+
+	if model, ok := tr.Admit(FeatureHeartbeat, "big"); !ok || model != "big" {
+		t.Errorf("Admit() under budget = (%q, %v), want (big, true)", model, ok)
+	}
+
+	usage := &providers.UsageInfo{PromptTokens: 100_000, TotalTokens: 100_000}
+	tr.Record(FeatureChat, "", "big", usage)
+	tr.Record(FeatureChat, "", "big", usage)
+
+	select {
+	case <-alerts:
+	case <-time.After(time.Second):
+		t.Error("budget alert did not fire")
+	}
+	select {
+	case <-alerts:
+		t.Error("budget alert fired twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if model, ok := tr.Admit(FeatureHeartbeat, "big"); !ok || model != "small" {
+		t.Errorf("Admit(heartbeat) over budget = (%q, %v), want (small, true)", model, ok)
+	}
+	if model, ok := tr.Admit(FeatureChat, "big"); !ok || model != "big" {
+		t.Errorf("Admit(chat) over budget = (%q, %v), want (big, true)", model, ok)
+	}
+
+	tr.SetCostConfig(config.CostConfig{
+		Prices:      map[string]config.ModelPrice{"big": {Input: 10, Output: 10}},
+		DailyBudget: 1,
+		OverBudget:  PolicyBlock,
+	})
+	if _, ok := tr.Admit(FeatureCouncil, "big"); ok {
+		t.Error("Admit(council) should be blocked over budget")
+	}
+}
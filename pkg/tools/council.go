@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/council"
+	"github.com/sipeed/picoclaw/pkg/telemetry"
+	"github.com/sipeed/picoclaw/pkg/tracing"
 )
 
 // CouncilTool wraps the council deliberation engine as an LLM-callable tool.
@@ -15,6 +17,7 @@ type CouncilTool struct {
 	sendCallback   SendCallback
 	defaultChannel string
 	defaultChatID  string
+	tracker        *telemetry.Tracker
 }
 
 func NewCouncilTool(c *council.Council) *CouncilTool {
@@ -53,19 +56,30 @@ func (t *CouncilTool) SetSendCallback(callback SendCallback) {
 	t.sendCallback = callback
 }
 
+// SetTracker enables the over-budget policy check before convening the council.
+func (t *CouncilTool) SetTracker(tracker *telemetry.Tracker) {
+	t.tracker = tracker
+}
+
 func (t *CouncilTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	question, ok := args["question"].(string)
 	if !ok || question == "" {
 		return ErrorResult("question is required")
 	}
 
+	if t.tracker != nil {
+		if _, ok := t.tracker.Admit(telemetry.FeatureCouncil, ""); !ok {
+			return ErrorResult("Council is paused: LLM budget exceeded")
+		}
+	}
+
 	// Notify user that deliberation is starting
 	if t.sendCallback != nil && t.defaultChannel != "" && t.defaultChatID != "" {
 		t.sendCallback(t.defaultChannel, t.defaultChatID, "Convocando al consejo... 🏛️")
 	}
 
 	// Use own timeout (4 min) since the global tool timeout (120s) is too short for 3 LLM calls
-	deliberateCtx, cancel := context.WithTimeout(context.Background(), 4*time.Minute)
+	deliberateCtx, cancel := context.WithTimeout(tracing.Detach(ctx), 4*time.Minute)
 	defer cancel()
 
 	responses, err := t.council.Deliberate(deliberateCtx, question)
@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/documents"
+)
+
+// DocumentTool pages through and searches documents ingested from chat
+// attachments (or from workspace files via the ingest action).
+type DocumentTool struct {
+	store     *documents.Store
+	workspace string
+	restrict  bool
+}
+
+func NewDocumentTool(store *documents.Store, workspace string, restrict bool) *DocumentTool {
+	return &DocumentTool{store: store, workspace: workspace, restrict: restrict}
+}
+
+func (t *DocumentTool) Name() string { return "document" }
+
+func (t *DocumentTool) Description() string {
+	return "Read and search documents the user sent (PDF, DOCX, XLSX, CSV, HTML, text). Documents are stored as numbered pages; use list to find ids, read to get a page, search to find pages mentioning something, ingest to add a workspace file."
+}
+
+func (t *DocumentTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "read", "search", "ingest", "delete"},
+				"description": "Action to perform",
+			},
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "Document id, e.g. doc_1a2b3c4d (required for read and delete; optional for search to limit it to one document)",
+			},
+			"page": map[string]interface{}{
+				"type":        "integer",
+				"description": "Page number to read, starting at 1 (default 1)",
+			},
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Words to search for (for search)",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "File path to ingest (for ingest)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *DocumentTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	id, _ := args["id"].(string)
+
+	switch action {
+	case "list":
+		return t.list()
+	case "read":
+		page := 1
+		if p, ok := args["page"].(float64); ok && p > 0 {
+			page = int(p)
+		}
+		return t.read(id, page)
+	case "search":
+		query, _ := args["query"].(string)
+		return t.search(id, query)
+	case "ingest":
+		path, _ := args["path"].(string)
+		return t.ingest(path)
+	case "delete":
+		if err := t.store.Delete(id); err != nil {
+			return ErrorResult(err.Error())
+		}
+		return SilentResult(fmt.Sprintf("Document %s deleted", id))
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *DocumentTool) list() *ToolResult {
+	docs, err := t.store.List()
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to list documents: %v", err))
+	}
+	if len(docs) == 0 {
+		return SilentResult("No documents stored")
+	}
+
+	lines := make([]string, 0, len(docs))
+	for _, d := range docs {
+		lines = append(lines, fmt.Sprintf("- %s: %s (%d pages, %d chars, %s)",
+			d.ID, d.Name, d.Pages, d.Chars, d.CreatedAt.Format("2006-01-02 15:04")))
+	}
+	return SilentResult(fmt.Sprintf("%d document(s):\n%s", len(docs), strings.Join(lines, "\n")))
+}
+
+func (t *DocumentTool) read(id string, page int) *ToolResult {
+	if id == "" {
+		return ErrorResult("id is required for read")
+	}
+	text, doc, err := t.store.Page(id, page)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	header := fmt.Sprintf("%s — page %d of %d", doc.Name, page, doc.Pages)
+	if page < doc.Pages {
+		header += fmt.Sprintf(" (next: page %d)", page+1)
+	}
+	return SilentResult(header + "\n\n" + text)
+}
+
+func (t *DocumentTool) search(id, query string) *ToolResult {
+	matches, err := t.store.Search(id, query, 8)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	if len(matches) == 0 {
+		return SilentResult(fmt.Sprintf("No pages match %q", query))
+	}
+
+	lines := make([]string, 0, len(matches))
+	for _, m := range matches {
+		lines = append(lines, fmt.Sprintf("- %s (%s) page %d: %s", m.DocID, m.DocName, m.Page, m.Snippet))
+	}
+	return SilentResult(fmt.Sprintf("%d matching page(s):\n%s", len(matches), strings.Join(lines, "\n")))
+}
+
+func (t *DocumentTool) ingest(path string) *ToolResult {
+	if path == "" {
+		return ErrorResult("path is required for ingest")
+	}
+	resolved, err := validatePath(path, t.workspace, t.restrict)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	name := filepath.Base(resolved)
+	if !documents.Supported(name, "") {
+		return ErrorResult(fmt.Sprintf("unsupported document type: %s", name))
+	}
+	doc, err := t.store.Ingest(resolved, name, "")
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to ingest %s: %v", name, err))
+	}
+	return SilentResult(fmt.Sprintf("Ingested %s as %s (%d pages, %d chars)", name, doc.ID, doc.Pages, doc.Chars))
+}
@@ -3,12 +3,18 @@ package tools
 import (
 	"context"
 	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
 type SendCallback func(channel, chatID, content string) error
 
+// RichSendCallback sends a message with buttons, choices or a card.
+type RichSendCallback func(msg bus.OutboundMessage) error
+
 type MessageTool struct {
 	sendCallback   SendCallback
+	richCallback   RichSendCallback
 	defaultChannel string
 	defaultChatID  string
 	sentInRound    bool   // Tracks whether a message was sent in the current processing round
@@ -24,7 +30,8 @@ func (t *MessageTool) Name() string {
 }
 
 func (t *MessageTool) Description() string {
-	return "Send a message to user on a chat channel. Use this when you want to communicate something."
+	return "Send a message to user on a chat channel. Use this when you want to communicate something. " +
+		"Add buttons for quick replies, choices for a list to pick from, or a card; the user's pick comes back as their next message."
 }
 
 func (t *MessageTool) Parameters() map[string]interface{} {
@@ -43,6 +50,26 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Optional: target chat/user ID",
 			},
+			"buttons": map[string]interface{}{
+				"type":        "array",
+				"description": "Optional: quick reply buttons (short labels)",
+				"items":       map[string]interface{}{"type": "string"},
+			},
+			"choices": map[string]interface{}{
+				"type":        "array",
+				"description": "Optional: options for the user to pick one from",
+				"items":       map[string]interface{}{"type": "string"},
+			},
+			"card": map[string]interface{}{
+				"type":        "object",
+				"description": "Optional: a card with title, text, image_url and url",
+				"properties": map[string]interface{}{
+					"title":     map[string]interface{}{"type": "string"},
+					"text":      map[string]interface{}{"type": "string"},
+					"image_url": map[string]interface{}{"type": "string"},
+					"url":       map[string]interface{}{"type": "string"},
+				},
+			},
 		},
 		"required": []string{"content"},
 	}
@@ -69,6 +96,10 @@ func (t *MessageTool) SetSendCallback(callback SendCallback) {
 	t.sendCallback = callback
 }
 
+func (t *MessageTool) SetRichSendCallback(callback RichSendCallback) {
+	t.richCallback = callback
+}
+
 func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	content, ok := args["content"].(string)
 	if !ok {
@@ -93,7 +124,22 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
 	}
 
-	if err := t.sendCallback(channel, chatID, content); err != nil {
+	msg := bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: content,
+		Buttons: parseButtons(args["buttons"]),
+		Choices: parseButtons(args["choices"]),
+		Card:    parseCard(args["card"]),
+	}
+
+	var err error
+	if msg.IsRich() && t.richCallback != nil {
+		err = t.richCallback(msg)
+	} else {
+		err = t.sendCallback(channel, chatID, content)
+	}
+	if err != nil {
 		return &ToolResult{
 			ForLLM:  fmt.Sprintf("sending message: %v", err),
 			IsError: true,
@@ -109,3 +155,40 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		Silent: true,
 	}
 }
+
+// parseButtons reads a list of labels, or of {"label", "value"} objects.
+func parseButtons(raw interface{}) []bus.Button {
+	items, _ := raw.([]interface{})
+	var buttons []bus.Button
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			if v != "" {
+				buttons = append(buttons, bus.Button{Label: v})
+			}
+		case map[string]interface{}:
+			label, _ := v["label"].(string)
+			value, _ := v["value"].(string)
+			if label != "" {
+				buttons = append(buttons, bus.Button{Label: label, Value: value})
+			}
+		}
+	}
+	return buttons
+}
+
+func parseCard(raw interface{}) *bus.Card {
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	card := &bus.Card{}
+	card.Title, _ = m["title"].(string)
+	card.Text, _ = m["text"].(string)
+	card.ImageURL, _ = m["image_url"].(string)
+	card.URL, _ = m["url"].(string)
+	if *card == (bus.Card{}) {
+		return nil
+	}
+	return card
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
 func TestMessageTool_Execute_Success(t *testing.T) {
@@ -257,3 +259,30 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+func TestMessageTool_Execute_RichMessage(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "42")
+	tool.SetSendCallback(func(channel, chatID, content string) error {
+		t.Error("rich message sent through the text callback")
+		return nil
+	})
+
+	var sent bus.OutboundMessage
+	tool.SetRichSendCallback(func(msg bus.OutboundMessage) error {
+		sent = msg
+		return nil
+	})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"content": "Which one?",
+		"buttons": []interface{}{"A", map[string]interface{}{"label": "B", "value": "b"}},
+		"card":    map[string]interface{}{"title": "Menu"},
+	})
+	if result.IsError {
+		t.Fatalf("Execute failed: %s", result.ForLLM)
+	}
+	if sent.ChatID != "42" || len(sent.Buttons) != 2 || sent.Buttons[1].Payload() != "b" || sent.Card == nil || sent.Card.Title != "Menu" {
+		t.Errorf("sent = %+v", sent)
+	}
+}
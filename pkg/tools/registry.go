@@ -6,8 +6,14 @@ import (
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/metrics"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tracing"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 type ToolRegistry struct {
@@ -42,6 +48,9 @@ func (r *ToolRegistry) Execute(ctx context.Context, name string, args map[string
 // If the tool implements AsyncTool and a non-nil callback is provided,
 // the callback will be set on the tool before execution.
 func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args map[string]interface{}, channel, chatID string, asyncCallback AsyncCallback) *ToolResult {
+	ctx, span := tracing.Start(ctx, "tool.execute", attribute.String("picoclaw.tool", name))
+	defer span.End()
+
 	logger.InfoCF("tool", "Tool execution started",
 		map[string]interface{}{
 			"tool": name,
@@ -54,6 +63,7 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 			map[string]interface{}{
 				"tool": name,
 			})
+		span.SetStatus(codes.Error, "tool not found")
 		return ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
 	}
 
@@ -96,6 +106,14 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 	}
 	duration := time.Since(start)
 
+	metrics.ToolDuration.Observe(duration.Seconds(), name)
+	if result.IsError {
+		metrics.ToolCalls.Inc(name, "error")
+		span.SetStatus(codes.Error, utils.Truncate(result.ForLLM, 200))
+	} else {
+		metrics.ToolCalls.Inc(name, "ok")
+	}
+
 	// Log based on result type
 	if result.IsError {
 		logger.ErrorCF("tool", "Tool execution failed",
@@ -6,8 +6,11 @@ import (
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tracing"
 )
 
 type SubagentTask struct {
@@ -149,7 +152,11 @@ func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, call
 	maxIter := sm.maxIterations
 	sm.mu.RUnlock()
 
-	loopResult, err := RunToolLoop(ctx, ToolLoopConfig{
+	spanCtx, span := tracing.Start(ctx, "subagent.run",
+		attribute.String("picoclaw.subagent.id", task.ID),
+		attribute.String("picoclaw.subagent.label", task.Label),
+	)
+	loopResult, err := RunToolLoop(spanCtx, ToolLoopConfig{
 		Provider:      sm.provider,
 		Model:         sm.defaultModel,
 		Tools:         tools,
@@ -159,6 +166,7 @@ func (sm *SubagentManager) runTask(ctx context.Context, task *SubagentTask, call
 			"temperature": 0.7,
 		},
 	}, messages, task.OriginChannel, task.OriginChatID)
+	tracing.End(span, err)
 
 	sm.mu.Lock()
 	var result *ToolResult
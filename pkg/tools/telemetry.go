@@ -28,8 +28,8 @@ func (t *TelemetryTool) Parameters() map[string]interface{} {
 		"properties": map[string]interface{}{
 			"action": map[string]interface{}{
 				"type":        "string",
-				"enum":        []string{"today", "day", "summary"},
-				"description": "Action: 'today' for today's usage, 'day' for a specific date, 'summary' for last 7 days",
+				"enum":        []string{"today", "day", "summary", "budget"},
+				"description": "Action: 'today' for today's usage, 'day' for a specific date, 'summary' for last 7 days, 'budget' for spend against budgets",
 			},
 			"date": map[string]interface{}{
 				"type":        "string",
@@ -67,18 +67,23 @@ func (t *TelemetryTool) Execute(ctx context.Context, args map[string]interface{}
 
 		var grandTotal int64
 		var grandCalls int64
+		var grandCost float64
 		for _, d := range days {
-			sb.WriteString(fmt.Sprintf("%s: %d tokens in %d calls\n",
-				d.Date, d.Totals.TotalTokens, d.Totals.Calls))
+			sb.WriteString(fmt.Sprintf("%s: %d tokens in %d calls, $%.4f\n",
+				d.Date, d.Totals.TotalTokens, d.Totals.Calls, d.Totals.CostUSD))
 			grandTotal += d.Totals.TotalTokens
 			grandCalls += d.Totals.Calls
+			grandCost += d.Totals.CostUSD
 		}
-		sb.WriteString(fmt.Sprintf("\nGrand total: %d tokens in %d calls over %d days\n",
-			grandTotal, grandCalls, len(days)))
+		sb.WriteString(fmt.Sprintf("\nGrand total: %d tokens in %d calls over %d days, $%.4f\n",
+			grandTotal, grandCalls, len(days), grandCost))
 
 		return SilentResult(sb.String())
 
+	case "budget":
+		return SilentResult(telemetry.FormatBudgetStatus(t.tracker.BudgetStatus()))
+
 	default:
-		return ErrorResult("invalid action, use: today, day, or summary")
+		return ErrorResult("invalid action, use: today, day, summary, or budget")
 	}
 }
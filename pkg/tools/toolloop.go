@@ -13,6 +13,8 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/telemetry"
+	"github.com/sipeed/picoclaw/pkg/tracing"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -23,6 +25,8 @@ type ToolLoopConfig struct {
 	Tools         *ToolRegistry
 	MaxIterations int
 	LLMOptions    map[string]any
+	Tracker       *telemetry.Tracker // optional, records token usage and cost
+	Feature       string             // telemetry feature label for Tracker
 }
 
 // ToolLoopResult contains the result of running the tool loop.
@@ -62,7 +66,12 @@ func RunToolLoop(ctx context.Context, config ToolLoopConfig, messages []provider
 		}
 
 		// 3. Call LLM
-		response, err := config.Provider.Chat(ctx, messages, providerToolDefs, config.Model, llmOpts)
+		llmCtx, llmSpan := tracing.StartLLM(ctx, config.Model, iteration)
+		response, err := config.Provider.Chat(llmCtx, messages, providerToolDefs, config.Model, llmOpts)
+		tracing.EndLLM(llmSpan, response, err)
+		if response != nil && config.Tracker != nil {
+			config.Tracker.Record(config.Feature, providers.ProviderName(config.Provider), config.Model, response.Usage)
+		}
 		if err != nil {
 			logger.ErrorCF("toolloop", "LLM call failed",
 				map[string]any{
@@ -97,8 +106,9 @@ func RunToolLoop(ctx context.Context, config ToolLoopConfig, messages []provider
 
 		// 6. Build assistant message with tool calls
 		assistantMsg := providers.Message{
-			Role:    "assistant",
-			Content: response.Content,
+			Role:           "assistant",
+			Content:        response.Content,
+			ThinkingBlocks: response.ThinkingBlocks,
 		}
 		for _, tc := range response.ToolCalls {
 			argumentsJSON, _ := json.Marshal(tc.Arguments)
@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestInjectExtract(t *testing.T) {
+	recorder := recordSpans(t)
+
+	ctx, root := StartRoot(context.Background(), "agent.message")
+	carrier := Inject(ctx)
+	if carrier["traceparent"] == "" {
+		t.Fatalf("carrier = %v, want a traceparent", carrier)
+	}
+	root.End()
+
+	// The outbound send happens later, from a context that only has the
+	// carrier the message brought along.
+	_, send := Start(Extract(context.Background(), carrier), "channel.send")
+	End(send, errors.New("chat not found"))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("spans = %d, want 2", len(spans))
+	}
+	if spans[1].Parent().SpanID() != spans[0].SpanContext().SpanID() {
+		t.Error("channel.send is not a child of agent.message")
+	}
+	if spans[1].Status().Code != codes.Error || len(spans[1].Events()) == 0 {
+		t.Errorf("status = %+v, events = %d", spans[1].Status(), len(spans[1].Events()))
+	}
+
+	if Inject(context.Background()) != nil {
+		t.Error("Inject without a span should return nil")
+	}
+}
+
+func TestLLMSpanAndDetach(t *testing.T) {
+	recorder := recordSpans(t)
+
+	parent, root := StartRoot(context.Background(), "agent.message")
+	ctx, cancel := context.WithCancel(parent)
+	cancel()
+
+	detached := Detach(ctx)
+	if detached.Err() != nil {
+		t.Error("Detach kept the cancellation")
+	}
+	_, llm := StartLLM(detached, "claude-sonnet", 1)
+	EndLLM(llm, &providers.LLMResponse{Usage: &providers.UsageInfo{PromptTokens: 120, CompletionTokens: 30}}, nil)
+	root.End()
+
+	span := recorder.Ended()[0]
+	if span.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Error("llm.chat lost its parent through Detach")
+	}
+	attrs := map[string]int64{}
+	for _, kv := range span.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInt64()
+	}
+	if attrs["gen_ai.usage.input_tokens"] != 120 || attrs["gen_ai.usage.output_tokens"] != 30 {
+		t.Errorf("attributes = %v", span.Attributes())
+	}
+}
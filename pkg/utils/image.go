@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Limits applied to images before they are handed to an LLM provider.
+// MaxImageDimension is Anthropic's recommended long edge (larger images are
+// downscaled server-side anyway); MaxImageBytes keeps the base64 payload
+// under the 5 MB per-image cap, the smallest among supported providers.
+// MaxImagePixels bounds what is decoded at all: a few kilobytes of PNG can
+// declare dimensions whose pixel buffer would take gigabytes.
+const (
+	MaxImageDimension = 1568
+	MaxImageBytes     = 3_750_000
+	MaxImagePixels    = 40_000_000
+
+	maxImageDownload = 20 << 20
+)
+
+var imageExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+
+// IsImageFile checks if a file is an image based on its filename extension and content type.
+func IsImageFile(filename, contentType string) bool {
+	if strings.HasPrefix(strings.ToLower(contentType), "image/") {
+		return true
+	}
+
+	lower := strings.ToLower(filename)
+	for _, ext := range imageExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsImageRef reports whether a media reference (data URI, http(s) URL or
+// local path) points to an image. Local files without a known extension are
+// sniffed.
+func IsImageRef(ref string) bool {
+	switch {
+	case strings.HasPrefix(ref, "data:"):
+		return strings.HasPrefix(ref, "data:image/")
+	case strings.HasPrefix(ref, "http://"), strings.HasPrefix(ref, "https://"):
+		u, err := url.Parse(ref)
+		return err == nil && IsImageFile(u.Path, "")
+	}
+
+	if IsImageFile(ref, "") {
+		return true
+	}
+	f, err := os.Open(ref)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	return strings.HasPrefix(http.DetectContentType(head[:n]), "image/")
+}
+
+// ImageDataURI loads the image at ref (data URI, http(s) URL or local path)
+// and returns it as a base64 data URI within MaxImageDimension and
+// MaxImageBytes, downscaling and re-encoding as JPEG when needed.
+func ImageDataURI(ref string) (string, error) {
+	data, err := readImageRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	data, mediaType, err := NormalizeImage(data)
+	if err != nil {
+		return "", err
+	}
+
+	return encodeDataURI(mediaType, data), nil
+}
+
+// DataURI encodes raw bytes as a base64 data URI, sniffing the media type.
+func DataURI(data []byte) string {
+	return encodeDataURI(http.DetectContentType(data), data)
+}
+
+func encodeDataURI(mediaType string, data []byte) string {
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// ParseDataURI splits a base64 data URI into its media type and payload.
+func ParseDataURI(uri string) (mediaType string, data []byte, err error) {
+	rest, ok := strings.CutPrefix(uri, "data:")
+	if !ok {
+		return "", nil, fmt.Errorf("not a data URI")
+	}
+	meta, payload, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(meta, ";base64") {
+		return "", nil, fmt.Errorf("data URI is not base64 encoded")
+	}
+
+	data, err = base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("decoding data URI: %w", err)
+	}
+	return strings.TrimSuffix(meta, ";base64"), data, nil
+}
+
+// NormalizeImage returns data unchanged when it is already within the image
+// limits, otherwise a downscaled JPEG. Images declaring more than
+// MaxImagePixels are rejected before decoding. WebP cannot be decoded with
+// the standard library, so oversized WebP images are rejected.
+func NormalizeImage(data []byte) ([]byte, string, error) {
+	mediaType := http.DetectContentType(data)
+	if !strings.HasPrefix(mediaType, "image/") {
+		return nil, "", fmt.Errorf("unsupported image type %q", mediaType)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if mediaType == "image/webp" && len(data) <= MaxImageBytes {
+			return data, mediaType, nil
+		}
+		return nil, "", fmt.Errorf("decoding %s image: %w", mediaType, err)
+	}
+
+	if int64(cfg.Width)*int64(cfg.Height) > MaxImagePixels {
+		return nil, "", fmt.Errorf("image %dx%d exceeds %d MP limit", cfg.Width, cfg.Height, MaxImagePixels/1_000_000)
+	}
+
+	if len(data) <= MaxImageBytes && cfg.Width <= MaxImageDimension && cfg.Height <= MaxImageDimension {
+		return data, "image/" + format, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding %s image: %w", format, err)
+	}
+
+	// Shrink until the JPEG fits; each pass also drops the long edge by a quarter.
+	limit := MaxImageDimension
+	for attempt := 0; attempt < 5; attempt++ {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, fitImage(img, limit), &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", fmt.Errorf("encoding image: %w", err)
+		}
+		if buf.Len() <= MaxImageBytes {
+			return buf.Bytes(), "image/jpeg", nil
+		}
+		limit = limit * 3 / 4
+	}
+
+	return nil, "", fmt.Errorf("image too large after downscaling")
+}
+
+func readImageRef(ref string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(ref, "data:"):
+		_, data, err := ParseDataURI(ref)
+		return data, err
+
+	case strings.HasPrefix(ref, "http://"), strings.HasPrefix(ref, "https://"):
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Get(ref)
+		if err != nil {
+			return nil, fmt.Errorf("downloading image %s: %w", path.Base(ref), err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("downloading image: status %d", resp.StatusCode)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageDownload+1))
+		if err != nil {
+			return nil, fmt.Errorf("downloading image: %w", err)
+		}
+		if len(data) > maxImageDownload {
+			return nil, fmt.Errorf("image exceeds %d MB download limit", maxImageDownload>>20)
+		}
+		return data, nil
+	}
+
+	return os.ReadFile(ref)
+}
+
+// fitImage flattens img onto white (JPEG has no alpha) and box-downsamples
+// it so neither edge exceeds limit.
+func fitImage(img image.Image, limit int) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+
+	src := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Over)
+
+	if sw <= limit && sh <= limit {
+		return src
+	}
+
+	dw, dh := limit, sh*limit/sw
+	if sh > sw {
+		dw, dh = sw*limit/sh, limit
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+3]
+					r += uint32(p[0])
+					g += uint32(p[1])
+					bl += uint32(p[2])
+					n++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0x80, 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNormalizeImage_SmallImageUnchanged(t *testing.T) {
+	data := encodePNG(t, 64, 32)
+
+	out, mediaType, err := NormalizeImage(data)
+	if err != nil {
+		t.Fatalf("NormalizeImage() error: %v", err)
+	}
+	if mediaType != "image/png" {
+		t.Errorf("mediaType = %q, want image/png", mediaType)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("small image should pass through unchanged")
+	}
+}
+
+func TestNormalizeImage_Downscales(t *testing.T) {
+	data := encodePNG(t, 3000, 1500)
+
+	out, mediaType, err := NormalizeImage(data)
+	if err != nil {
+		t.Fatalf("NormalizeImage() error: %v", err)
+	}
+	if mediaType != "image/jpeg" {
+		t.Errorf("mediaType = %q, want image/jpeg", mediaType)
+	}
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("output is not a JPEG: %v", err)
+	}
+	if cfg.Width != MaxImageDimension || cfg.Height != MaxImageDimension/2 {
+		t.Errorf("size = %dx%d, want %dx%d", cfg.Width, cfg.Height, MaxImageDimension, MaxImageDimension/2)
+	}
+}
+
+func TestNormalizeImage_RejectsPixelBomb(t *testing.T) {
+	// A bare PNG signature and IHDR chunk declaring 50000x50000 RGBA pixels:
+	// DecodeConfig accepts it, a full decode would allocate ~10 GB.
+	ihdr := make([]byte, 0, 17)
+	ihdr = append(ihdr, "IHDR"...)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 50000)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, 50000)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)-4))
+	data = append(data, ihdr...)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+
+	if _, err := png.DecodeConfig(bytes.NewReader(data)); err != nil {
+		t.Fatalf("crafted header should parse: %v", err)
+	}
+
+	_, _, err := NormalizeImage(data)
+	if err == nil || !strings.Contains(err.Error(), "MP limit") {
+		t.Errorf("NormalizeImage() error = %v, want pixel limit error", err)
+	}
+}
+
+func TestNormalizeImage_RejectsNonImage(t *testing.T) {
+	if _, _, err := NormalizeImage([]byte("just some text")); err == nil {
+		t.Error("expected error for non-image data")
+	}
+}
+
+func TestImageDataURI_LocalFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo")
+	if err := os.WriteFile(path, encodePNG(t, 10, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsImageRef(path) {
+		t.Fatal("IsImageRef should sniff an extensionless PNG")
+	}
+	uri, err := ImageDataURI(path)
+	if err != nil {
+		t.Fatalf("ImageDataURI() error: %v", err)
+	}
+	if !strings.HasPrefix(uri, "data:image/png;base64,") {
+		t.Errorf("uri = %q, want png data URI", uri[:30])
+	}
+
+	mediaType, data, err := ParseDataURI(uri)
+	if err != nil || mediaType != "image/png" || len(data) == 0 {
+		t.Errorf("ParseDataURI() = %q, %d bytes, %v", mediaType, len(data), err)
+	}
+}
+
+func TestIsImageRef(t *testing.T) {
+	tests := map[string]bool{
+		"data:image/jpeg;base64,abc":                    true,
+		"data:audio/ogg;base64,abc":                     false,
+		"https://cdn.example.com/a/b.PNG?ex=1&is=2":     true,
+		"https://cdn.example.com/voice.ogg":             false,
+		filepath.Join(os.TempDir(), "missing-file.jpg"): true,
+	}
+	for ref, want := range tests {
+		if got := IsImageRef(ref); got != want {
+			t.Errorf("IsImageRef(%q) = %v, want %v", ref, got, want)
+		}
+	}
+}
@@ -46,6 +46,21 @@ func SanitizeFilename(filename string) string {
 	return base
 }
 
+// downloadPrefixLen is the length of the "xxxxxxxx_" prefix DownloadFile
+// puts in front of filenames.
+const downloadPrefixLen = 9
+
+// DownloadedFilename returns the original filename of a file saved by
+// DownloadFile, without its unique prefix.
+func DownloadedFilename(localPath string) string {
+	base := filepath.Base(localPath)
+	if len(base) > downloadPrefixLen && base[downloadPrefixLen-1] == '_' &&
+		strings.Contains(localPath, "picoclaw_media") {
+		return base[downloadPrefixLen:]
+	}
+	return base
+}
+
 // DownloadOptions holds optional parameters for downloading files
 type DownloadOptions struct {
 	Timeout      time.Duration
@@ -64,18 +79,6 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		opts.LoggerPrefix = "utils"
 	}
 
-	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
-	if err := os.MkdirAll(mediaDir, 0700); err != nil {
-		logger.ErrorCF(opts.LoggerPrefix, "Failed to create media directory", map[string]interface{}{
-			"error": err.Error(),
-		})
-		return ""
-	}
-
-	// Generate unique filename with UUID prefix to prevent conflicts
-	safeName := SanitizeFilename(filename)
-	localPath := filepath.Join(mediaDir, uuid.New().String()[:8]+"_"+safeName)
-
 	// Create HTTP request
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -109,28 +112,51 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		return ""
 	}
 
+	localPath := SaveMedia(resp.Body, filename, opts.LoggerPrefix)
+	if localPath == "" {
+		return ""
+	}
+
+	logger.DebugCF(opts.LoggerPrefix, "File downloaded successfully", map[string]interface{}{
+		"path": localPath,
+	})
+
+	return localPath
+}
+
+// SaveMedia writes r to a uniquely named file in the media temp directory,
+// where DownloadedFilename can recover filename from it. Returns the local
+// file path or empty string on error.
+func SaveMedia(r io.Reader, filename, loggerPrefix string) string {
+	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	if err := os.MkdirAll(mediaDir, 0700); err != nil {
+		logger.ErrorCF(loggerPrefix, "Failed to create media directory", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return ""
+	}
+
+	// Generate unique filename with UUID prefix to prevent conflicts
+	safeName := SanitizeFilename(filename)
+	localPath := filepath.Join(mediaDir, uuid.New().String()[:downloadPrefixLen-1]+"_"+safeName)
+
 	out, err := os.Create(localPath)
 	if err != nil {
-		logger.ErrorCF(opts.LoggerPrefix, "Failed to create local file", map[string]interface{}{
+		logger.ErrorCF(loggerPrefix, "Failed to create local file", map[string]interface{}{
 			"error": err.Error(),
 		})
 		return ""
 	}
 	defer out.Close()
 
-	if _, err := io.Copy(out, resp.Body); err != nil {
+	if _, err := io.Copy(out, r); err != nil {
 		out.Close()
 		os.Remove(localPath)
-		logger.ErrorCF(opts.LoggerPrefix, "Failed to write file", map[string]interface{}{
+		logger.ErrorCF(loggerPrefix, "Failed to write file", map[string]interface{}{
 			"error": err.Error(),
 		})
 		return ""
 	}
-
-	logger.DebugCF(opts.LoggerPrefix, "File downloaded successfully", map[string]interface{}{
-		"path": localPath,
-	})
-
 	return localPath
 }
 
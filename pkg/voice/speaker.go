@@ -0,0 +1,302 @@
+package voice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Reply modes for voice answers.
+const (
+	ReplyAuto   = "auto"   // speak answers to voice messages
+	ReplyAlways = "always" // speak every answer
+	ReplyOff    = "off"    // never speak
+)
+
+// Format is the container a channel needs for voice notes.
+type Format string
+
+const (
+	FormatOpus Format = "ogg" // Ogg/Opus, what Telegram and WhatsApp show as voice notes
+	FormatMP3  Format = "mp3"
+)
+
+// speechChunkChars bounds each synthesis request: OpenAI rejects input over
+// 4096 characters, and shorter pieces keep edge-tts and piper responsive.
+const speechChunkChars = 1000
+
+// Speaker produces voice replies: it resolves the voice for a chat from its
+// preferences, synthesizes long answers in chunks and joins them into the
+// format the channel needs.
+type Speaker struct {
+	synth Synthesizer
+	cfg   config.TTSConfig
+	prefs *Preferences
+}
+
+// NewSpeaker builds the speaker for cfg.Voice.TTS, or returns nil when
+// text-to-speech is disabled.
+func NewSpeaker(cfg *config.Config) *Speaker {
+	tc := cfg.Voice.TTS
+	var synth Synthesizer
+	switch strings.ToLower(tc.Provider) {
+	case "", "none", "off":
+		return nil
+	case "edge", "edge-tts":
+		synth = NewEdgeSynthesizer(tc.Voice)
+	case "piper":
+		synth = NewPiperSynthesizer(tc.PiperBinary, tc.Voice, tc.PiperModels)
+	case "openai":
+		apiKey := tc.APIKey
+		if apiKey == "" && tc.APIBase == "" {
+			apiKey = cfg.Providers.OpenAI.APIKey
+		}
+		synth = NewOpenAISynthesizer(tc.APIBase, apiKey, tc.Model, tc.Voice)
+	default:
+		logger.WarnCF("voice", "Unknown TTS provider", map[string]interface{}{"provider": tc.Provider})
+		return nil
+	}
+	return &Speaker{synth: synth, cfg: tc, prefs: NewPreferences(cfg.WorkspacePath())}
+}
+
+// NewSpeakerWith builds a speaker around an existing synthesizer.
+func NewSpeakerWith(synth Synthesizer, cfg config.TTSConfig, prefs *Preferences) *Speaker {
+	return &Speaker{synth: synth, cfg: cfg, prefs: prefs}
+}
+
+// MaxChars is the longest answer spoken; longer ones are sent as text.
+func (s *Speaker) MaxChars() int {
+	if s.cfg.MaxChars > 0 {
+		return s.cfg.MaxChars
+	}
+	return 1500
+}
+
+// ShouldSpeak reports whether the answer for chat key should be spoken,
+// given whether the user's last message was a voice message.
+func (s *Speaker) ShouldSpeak(key string, inputWasVoice bool) bool {
+	mode := s.prefs.Get(key).Reply
+	if mode == "" {
+		mode = s.cfg.Reply
+	}
+	switch mode {
+	case ReplyAlways:
+		return true
+	case ReplyOff:
+		return false
+	default:
+		return inputWasVoice
+	}
+}
+
+// Speak synthesizes text with the voice chosen for chat key and returns the
+// path of a temp audio file in the given format; the caller removes it.
+func (s *Speaker) Speak(ctx context.Context, key, text string, format Format) (string, error) {
+	voice := s.voiceFor(key)
+
+	var parts []string
+	defer func() {
+		for _, p := range parts {
+			os.Remove(p)
+		}
+	}()
+	for _, chunk := range SplitSpeech(text, speechChunkChars) {
+		part, err := s.synth.Synthesize(ctx, chunk, voice)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("nothing to speak")
+	}
+
+	// A single piece already in the right container needs no transcoding.
+	if len(parts) == 1 && strings.EqualFold(filepath.Ext(parts[0]), "."+string(format)) {
+		out := parts[0]
+		parts = nil
+		return out, nil
+	}
+	return joinAudio(ctx, parts, format)
+}
+
+// voiceFor resolves the voice for a chat: an explicit per-chat voice, then
+// the configured voice for the chat's language, then the default.
+func (s *Speaker) voiceFor(key string) string {
+	pref := s.prefs.Get(key)
+	if pref.Voice != "" {
+		return pref.Voice
+	}
+	if v, ok := s.cfg.Voices[pref.Language]; ok && pref.Language != "" {
+		return v
+	}
+	return s.cfg.Voice
+}
+
+// joinAudio concatenates parts with ffmpeg and encodes them as format.
+func joinAudio(ctx context.Context, parts []string, format Format) (string, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg is required to encode voice replies")
+	}
+
+	out, err := tempAudioFile("." + string(format))
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"-y", "-loglevel", "error"}
+	var filter strings.Builder
+	for i, p := range parts {
+		args = append(args, "-i", p)
+		fmt.Fprintf(&filter, "[%d:a]", i)
+	}
+	fmt.Fprintf(&filter, "concat=n=%d:v=0:a=1", len(parts))
+	args = append(args, "-filter_complex", filter.String())
+
+	switch format {
+	case FormatOpus:
+		args = append(args, "-c:a", "libopus", "-b:a", "48k")
+	default:
+		args = append(args, "-c:a", "libmp3lame", "-q:a", "4")
+	}
+	args = append(args, out)
+
+	if output, err := exec.CommandContext(ctx, ffmpeg, args...).CombinedOutput(); err != nil {
+		os.Remove(out)
+		return "", fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return out, nil
+}
+
+// SplitSpeech splits text into pieces of at most size characters at
+// sentence boundaries, falling back to word boundaries for long sentences.
+func SplitSpeech(text string, size int) []string {
+	var chunks []string
+	var current strings.Builder
+
+	flush := func() {
+		if c := strings.TrimSpace(current.String()); c != "" {
+			chunks = append(chunks, c)
+		}
+		current.Reset()
+	}
+	add := func(piece string) {
+		if current.Len() > 0 && utf8.RuneCountInString(current.String())+1+utf8.RuneCountInString(piece) > size {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteByte(' ')
+		}
+		current.WriteString(piece)
+	}
+
+	for _, sentence := range splitSentences(text) {
+		if utf8.RuneCountInString(sentence) <= size {
+			add(sentence)
+			continue
+		}
+		for _, word := range strings.Fields(sentence) {
+			add(word)
+		}
+	}
+	flush()
+	return chunks
+}
+
+// splitSentences breaks text after ., !, ? and newlines.
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i, r := range text {
+		end := -1
+		switch r {
+		case '\n':
+			end = i
+		case '.', '!', '?':
+			if next := i + 1; next == len(text) || text[next] == ' ' || text[next] == '\n' {
+				end = next
+			}
+		}
+		if end >= 0 {
+			if s := strings.TrimSpace(text[start:end]); s != "" {
+				sentences = append(sentences, s)
+			}
+			start = end
+		}
+	}
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
+
+// Preference is a chat's voice reply setting. Empty fields inherit the
+// configured defaults.
+type Preference struct {
+	Voice    string `json:"voice,omitempty"`
+	Language string `json:"language,omitempty"`
+	Reply    string `json:"reply,omitempty"`
+}
+
+// Preferences stores per-chat voice settings in
+// <workspace>/voice/preferences.json, keyed by "channel:chat_id". The file
+// is re-read on every access so the agent (which changes settings via
+// /voice) and the channels (which read them) can use separate instances.
+type Preferences struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewPreferences(workspace string) *Preferences {
+	return &Preferences{path: filepath.Join(workspace, "voice", "preferences.json")}
+}
+
+func (p *Preferences) Get(key string) Preference {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.load()[key]
+}
+
+// Set stores pref for key; an empty preference removes the entry.
+func (p *Preferences) Set(key string, pref Preference) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	all := p.load()
+	if pref == (Preference{}) {
+		delete(all, key)
+	} else {
+		all[key] = pref
+	}
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+func (p *Preferences) load() map[string]Preference {
+	all := map[string]Preference{}
+	if data, err := os.ReadFile(p.path); err == nil {
+		json.Unmarshal(data, &all)
+	}
+	return all
+}
@@ -0,0 +1,147 @@
+package voice
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type fakeSynthesizer struct {
+	calls  []string
+	voices []string
+}
+
+func (f *fakeSynthesizer) Synthesize(ctx context.Context, text, voice string) (string, error) {
+	f.calls = append(f.calls, text)
+	f.voices = append(f.voices, voice)
+	out, err := tempAudioFile(".mp3")
+	if err != nil {
+		return "", err
+	}
+	return out, os.WriteFile(out, []byte(text), 0644)
+}
+
+func (f *fakeSynthesizer) IsAvailable() bool { return true }
+
+func TestSplitSpeech(t *testing.T) {
+	text := "First sentence. Second one! Third? " + strings.Repeat("word ", 40)
+	chunks := SplitSpeech(text, 50)
+	if len(chunks) < 4 {
+		t.Fatalf("expected several chunks, got %q", chunks)
+	}
+	if !strings.HasPrefix(chunks[0], "First sentence. Second one! Third?") {
+		t.Errorf("first chunk = %q", chunks[0])
+	}
+	for _, c := range chunks {
+		if utf8.RuneCountInString(c) > 50 {
+			t.Errorf("chunk over limit: %q", c)
+		}
+	}
+	if got := strings.Join(strings.Fields(strings.Join(chunks, " ")), " "); got != strings.Join(strings.Fields(text), " ") {
+		t.Errorf("chunks lost text: %q", got)
+	}
+	if got := SplitSpeech("v1.2 is out", 50); len(got) != 1 {
+		t.Errorf("decimal point split the sentence: %q", got)
+	}
+}
+
+func TestSpeakerPreferences(t *testing.T) {
+	prefs := NewPreferences(t.TempDir())
+	synth := &fakeSynthesizer{}
+	s := NewSpeakerWith(synth, config.TTSConfig{
+		Voice:  "default-voice",
+		Voices: map[string]string{"en": "english-voice"},
+		Reply:  ReplyAuto,
+	}, prefs)
+
+	const key = "discord:123"
+	if s.ShouldSpeak(key, false) || !s.ShouldSpeak(key, true) {
+		t.Error("auto mode should only speak after voice input")
+	}
+
+	prefs.Set(key, Preference{Reply: ReplyAlways, Language: "en"})
+	if !s.ShouldSpeak(key, false) {
+		t.Error("always mode should speak")
+	}
+
+	path, err := s.Speak(context.Background(), key, "Hello there.", FormatMP3)
+	if err != nil {
+		t.Fatalf("Speak: %v", err)
+	}
+	defer os.Remove(path)
+	if synth.voices[0] != "english-voice" {
+		t.Errorf("voice = %q, want the configured voice for en", synth.voices[0])
+	}
+	if data, _ := os.ReadFile(path); string(data) != "Hello there." {
+		t.Errorf("single mp3 chunk should be returned as is, got %q", data)
+	}
+
+	prefs.Set(key, Preference{Reply: ReplyOff, Voice: "custom"})
+	if s.ShouldSpeak(key, true) {
+		t.Error("off mode should never speak")
+	}
+	if got := s.voiceFor(key); got != "custom" {
+		t.Errorf("voiceFor = %q", got)
+	}
+
+	prefs.Set(key, Preference{})
+	if got := prefs.Get(key); got != (Preference{}) {
+		t.Errorf("empty preference should be removed, got %+v", got)
+	}
+}
+
+func TestNewSpeaker(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	if s := NewSpeaker(cfg); s == nil {
+		t.Fatal("default config should enable edge-tts")
+	} else if _, ok := s.synth.(*EdgeSynthesizer); !ok {
+		t.Errorf("synth = %T", s.synth)
+	}
+
+	cfg.Voice.TTS.Provider = "none"
+	if NewSpeaker(cfg) != nil {
+		t.Error("provider none should disable speech")
+	}
+}
+
+func TestPiperModelFor(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"default.onnx", "en_US-amy.onnx"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewPiperSynthesizer("", filepath.Join(dir, "default.onnx"), "")
+
+	tests := []struct {
+		voice string
+		want  string // model file, or "" for an error
+	}{
+		{"", filepath.Join(dir, "default.onnx")},
+		{"en_US-amy", filepath.Join(dir, "en_US-amy.onnx")},
+		{"en_US-amy.onnx", filepath.Join(dir, "en_US-amy.onnx")},
+		{"missing", ""},
+		{"/etc/passwd", ""},
+		{"../default", ""},
+		{"--help", ""},
+		{".onnx", ""},
+	}
+	for _, tt := range tests {
+		got, err := s.modelFor(tt.voice)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("modelFor(%q) = %q, want an error", tt.voice, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("modelFor(%q) = %q, %v, want %q", tt.voice, got, err, tt.want)
+		}
+	}
+}
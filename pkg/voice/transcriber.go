@@ -1,25 +1,17 @@
 package voice
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"mime/multipart"
-	"net/http"
-	"os"
-	"path/filepath"
-	"time"
+	"strings"
 
+	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
-	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
-type GroqTranscriber struct {
-	apiKey     string
-	apiBase    string
-	httpClient *http.Client
+// Transcriber turns a received audio file into text.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audioFilePath string) (*TranscriptionResponse, error)
+	IsAvailable() bool
 }
 
 type TranscriptionResponse struct {
@@ -28,132 +20,73 @@ type TranscriptionResponse struct {
 	Duration float64 `json:"duration,omitempty"`
 }
 
-func NewGroqTranscriber(apiKey string) *GroqTranscriber {
-	logger.DebugCF("voice", "Creating Groq transcriber", map[string]interface{}{"has_api_key": apiKey != ""})
-
-	apiBase := "https://api.groq.com/openai/v1"
-	return &GroqTranscriber{
-		apiKey:  apiKey,
-		apiBase: apiBase,
-		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
-		},
-	}
-}
-
-func (t *GroqTranscriber) Transcribe(ctx context.Context, audioFilePath string) (*TranscriptionResponse, error) {
-	logger.InfoCF("voice", "Starting transcription", map[string]interface{}{"audio_file": audioFilePath})
-
-	audioFile, err := os.Open(audioFilePath)
-	if err != nil {
-		logger.ErrorCF("voice", "Failed to open audio file", map[string]interface{}{"path": audioFilePath, "error": err})
-		return nil, fmt.Errorf("failed to open audio file: %w", err)
-	}
-	defer audioFile.Close()
-
-	fileInfo, err := audioFile.Stat()
-	if err != nil {
-		logger.ErrorCF("voice", "Failed to get file info", map[string]interface{}{"path": audioFilePath, "error": err})
-		return nil, fmt.Errorf("failed to get file info: %w", err)
-	}
-
-	logger.DebugCF("voice", "Audio file details", map[string]interface{}{
-		"size_bytes": fileInfo.Size(),
-		"file_name":  filepath.Base(audioFilePath),
-	})
-
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-
-	part, err := writer.CreateFormFile("file", filepath.Base(audioFilePath))
-	if err != nil {
-		logger.ErrorCF("voice", "Failed to create form file", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to create form file: %w", err)
-	}
-
-	copied, err := io.Copy(part, audioFile)
-	if err != nil {
-		logger.ErrorCF("voice", "Failed to copy file content", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to copy file content: %w", err)
-	}
-
-	logger.DebugCF("voice", "File copied to request", map[string]interface{}{"bytes_copied": copied})
-
-	if err := writer.WriteField("model", "whisper-large-v3"); err != nil {
-		logger.ErrorCF("voice", "Failed to write model field", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to write model field: %w", err)
-	}
-
-	if err := writer.WriteField("response_format", "json"); err != nil {
-		logger.ErrorCF("voice", "Failed to write response_format field", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to write response_format field: %w", err)
-	}
-
-	if err := writer.Close(); err != nil {
-		logger.ErrorCF("voice", "Failed to close multipart writer", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
-	}
+const (
+	groqAPIBase = "https://api.groq.com/openai/v1"
+	groqModel   = "whisper-large-v3"
 
-	url := t.apiBase + "/audio/transcriptions"
-	req, err := http.NewRequestWithContext(ctx, "POST", url, &requestBody)
-	if err != nil {
-		logger.ErrorCF("voice", "Failed to create request", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Authorization", "Bearer "+t.apiKey)
+	openAIAPIBase = "https://api.openai.com/v1"
+	openAIModel   = "whisper-1"
+)
 
-	logger.DebugCF("voice", "Sending transcription request to Groq API", map[string]interface{}{
-		"url":                url,
-		"request_size_bytes": requestBody.Len(),
-		"file_size_bytes":    fileInfo.Size(),
-	})
+// GroqTranscriber is the OpenAI-compatible transcriber preset for Groq's
+// hosted Whisper.
+type GroqTranscriber struct {
+	*OpenAITranscriber
+}
 
-	resp, err := t.httpClient.Do(req)
-	if err != nil {
-		logger.ErrorCF("voice", "Failed to send request", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
+func NewGroqTranscriber(apiKey string) *GroqTranscriber {
+	return &GroqTranscriber{NewOpenAITranscriber(groqAPIBase, apiKey, groqModel, "")}
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.ErrorCF("voice", "Failed to read response", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
+func (t *GroqTranscriber) IsAvailable() bool {
+	available := t.apiKey != ""
+	logger.DebugCF("voice", "Checking transcriber availability", map[string]interface{}{"available": available})
+	return available
+}
 
-	if resp.StatusCode != http.StatusOK {
-		logger.ErrorCF("voice", "API error", map[string]interface{}{
-			"status_code": resp.StatusCode,
-			"response":    string(body),
-		})
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+// NewTranscriber builds the transcriber selected by cfg.Voice.Transcriber,
+// or returns nil when speech-to-text is not configured. With no backend
+// set, Groq is used if a Groq API key is present.
+func NewTranscriber(cfg *config.Config) Transcriber {
+	vc := cfg.Voice
+	backend := strings.ToLower(vc.Transcriber)
+	if backend == "" && cfg.Providers.Groq.APIKey != "" {
+		backend = "groq"
 	}
 
-	logger.DebugCF("voice", "Received response from Groq API", map[string]interface{}{
-		"status_code":         resp.StatusCode,
-		"response_size_bytes": len(body),
-	})
-
-	var result TranscriptionResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		logger.ErrorCF("voice", "Failed to unmarshal response", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	switch backend {
+	case "":
+		return nil
+	case "none", "off":
+		return nil
+	case "groq":
+		apiKey := firstNonEmpty(vc.APIKey, cfg.Providers.Groq.APIKey)
+		if apiKey == "" {
+			logger.WarnC("voice", "Groq transcriber selected but no Groq API key is configured")
+			return nil
+		}
+		apiBase := firstNonEmpty(vc.APIBase, cfg.Providers.Groq.APIBase, groqAPIBase)
+		return &GroqTranscriber{NewOpenAITranscriber(apiBase, apiKey, firstNonEmpty(vc.Model, groqModel), vc.Language)}
+	case "openai":
+		apiBase := firstNonEmpty(vc.APIBase, openAIAPIBase)
+		apiKey := vc.APIKey
+		if apiKey == "" && vc.APIBase == "" {
+			apiKey = cfg.Providers.OpenAI.APIKey
+		}
+		return NewOpenAITranscriber(apiBase, apiKey, firstNonEmpty(vc.Model, openAIModel), vc.Language)
+	case "whisper_cpp", "whisper.cpp", "whispercpp":
+		return NewWhisperCppTranscriber(vc.WhisperCppBinary, vc.WhisperCppModel, vc.Language)
+	default:
+		logger.WarnCF("voice", "Unknown transcriber backend", map[string]interface{}{"transcriber": vc.Transcriber})
+		return nil
 	}
-
-	logger.InfoCF("voice", "Transcription completed successfully", map[string]interface{}{
-		"text_length":           len(result.Text),
-		"language":              result.Language,
-		"duration_seconds":      result.Duration,
-		"transcription_preview": utils.Truncate(result.Text, 50),
-	})
-
-	return &result, nil
 }
 
-func (t *GroqTranscriber) IsAvailable() bool {
-	available := t.apiKey != ""
-	logger.DebugCF("voice", "Checking transcriber availability", map[string]interface{}{"available": available})
-	return available
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
@@ -0,0 +1,91 @@
+package voice
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestOpenAITranscriberTranscribe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("FormFile: %v", err)
+		}
+		data, _ := io.ReadAll(file)
+		if header.Filename != "note.ogg" || string(data) != "audio" {
+			t.Errorf("file = %s %q", header.Filename, data)
+		}
+		if r.FormValue("model") != "base" || r.FormValue("language") != "es" {
+			t.Errorf("model=%q language=%q", r.FormValue("model"), r.FormValue("language"))
+		}
+		w.Write([]byte(`{"text":" hola mundo ","language":"es"}`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "note.ogg")
+	os.WriteFile(path, []byte("audio"), 0644)
+
+	tr := NewOpenAITranscriber(srv.URL+"/v1/", "", "base", "es")
+	if !tr.IsAvailable() {
+		t.Fatal("local endpoint without key should be available")
+	}
+	result, err := tr.Transcribe(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+	if result.Text != "hola mundo" || result.Language != "es" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestNewTranscriber(t *testing.T) {
+	cfg := config.DefaultConfig()
+	if tr := NewTranscriber(cfg); tr != nil {
+		t.Errorf("unconfigured: got %T", tr)
+	}
+
+	cfg.Providers.Groq.APIKey = "gsk-test"
+	if tr, ok := NewTranscriber(cfg).(*GroqTranscriber); !ok || !tr.IsAvailable() {
+		t.Errorf("groq key: got %T", tr)
+	}
+
+	cfg.Voice.Transcriber = "none"
+	if tr := NewTranscriber(cfg); tr != nil {
+		t.Errorf("none: got %T", tr)
+	}
+
+	cfg.Voice = config.VoiceConfig{Transcriber: "openai", APIBase: "http://localhost:8000/v1"}
+	tr, ok := NewTranscriber(cfg).(*OpenAITranscriber)
+	if !ok || tr.apiBase != "http://localhost:8000/v1" || tr.model != openAIModel {
+		t.Errorf("openai: got %+v", tr)
+	}
+
+	cfg.Voice = config.VoiceConfig{Transcriber: "whisper_cpp", WhisperCppModel: "/nonexistent/ggml-base.bin"}
+	wc, ok := NewTranscriber(cfg).(*WhisperCppTranscriber)
+	if !ok || wc.binary != defaultWhisperCppBinary {
+		t.Fatalf("whisper_cpp: got %+v", wc)
+	}
+	if wc.IsAvailable() {
+		t.Error("whisper.cpp with a missing model should be unavailable")
+	}
+}
+
+func TestParseWhisperCppOutput(t *testing.T) {
+	out := "\n Hello there.\n [BLANK_AUDIO]\n How are you?\n\n"
+	if got := parseWhisperCppOutput(out); got != "Hello there. How are you?" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,229 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Synthesizer turns text into speech. Synthesize writes one audio file and
+// returns its path; the caller removes it. The meaning of voice depends on
+// the backend (edge-tts voice name, piper model name, OpenAI voice) and an
+// empty voice selects the backend default.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text, voice string) (string, error)
+	IsAvailable() bool
+}
+
+// voiceNamePattern matches a voice name. Names start with a letter or digit
+// so they can be neither a path nor a command-line flag.
+var voiceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// IsVoiceName reports whether name can name a voice. Users pick voices with
+// /voice name, so a name must never reach a backend as a path or a flag.
+func IsVoiceName(name string) bool {
+	return voiceNamePattern.MatchString(name)
+}
+
+const (
+	defaultEdgeVoice   = "es-AR-TomasNeural"
+	defaultOpenAIVoice = "alloy"
+	defaultOpenAITTS   = "tts-1"
+	defaultPiperBinary = "piper"
+)
+
+// EdgeSynthesizer runs the edge-tts CLI, which uses Microsoft Edge's online
+// voices and writes MP3.
+type EdgeSynthesizer struct {
+	voice string
+}
+
+func NewEdgeSynthesizer(voice string) *EdgeSynthesizer {
+	return &EdgeSynthesizer{voice: firstNonEmpty(voice, defaultEdgeVoice)}
+}
+
+func (s *EdgeSynthesizer) Synthesize(ctx context.Context, text, voice string) (string, error) {
+	out, err := tempAudioFile(".mp3")
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, "edge-tts", "--voice", firstNonEmpty(voice, s.voice), "--text", text, "--write-media", out)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(out)
+		return "", fmt.Errorf("edge-tts failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return out, nil
+}
+
+func (s *EdgeSynthesizer) IsAvailable() bool {
+	_, err := exec.LookPath("edge-tts")
+	return err == nil
+}
+
+// PiperSynthesizer runs the piper CLI fully offline. The default voice is
+// the configured .onnx model path; other voices are model names, resolved
+// to <name>.onnx in the models directory (by default the one holding the
+// default model). Piper reads the text on stdin and writes WAV.
+type PiperSynthesizer struct {
+	binary string
+	model  string
+	models string
+}
+
+func NewPiperSynthesizer(binary, model, models string) *PiperSynthesizer {
+	model = expandHome(model)
+	if models == "" && model != "" {
+		models = filepath.Dir(model)
+	}
+	return &PiperSynthesizer{
+		binary: firstNonEmpty(binary, defaultPiperBinary),
+		model:  model,
+		models: expandHome(models),
+	}
+}
+
+// modelFor returns the model file for voice.
+func (s *PiperSynthesizer) modelFor(voice string) (string, error) {
+	if voice == "" {
+		if s.model == "" {
+			return "", fmt.Errorf("piper: no voice model configured")
+		}
+		return s.model, nil
+	}
+	if !IsVoiceName(voice) {
+		return "", fmt.Errorf("piper: invalid voice name %q", voice)
+	}
+	if s.models == "" {
+		return "", fmt.Errorf("piper: no models directory configured")
+	}
+	model := filepath.Join(s.models, strings.TrimSuffix(voice, ".onnx")+".onnx")
+	if _, err := os.Stat(model); err != nil {
+		return "", fmt.Errorf("piper: unknown voice %q", voice)
+	}
+	return model, nil
+}
+
+func (s *PiperSynthesizer) Synthesize(ctx context.Context, text, voice string) (string, error) {
+	model, err := s.modelFor(voice)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := tempAudioFile(".wav")
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, s.binary, "--model", model, "--output_file", out)
+	cmd.Stdin = strings.NewReader(text)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(out)
+		return "", fmt.Errorf("piper failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return out, nil
+}
+
+func (s *PiperSynthesizer) IsAvailable() bool {
+	_, err := exec.LookPath(s.binary)
+	return err == nil && s.model != ""
+}
+
+// OpenAISynthesizer calls an OpenAI-compatible /audio/speech endpoint:
+// OpenAI itself or a local server such as openedai-speech or Kokoro-FastAPI.
+type OpenAISynthesizer struct {
+	apiBase    string
+	apiKey     string
+	model      string
+	voice      string
+	httpClient *http.Client
+}
+
+func NewOpenAISynthesizer(apiBase, apiKey, model, voice string) *OpenAISynthesizer {
+	return &OpenAISynthesizer{
+		apiBase: strings.TrimRight(firstNonEmpty(apiBase, openAIAPIBase), "/"),
+		apiKey:  apiKey,
+		model:   firstNonEmpty(model, defaultOpenAITTS),
+		voice:   firstNonEmpty(voice, defaultOpenAIVoice),
+		httpClient: &http.Client{
+			Timeout: 2 * time.Minute,
+		},
+	}
+}
+
+func (s *OpenAISynthesizer) Synthesize(ctx context.Context, text, voice string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"model":           s.model,
+		"input":           text,
+		"voice":           firstNonEmpty(voice, s.voice),
+		"response_format": "mp3",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.apiBase+"/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		logger.ErrorCF("voice", "Speech API error", map[string]interface{}{
+			"status_code": resp.StatusCode,
+			"response":    string(msg),
+		})
+		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(msg))
+	}
+
+	out, err := tempAudioFile(".mp3")
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		os.Remove(out)
+		return "", err
+	}
+	_, err = io.Copy(f, resp.Body)
+	f.Close()
+	if err != nil {
+		os.Remove(out)
+		return "", fmt.Errorf("failed to read speech audio: %w", err)
+	}
+	return out, nil
+}
+
+func (s *OpenAISynthesizer) IsAvailable() bool {
+	return s.apiBase != ""
+}
+
+func tempAudioFile(ext string) (string, error) {
+	f, err := os.CreateTemp("", "picoclaw-tts-*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("creating temp audio file: %w", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
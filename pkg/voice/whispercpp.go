@@ -0,0 +1,131 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// defaultWhisperCppBinary is the CLI name since whisper.cpp renamed its
+// "main" example.
+const defaultWhisperCppBinary = "whisper-cli"
+
+// WhisperCppTranscriber runs the whisper.cpp CLI locally. whisper.cpp only
+// reads a few container formats reliably, so anything that is not WAV is
+// first converted to 16 kHz mono WAV with ffmpeg when it is installed.
+type WhisperCppTranscriber struct {
+	binary   string
+	model    string
+	language string
+}
+
+func NewWhisperCppTranscriber(binary, model, language string) *WhisperCppTranscriber {
+	if binary == "" {
+		binary = defaultWhisperCppBinary
+	}
+	return &WhisperCppTranscriber{
+		binary:   binary,
+		model:    expandHome(model),
+		language: language,
+	}
+}
+
+func (t *WhisperCppTranscriber) Transcribe(ctx context.Context, audioFilePath string) (*TranscriptionResponse, error) {
+	logger.InfoCF("voice", "Starting whisper.cpp transcription", map[string]interface{}{"audio_file": audioFilePath})
+
+	input := audioFilePath
+	if !strings.EqualFold(filepath.Ext(audioFilePath), ".wav") {
+		if wav, err := convertToWav(ctx, audioFilePath); err != nil {
+			logger.DebugCF("voice", "Passing audio to whisper.cpp unconverted", map[string]interface{}{"error": err.Error()})
+		} else {
+			defer os.Remove(wav)
+			input = wav
+		}
+	}
+
+	args := []string{"-m", t.model, "-f", input, "-nt", "-np"}
+	if t.language != "" {
+		args = append(args, "-l", t.language)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		logger.ErrorCF("voice", "whisper.cpp failed", map[string]interface{}{
+			"error":  err.Error(),
+			"stderr": utils.Truncate(stderr.String(), 500),
+		})
+		return nil, fmt.Errorf("whisper.cpp failed: %w", err)
+	}
+
+	result := &TranscriptionResponse{Text: parseWhisperCppOutput(stdout.String()), Language: t.language}
+
+	logger.InfoCF("voice", "Transcription completed successfully", map[string]interface{}{
+		"text_length":           len(result.Text),
+		"transcription_preview": utils.Truncate(result.Text, 50),
+	})
+
+	return result, nil
+}
+
+// IsAvailable reports whether both the binary and the model file exist.
+func (t *WhisperCppTranscriber) IsAvailable() bool {
+	_, binErr := exec.LookPath(t.binary)
+	_, modelErr := os.Stat(t.model)
+	available := binErr == nil && t.model != "" && modelErr == nil
+	logger.DebugCF("voice", "Checking transcriber availability", map[string]interface{}{"available": available})
+	return available
+}
+
+// parseWhisperCppOutput joins the transcript lines printed with -nt,
+// dropping blank lines and the [BLANK_AUDIO] marker.
+func parseWhisperCppOutput(out string) string {
+	var parts []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(strings.ReplaceAll(line, "[BLANK_AUDIO]", ""))
+		if line != "" {
+			parts = append(parts, line)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// convertToWav transcodes path to a temporary 16 kHz mono WAV file.
+func convertToWav(ctx context.Context, path string) (string, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg not found")
+	}
+
+	out, err := os.CreateTemp("", "picoclaw-stt-*.wav")
+	if err != nil {
+		return "", err
+	}
+	out.Close()
+
+	cmd := exec.CommandContext(ctx, ffmpeg, "-y", "-loglevel", "error",
+		"-i", path, "-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", out.Name())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return out.Name(), nil
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}